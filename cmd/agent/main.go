@@ -3,21 +3,30 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/kardianos/service"
-	"github.com/user/server-moni/internal/auth"
-	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/certs"
+	"github.com/user/server-moni/internal/checks"
+	"github.com/user/server-moni/internal/inventory"
 	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/logtail"
 	"github.com/user/server-moni/internal/metrics"
+	"github.com/user/server-moni/internal/procwatch"
+	"github.com/user/server-moni/internal/systemd"
+	"github.com/user/server-moni/internal/tags"
 )
 
 type program struct {
@@ -28,6 +37,42 @@ type program struct {
 type Config struct {
 	ServerURL string
 	APIKey    string
+	Tags      string // key=value,key2=value2 reported to the server
+
+	// Comma separated TLS endpoints (host:port) and certificate files or
+	// directories whose expiry is reported
+	CertEndpoints string
+	CertPaths     string
+
+	// Comma separated patterns of the systemd units reported ("none" turns
+	// unit collection off) and of units left out
+	Services        string
+	ServicesExclude string
+
+	// Number of processes reported, what they are ranked by (cpu, memory,
+	// io or files) and whether the process tree is reported too
+	ProcessTop  string
+	ProcessSort string
+	ProcessTree string
+
+	// Comma separated patterns of the mounts and block devices reported and
+	// of those left out ("none" to leave nothing out)
+	Disks        string
+	DisksExclude string
+
+	// Schedules of the collector subsystems overriding the defaults, e.g.
+	// disk=30s,containers=15s/30s
+	Collect string
+
+	// Where the host's procfs and sysfs are mounted, for agents running in
+	// a container
+	ProcRoot string
+	SysRoot  string
+
+	// JSON file with the log sources to tail; by default the auth and
+	// fail2ban logs, or their journal entries on hosts without the files.
+	// "none" turns tailing off
+	LogConfig string
 }
 
 func (p *program) Start(s service.Service) error {
@@ -72,21 +117,112 @@ func (p *program) run() {
 		logger.Error("Failed to change working directory", "error", err)
 	}
 	
-	db.InitDB()
-	metrics.InitStore()
+	procRoot := p.cfg.ProcRoot
+	if procRoot == "" {
+		procRoot = os.Getenv("HOST_PROC")
+	}
+	sysRoot := p.cfg.SysRoot
+	if sysRoot == "" {
+		sysRoot = os.Getenv("HOST_SYS")
+	}
+	metrics.SetRoots(procRoot, sysRoot)
 
 	// Initialize Collector
 	collector := metrics.NewCollector()
 	collector.StartBackgroundTasks()
 
-	// Start Local Collector (Self-Monitoring / Cache)
-	go func() {
-		ticker := time.NewTicker(2 * time.Second)
-		for range ticker.C {
-			m := collector.Collect()
-			metrics.GlobalStore.Update("local", m)
+	certEndpoints := p.cfg.CertEndpoints
+	if certEndpoints == "" {
+		certEndpoints = os.Getenv("CERT_ENDPOINTS")
+	}
+	certPaths := p.cfg.CertPaths
+	if certPaths == "" {
+		certPaths = os.Getenv("CERT_PATHS")
+	}
+	if endpoints, paths := splitList(certEndpoints), splitList(certPaths); len(endpoints) > 0 || len(paths) > 0 {
+		watcher := certs.NewWatcher(endpoints, paths)
+		watcher.Start(certs.DefaultInterval)
+		collector.WatchCertificates(watcher)
+	}
+
+	services := p.cfg.Services
+	if services == "" {
+		services = os.Getenv("SERVICES")
+	}
+	servicesExclude := p.cfg.ServicesExclude
+	if servicesExclude == "" {
+		servicesExclude = os.Getenv("SERVICES_EXCLUDE")
+	}
+	if runtime.GOOS == "linux" && services != "none" {
+		collector.CollectServices(systemd.NewCollector(systemd.Filter{
+			Include: splitList(services),
+			Exclude: splitList(servicesExclude),
+		}))
+	}
+
+	processTop := p.cfg.ProcessTop
+	if processTop == "" {
+		processTop = os.Getenv("PROCESS_TOP")
+	}
+	processSort := p.cfg.ProcessSort
+	if processSort == "" {
+		processSort = os.Getenv("PROCESS_SORT")
+	}
+	processTree := p.cfg.ProcessTree
+	if processTree == "" {
+		processTree = os.Getenv("PROCESS_TREE")
+	}
+	disks := p.cfg.Disks
+	if disks == "" {
+		disks = os.Getenv("DISKS")
+	}
+	disksExclude := p.cfg.DisksExclude
+	if disksExclude == "" {
+		disksExclude = os.Getenv("DISKS_EXCLUDE")
+	}
+	diskFilter := metrics.DiskFilter{Include: splitList(disks), Exclude: splitList(disksExclude)}
+	if disksExclude == "none" {
+		diskFilter.Exclude = []string{}
+	}
+	if err := collector.SetDiskFilter(diskFilter); err != nil {
+		logger.Error("Invalid disk patterns, using the defaults", "error", err)
+	}
+
+	if err := collector.SetProcessOptions(processOptions(processTop, processSort, processTree)); err != nil {
+		logger.Error("Invalid process options, using the defaults", "error", err)
+	}
+
+	// Process watches come from the server in every ingest response
+	processes := procwatch.NewWatcher()
+	collector.WatchProcesses(processes)
+
+	// Log events are shipped with the metrics
+	logConfig := p.cfg.LogConfig
+	if logConfig == "" {
+		logConfig = os.Getenv("LOG_CONFIG")
+	}
+	var tailer *logtail.Tailer
+	if logConfig != "none" {
+		t, err := newTailer(logConfig, dataDir)
+		if err != nil {
+			logger.Error("Invalid log config, not tailing logs", "error", err)
+		} else {
+			tailer = t
+			collector.TailLogs(tailer)
 		}
-	}()
+	}
+
+	// Start the collector; the local API and the pusher read its snapshot
+	collect := p.cfg.Collect
+	if collect == "" {
+		collect = os.Getenv("COLLECT")
+	}
+	schedules, err := metrics.ParseSchedules(collect)
+	if err != nil {
+		logger.Error("Invalid collection schedules, using the defaults", "error", err)
+		schedules = metrics.DefaultSchedules()
+	}
+	collector.Start(context.Background(), schedules)
 
 	// Start Pusher if configured
 	// Priority: Config (Flags) > Env
@@ -100,8 +236,18 @@ func (p *program) run() {
 		apiKey = os.Getenv("API_KEY")
 	}
 
+	tagList := p.cfg.Tags
+	if tagList == "" {
+		tagList = os.Getenv("AGENT_TAGS")
+	}
+	agentTags, err := tags.Parse(tagList)
+	if err != nil {
+		logger.Error("Invalid agent tags, ignoring", "error", err)
+		agentTags = nil
+	}
+
 	if serverURL != "" && apiKey != "" {
-		go startPusher(collector, serverURL, apiKey)
+		go startPusher(collector, processes, tailer, serverURL, apiKey, agentTags)
 	} else {
 		logger.Warn("Push mode disabled: Missing SERVER_URL or API_KEY")
 	}
@@ -126,9 +272,9 @@ func (p *program) run() {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
-	api.GET("/metrics", auth.AuthMiddleware(), func(c *gin.Context) {
-		data, ok := metrics.GlobalStore.Get("local")
-		if !ok {
+	api.GET("/metrics", apiKeyMiddleware(apiKey), func(c *gin.Context) {
+		data := collector.Snapshot()
+		if data.LastUpdate.IsZero() {
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Collecting metrics..."})
 			return
 		}
@@ -155,9 +301,25 @@ func main() {
 	logger.InitLogger()
 	
 	// Agent specific flags
-	var flagServer, flagToken, flagService string
+	var flagServer, flagToken, flagService, flagTags, flagCertEndpoints, flagCertPaths, flagServices, flagServicesExclude string
+	var flagProcessTop, flagProcessSort, flagProcessTree, flagCollect, flagProcRoot, flagSysRoot string
+	var flagDisks, flagDisksExclude, flagLogConfig string
 	flag.StringVar(&flagServer, "server", "", "Server URL")
 	flag.StringVar(&flagToken, "token", "", "API Key")
+	flag.StringVar(&flagTags, "tags", "", "Tags to report for this host, e.g. env=prod,role=web")
+	flag.StringVar(&flagCertEndpoints, "cert-endpoints", "", "TLS endpoints whose certificates are watched, e.g. example.com:443,10.0.0.5:8443")
+	flag.StringVar(&flagCertPaths, "cert-paths", "", "Certificate files or directories that are watched, e.g. /etc/letsencrypt/live")
+	flag.StringVar(&flagServices, "services", "", "Patterns of the systemd units to report (default *.service, none to disable)")
+	flag.StringVar(&flagServicesExclude, "services-exclude", "", "Patterns of the systemd units to leave out, e.g. user@*.service")
+	flag.StringVar(&flagDisks, "disks", "", "Patterns of the mount points (starting with /), filesystem types and block devices to report (default all)")
+	flag.StringVar(&flagDisksExclude, "disks-exclude", "", "Patterns of the mounts and devices to leave out, replacing the defaults (none to leave nothing out)")
+	flag.StringVar(&flagProcessTop, "process-top", "", "Number of processes to report (default 20)")
+	flag.StringVar(&flagProcessSort, "process-sort", "", "What processes are ranked by: cpu (default), memory, io or files")
+	flag.StringVar(&flagProcessTree, "process-tree", "", "Also report the tree of all processes (true or false)")
+	flag.StringVar(&flagCollect, "collect", "", "Collection schedules as subsystem=interval[/timeout], e.g. disk=30s,containers=15s/30s,processes=0")
+	flag.StringVar(&flagProcRoot, "proc-root", "", "Where the host's procfs is mounted (default /proc)")
+	flag.StringVar(&flagSysRoot, "sys-root", "", "Where the host's sysfs is mounted (default /sys)")
+	flag.StringVar(&flagLogConfig, "log-config", "", "JSON file with the log sources to tail (default the auth and fail2ban logs or journal entries, none to disable)")
 	flag.StringVar(&flagService, "service", "", "Service action: install, uninstall, start, stop")
 	flag.Parse()
 
@@ -165,13 +327,27 @@ func main() {
 		Name:        "ServerMoniAgent",
 		DisplayName: "Server Monitor Agent",
 		Description: "Agent for Server Monitor SaaS",
-		Arguments:   []string{"-server", flagServer, "-token", flagToken},
+		Arguments:   []string{"-server", flagServer, "-token", flagToken, "-tags", flagTags, "-cert-endpoints", flagCertEndpoints, "-cert-paths", flagCertPaths, "-services", flagServices, "-services-exclude", flagServicesExclude, "-disks", flagDisks, "-disks-exclude", flagDisksExclude, "-process-top", flagProcessTop, "-process-sort", flagProcessSort, "-process-tree", flagProcessTree, "-collect", flagCollect, "-proc-root", flagProcRoot, "-sys-root", flagSysRoot, "-log-config", flagLogConfig},
 	}
 
 	prg := &program{
 		cfg: &Config{
-			ServerURL: flagServer,
-			APIKey:    flagToken,
+			ServerURL:       flagServer,
+			APIKey:          flagToken,
+			Tags:            flagTags,
+			CertEndpoints:   flagCertEndpoints,
+			CertPaths:       flagCertPaths,
+			Services:        flagServices,
+			ServicesExclude: flagServicesExclude,
+			Disks:           flagDisks,
+			DisksExclude:    flagDisksExclude,
+			ProcessTop:      flagProcessTop,
+			ProcessSort:     flagProcessSort,
+			ProcessTree:     flagProcessTree,
+			Collect:         flagCollect,
+			ProcRoot:        flagProcRoot,
+			SysRoot:         flagSysRoot,
+			LogConfig:       flagLogConfig,
 		},
 	}
 	s, err := service.New(prg, svcConfig)
@@ -194,22 +370,114 @@ func main() {
 	}
 }
 
-func startPusher(c *metrics.Collector, serverURL, apiKey string) {
+// apiKeyMiddleware lets through requests carrying the agent's API key as a
+// bearer token, as the server's proxy sends it. The agent has no user
+// sessions to check, so without a key nothing gets through.
+func apiKeyMiddleware(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || apiKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API Key"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newTailer loads the log sources from a config file, or follows the
+// presets whose files exist. Offsets are saved in the data directory unless
+// the config names a state file.
+func newTailer(path, dataDir string) (*logtail.Tailer, error) {
+	cfg := logtail.DefaultConfig()
+	if path != "" {
+		var err error
+		if cfg, err = logtail.LoadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.StateFile == "" {
+		cfg.StateFile = filepath.Join(dataDir, "logtail.json")
+	}
+	return logtail.NewTailer(cfg)
+}
+
+// processOptions parses the process flags; empty values keep the defaults.
+func processOptions(top, sortBy, tree string) metrics.ProcessOptions {
+	o := metrics.ProcessOptions{SortBy: sortBy}
+	if top != "" {
+		n, err := strconv.Atoi(top)
+		if err != nil {
+			logger.Error("Invalid process count, using the default", "value", top)
+		}
+		o.Limit = n
+	}
+	if tree != "" {
+		b, err := strconv.ParseBool(tree)
+		if err != nil {
+			logger.Error("Invalid process tree setting, leaving it off", "value", tree)
+		}
+		o.Tree = b
+	}
+	return o
+}
+
+func startPusher(c *metrics.Collector, processes *procwatch.Watcher, logs *logtail.Tailer, serverURL, apiKey string, agentTags map[string]string) {
 	logger.Info("Starting Push Mode", "url", serverURL)
 	client := &http.Client{Timeout: 5 * time.Second}
+
+	// Synthetic checks come from the server in every ingest response
+	sched := checks.NewScheduler()
+	go sched.Run(context.Background())
+
+	// The inventory is uploaded apart, when the collector has a new one
+	var inventorySent time.Time
+
 	ticker := time.NewTicker(2 * time.Second)
 	for range ticker.C {
-		m := c.Collect()
+		if inv := c.Inventory(); inv != nil && !inv.CollectedAt.Equal(inventorySent) {
+			if err := uploadInventory(serverURL, apiKey, inv); err != nil {
+				logger.Error("Error uploading inventory", "error", err)
+			} else {
+				inventorySent = inv.CollectedAt
+			}
+		}
+
+		m := c.Snapshot()
+		m.Tags = agentTags
+		m.CheckResults = sched.Drain()
+		if logs != nil {
+			m.LogEvents = logs.Drain()
+		}
+		// What could not be delivered goes out with the next push
+		requeue := func() {
+			sched.Requeue(m.CheckResults)
+			if logs != nil {
+				logs.Requeue(m.LogEvents)
+			}
+		}
 		
 		data, err := json.Marshal(m)
 		if err != nil {
 			logger.Error("Error marshaling metrics", "error", err)
+			requeue()
 			continue
 		}
 
 		req, err := http.NewRequest("POST", serverURL+"/api/v1/ingest", bytes.NewBuffer(data))
 		if err != nil {
 			logger.Error("Error creating request", "error", err)
+			requeue()
 			continue
 		}
 		req.Header.Set("Authorization", "Bearer "+apiKey)
@@ -218,11 +486,57 @@ func startPusher(c *metrics.Collector, serverURL, apiKey string) {
 		resp, err := client.Do(req)
 		if err != nil {
 			logger.Error("Error pushing metrics", "error", err)
+			requeue()
 			continue
 		}
-		resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
 			logger.Warn("Error pushing metrics", "status", resp.StatusCode)
+			requeue()
+			continue
+		}
+
+		// A missing list means the server could not load it; keep the current one
+		var body struct {
+			Checks         *[]checks.Definition `json:"checks"`
+			ProcessWatches *[]procwatch.Watch   `json:"process_watches"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			logger.Warn("Error reading ingest response", "error", err)
+			continue
+		}
+		if body.Checks != nil {
+			sched.Update(*body.Checks)
 		}
+		if body.ProcessWatches != nil {
+			processes.Update(*body.ProcessWatches)
+		}
+	}
+}
+
+// uploadInventory sends a software inventory to the server. It can be
+// large, so it gets a longer timeout than the metrics.
+func uploadInventory(serverURL, apiKey string, inv *inventory.Inventory) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
 	}
+	req, err := http.NewRequest("POST", serverURL+"/api/v1/inventory", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+	return nil
 }
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/user/server-moni/internal/api"
+	"github.com/user/server-moni/internal/auth"
+	"github.com/user/server-moni/internal/db"
+)
+
+// Administrative subcommands run against the local database and exit, e.g.
+//
+//	server reset-password -email admin@example.com
+//	server migrate status
+//	server backup -o snapshot.db
+var commands = map[string]func(args []string) error{
+	"backup":         backupCommand,
+	"export":         exportCommand,
+	"import":         importCommand,
+	"migrate":        migrateCommand,
+	"reset-password": resetPasswordCommand,
+	"restore":        restoreCommand,
+}
+
+// databaseFlag registers -database-url on a subcommand. It defaults to the
+// DATABASE_URL environment variable, then to the local SQLite file.
+func databaseFlag(fs *flag.FlagSet) *string {
+	def := os.Getenv("DATABASE_URL")
+	if def == "" {
+		def = db.DefaultDatabaseURL
+	}
+	return fs.String("database-url", def, "SQLite database file, or a postgres:// connection URL")
+}
+
+// runCommand executes the subcommand named by args[0], if any. It reports
+// whether a subcommand was found.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+	if err := cmd(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// migrateCommand inspects or changes the schema version:
+//
+//	server migrate status
+//	server migrate up [-to N]     apply pending migrations (default: all)
+//	server migrate down [-to N]   revert migrations (default: the last one)
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate status|up|down [-to N] [-database-url URL]")
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	to := fs.Int("to", -1, "Target schema version")
+	databaseURL := databaseFlag(fs)
+	fs.Parse(args[1:])
+
+	store, err := db.Open(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	current, err := store.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "status":
+		status, err := store.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s database at schema version %d, binary expects %d\n", store.Driver(), current, db.SchemaVersion)
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied " + m.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			if m.Version > db.SchemaVersion {
+				state += " (unknown to this binary)"
+			}
+			fmt.Printf("  %3d  %-45s %s\n", m.Version, m.Name, state)
+		}
+		return nil
+
+	case "up":
+		target := *to
+		if target < 0 {
+			target = db.SchemaVersion
+		}
+		if target > db.SchemaVersion {
+			return fmt.Errorf("this binary only knows migrations up to version %d", db.SchemaVersion)
+		}
+		applied, err := store.MigrateUp(target)
+		for _, m := range applied {
+			fmt.Printf("Applied %d (%s)\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Printf("Already at version %d\n", current)
+		}
+		return nil
+
+	case "down":
+		target := *to
+		if target < 0 {
+			target = current - 1
+		}
+		if target < 0 || target >= current {
+			fmt.Printf("Nothing to revert, database is at version %d\n", current)
+			return nil
+		}
+		reverted, err := store.MigrateDown(target)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %d (%s)\n", m.Version, m.Name)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown action %q, expected status, up or down", action)
+}
+
+func resetPasswordCommand(args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	email := fs.String("email", "", "Email of the account to reset")
+	password := fs.String("password", "", "New password (a random one is generated if omitted)")
+	keepSessions := fs.Bool("keep-sessions", false, "Do not revoke the account's existing sessions")
+	databaseURL := databaseFlag(fs)
+	fs.Parse(args)
+
+	if *email == "" {
+		return fmt.Errorf("-email is required")
+	}
+
+	store, err := openStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	db.GlobalStore = store // For auth.SetPassword
+
+	user, err := store.GetUserByEmail(*email)
+	if err != nil {
+		return fmt.Errorf("no user with email %s", *email)
+	}
+
+	generated := *password == ""
+	if generated {
+		*password, err = auth.GeneratePassword()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := auth.SetPassword(user.ID, *password); err != nil {
+		return err
+	}
+	if !*keepSessions {
+		if _, err := store.DeleteUserSessions(user.ID, ""); err != nil {
+			return err
+		}
+	}
+
+	store.AddAuditEntry(&db.AuditEntry{
+		UserID:  user.ID,
+		Actor:   "cli",
+		Action:  api.AuditPasswordReset,
+		Result:  "success",
+		Details: "reset from the command line",
+	})
+
+	if generated {
+		fmt.Printf("Password for %s reset to: %s\n", user.Email, *password)
+	} else {
+		fmt.Printf("Password for %s updated\n", user.Email)
+	}
+	return nil
+}
+
+// openStore opens the database for a maintenance command. It only checks
+// the schema: a command must not migrate a database the server, or a
+// different release, is still using, so that is left to migrate up.
+func openStore(url string) (db.Store, error) {
+	store, err := db.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.CheckSchema(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// backupCommand writes a consistent snapshot of a SQLite database. It is
+// safe to run while the server is using the database.
+func backupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("o", "", "Snapshot file to create (default: server-moni-<timestamp>.db)")
+	databaseURL := databaseFlag(fs)
+	fs.Parse(args)
+
+	if *out == "" {
+		*out = "server-moni-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	}
+
+	store, err := openStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.Backup(*out); err != nil {
+		return err
+	}
+	store.AddAuditEntry(&db.AuditEntry{Actor: "cli", Action: api.AuditBackup, Result: "success", Details: *out})
+	fmt.Printf("Backup written to %s\n", *out)
+	return nil
+}
+
+// restoreCommand replaces a SQLite database with a snapshot made by backup.
+// Stop the server first.
+func restoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := fs.String("from", "", "Snapshot file to restore")
+	databaseURL := databaseFlag(fs)
+	fs.Parse(args)
+
+	if *from == "" {
+		return fmt.Errorf("-from is required")
+	}
+	if err := db.RestoreSQLite(*from, *databaseURL); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s from %s (previous database kept as %s.pre-restore)\n", *databaseURL, *from, *databaseURL)
+	return nil
+}
+
+// exportCommand writes the portable JSON export.
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "-", "Output file, - for stdout")
+	databaseURL := databaseFlag(fs)
+	fs.Parse(args)
+
+	store, err := openStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	export, err := store.Export()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if *out == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*out, data, 0600)
+	}
+	if err != nil {
+		return err
+	}
+	store.AddAuditEntry(&db.AuditEntry{Actor: "cli", Action: api.AuditExport, Result: "success", Details: *out})
+	if *out != "-" {
+		fmt.Printf("Exported %d users, %d systems, %d groups, %d alert rules, %d checks and %d process watches to %s\n", len(export.Users), len(export.Systems), len(export.Groups), len(export.AlertRules), len(export.Checks), len(export.ProcessWatches), *out)
+	}
+	return nil
+}
+
+// importCommand loads a JSON export into an empty database, e.g. to move an
+// instance from SQLite to PostgreSQL.
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("i", "-", "Export file, - for stdin")
+	databaseURL := databaseFlag(fs)
+	fs.Parse(args)
+
+	var data []byte
+	var err error
+	if *in == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		return err
+	}
+	var export db.Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		return fmt.Errorf("invalid export: %w", err)
+	}
+
+	store, err := openStore(*databaseURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.Import(&export); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d users, %d systems, %d groups, %d alert rules, %d checks and %d process watches into %s\n", len(export.Users), len(export.Systems), len(export.Groups), len(export.AlertRules), len(export.Checks), len(export.ProcessWatches), store.Driver())
+	return nil
+}
@@ -13,7 +13,9 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/kardianos/service"
+	"github.com/user/server-moni/internal/alerts"
 	"github.com/user/server-moni/internal/api"
+	"github.com/user/server-moni/internal/auth"
 	"github.com/user/server-moni/internal/config"
 	"github.com/user/server-moni/internal/db"
 	"github.com/user/server-moni/internal/logger"
@@ -47,14 +49,17 @@ func (p *program) run() {
 	// Initialize Components
 	db.InitDB()
 	metrics.InitStore()
+	auth.StartSessionSweeper(config.AppConfig.SessionSweepInterval)
+	api.StartHistorySweeper(config.AppConfig.MetricHistoryRetention)
+	alerts.Start(config.AppConfig.AlertInterval)
 
 	// Start Local Collector
+	collector := metrics.NewCollector()
+	collector.Start(context.Background(), metrics.DefaultSchedules())
 	go func() {
-		collector := metrics.NewCollector()
 		ticker := time.NewTicker(1 * time.Second)
 		for range ticker.C {
-			m := collector.Collect()
-			metrics.GlobalStore.Update("local", m)
+			metrics.GlobalStore.Update("local", collector.Snapshot())
 		}
 	}()
 
@@ -79,7 +84,7 @@ func (p *program) run() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", auth.CSRFHeader},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -156,6 +161,9 @@ func (p *program) run() {
 
 func main() {
 	logger.InitLogger()
+	if runCommand(os.Args[1:]) {
+		return
+	}
 	config.Load()
 
 	svcConfig := &service.Config{
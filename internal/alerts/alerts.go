@@ -0,0 +1,95 @@
+// Package alerts evaluates user-defined alert rules against the systems they
+// select and keeps track of the alerts currently firing.
+//
+// A rule names a Condition and carries its parameters as JSON. Conditions
+// register themselves by name; see conditions.go for the built-in ones.
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/tags"
+)
+
+// Condition decides which parts of a system a rule fires for.
+type Condition interface {
+	// Validate checks the params of a rule and returns them normalized,
+	// with defaults filled in.
+	Validate(params json.RawMessage) (json.RawMessage, error)
+	// Evaluate returns a finding for everything on the system the
+	// condition holds for, or none.
+	Evaluate(params json.RawMessage, system *db.System, now time.Time) ([]Finding, error)
+}
+
+// Finding is one thing a condition holds for on a system.
+type Finding struct {
+	Subject string  // What on the system, e.g. a mountpoint; empty for the system as a whole
+	Value   float64 // The value that triggered, in the unit of the condition
+	Message string
+}
+
+var conditions = make(map[string]Condition)
+
+// Register makes a condition available to rules under the given name.
+func Register(name string, c Condition) {
+	if _, dup := conditions[name]; dup {
+		panic("alerts: condition registered twice: " + name)
+	}
+	conditions[name] = c
+}
+
+// Conditions returns the names of all registered conditions.
+func Conditions() []string {
+	names := make([]string, 0, len(conditions))
+	for name := range conditions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateRule checks a rule before it is stored, normalizing its name,
+// selector and params.
+func ValidateRule(r *db.AlertRule) error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	c, ok := conditions[r.Condition]
+	if !ok {
+		return fmt.Errorf("condition must be one of %s", strings.Join(Conditions(), ", "))
+	}
+	params, err := c.Validate(r.Params)
+	if err != nil {
+		return err
+	}
+	r.Params = params
+	sel, err := tags.ParseSelector(r.Selector)
+	if err != nil {
+		return err
+	}
+	r.Selector = sel.String()
+	r.Group = strings.TrimSpace(r.Group)
+	return nil
+}
+
+// decodeParams strictly decodes rule params into v, which holds the
+// defaults; empty params keep them all.
+func decodeParams(raw json.RawMessage, v any) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,740 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/server-moni/internal/anomaly"
+	"github.com/user/server-moni/internal/capacity"
+	"github.com/user/server-moni/internal/certs"
+	"github.com/user/server-moni/internal/config"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/metrics"
+	"github.com/user/server-moni/internal/systemd"
+)
+
+// Built-in conditions
+const (
+	ConditionThreshold      = "threshold"
+	ConditionDiskFull       = "disk_full"
+	ConditionAnomaly        = "anomaly"
+	ConditionCheckDown      = "check_down"
+	ConditionCertExpiry     = "cert_expiry"
+	ConditionUnitFailed     = "unit_failed"
+	ConditionProcessMissing = "process_missing"
+	ConditionOOMKill        = "oom_kill"
+	ConditionDiskReadOnly   = "disk_read_only"
+	ConditionNewListener    = "new_listening_port"
+	ConditionSensor         = "sensor"
+)
+
+func init() {
+	Register(ConditionThreshold, threshold{})
+	Register(ConditionDiskFull, diskFull{})
+	Register(ConditionAnomaly, anomalous{})
+	Register(ConditionCheckDown, checkDown{})
+	Register(ConditionCertExpiry, certExpiry{})
+	Register(ConditionUnitFailed, unitFailed{})
+	Register(ConditionProcessMissing, processMissing{})
+	Register(ConditionOOMKill, oomKill{})
+	Register(ConditionDiskReadOnly, diskReadOnly{})
+	Register(ConditionNewListener, newListener{})
+	Register(ConditionSensor, sensorLimit{})
+}
+
+// onlineMetrics returns the latest metrics of a system for a condition to
+// judge, or false if there are none or they stopped being current when the
+// system went offline.
+func onlineMetrics(system *db.System, now time.Time) (metrics.SystemMetrics, bool) {
+	key := strconv.Itoa(system.ID)
+	m, ok := metrics.GlobalStore.Get(key)
+	if !ok {
+		return metrics.SystemMetrics{}, false
+	}
+	seen, _ := metrics.GlobalStore.LastSeen(key)
+	if metrics.Status(seen, now) == metrics.StatusOffline {
+		return metrics.SystemMetrics{}, false
+	}
+	return m, true
+}
+
+// threshold fires when a headline metric of the latest snapshot of a system
+// is above a limit. The disk and inodes metrics are checked per mount.
+//
+//	{"metric": "cpu", "above": 90}
+type threshold struct{}
+
+type thresholdParams struct {
+	Metric string  `json:"metric"` // cpu, memory, disk, inodes (percent) or load1
+	Above  float64 `json:"above"`
+}
+
+func (threshold) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	var p thresholdParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	switch p.Metric {
+	case "cpu", "memory", "disk", "inodes", "load1":
+	default:
+		return nil, errors.New("metric must be one of cpu, memory, disk, inodes, load1")
+	}
+	return json.Marshal(p)
+}
+
+func (threshold) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	var p thresholdParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	m, ok := onlineMetrics(system, now)
+	if !ok {
+		return nil, nil
+	}
+
+	if p.Metric == "disk" {
+		var findings []Finding
+		for _, d := range m.Disks {
+			if d.UsedPercent > p.Above {
+				findings = append(findings, Finding{
+					Subject: d.Path,
+					Value:   d.UsedPercent,
+					Message: fmt.Sprintf("%s is %.1f%% full (above %g%%)", d.Path, d.UsedPercent, p.Above),
+				})
+			}
+		}
+		return findings, nil
+	}
+	if p.Metric == "inodes" {
+		var findings []Finding
+		for _, d := range m.Disks {
+			if d.InodesTotal > 0 && d.InodesUsedPercent > p.Above {
+				findings = append(findings, Finding{
+					Subject: d.Path,
+					Value:   d.InodesUsedPercent,
+					Message: fmt.Sprintf("%s has used %.1f%% of its inodes (above %g%%)", d.Path, d.InodesUsedPercent, p.Above),
+				})
+			}
+		}
+		return findings, nil
+	}
+
+	// onlineMetrics has judged how current they are; only the numbers count
+	h := metrics.Summarize(m, now, now)
+	var value float64
+	switch p.Metric {
+	case "cpu":
+		value = h.CPU
+	case "memory":
+		value = h.MemoryPercent
+	case "load1":
+		value = h.Load1
+	}
+	if value <= p.Above {
+		return nil, nil
+	}
+	return []Finding{{
+		Value:   value,
+		Message: fmt.Sprintf("%s is %.1f (above %g)", p.Metric, value, p.Above),
+	}}, nil
+}
+
+// diskFull is the predictive disk condition: it fires when the forecast of a
+// mount, fitted to its stored disk history, has it full within a number of
+// days.
+//
+//	{"within_days": 7, "lookback_days": 30, "method": "robust", "mount": "/var"}
+type diskFull struct{}
+
+type diskFullParams struct {
+	WithinDays   float64 `json:"within_days"`
+	LookbackDays int     `json:"lookback_days"` // History the forecast is fitted to
+	Method       string  `json:"method"`        // linear or robust
+	Mount        string  `json:"mount"`         // Empty for every mount
+}
+
+func defaultDiskFullParams() diskFullParams {
+	return diskFullParams{WithinDays: 7, LookbackDays: 30, Method: capacity.MethodRobust}
+}
+
+func (diskFull) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	p := defaultDiskFullParams()
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.WithinDays <= 0 {
+		return nil, errors.New("within_days must be positive")
+	}
+	if p.LookbackDays <= 0 {
+		return nil, errors.New("lookback_days must be positive")
+	}
+	method, err := capacity.ParseMethod(p.Method)
+	if err != nil {
+		return nil, err
+	}
+	p.Method = method
+	return json.Marshal(p)
+}
+
+func (diskFull) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	p := defaultDiskFullParams()
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	mounts, err := capacity.LoadMounts(system.ID, p.Mount, now.AddDate(0, 0, -p.LookbackDays))
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, m := range mounts {
+		f, ok := capacity.Predict(m.Points(), p.Method, now)
+		if !ok || !f.FullWithin(p.WithinDays) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Subject: m.Mountpoint,
+			Value:   *f.DaysUntilFull,
+			Message: fmt.Sprintf("%s is predicted to be full in %.1f days (%s)", m.Mountpoint, *f.DaysUntilFull, f.FullAt.Format("2006-01-02")),
+		})
+	}
+	return findings, nil
+}
+
+// anomalous fires when the latest stored sample of a metric deviates from
+// the baseline learned from its history, see internal/anomaly.
+//
+//	{"metric": "cpu", "detector": "seasonal", "sigma": 3, "min_samples": 10, "direction": "above"}
+type anomalous struct{}
+
+type anomalyParams struct {
+	Metric string `json:"metric"` // One of metrics.HistoryMetrics
+	anomaly.Options
+	Direction string `json:"direction"` // above, below or both
+}
+
+func defaultAnomalyParams() anomalyParams {
+	return anomalyParams{Options: anomaly.DefaultOptions(), Direction: "both"}
+}
+
+func (anomalous) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	p := defaultAnomalyParams()
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if !metrics.IsHistoryMetric(p.Metric) {
+		return nil, fmt.Errorf("metric must be one of %s", strings.Join(metrics.HistoryMetrics, ", "))
+	}
+	if p.Direction != "above" && p.Direction != "below" && p.Direction != "both" {
+		return nil, errors.New("direction must be above, below or both")
+	}
+	if err := p.Options.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(p)
+}
+
+func (anomalous) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	p := defaultAnomalyParams()
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	interval := config.AppConfig.MetricHistoryInterval
+	if interval <= 0 {
+		return nil, nil
+	}
+
+	from := now.Add(-2 * interval)
+	if p.Detector == anomaly.DetectorRolling {
+		from = now.Add(-2 * time.Duration(p.Window+1) * interval)
+	}
+	samples, err := db.GlobalStore.GetMetricSamples(system.ID, p.Metric, from, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	// Nothing recent: the system stopped reporting
+	if len(samples) == 0 || now.Sub(samples[len(samples)-1].Timestamp) > 2*interval {
+		return nil, nil
+	}
+	latest := samples[len(samples)-1]
+
+	var baseline []float64
+	if p.Detector == anomaly.DetectorRolling {
+		samples = samples[:len(samples)-1]
+		if len(samples) > p.Window {
+			samples = samples[len(samples)-p.Window:]
+		}
+		for _, s := range samples {
+			baseline = append(baseline, s.Value)
+		}
+	} else {
+		// The same hour in each earlier week still retained
+		start := latest.Timestamp.Truncate(time.Hour)
+		for week := 1; time.Duration(week)*7*24*time.Hour <= config.AppConfig.MetricHistoryRetention; week++ {
+			at := start.AddDate(0, 0, -7*week)
+			earlier, err := db.GlobalStore.GetMetricSamples(system.ID, p.Metric, at, at.Add(time.Hour))
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range earlier {
+				baseline = append(baseline, s.Value)
+			}
+		}
+	}
+
+	score := anomaly.Compare(anomaly.Point{Time: latest.Timestamp, Value: latest.Value}, baseline, p.Options)
+	if !score.Anomaly || (p.Direction == "above" && *score.Score < 0) || (p.Direction == "below" && *score.Score > 0) {
+		return nil, nil
+	}
+	return []Finding{{
+		Subject: p.Metric,
+		Value:   *score.Score,
+		Message: fmt.Sprintf("%s is %.1f, %.1f standard deviations from its baseline of %.1f", p.Metric, latest.Value, *score.Score, *score.Baseline),
+	}}, nil
+}
+
+// checkDown fires when the latest runs of a synthetic check of a system all
+// failed, see internal/checks.
+//
+//	{"check": "web", "failures": 3}
+type checkDown struct{}
+
+type checkDownParams struct {
+	Check    string `json:"check"`    // Name of the check; empty for every check
+	Failures int    `json:"failures"` // Consecutive failed runs before firing
+}
+
+func defaultCheckDownParams() checkDownParams {
+	return checkDownParams{Failures: 1}
+}
+
+func (checkDown) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	p := defaultCheckDownParams()
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.Failures < 1 || p.Failures > 100 {
+		return nil, errors.New("failures must be between 1 and 100")
+	}
+	return json.Marshal(p)
+}
+
+func (checkDown) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	p := defaultCheckDownParams()
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	checks, err := db.GlobalStore.GetChecks(system.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, c := range checks {
+		if !c.Enabled || (p.Check != "" && c.Name != p.Check) {
+			continue
+		}
+		results, err := db.GlobalStore.LastCheckResults(c.ID, p.Failures)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) < p.Failures {
+			continue
+		}
+		// Results stop when the agent does; stale failures say nothing
+		// about the service
+		if now.Sub(results[0].Timestamp) > 3*time.Duration(c.Interval)*time.Second {
+			continue
+		}
+		down := true
+		for _, r := range results {
+			down = down && !r.Up
+		}
+		if !down {
+			continue
+		}
+		findings = append(findings, Finding{
+			Subject: c.Name,
+			Value:   float64(len(results)),
+			Message: fmt.Sprintf("%s check %s (%s) is down: %s", c.Type, c.Name, c.Target, results[0].Error),
+		})
+	}
+	return findings, nil
+}
+
+// certExpiry fires when a certificate reported by the agent of a system
+// expires within a number of days, or has expired. One rule per threshold
+// gives staged warnings, e.g. 30, 14 and 3 days.
+//
+//	{"within_days": 14, "match": "example.com"}
+type certExpiry struct{}
+
+type certExpiryParams struct {
+	WithinDays float64 `json:"within_days"`
+	Match      string  `json:"match"` // Only certificates whose location, subject or a SAN contain it; empty for all
+}
+
+func defaultCertExpiryParams() certExpiryParams {
+	return certExpiryParams{WithinDays: 14}
+}
+
+func (certExpiry) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	p := defaultCertExpiryParams()
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.WithinDays <= 0 {
+		return nil, errors.New("within_days must be positive")
+	}
+	return json.Marshal(p)
+}
+
+func (certExpiry) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	p := defaultCertExpiryParams()
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	m, ok := onlineMetrics(system, now)
+	if !ok {
+		return nil, nil
+	}
+
+	var findings []Finding
+	for _, c := range m.Certificates {
+		if c.Error != "" || (p.Match != "" && !certMatches(c, p.Match)) {
+			continue
+		}
+		days := c.DaysUntilExpiry(now)
+		if days > p.WithinDays {
+			continue
+		}
+		message := fmt.Sprintf("certificate %s at %s expires in %.1f days (%s)", c.Subject, c.Location, days, c.NotAfter.Format("2006-01-02"))
+		if days < 0 {
+			message = fmt.Sprintf("certificate %s at %s expired %.1f days ago (%s)", c.Subject, c.Location, -days, c.NotAfter.Format("2006-01-02"))
+		}
+		findings = append(findings, Finding{Subject: c.Location, Value: days, Message: message})
+	}
+	return findings, nil
+}
+
+func certMatches(c certs.Certificate, match string) bool {
+	if strings.Contains(c.Location, match) || strings.Contains(c.Subject, match) {
+		return true
+	}
+	for _, san := range c.SANs {
+		if strings.Contains(san, match) {
+			return true
+		}
+	}
+	return false
+}
+
+// unitFailed fires when a systemd unit reported by the agent of a system is
+// in the failed state.
+//
+//	{"unit": "nginx.service"}
+type unitFailed struct{}
+
+type unitFailedParams struct {
+	Unit string `json:"unit"` // Shell pattern of unit names; empty for every unit
+}
+
+func (unitFailed) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	var p unitFailedParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(p.Unit, ""); err != nil {
+		return nil, fmt.Errorf("invalid unit pattern: %v", err)
+	}
+	return json.Marshal(p)
+}
+
+func (unitFailed) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	var p unitFailedParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	m, ok := onlineMetrics(system, now)
+	if !ok {
+		return nil, nil
+	}
+
+	var findings []Finding
+	for _, u := range m.Services {
+		if u.ActiveState != systemd.StateFailed || (p.Unit != "" && !systemd.MatchPattern(p.Unit, u.Name)) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Subject: u.Name,
+			Value:   float64(u.Restarts),
+			Message: fmt.Sprintf("%s has failed (%s, %d restarts)", u.Name, u.SubState, u.Restarts),
+		})
+	}
+	return findings, nil
+}
+
+// processMissing fires when a process watch of a system has no running
+// instance. Watches the agent has not reported yet are not judged.
+//
+//	{"watch": "nginx"}
+type processMissing struct{}
+
+type processMissingParams struct {
+	Watch string `json:"watch"` // Name of the watch; empty for every watch
+}
+
+func (processMissing) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	var p processMissingParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	p.Watch = strings.TrimSpace(p.Watch)
+	return json.Marshal(p)
+}
+
+func (processMissing) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	var p processMissingParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	m, ok := onlineMetrics(system, now)
+	if !ok {
+		return nil, nil
+	}
+
+	var findings []Finding
+	for _, w := range m.WatchedProcesses {
+		if w.Instances > 0 || (p.Watch != "" && w.Name != p.Watch) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Subject: w.Name,
+			Value:   0,
+			Message: fmt.Sprintf("No %s process is running", w.Name),
+		})
+	}
+	return findings, nil
+}
+
+// oomKill fires when the OOM killer of a system has killed more processes
+// within the last hour than allowed. Agents that don't report OOM kills
+// (outside Linux) are not judged.
+//
+//	{"above": 0}
+type oomKill struct{}
+
+type oomKillParams struct {
+	Above uint64 `json:"above"` // Kills within the last hour that are tolerated
+}
+
+func (oomKill) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	var p oomKillParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(p)
+}
+
+func (oomKill) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	var p oomKillParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	m, ok := onlineMetrics(system, now)
+	if !ok || m.Memory == nil || m.Memory.VM == nil {
+		return nil, nil
+	}
+
+	kills := m.Memory.VM.OOMKillsRecent
+	if kills <= p.Above {
+		return nil, nil
+	}
+	return []Finding{{
+		Value:   float64(kills),
+		Message: fmt.Sprintf("The OOM killer killed %d processes within the last hour (%d since boot)", kills, m.Memory.VM.OOMKills),
+	}}, nil
+}
+
+// diskReadOnly fires for a mount that was remounted read-only, as
+// filesystems with errors=remount-ro are on errors. With a mount pattern it
+// fires for every matching mount that is read-only, however it got there.
+//
+//	{"mount": "/data"}
+type diskReadOnly struct{}
+
+type diskReadOnlyParams struct {
+	Mount string `json:"mount"` // Shell pattern of mount points, matching below them too; empty for remounts of any mount
+}
+
+func (diskReadOnly) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	var p diskReadOnlyParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(p.Mount, ""); err != nil {
+		return nil, fmt.Errorf("invalid mount pattern: %v", err)
+	}
+	return json.Marshal(p)
+}
+
+func (diskReadOnly) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	var p diskReadOnlyParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	m, ok := onlineMetrics(system, now)
+	if !ok {
+		return nil, nil
+	}
+
+	var findings []Finding
+	for _, d := range m.Disks {
+		if !d.ReadOnly {
+			continue
+		}
+		if p.Mount == "" && !d.Remounted || p.Mount != "" && !metrics.MatchMountPattern(p.Mount, d.Path) {
+			continue
+		}
+		msg := fmt.Sprintf("%s is mounted read-only", d.Path)
+		if d.Remounted {
+			msg = fmt.Sprintf("%s was remounted read-only", d.Path)
+		}
+		findings = append(findings, Finding{Subject: d.Path, Value: 1, Message: msg})
+	}
+	return findings, nil
+}
+
+// newListener fires for listening sockets that appeared on a system after
+// its agent started, for a while after they appeared. Ports expected to
+// come and go can be ignored.
+//
+//	{"within_minutes": 60, "ignore_ports": [8080]}
+type newListener struct{}
+
+type newListenerParams struct {
+	WithinMinutes int      `json:"within_minutes"` // Default 60
+	IgnorePorts   []uint16 `json:"ignore_ports,omitempty"`
+}
+
+func (newListener) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	var p newListenerParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if p.WithinMinutes < 0 {
+		return nil, errors.New("within_minutes must not be negative")
+	}
+	if p.WithinMinutes == 0 {
+		p.WithinMinutes = 60
+	}
+	return json.Marshal(p)
+}
+
+func (newListener) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	var p newListenerParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	m, ok := onlineMetrics(system, now)
+	if !ok {
+		return nil, nil
+	}
+
+	within := time.Duration(p.WithinMinutes) * time.Minute
+	var findings []Finding
+	for _, l := range m.Listeners {
+		if !l.New || now.Sub(l.FirstSeen) > within || slices.Contains(p.IgnorePorts, l.Port) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Subject: l.Endpoint(),
+			Value:   float64(l.Port),
+			Message: "New listening socket " + l.String(),
+		})
+	}
+	return findings, nil
+}
+
+// sensorLimit fires for hardware sensors past a limit: above or below the
+// given values, or without either past the limits the hardware reports.
+//
+//	{"sensor": "coretemp/*", "kind": "temperature", "above": 85}
+type sensorLimit struct{}
+
+type sensorLimitParams struct {
+	Sensor string   `json:"sensor"` // Shell pattern of chip/label; empty for every sensor
+	Kind   string   `json:"kind"`   // temperature, fan or voltage; empty for every kind
+	Above  *float64 `json:"above,omitempty"`
+	Below  *float64 `json:"below,omitempty"`
+}
+
+func (sensorLimit) Validate(raw json.RawMessage) (json.RawMessage, error) {
+	var p sensorLimitParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(p.Sensor, ""); err != nil {
+		return nil, fmt.Errorf("invalid sensor pattern: %v", err)
+	}
+	switch p.Kind {
+	case "", metrics.SensorTemperature, metrics.SensorFan, metrics.SensorVoltage:
+	default:
+		return nil, errors.New("kind must be one of temperature, fan, voltage")
+	}
+	return json.Marshal(p)
+}
+
+func (sensorLimit) Evaluate(raw json.RawMessage, system *db.System, now time.Time) ([]Finding, error) {
+	var p sensorLimitParams
+	if err := decodeParams(raw, &p); err != nil {
+		return nil, err
+	}
+	m, ok := onlineMetrics(system, now)
+	if !ok {
+		return nil, nil
+	}
+
+	var findings []Finding
+	for _, s := range m.Sensors {
+		if p.Kind != "" && s.Kind != p.Kind {
+			continue
+		}
+		if p.Sensor != "" {
+			if ok, _ := path.Match(p.Sensor, s.ID()); !ok {
+				continue
+			}
+		}
+		var msg string
+		switch {
+		case p.Above != nil && s.Value > *p.Above:
+			msg = fmt.Sprintf("%s is %s (above %g)", s.ID(), sensorValue(s), *p.Above)
+		case p.Below != nil && s.Value < *p.Below:
+			msg = fmt.Sprintf("%s is %s (below %g)", s.ID(), sensorValue(s), *p.Below)
+		case p.Above == nil && p.Below == nil && s.OverLimit():
+			msg = fmt.Sprintf("%s is %s, past the hardware limit", s.ID(), sensorValue(s))
+		default:
+			continue
+		}
+		findings = append(findings, Finding{Subject: s.ID(), Value: s.Value, Message: msg})
+	}
+	return findings, nil
+}
+
+func sensorValue(s metrics.Sensor) string {
+	switch s.Kind {
+	case metrics.SensorTemperature:
+		return fmt.Sprintf("%.1f°C", s.Value)
+	case metrics.SensorFan:
+		return fmt.Sprintf("%.0f RPM", s.Value)
+	case metrics.SensorVoltage:
+		return fmt.Sprintf("%.2f V", s.Value)
+	}
+	return fmt.Sprintf("%g", s.Value)
+}
@@ -0,0 +1,56 @@
+package alerts
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/metrics"
+)
+
+func TestOOMKill(t *testing.T) {
+	metrics.InitStore()
+	system := &db.System{ID: 1}
+	params, err := oomKill{}.Validate(json.RawMessage(`{"above": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluate := func(vm *metrics.VMStats) []Finding {
+		t.Helper()
+		metrics.GlobalStore.Update("1", metrics.SystemMetrics{Memory: &metrics.ExtendedMemoryStat{VM: vm}})
+		findings, err := oomKill{}.Evaluate(params, system, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return findings
+	}
+
+	if f := evaluate(&metrics.VMStats{OOMKills: 7, OOMKillsRecent: 2}); len(f) != 0 {
+		t.Errorf("kills within the allowed = %+v, want none", f)
+	}
+	f := evaluate(&metrics.VMStats{OOMKills: 8, OOMKillsRecent: 3})
+	if len(f) != 1 || f[0].Value != 3 || f[0].Subject != "" {
+		t.Errorf("kills over the allowed = %+v, want one finding of 3", f)
+	}
+	// Agents outside Linux don't report OOM kills
+	if f := evaluate(nil); len(f) != 0 {
+		t.Errorf("no OOM figures = %+v, want none", f)
+	}
+}
+
+func TestOnlineMetrics(t *testing.T) {
+	metrics.InitStore()
+	system := &db.System{ID: 2}
+	now := time.Now()
+	if _, ok := onlineMetrics(system, now); ok {
+		t.Error("a system without metrics has metrics")
+	}
+	metrics.GlobalStore.Update("2", metrics.SystemMetrics{CPUTotal: 42})
+	if m, ok := onlineMetrics(system, now); !ok || m.CPUTotal != 42 {
+		t.Errorf("onlineMetrics = %+v, %v, want the latest metrics", m, ok)
+	}
+	if _, ok := onlineMetrics(system, now.Add(metrics.OfflineAfter+time.Minute)); ok {
+		t.Error("the metrics of an offline system are judged")
+	}
+}
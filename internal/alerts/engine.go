@@ -0,0 +1,182 @@
+package alerts
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/tags"
+)
+
+// Alert is a rule firing for one subject on one system.
+type Alert struct {
+	RuleID     int       `json:"rule_id"`
+	RuleName   string    `json:"rule_name"`
+	UserID     int       `json:"-"`
+	Condition  string    `json:"condition"`
+	SystemID   int       `json:"system_id"`
+	SystemName string    `json:"system_name"`
+	Subject    string    `json:"subject"`
+	Value      float64   `json:"value"`
+	Message    string    `json:"message"`
+	Since      time.Time `json:"since"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type alertKey struct {
+	rule    int
+	system  int
+	subject string
+}
+
+// Firing alerts live in memory only; after a restart they fire again on the
+// first evaluation.
+var (
+	mu     sync.Mutex
+	active = make(map[alertKey]*Alert)
+)
+
+// Start evaluates all enabled rules every interval in the background. A
+// non-positive interval disables alerting.
+func Start(interval time.Duration) {
+	if interval <= 0 {
+		logger.Info("Alerting disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			Evaluate(time.Now())
+		}
+	}()
+}
+
+// Evaluate runs every enabled rule once, opening alerts for new findings and
+// resolving the ones whose condition no longer holds.
+func Evaluate(now time.Time) {
+	rules, err := db.GlobalStore.GetEnabledAlertRules()
+	if err != nil {
+		logger.Error("Failed to load alert rules", "error", err)
+		return
+	}
+
+	systems := make(map[int][]db.System) // Per user
+	found := make(map[alertKey]*Alert)
+	failed := make(map[[2]int]bool) // Rule and system whose alerts are kept as they are
+	for _, r := range rules {
+		c, ok := conditions[r.Condition]
+		if !ok {
+			logger.Warn("Alert rule has an unknown condition", "rule_id", r.ID, "condition", r.Condition)
+			continue
+		}
+		sel, err := tags.ParseSelector(r.Selector)
+		if err != nil {
+			logger.Warn("Alert rule has an invalid selector", "rule_id", r.ID, "error", err)
+			continue
+		}
+		if _, ok := systems[r.UserID]; !ok {
+			list, err := db.GlobalStore.GetSystems(r.UserID)
+			if err != nil {
+				logger.Error("Failed to load systems for alert rules", "user_id", r.UserID, "error", err)
+				continue
+			}
+			systems[r.UserID] = list
+		}
+
+		for i := range systems[r.UserID] {
+			s := &systems[r.UserID][i]
+			if !sel.Matches(s.Tags) || (r.Group != "" && !inGroup(s, r.Group)) {
+				continue
+			}
+			findings, err := c.Evaluate(r.Params, s, now)
+			if err != nil {
+				logger.Warn("Failed to evaluate alert rule", "rule_id", r.ID, "system_id", s.ID, "error", err)
+				failed[[2]int{r.ID, s.ID}] = true
+				continue
+			}
+			for _, f := range findings {
+				found[alertKey{r.ID, s.ID, f.Subject}] = &Alert{
+					RuleID:     r.ID,
+					RuleName:   r.Name,
+					UserID:     r.UserID,
+					Condition:  r.Condition,
+					SystemID:   s.ID,
+					SystemName: s.Name,
+					Subject:    f.Subject,
+					Value:      f.Value,
+					Message:    f.Message,
+					Since:      now.UTC(),
+					UpdatedAt:  now.UTC(),
+				}
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for key, a := range active {
+		if _, ok := found[key]; ok || failed[[2]int{key.rule, key.system}] {
+			continue
+		}
+		delete(active, key)
+		logger.Info("Alert resolved", "rule", a.RuleName, "system", a.SystemName, "subject", a.Subject)
+	}
+	for key, a := range found {
+		if prev, ok := active[key]; ok {
+			a.Since = prev.Since
+		} else {
+			logger.Warn("Alert firing", "rule", a.RuleName, "system", a.SystemName, "subject", a.Subject, "message", a.Message)
+		}
+		active[key] = a
+	}
+}
+
+// Active returns the alerts currently firing for a user's rules, oldest
+// first.
+func Active(userID int) []Alert {
+	mu.Lock()
+	list := []Alert{}
+	for _, a := range active {
+		if a.UserID == userID {
+			list = append(list, *a)
+		}
+	}
+	mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Since.Equal(list[j].Since) {
+			return list[i].Since.Before(list[j].Since)
+		}
+		if list[i].RuleID != list[j].RuleID {
+			return list[i].RuleID < list[j].RuleID
+		}
+		if list[i].SystemID != list[j].SystemID {
+			return list[i].SystemID < list[j].SystemID
+		}
+		return list[i].Subject < list[j].Subject
+	})
+	return list
+}
+
+// Forget drops the alerts of a rule that was changed or deleted; they are
+// raised again on the next evaluation if the rule still fires.
+func Forget(ruleID int) {
+	mu.Lock()
+	defer mu.Unlock()
+	for key := range active {
+		if key.rule == ruleID {
+			delete(active, key)
+		}
+	}
+}
+
+func inGroup(s *db.System, group string) bool {
+	for _, g := range s.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Package anomaly scores metric samples by how far they deviate from a
+// baseline learned from earlier samples of the same series.
+//
+// Two baselines are supported: the rolling window of the samples just
+// before, and a seasonal one made of the samples taken in the same hour of
+// the week in earlier weeks, which learns daily and weekly patterns such as
+// nightly backups.
+package anomaly
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Detectors
+const (
+	DetectorRolling  = "rolling"
+	DetectorSeasonal = "seasonal"
+)
+
+// Options configure a detector.
+type Options struct {
+	Detector   string  `json:"detector"`
+	Sigma      float64 `json:"sigma"`       // Deviation, in standard deviations, that counts as anomalous
+	Window     int     `json:"window"`      // Rolling: number of preceding samples in the baseline
+	MinSamples int     `json:"min_samples"` // Baseline size needed before a sample is scored
+}
+
+// DefaultOptions returns a rolling detector over the last 30 samples that
+// flags deviations of three standard deviations.
+func DefaultOptions() Options {
+	return Options{Detector: DetectorRolling, Sigma: 3, Window: 30, MinSamples: 10}
+}
+
+func (o Options) Validate() error {
+	switch {
+	case o.Detector != DetectorRolling && o.Detector != DetectorSeasonal:
+		return errors.New("detector must be rolling or seasonal")
+	case o.Sigma <= 0:
+		return errors.New("sigma must be positive")
+	case o.Detector == DetectorRolling && o.Window < 2:
+		return errors.New("window must be at least 2")
+	case o.MinSamples < 2:
+		return errors.New("min_samples must be at least 2")
+	case o.Detector == DetectorRolling && o.MinSamples > o.Window:
+		return errors.New("min_samples cannot exceed window")
+	}
+	return nil
+}
+
+// Point is one sample of a series.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Score is a sample together with its deviation from the baseline. The
+// baseline fields are null while the baseline is smaller than MinSamples.
+type Score struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Baseline  *float64  `json:"baseline"` // Mean of the baseline
+	StdDev    *float64  `json:"stddev"`
+	Score     *float64  `json:"score"` // (value - baseline) / stddev
+	Anomaly   bool      `json:"anomaly"`
+}
+
+// Compare scores p against the values of its baseline.
+func Compare(p Point, baseline []float64, o Options) Score {
+	s := Score{Timestamp: p.Time, Value: p.Value}
+	if len(baseline) < o.MinSamples || len(baseline) == 0 {
+		return s
+	}
+	mean, sd := meanStdDev(baseline)
+	// A perfectly flat baseline would make any change infinitely
+	// anomalous; never assume less spread than 1% of the mean.
+	sd = math.Max(sd, math.Max(math.Abs(mean)*0.01, 1e-6))
+	z := (p.Value - mean) / sd
+	s.Baseline, s.StdDev, s.Score = &mean, &sd, &z
+	s.Anomaly = math.Abs(z) >= o.Sigma
+	return s
+}
+
+// Detect scores every point of a chronological series against the baseline
+// formed by the points before it.
+func Detect(points []Point, o Options) []Score {
+	scores := make([]Score, len(points))
+	if o.Detector == DetectorSeasonal {
+		// Indexes of the points in each hour of the week, in order
+		buckets := make(map[int][]int)
+		for i, p := range points {
+			h := HourOfWeek(p.Time)
+			buckets[h] = append(buckets[h], i)
+		}
+		for i, p := range points {
+			start := p.Time.Truncate(time.Hour)
+			var baseline []float64
+			for _, j := range buckets[HourOfWeek(p.Time)] {
+				if !points[j].Time.Before(start) {
+					break
+				}
+				baseline = append(baseline, points[j].Value)
+			}
+			scores[i] = Compare(p, baseline, o)
+		}
+		return scores
+	}
+
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = p.Value
+	}
+	for i, p := range points {
+		from := i - o.Window
+		if from < 0 {
+			from = 0
+		}
+		scores[i] = Compare(p, values[from:i], o)
+	}
+	return scores
+}
+
+// HourOfWeek numbers the hours of the week from 0 (Sunday 00:00 UTC) to 167.
+func HourOfWeek(t time.Time) int {
+	t = t.UTC()
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+func meanStdDev(values []float64) (mean, sd float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		sd += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(values)))
+}
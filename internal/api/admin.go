@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+)
+
+// Audit actions
+const (
+	AuditBackup = "admin.backup"
+	AuditExport = "admin.export"
+)
+
+// DownloadBackup streams a consistent snapshot of the database, taken while
+// the server keeps running.
+//
+//	GET /api/v1/admin/backup
+func DownloadBackup(c *gin.Context) {
+	dir, err := os.MkdirTemp("", "server-moni-backup-")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create backup"})
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := "server-moni-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	path := filepath.Join(dir, name)
+	if err := db.GlobalStore.Backup(path); err != nil {
+		recordAudit(c, auditEvent{Action: AuditBackup, Err: err})
+		if errors.Is(err, db.ErrBackupUnsupported) {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Error("Backup failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create backup"})
+		return
+	}
+
+	recordAudit(c, auditEvent{Action: AuditBackup, Details: name})
+	c.FileAttachment(path, name)
+}
+
+// DownloadExport returns the portable JSON export of all accounts, systems,
+// tags and groups. It includes password hashes and agent API keys.
+//
+//	GET /api/v1/admin/export
+func DownloadExport(c *gin.Context) {
+	export, err := db.GlobalStore.Export()
+	if err != nil {
+		recordAudit(c, auditEvent{Action: AuditExport, Err: err})
+		logger.Error("Export failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data"})
+		return
+	}
+
+	recordAudit(c, auditEvent{Action: AuditExport})
+	name := "server-moni-export-" + export.CreatedAt.Format("20060102-150405") + ".json"
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.JSON(http.StatusOK, export)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/alerts"
+	"github.com/user/server-moni/internal/db"
+)
+
+const (
+	AuditAlertRuleCreate = "alert_rule.create"
+	AuditAlertRuleUpdate = "alert_rule.update"
+	AuditAlertRuleDelete = "alert_rule.delete"
+)
+
+type alertRuleRequest struct {
+	Name      string          `json:"name"`
+	Condition string          `json:"condition"`
+	Params    json.RawMessage `json:"params"`
+	Selector  string          `json:"selector"`
+	Group     string          `json:"group"`
+	Enabled   *bool           `json:"enabled"` // Defaults to true
+}
+
+// bindAlertRule parses and validates a rule body, writing an error response
+// if it is invalid.
+func bindAlertRule(c *gin.Context) (*db.AlertRule, bool) {
+	var req alertRuleRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	rule := &db.AlertRule{
+		UserID:    c.GetInt("userID"),
+		Name:      req.Name,
+		Condition: req.Condition,
+		Params:    req.Params,
+		Selector:  req.Selector,
+		Group:     req.Group,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+	}
+	if err := alerts.ValidateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return rule, true
+}
+
+func GetAlertRules(c *gin.Context) {
+	rules, err := db.GlobalStore.GetAlertRules(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert rules"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "conditions": alerts.Conditions()})
+}
+
+func CreateAlertRule(c *gin.Context) {
+	rule, ok := bindAlertRule(c)
+	if !ok {
+		return
+	}
+	id, err := db.GlobalStore.CreateAlertRule(rule)
+	recordAudit(c, auditEvent{Action: AuditAlertRuleCreate, TargetType: "alert_rule", TargetID: strconv.FormatInt(id, 10), Details: rule.Name, Err: err})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func UpdateAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	rule, ok := bindAlertRule(c)
+	if !ok {
+		return
+	}
+	rule.ID = id
+	err = db.GlobalStore.UpdateAlertRule(rule)
+	recordAudit(c, auditEvent{Action: AuditAlertRuleUpdate, TargetType: "alert_rule", TargetID: c.Param("id"), Details: rule.Name, Err: err})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert rule"})
+		return
+	}
+	alerts.Forget(id)
+	c.Status(http.StatusOK)
+}
+
+func DeleteAlertRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	err = db.GlobalStore.DeleteAlertRule(id, c.GetInt("userID"))
+	recordAudit(c, auditEvent{Action: AuditAlertRuleDelete, TargetType: "alert_rule", TargetID: c.Param("id"), Err: err})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert rule"})
+		return
+	}
+	alerts.Forget(id)
+	c.Status(http.StatusOK)
+}
+
+// GetAlerts returns the alerts currently firing for the caller's rules.
+//
+//	GET /api/v1/alerts
+func GetAlerts(c *gin.Context) {
+	c.JSON(http.StatusOK, alerts.Active(c.GetInt("userID")))
+}
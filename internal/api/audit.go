@@ -0,0 +1,243 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/metrics"
+)
+
+// Audit actions
+const (
+	AuditRegister        = "auth.register"
+	AuditLogin           = "auth.login"
+	AuditLogout          = "auth.logout"
+	AuditRefresh         = "auth.refresh"
+	AuditPasswordChange  = "auth.password_change"
+	AuditPasswordForgot  = "auth.password_reset_request"
+	AuditPasswordReset   = "auth.password_reset"
+	AuditEmailVerify     = "auth.email_verify"
+	AuditSessionRevoke   = "session.revoke"
+	AuditSessionsRevoke  = "session.revoke_all"
+	AuditSystemCreate    = "system.create"
+	AuditSystemDelete    = "system.delete"
+	AuditSystemProxy     = "system.proxy"
+	AuditAgentIngest     = "agent.ingest"
+	AuditAgentListen     = "agent.listen"
+	AuditAuditExport     = "audit.export"
+	maxAuditExportRows   = 100000
+	defaultAuditPageSize = 50
+)
+
+type auditEvent struct {
+	UserID     int    // Owner of the entry; defaults to the authenticated user
+	Actor      string // Defaults to the email of UserID
+	Action     string
+	TargetType string
+	TargetID   string
+	Details    string
+	Err        error // Non-nil marks the entry as a failure
+}
+
+// recordAudit appends an entry to the audit log. Failures to write are
+// logged but never fail the request being audited.
+func recordAudit(c *gin.Context, ev auditEvent) {
+	if ev.UserID == 0 {
+		ev.UserID = c.GetInt("userID")
+	}
+	if ev.Actor == "" && ev.UserID != 0 {
+		if u, err := db.GlobalStore.GetUserByID(ev.UserID); err == nil {
+			ev.Actor = u.Email
+		}
+	}
+	if ev.Actor == "" {
+		ev.Actor = "anonymous"
+	}
+
+	entry := &db.AuditEntry{
+		UserID:     ev.UserID,
+		Actor:      ev.Actor,
+		Action:     ev.Action,
+		TargetType: ev.TargetType,
+		TargetID:   ev.TargetID,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Result:     "success",
+		Details:    ev.Details,
+	}
+	if ev.Err != nil {
+		entry.Result = "failure"
+		if entry.Details == "" {
+			entry.Details = ev.Err.Error()
+		}
+	}
+
+	if err := db.GlobalStore.AddAuditEntry(entry); err != nil {
+		logger.Error("Failed to write audit entry", "action", ev.Action, "error", err)
+	}
+}
+
+// ingestSources remembers the last address each system pushed from, so an
+// audit entry is written when an API key is first used or used from a new
+// location rather than on every push.
+var ingestSources sync.Map // system ID -> IP
+
+func auditIngestSource(c *gin.Context, system *db.System) {
+	ip := c.ClientIP()
+	if prev, ok := ingestSources.Load(system.ID); ok && prev.(string) == ip {
+		return
+	}
+	ingestSources.Store(system.ID, ip)
+	recordAudit(c, auditEvent{
+		UserID:     system.UserID,
+		Actor:      "system:" + strconv.Itoa(system.ID),
+		Action:     AuditAgentIngest,
+		TargetType: "system",
+		TargetID:   strconv.Itoa(system.ID),
+		Details:    "ingest from new source address",
+	})
+}
+
+// auditNewListeners writes an audit entry for each listening socket the
+// agent reports as new that was not in the previous snapshot of the system,
+// so a port opened on a host can be reviewed. After a restart of the server
+// there is no previous snapshot and nothing is written.
+func auditNewListeners(c *gin.Context, system *db.System, m *metrics.SystemMetrics) {
+	if m.Listeners == nil {
+		return // The agent has not scanned sockets yet
+	}
+	prev, ok := metrics.GlobalStore.Get(strconv.Itoa(system.ID))
+	if !ok || prev.Listeners == nil {
+		return
+	}
+	known := make(map[string]bool, len(prev.Listeners))
+	for _, l := range prev.Listeners {
+		known[l.Endpoint()] = true
+	}
+	for _, l := range m.Listeners {
+		if !l.New || known[l.Endpoint()] {
+			continue
+		}
+		recordAudit(c, auditEvent{
+			UserID:     system.UserID,
+			Actor:      "system:" + strconv.Itoa(system.ID),
+			Action:     AuditAgentListen,
+			TargetType: "system",
+			TargetID:   strconv.Itoa(system.ID),
+			Details:    "new listening socket " + l.String(),
+		})
+	}
+}
+
+// auditFilter builds a filter for the caller from the query string.
+func auditFilter(c *gin.Context) (db.AuditFilter, error) {
+	f := db.AuditFilter{
+		UserID:     c.GetInt("userID"),
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		Result:     c.Query("result"),
+	}
+	var err error
+	if v := c.Query("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, err
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// GetAuditLog returns a page of the caller's audit log.
+//
+//	GET /api/v1/audit?action=system.*&result=failure&since=2024-01-01T00:00:00Z&limit=50&offset=0
+func GetAuditLog(c *gin.Context) {
+	f, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since/until must be RFC3339 timestamps"})
+		return
+	}
+	f.Limit = defaultAuditPageSize
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 1000 {
+		f.Limit = v
+	}
+	if v, err := strconv.Atoi(c.Query("offset")); err == nil && v >= 0 {
+		f.Offset = v
+	}
+
+	entries, total, err := db.GlobalStore.QueryAuditLog(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   total,
+		"limit":   f.Limit,
+		"offset":  f.Offset,
+	})
+}
+
+// ExportAuditLog downloads every matching entry as CSV or JSON.
+//
+//	GET /api/v1/audit/export?format=csv&since=2024-01-01T00:00:00Z
+func ExportAuditLog(c *gin.Context) {
+	f, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since/until must be RFC3339 timestamps"})
+		return
+	}
+	f.Limit = maxAuditExportRows
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	entries, _, err := db.GlobalStore.QueryAuditLog(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	recordAudit(c, auditEvent{Action: AuditAuditExport, Details: format + ", " + strconv.Itoa(len(entries)) + " entries"})
+
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == "json" {
+		c.JSON(http.StatusOK, entries)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor", "action", "target_type", "target_id", "ip", "user_agent", "result", "details"})
+	for _, e := range entries {
+		w.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			e.Actor,
+			e.Action,
+			e.TargetType,
+			e.TargetID,
+			e.IP,
+			e.UserAgent,
+			e.Result,
+			e.Details,
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/certs"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/metrics"
+)
+
+type systemCertificate struct {
+	SystemID   int    `json:"system_id"`
+	SystemName string `json:"system_name"`
+	certs.Certificate
+}
+
+// GetCertificates lists the certificates reported by the agents of the
+// caller's systems, soonest expiry first. With within, only the ones that
+// expire within that many days (or have expired) are listed; certificates
+// that could not be read are always listed, last.
+//
+//	GET /api/v1/certificates?within=30&selector=env=prod&group=web
+func GetCertificates(c *gin.Context) {
+	filter, err := parseSystemFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	within := 0
+	if c.Query("within") != "" {
+		var ok bool
+		if within, ok = queryDays(c, "within", 0); !ok {
+			return
+		}
+	}
+
+	systems, err := db.GlobalStore.GetSystems(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch systems"})
+		return
+	}
+	systems = filter.Apply(systems)
+
+	now := time.Now().UTC()
+	result := []systemCertificate{}
+	for _, s := range systems {
+		m, ok := metrics.GlobalStore.Get(strconv.Itoa(s.ID))
+		if !ok {
+			continue
+		}
+		for _, cert := range m.Certificates {
+			if cert.Error == "" {
+				cert.DaysLeft = cert.DaysUntilExpiry(now)
+				if within > 0 && cert.DaysLeft > float64(within) {
+					continue
+				}
+			}
+			result = append(result, systemCertificate{SystemID: s.ID, SystemName: s.Name, Certificate: cert})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if (a.Error == "") != (b.Error == "") {
+			return a.Error == ""
+		}
+		return a.DaysLeft < b.DaysLeft
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"within_days":  within,
+		"certificates": result,
+	})
+}
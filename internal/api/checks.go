@@ -0,0 +1,304 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/checks"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+)
+
+const (
+	AuditCheckCreate = "check.create"
+	AuditCheckUpdate = "check.update"
+	AuditCheckDelete = "check.delete"
+)
+
+const (
+	defaultCheckResultHours = 24
+	maxCheckError           = 1024 // Longer agent errors are cut
+)
+
+type checkRequest struct {
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Target   string         `json:"target"`
+	Interval int            `json:"interval"`
+	Timeout  int            `json:"timeout"`
+	Options  checks.Options `json:"options"`
+	Enabled  *bool          `json:"enabled"` // Defaults to true
+}
+
+// bindCheck parses and validates a check body, writing an error response if
+// it is invalid.
+func bindCheck(c *gin.Context) (*db.Check, bool) {
+	var req checkRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	d := checks.Definition{Name: req.Name, Type: req.Type, Target: req.Target, Interval: req.Interval, Timeout: req.Timeout, Options: req.Options}
+	if err := d.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	options, err := json.Marshal(d.Options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &db.Check{
+		Name:     d.Name,
+		Type:     d.Type,
+		Target:   d.Target,
+		Interval: d.Interval,
+		Timeout:  d.Timeout,
+		Options:  options,
+		Enabled:  req.Enabled == nil || *req.Enabled,
+	}, true
+}
+
+// checkDefinition converts a stored check to what its agent runs.
+func checkDefinition(c db.Check) (checks.Definition, error) {
+	d := checks.Definition{ID: c.ID, Name: c.Name, Type: c.Type, Target: c.Target, Interval: c.Interval, Timeout: c.Timeout}
+	err := json.Unmarshal(c.Options, &d.Options)
+	return d, err
+}
+
+// syncChecks stores the results an agent sent for checks of its system and
+// returns the enabled checks it should run from now on. Results for unknown
+// checks, such as ones deleted since the agent last synced, are dropped.
+func syncChecks(systemID int, results []checks.Result) ([]checks.Definition, error) {
+	stored, err := db.GlobalStore.GetChecks(systemID)
+	if err != nil {
+		logger.Warn("Failed to load checks", "system_id", systemID, "error", err)
+		return nil, err
+	}
+
+	known := make(map[int]bool, len(stored))
+	defs := []checks.Definition{}
+	for _, c := range stored {
+		known[c.ID] = true
+		if !c.Enabled {
+			continue
+		}
+		d, err := checkDefinition(c)
+		if err != nil {
+			logger.Warn("Skipping check with invalid options", "check_id", c.ID, "error", err)
+			continue
+		}
+		defs = append(defs, d)
+	}
+
+	now := time.Now().UTC()
+	rows := make([]db.CheckResult, 0, len(results))
+	for _, r := range results {
+		if !known[r.CheckID] {
+			continue
+		}
+		// Agent clocks can be off; never store results from the future
+		at := r.Time
+		if at.IsZero() || at.After(now) {
+			at = now
+		}
+		if len(r.Error) > maxCheckError {
+			r.Error = r.Error[:maxCheckError]
+		}
+		rows = append(rows, db.CheckResult{
+			CheckID:    r.CheckID,
+			SystemID:   systemID,
+			Timestamp:  at,
+			Up:         r.Up,
+			LatencyMS:  r.LatencyMS,
+			StatusCode: r.StatusCode,
+			Error:      r.Error,
+		})
+	}
+	if len(rows) > 0 {
+		if err := db.GlobalStore.AddCheckResults(rows); err != nil {
+			logger.Warn("Failed to save check results", "system_id", systemID, "error", err)
+		}
+	}
+	return defs, nil
+}
+
+// ownedCheck loads the check in the :id parameter, writing an error response
+// unless it belongs to a system of the caller.
+func ownedCheck(c *gin.Context) (*db.Check, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+	check, err := db.GlobalStore.GetCheck(id)
+	if err == nil {
+		var system *db.System
+		system, err = db.GlobalStore.GetSystem(check.SystemID)
+		if err == nil && system.UserID != c.GetInt("userID") {
+			err = sql.ErrNoRows
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Check not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check"})
+		return nil, false
+	}
+	return check, true
+}
+
+type checkStatus struct {
+	db.Check
+	LastResult *db.CheckResult `json:"last_result"` // nil until the agent has run it
+}
+
+// GetChecks lists the checks of a system with their latest result.
+//
+//	GET /api/v1/systems/:id/checks
+func GetChecks(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	stored, err := db.GlobalStore.GetChecks(system.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checks"})
+		return
+	}
+	list := make([]checkStatus, 0, len(stored))
+	for _, check := range stored {
+		s := checkStatus{Check: check}
+		last, err := db.GlobalStore.LastCheckResults(check.ID, 1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check results"})
+			return
+		}
+		if len(last) > 0 {
+			s.LastResult = &last[0]
+		}
+		list = append(list, s)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func CreateCheck(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	check, ok := bindCheck(c)
+	if !ok {
+		return
+	}
+	check.SystemID = system.ID
+	id, err := db.GlobalStore.CreateCheck(check)
+	recordAudit(c, auditEvent{Action: AuditCheckCreate, TargetType: "check", TargetID: strconv.FormatInt(id, 10), Details: system.Name + ": " + check.Name, Err: err})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create check"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func UpdateCheck(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	check, ok := bindCheck(c)
+	if !ok {
+		return
+	}
+	check.ID = id
+	err = db.GlobalStore.UpdateCheck(check, c.GetInt("userID"))
+	recordAudit(c, auditEvent{Action: AuditCheckUpdate, TargetType: "check", TargetID: c.Param("id"), Details: check.Name, Err: err})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Check not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update check"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func DeleteCheck(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	err = db.GlobalStore.DeleteCheck(id, c.GetInt("userID"))
+	recordAudit(c, auditEvent{Action: AuditCheckDelete, TargetType: "check", TargetID: c.Param("id"), Err: err})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Check not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete check"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// GetCheckResults returns the results of a check over the last hours with
+// its uptime over them and the average latency of the runs that were up.
+//
+//	GET /api/v1/checks/:id/results?hours=24
+func GetCheckResults(c *gin.Context) {
+	check, ok := ownedCheck(c)
+	if !ok {
+		return
+	}
+	hours := defaultCheckResultHours
+	if v := c.Query("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be a positive number"})
+			return
+		}
+		hours = n
+	}
+	since := time.Now().UTC().Add(-time.Duration(hours) * time.Hour)
+	results, err := db.GlobalStore.GetCheckResults(check.ID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check results"})
+		return
+	}
+
+	// Uptime and latency stay null without results to average
+	var uptime, latency *float64
+	if len(results) > 0 {
+		up, total := 0, 0.0
+		for _, r := range results {
+			if r.Up {
+				up++
+				total += r.LatencyMS
+			}
+		}
+		pct := 100 * float64(up) / float64(len(results))
+		uptime = &pct
+		if up > 0 {
+			avg := total / float64(up)
+			latency = &avg
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"check":          check,
+		"since":          since,
+		"uptime_percent": uptime,
+		"avg_latency_ms": latency,
+		"results":        results,
+	})
+}
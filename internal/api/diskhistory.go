@@ -0,0 +1,235 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/capacity"
+	"github.com/user/server-moni/internal/config"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/metrics"
+)
+
+const (
+	defaultDiskHistoryDays    = 90
+	defaultForecastDays       = 30
+	defaultForecastWithinDays = 30
+	maxDiskHistoryDays        = 3650
+)
+
+// lastDiskSnapshot caches when each system was last snapshotted so ingest
+// only hits the database once per interval.
+var (
+	diskSnapshotMu   sync.Mutex
+	lastDiskSnapshot = make(map[int]time.Time)
+)
+
+// recordDiskHistory stores the capacity of every mount of a system once per
+// config.AppConfig.DiskHistoryInterval. Intervals are aligned to UTC, so the
+// default of 24h yields one snapshot per calendar day.
+func recordDiskHistory(systemID int, m metrics.SystemMetrics) {
+	interval := config.AppConfig.DiskHistoryInterval
+	if interval <= 0 || len(m.Disks) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	bucket := now.Truncate(interval)
+
+	diskSnapshotMu.Lock()
+	last, ok := lastDiskSnapshot[systemID]
+	if !ok {
+		var err error
+		if last, err = db.GlobalStore.LastDiskHistory(systemID); err != nil {
+			diskSnapshotMu.Unlock()
+			logger.Warn("Failed to read disk history", "system_id", systemID, "error", err)
+			return
+		}
+	}
+	if !last.Before(bucket) {
+		lastDiskSnapshot[systemID] = last
+		diskSnapshotMu.Unlock()
+		return
+	}
+	lastDiskSnapshot[systemID] = now
+	diskSnapshotMu.Unlock()
+
+	entries := make([]db.DiskHistory, 0, len(m.Disks))
+	for _, d := range m.Disks {
+		if d.Total == 0 {
+			continue
+		}
+		entries = append(entries, db.DiskHistory{
+			SystemID:    systemID,
+			Mountpoint:  d.Path,
+			Timestamp:   now,
+			UsedPercent: d.UsedPercent,
+			Total:       d.Total,
+			Used:        d.Used,
+		})
+	}
+	if err := db.GlobalStore.AddDiskHistory(entries); err != nil {
+		logger.Warn("Failed to save disk history", "system_id", systemID, "error", err)
+		// Retry on the next ingest
+		diskSnapshotMu.Lock()
+		lastDiskSnapshot[systemID] = last
+		diskSnapshotMu.Unlock()
+	}
+}
+
+func forgetDiskHistory(systemID int) {
+	diskSnapshotMu.Lock()
+	delete(lastDiskSnapshot, systemID)
+	diskSnapshotMu.Unlock()
+}
+
+type mountHistory struct {
+	Mountpoint string             `json:"mountpoint"`
+	Latest     db.DiskHistory     `json:"latest"`
+	Growth     *capacity.Trend    `json:"growth"`   // null until there are two snapshots
+	Forecast   *capacity.Forecast `json:"forecast"` // null below capacity.MinForecastSamples
+	Snapshots  []db.DiskHistory   `json:"snapshots"`
+}
+
+// GetDiskHistory returns the capacity snapshots of a system per mountpoint,
+// with the growth rate and disk-full forecast of each.
+//
+//	GET /api/v1/systems/:id/disk-history?mount=/var&days=90&method=robust
+func GetDiskHistory(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	days, ok := queryDays(c, "days", defaultDiskHistoryDays)
+	if !ok {
+		return
+	}
+	method, err := capacity.ParseMethod(c.Query("method"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -days)
+	mounts, err := capacity.LoadMounts(system.ID, c.Query("mount"), since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch disk history"})
+		return
+	}
+
+	result := make([]mountHistory, 0, len(mounts))
+	for _, m := range mounts {
+		h := mountHistory{Mountpoint: m.Mountpoint, Latest: m.Latest(), Snapshots: m.History}
+		points := m.Points()
+		if trend, ok := capacity.Growth(points); ok {
+			h.Growth = &trend
+		}
+		if f, ok := capacity.Predict(points, method, now); ok {
+			h.Forecast = &f
+		}
+		result = append(result, h)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"system_id": system.ID,
+		"interval":  config.AppConfig.DiskHistoryInterval.String(),
+		"since":     since,
+		"mounts":    result,
+	})
+}
+
+type mountForecast struct {
+	SystemID    int               `json:"system_id"`
+	SystemName  string            `json:"system_name"`
+	Mountpoint  string            `json:"mountpoint"`
+	UsedPercent float64           `json:"used_percent"`
+	Forecast    capacity.Forecast `json:"forecast"`
+}
+
+// GetCapacityForecast lists the mounts of the caller's systems predicted to
+// be full within a number of days, soonest first.
+//
+//	GET /api/v1/capacity/forecast?within=30&days=30&method=robust&selector=env=prod&group=web
+//
+// days is how much history the forecasts are fitted to.
+func GetCapacityForecast(c *gin.Context) {
+	filter, err := parseSystemFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	within, ok := queryDays(c, "within", defaultForecastWithinDays)
+	if !ok {
+		return
+	}
+	days, ok := queryDays(c, "days", defaultForecastDays)
+	if !ok {
+		return
+	}
+	method, err := capacity.ParseMethod(c.Query("method"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	systems, err := db.GlobalStore.GetSystems(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch systems"})
+		return
+	}
+	systems = filter.Apply(systems)
+
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -days)
+	result := []mountForecast{}
+	for _, s := range systems {
+		mounts, err := capacity.LoadMounts(s.ID, "", since)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch disk history"})
+			return
+		}
+		for _, m := range mounts {
+			f, ok := capacity.Predict(m.Points(), method, now)
+			if !ok || !f.FullWithin(float64(within)) {
+				continue
+			}
+			result = append(result, mountForecast{
+				SystemID:    s.ID,
+				SystemName:  s.Name,
+				Mountpoint:  m.Mountpoint,
+				UsedPercent: m.Latest().UsedPercent,
+				Forecast:    f,
+			})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return *result[i].Forecast.DaysUntilFull < *result[j].Forecast.DaysUntilFull
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"within_days": within,
+		"days":        days,
+		"method":      method,
+		"mounts":      result,
+	})
+}
+
+// queryDays parses a positive number of days, writing an error response if
+// it is invalid.
+func queryDays(c *gin.Context, key string, def int) (int, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > maxDiskHistoryDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": key + " must be between 1 and " + strconv.Itoa(maxDiskHistoryDays)})
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/alerts"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/metrics"
+)
+
+const (
+	defaultFleetPageSize = 100
+	fleetTopOffenders    = 5
+)
+
+type fleetThresholds struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+	Disk   float64 `json:"disk"`
+}
+
+type fleetHost struct {
+	ID     int               `json:"id"`
+	Name   string            `json:"name"`
+	Tags   map[string]string `json:"tags"`
+	Groups []string          `json:"groups"`
+	metrics.Headline
+	Alerts     []string `json:"alerts"`      // Headline metrics over their threshold
+	AlertCount int      `json:"alert_count"` // Alert rules firing for the system, as listed by GET /alerts
+}
+
+type fleetAggregate struct {
+	Hosts              int            `json:"hosts"`
+	ByStatus           map[string]int `json:"by_status"`
+	AvgCPU             float64        `json:"avg_cpu"`
+	MaxCPU             float64        `json:"max_cpu"`
+	TotalMemory        uint64         `json:"total_memory"`
+	UsedMemory         uint64         `json:"used_memory"`
+	AvgMemoryPercent   float64        `json:"avg_memory_percent"`
+	MaxDiskPercent     float64        `json:"max_disk_percent"`
+	HostsOverThreshold map[string]int `json:"hosts_over_threshold"` // cpu, memory, disk, any
+}
+
+type fleetOffender struct {
+	ID    int     `json:"id"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// GetFleetSummary returns headline numbers for every accessible system in a
+// single call, with aggregates and the worst hosts per resource.
+//
+//	GET /api/v1/fleet/summary?selector=env=prod&group=web&sort=cpu&order=desc&limit=50&offset=0
+//
+// Optional: cpu_threshold, memory_threshold, disk_threshold (percent) and
+// group_by (a tag key, or "group") to also aggregate per tag value / group.
+func GetFleetSummary(c *gin.Context) {
+	filter, err := parseSystemFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	th := fleetThresholds{
+		CPU:    queryFloat(c, "cpu_threshold", 90),
+		Memory: queryFloat(c, "memory_threshold", 90),
+		Disk:   queryFloat(c, "disk_threshold", 90),
+	}
+
+	userID := c.GetInt("userID")
+	systems, err := db.GlobalStore.GetSystems(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch systems"})
+		return
+	}
+	systems = filter.Apply(systems)
+
+	firing := make(map[int]int)
+	for _, a := range alerts.Active(userID) {
+		firing[a.SystemID]++
+	}
+
+	now := time.Now()
+	hosts := make([]fleetHost, 0, len(systems))
+	for _, s := range systems {
+		h := fleetHost{ID: s.ID, Name: s.Name, Tags: s.Tags, Groups: s.Groups, Alerts: []string{}}
+		key := strconv.Itoa(s.ID)
+		if m, ok := metrics.GlobalStore.Get(key); ok {
+			seen, _ := metrics.GlobalStore.LastSeen(key)
+			h.Headline = metrics.Summarize(m, seen, now)
+		} else {
+			h.Status = metrics.StatusUnknown
+		}
+		h.Alerts = thresholdAlerts(h.Headline, th)
+		h.AlertCount = firing[s.ID]
+		hosts = append(hosts, h)
+	}
+
+	if !sortFleet(hosts, c.DefaultQuery("sort", "name"), c.DefaultQuery("order", "")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of name, status, cpu, memory, disk, load, alerts"})
+		return
+	}
+
+	response := gin.H{
+		"total":         len(hosts),
+		"thresholds":    th,
+		"aggregate":     aggregateFleet(hosts),
+		"top_offenders": topOffenders(hosts),
+	}
+
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		buckets := make(map[string][]fleetHost)
+		for _, h := range hosts {
+			if groupBy == "group" {
+				for _, g := range h.Groups {
+					buckets[g] = append(buckets[g], h)
+				}
+			} else if v, ok := h.Tags[groupBy]; ok {
+				buckets[v] = append(buckets[v], h)
+			}
+		}
+		groups := make(map[string]fleetAggregate, len(buckets))
+		for k, v := range buckets {
+			groups[k] = aggregateFleet(v)
+		}
+		response["groups"] = groups
+	}
+
+	limit := defaultFleetPageSize
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 1000 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(c.Query("offset")); err == nil && v >= 0 {
+		offset = v
+	}
+	page := []fleetHost{}
+	if offset < len(hosts) {
+		end := offset + limit
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		page = hosts[offset:end]
+	}
+	response["systems"] = page
+	response["limit"] = limit
+	response["offset"] = offset
+
+	c.JSON(http.StatusOK, response)
+}
+
+func queryFloat(c *gin.Context, key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(c.Query(key), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+func thresholdAlerts(h metrics.Headline, th fleetThresholds) []string {
+	alerts := []string{}
+	if h.Status == metrics.StatusOffline {
+		alerts = append(alerts, "offline")
+	}
+	if h.Status != metrics.StatusOnline {
+		return alerts
+	}
+	if h.CPU >= th.CPU {
+		alerts = append(alerts, "cpu")
+	}
+	if h.MemoryPercent >= th.Memory {
+		alerts = append(alerts, "memory")
+	}
+	if h.DiskPercent >= th.Disk {
+		alerts = append(alerts, "disk:"+h.DiskPath)
+	}
+	return alerts
+}
+
+var statusRank = map[string]int{
+	metrics.StatusOffline: 0,
+	metrics.StatusStale:   1,
+	metrics.StatusUnknown: 2,
+	metrics.StatusOnline:  3,
+}
+
+// sortFleet orders hosts in place. Numeric columns default to descending
+// (worst first), name and status to ascending.
+func sortFleet(hosts []fleetHost, field, order string) bool {
+	var less func(a, b *fleetHost) bool
+	desc := true
+	switch field {
+	case "name":
+		less = func(a, b *fleetHost) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+		desc = false
+	case "status":
+		less = func(a, b *fleetHost) bool { return statusRank[a.Status] < statusRank[b.Status] }
+		desc = false
+	case "cpu":
+		less = func(a, b *fleetHost) bool { return a.CPU < b.CPU }
+	case "memory":
+		less = func(a, b *fleetHost) bool { return a.MemoryPercent < b.MemoryPercent }
+	case "disk":
+		less = func(a, b *fleetHost) bool { return a.DiskPercent < b.DiskPercent }
+	case "load":
+		less = func(a, b *fleetHost) bool { return a.Load1 < b.Load1 }
+	case "alerts":
+		less = func(a, b *fleetHost) bool { return a.AlertCount < b.AlertCount }
+	default:
+		return false
+	}
+	switch order {
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	}
+
+	sort.SliceStable(hosts, func(i, j int) bool {
+		if desc {
+			return less(&hosts[j], &hosts[i])
+		}
+		return less(&hosts[i], &hosts[j])
+	})
+	return true
+}
+
+func aggregateFleet(hosts []fleetHost) fleetAggregate {
+	agg := fleetAggregate{
+		Hosts:              len(hosts),
+		ByStatus:           make(map[string]int),
+		HostsOverThreshold: map[string]int{"cpu": 0, "memory": 0, "disk": 0, "any": 0},
+	}
+	reporting := 0
+	for _, h := range hosts {
+		agg.ByStatus[h.Status]++
+		for _, a := range h.Alerts {
+			key := a
+			if strings.HasPrefix(a, "disk:") {
+				key = "disk"
+			}
+			if _, ok := agg.HostsOverThreshold[key]; ok {
+				agg.HostsOverThreshold[key]++
+			}
+		}
+		if len(h.Alerts) > 0 {
+			agg.HostsOverThreshold["any"]++
+		}
+
+		// Only hosts with current data contribute to resource statistics
+		if h.Status != metrics.StatusOnline {
+			continue
+		}
+		reporting++
+		agg.AvgCPU += h.CPU
+		if h.CPU > agg.MaxCPU {
+			agg.MaxCPU = h.CPU
+		}
+		agg.TotalMemory += h.MemoryTotal
+		agg.UsedMemory += h.MemoryUsed
+		agg.AvgMemoryPercent += h.MemoryPercent
+		if h.DiskPercent > agg.MaxDiskPercent {
+			agg.MaxDiskPercent = h.DiskPercent
+		}
+	}
+	if reporting > 0 {
+		agg.AvgCPU /= float64(reporting)
+		agg.AvgMemoryPercent /= float64(reporting)
+	}
+	return agg
+}
+
+func topOffenders(hosts []fleetHost) map[string][]fleetOffender {
+	pick := func(value func(h *fleetHost) float64) []fleetOffender {
+		var online []fleetHost
+		for _, h := range hosts {
+			if h.Status == metrics.StatusOnline {
+				online = append(online, h)
+			}
+		}
+		sort.SliceStable(online, func(i, j int) bool { return value(&online[i]) > value(&online[j]) })
+		result := []fleetOffender{}
+		for i := 0; i < len(online) && i < fleetTopOffenders; i++ {
+			result = append(result, fleetOffender{ID: online[i].ID, Name: online[i].Name, Value: value(&online[i])})
+		}
+		return result
+	}
+	return map[string][]fleetOffender{
+		"cpu":    pick(func(h *fleetHost) float64 { return h.CPU }),
+		"memory": pick(func(h *fleetHost) float64 { return h.MemoryPercent }),
+		"disk":   pick(func(h *fleetHost) float64 { return h.DiskPercent }),
+		"load":   pick(func(h *fleetHost) float64 { return h.Load1 }),
+	}
+}
@@ -1,7 +1,7 @@
 package api
 
 import (
-
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,7 +11,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/user/server-moni/internal/auth"
+	"github.com/user/server-moni/internal/config"
 	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/mail"
 	"github.com/user/server-moni/internal/metrics"
 )
 
@@ -21,6 +24,10 @@ func RegisterRoutes(r *gin.Engine) {
 	// Public Auth Routes
 	api.POST("/auth/register", Register)
 	api.POST("/auth/login", Login)
+	api.POST("/auth/forgot-password", ForgotPassword)
+	api.POST("/auth/reset-password", ResetPassword)
+	api.GET("/auth/verify", VerifyEmail)
+	api.POST("/auth/verify/resend", ResendVerification)
 	
 	// Health Check
 	r.GET("/health", HealthCheck)
@@ -28,6 +35,7 @@ func RegisterRoutes(r *gin.Engine) {
 	
 	// Ingestion (Agent Push) - Validates System API Key internally
 	api.POST("/ingest", IngestMetrics)
+	api.POST("/inventory", UploadInventory)
 
 	// Protected Routes (User UI)
 	protected := api.Group("/")
@@ -36,9 +44,53 @@ func RegisterRoutes(r *gin.Engine) {
 		protected.GET("/systems", GetSystems)
 		protected.POST("/systems", AddSystem)
 		protected.DELETE("/systems/:id", DeleteSystem)
+		protected.GET("/systems/:id/tags", GetSystemTags)
+		protected.PUT("/systems/:id/tags", SetSystemTags)
+		protected.GET("/systems/:id/disk-history", GetDiskHistory)
+		protected.GET("/systems/:id/metric-history", GetMetricHistory)
+		protected.GET("/groups", GetGroups)
+		protected.POST("/groups", CreateGroup)
+		protected.PUT("/groups/:id", UpdateGroup)
+		protected.DELETE("/groups/:id", DeleteGroup)
 		protected.GET("/metrics", GetMetrics)
+		protected.GET("/fleet/summary", GetFleetSummary)
+		protected.GET("/capacity/forecast", GetCapacityForecast)
+		protected.GET("/certificates", GetCertificates)
+		protected.GET("/systems/:id/checks", GetChecks)
+		protected.POST("/systems/:id/checks", CreateCheck)
+		protected.PUT("/checks/:id", UpdateCheck)
+		protected.DELETE("/checks/:id", DeleteCheck)
+		protected.GET("/checks/:id/results", GetCheckResults)
+		protected.GET("/systems/:id/process-watches", GetProcessWatches)
+		protected.POST("/systems/:id/process-watches", CreateProcessWatch)
+		protected.PUT("/process-watches/:id", UpdateProcessWatch)
+		protected.DELETE("/process-watches/:id", DeleteProcessWatch)
+		protected.GET("/process-watches/:id/history", GetProcessHistory)
+		protected.GET("/systems/:id/inventory", GetInventory)
+		protected.GET("/packages", FindPackages)
+		protected.GET("/systems/:id/log-events", GetLogEvents)
+		protected.GET("/systems/:id/security", GetSecuritySummary)
+		protected.GET("/alerts", GetAlerts)
+		protected.GET("/alert-rules", GetAlertRules)
+		protected.POST("/alert-rules", CreateAlertRule)
+		protected.PUT("/alert-rules/:id", UpdateAlertRule)
+		protected.DELETE("/alert-rules/:id", DeleteAlertRule)
 		protected.GET("/systems/:id/proxy", ProxyRequest)
 		protected.POST("/auth/logout", Logout)
+		protected.POST("/auth/refresh", RefreshSession)
+		protected.POST("/auth/password", ChangePassword)
+		protected.GET("/auth/sessions", GetSessions)
+		protected.DELETE("/auth/sessions", RevokeSessions)
+		protected.DELETE("/auth/sessions/:id", RevokeSession)
+		protected.GET("/audit", GetAuditLog)
+		protected.GET("/audit/export", ExportAuditLog)
+	}
+
+	admin := protected.Group("/admin")
+	admin.Use(auth.AdminMiddleware())
+	{
+		admin.GET("/backup", DownloadBackup)
+		admin.GET("/export", DownloadExport)
 	}
 }
 
@@ -58,11 +110,18 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	if err := auth.Register(req.Email, req.Password); err != nil {
+	if err := auth.Register(req.Email, req.Password, publicBaseURL(c)); err != nil {
+		recordAudit(c, auditEvent{Actor: req.Email, Action: AuditRegister, Err: err})
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user (email might be taken)"})
 		return
 	}
 
+	recordAudit(c, auditEvent{UserID: userIDForEmail(req.Email), Action: AuditRegister})
+
+	if config.AppConfig.RequireEmailVerification {
+		c.JSON(http.StatusOK, gin.H{"status": "verification_required"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"status": "registered"})
 }
 
@@ -70,32 +129,262 @@ func Login(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Cookie   bool   `json:"cookie"` // Use an HttpOnly cookie session instead of a bearer token
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	token, err := auth.Login(req.Email, req.Password)
+	session, err := auth.Login(req.Email, req.Password, c.ClientIP(), c.Request.UserAgent())
+	if errors.Is(err, auth.ErrEmailNotVerified) {
+		recordAudit(c, auditEvent{UserID: userIDForEmail(req.Email), Actor: req.Email, Action: AuditLogin, Err: err})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
 	if err != nil {
+		recordAudit(c, auditEvent{UserID: userIDForEmail(req.Email), Actor: req.Email, Action: AuditLogin, Err: err, Details: "invalid credentials"})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	recordAudit(c, auditEvent{UserID: session.UserID, Action: AuditLogin, TargetType: "session", TargetID: session.ID})
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	respondSession(c, session, req.Cookie)
+}
+
+// RefreshSession rotates the caller's session token and extends its expiry.
+func RefreshSession(c *gin.Context) {
+	current := c.MustGet("session").(*db.Session)
+	_, fromCookie, _ := auth.RequestToken(c)
+
+	session, err := auth.Refresh(current, c.ClientIP(), c.Request.UserAgent())
+	recordAudit(c, auditEvent{Action: AuditRefresh, TargetType: "session", TargetID: current.ID, Err: err})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	respondSession(c, session, fromCookie)
+}
+
+func respondSession(c *gin.Context, session *db.Session, cookie bool) {
+	if cookie {
+		auth.SetSessionCookies(c, session)
+		c.JSON(http.StatusOK, gin.H{
+			"session_id": session.ID,
+			"csrf_token": session.CSRFToken,
+			"expires_at": session.ExpiresAt,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":      session.Token,
+		"session_id": session.ID,
+		"expires_at": session.ExpiresAt,
+	})
 }
 
 func Logout(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader != "" {
-		parts := strings.Split(authHeader, " ")
-		if len(parts) == 2 {
-			auth.Logout(parts[1])
+	if token, fromCookie, ok := auth.RequestToken(c); ok {
+		err := auth.Logout(token)
+		recordAudit(c, auditEvent{Action: AuditLogout, Err: err})
+		if fromCookie {
+			auth.ClearSessionCookies(c)
 		}
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "logged out"})
 }
 
+// GetSessions lists the caller's active sessions.
+func GetSessions(c *gin.Context) {
+	userID := c.GetInt("userID")
+	current := c.MustGet("session").(*db.Session)
+
+	sessions, err := db.GlobalStore.GetUserSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	type sessionView struct {
+		db.Session
+		Current bool `json:"current"`
+	}
+	views := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		views = append(views, sessionView{Session: s, Current: s.ID == current.ID})
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+// RevokeSession ends one of the caller's sessions by ID.
+func RevokeSession(c *gin.Context) {
+	userID := c.GetInt("userID")
+	found, err := db.GlobalStore.DeleteUserSession(userID, c.Param("id"))
+	if err != nil {
+		recordAudit(c, auditEvent{Action: AuditSessionRevoke, TargetType: "session", TargetID: c.Param("id"), Err: err})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	recordAudit(c, auditEvent{Action: AuditSessionRevoke, TargetType: "session", TargetID: c.Param("id")})
+	c.Status(http.StatusOK)
+}
+
+// RevokeSessions ends all of the caller's sessions. With ?keep_current=true
+// the session making the request survives.
+func RevokeSessions(c *gin.Context) {
+	userID := c.GetInt("userID")
+	current := c.MustGet("session").(*db.Session)
+
+	except := ""
+	if c.Query("keep_current") == "true" {
+		except = current.ID
+	}
+
+	n, err := db.GlobalStore.DeleteUserSessions(userID, except)
+	recordAudit(c, auditEvent{Action: AuditSessionsRevoke, Details: fmt.Sprintf("%d sessions", n), Err: err})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	if except == "" {
+		if _, fromCookie, _ := auth.RequestToken(c); fromCookie {
+			auth.ClearSessionCookies(c)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": n})
+}
+
+// ChangePassword updates the caller's password. Other sessions are revoked.
+func ChangePassword(c *gin.Context) {
+	userID := c.GetInt("userID")
+	current := c.MustGet("session").(*db.Session)
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := auth.ChangePassword(userID, current.ID, req.CurrentPassword, req.NewPassword)
+	recordAudit(c, auditEvent{Action: AuditPasswordChange, Err: err})
+	switch {
+	case errors.Is(err, auth.ErrInvalidPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrWeakPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": "password changed"})
+	}
+}
+
+// ForgotPassword emails a reset link. The response is the same whether or
+// not the address has an account.
+func ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !mail.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Email delivery is not configured"})
+		return
+	}
+
+	err := auth.RequestPasswordReset(req.Email, publicBaseURL(c))
+	if err != nil {
+		logger.Error("Failed to send password reset", "error", err)
+	}
+	if id := userIDForEmail(req.Email); id != 0 {
+		recordAudit(c, auditEvent{UserID: id, Action: AuditPasswordForgot, Err: err})
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "If the account exists, a reset link has been sent"})
+}
+
+func ResetPassword(c *gin.Context) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := auth.ResetPassword(req.Token, req.NewPassword)
+	recordAudit(c, auditEvent{UserID: userID, Action: AuditPasswordReset, Err: err})
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrWeakPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": "password reset"})
+	}
+}
+
+func VerifyEmail(c *gin.Context) {
+	userID, err := auth.VerifyEmail(c.Query("token"))
+	recordAudit(c, auditEvent{UserID: userID, Action: AuditEmailVerify, Err: err})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "verified"})
+}
+
+func ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !mail.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Email delivery is not configured"})
+		return
+	}
+
+	if user, err := db.GlobalStore.GetUserByEmail(req.Email); err == nil && !user.EmailVerified {
+		if err := auth.SendVerification(user.ID, user.Email, publicBaseURL(c)); err != nil {
+			logger.Error("Failed to send verification email", "user_id", user.ID, "error", err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "If the account needs verification, an email has been sent"})
+}
+
+// userIDForEmail returns the ID of the account with the given email, or 0.
+func userIDForEmail(email string) int {
+	if u, err := db.GlobalStore.GetUserByEmail(email); err == nil {
+		return u.ID
+	}
+	return 0
+}
+
+// publicBaseURL returns the configured public URL, or the scheme and host
+// the request was made to.
+func publicBaseURL(c *gin.Context) string {
+	if config.AppConfig.PublicURL != "" {
+		return config.AppConfig.PublicURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
 // System Handlers
 
 func AddSystem(c *gin.Context) {
@@ -110,7 +399,8 @@ func AddSystem(c *gin.Context) {
 		return
 	}
 
-	id, err := db.AddSystem(userID, req.Name, req.URL, strings.TrimSpace(req.APIKey))
+	id, err := db.GlobalStore.AddSystem(userID, req.Name, req.URL, strings.TrimSpace(req.APIKey))
+	recordAudit(c, auditEvent{Action: AuditSystemCreate, TargetType: "system", TargetID: strconv.FormatInt(id, 10), Details: req.Name, Err: err})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add system"})
 		return
@@ -121,11 +411,20 @@ func AddSystem(c *gin.Context) {
 
 func GetSystems(c *gin.Context) {
 	userID := c.GetInt("userID")
-	systems, err := db.GetSystems(userID)
+	filter, err := parseSystemFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	systems, err := db.GlobalStore.GetSystems(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch systems"})
 		return
 	}
+	if filter.Active() {
+		systems = filter.Apply(systems)
+	}
 	c.JSON(http.StatusOK, systems)
 }
 
@@ -138,10 +437,15 @@ func DeleteSystem(c *gin.Context) {
 		return
 	}
 
-	if err := db.DeleteSystem(id, userID); err != nil {
+	err = db.GlobalStore.DeleteSystem(id, userID)
+	recordAudit(c, auditEvent{Action: AuditSystemDelete, TargetType: "system", TargetID: idStr, Err: err})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete system"})
 		return
 	}
+	forgetDiskHistory(id)
+	forgetMetricHistory(id)
+	forgetProcessHistory(id)
 	c.Status(http.StatusOK)
 }
 
@@ -149,7 +453,7 @@ func GetMetrics(c *gin.Context) {
 	userID := c.GetInt("userID")
 	systemIDStr := c.Query("system_id")
 	if systemIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "system_id is required"})
+		getFilteredMetrics(c)
 		return
 	}
 
@@ -159,7 +463,7 @@ func GetMetrics(c *gin.Context) {
 		return
 	}
 
-	system, err := db.GetSystem(systemID)
+	system, err := db.GlobalStore.GetSystem(systemID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "System not found"})
 		return
@@ -187,24 +491,63 @@ func GetMetrics(c *gin.Context) {
 	// ...
 }
 
-func IngestMetrics(c *gin.Context) {
+// getFilteredMetrics returns the latest metrics of every system matching
+// the selector/group query, keyed by system ID.
+func getFilteredMetrics(c *gin.Context) {
+	filter, err := parseSystemFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !filter.Active() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "system_id, selector or group is required"})
+		return
+	}
+
+	systems, err := db.GlobalStore.GetSystems(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch systems"})
+		return
+	}
+
+	result := make(map[string]metrics.SystemMetrics)
+	for _, s := range filter.Apply(systems) {
+		id := strconv.Itoa(s.ID)
+		if data, ok := metrics.GlobalStore.Get(id); ok {
+			result[id] = data
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// agentSystem returns the system whose API key the agent sent as a bearer
+// token, writing an error response if there is none.
+func agentSystem(c *gin.Context) (*db.System, bool) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
-		return
+		return nil, false
 	}
 
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header format"})
-		return
+		return nil, false
 	}
 	apiKey := parts[1]
 
 	// Validate API Key
-	system, err := db.GetSystemByAPIKey(apiKey)
+	system, err := db.GlobalStore.GetSystemByAPIKey(apiKey)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API Key"})
+		return nil, false
+	}
+	return system, true
+}
+
+func IngestMetrics(c *gin.Context) {
+	system, ok := agentSystem(c)
+	if !ok {
 		return
 	}
 
@@ -214,10 +557,34 @@ func IngestMetrics(c *gin.Context) {
 		return
 	}
 
+	auditIngestSource(c, system)
+	auditNewListeners(c, system, &metricsData)
+	if metricsData.Tags != nil {
+		syncAgentTags(system, metricsData.Tags)
+	}
+	checkResults := metricsData.CheckResults
+	metricsData.CheckResults = nil
+	logEvents := metricsData.LogEvents
+	metricsData.LogEvents = nil
+	watches, watchErr := syncProcessWatches(system.ID, &metricsData)
+
 	// Update Store
 	metrics.GlobalStore.Update(strconv.Itoa(system.ID), metricsData)
+	recordDiskHistory(system.ID, metricsData)
+	recordMetricHistory(system.ID, metricsData)
+	recordLogEvents(system.ID, logEvents)
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	// Agents replace their checks and process watches with the lists in the
+	// response; leave a list out if it cannot be loaded so they keep the
+	// current one
+	resp := gin.H{"status": "ok"}
+	if defs, err := syncChecks(system.ID, checkResults); err == nil {
+		resp["checks"] = defs
+	}
+	if watchErr == nil {
+		resp["process_watches"] = watches
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func ProxyRequest(c *gin.Context) {
@@ -235,7 +602,7 @@ func ProxyRequest(c *gin.Context) {
 		return
 	}
 
-	system, err := db.GetSystem(systemID)
+	system, err := db.GlobalStore.GetSystem(systemID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "System not found"})
 		return
@@ -277,6 +644,7 @@ func ProxyRequest(c *gin.Context) {
 	req.URL.RawQuery = q.Encode()
 
 	resp, err := client.Do(req)
+	recordAudit(c, auditEvent{Action: AuditSystemProxy, TargetType: "system", TargetID: systemIDStr, Details: path, Err: err})
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to connect to agent: %v", err)})
 		return
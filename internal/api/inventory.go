@@ -0,0 +1,191 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/inventory"
+	"github.com/user/server-moni/internal/logger"
+)
+
+const (
+	maxInventoryBytes    = 32 << 20
+	maxInventoryPackages = 100000
+)
+
+// UploadInventory replaces the software inventory of the agent's system.
+// Agents upload it when they collect a new one, see internal/inventory.
+//
+//	POST /api/v1/inventory
+func UploadInventory(c *gin.Context) {
+	system, ok := agentSystem(c)
+	if !ok {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxInventoryBytes)
+	var inv inventory.Inventory
+	if err := c.BindJSON(&inv); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch inv.Manager {
+	case inventory.ManagerDpkg, inventory.ManagerRPM, inventory.ManagerAPK:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "manager must be dpkg, rpm or apk"})
+		return
+	}
+	if len(inv.Packages) > maxInventoryPackages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many packages"})
+		return
+	}
+	if inv.CollectedAt.IsZero() {
+		inv.CollectedAt = time.Now().UTC()
+	}
+
+	packages := make([]db.InstalledPackage, 0, len(inv.Packages))
+	for _, p := range inv.Packages {
+		if p.Name == "" || p.Version == "" {
+			continue
+		}
+		packages = append(packages, db.InstalledPackage{
+			Name:      p.Name,
+			Version:   p.Version,
+			Arch:      p.Arch,
+			Available: p.Available,
+			Security:  p.Security,
+		})
+	}
+	err := db.GlobalStore.SaveInventory(&db.SoftwareInventory{
+		SystemID:        system.ID,
+		CollectedAt:     inv.CollectedAt,
+		Manager:         inv.Manager,
+		PendingUpdates:  inv.PendingUpdates,
+		SecurityUpdates: inv.SecurityUpdates,
+		UpdatesError:    inv.UpdatesError,
+		RunningKernel:   inv.RunningKernel,
+		InstalledKernel: inv.InstalledKernel,
+		RebootRequired:  inv.RebootRequired,
+	}, packages)
+	if err != nil {
+		logger.Error("Failed to save inventory", "system_id", system.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save inventory"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "packages": len(packages)})
+}
+
+// GetInventory returns the latest inventory of a system with its packages,
+// optionally only those whose name contains a string or with a pending
+// update.
+//
+//	GET /api/v1/systems/:id/inventory?name=ssl&updates=true
+func GetInventory(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	inv, err := db.GlobalStore.GetInventory(system.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No inventory uploaded yet"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
+		return
+	}
+	packages, err := db.GlobalStore.GetInstalledPackages(system.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch packages"})
+		return
+	}
+	name := strings.TrimSpace(c.Query("name"))
+	updatesOnly := c.Query("updates") == "true"
+	if name != "" || updatesOnly {
+		matched := []db.InstalledPackage{}
+		for _, p := range packages {
+			if strings.Contains(p.Name, name) && (!updatesOnly || p.Available != "") {
+				matched = append(matched, p)
+			}
+		}
+		packages = matched
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"inventory": inv,
+		"packages":  packages,
+	})
+}
+
+type systemPackage struct {
+	SystemName string `json:"system_name"`
+	Manager    string `json:"manager"`
+	db.InstalledPackage
+}
+
+// FindPackages lists the systems that have a package installed, optionally
+// only those with a version older than below, compared by the rules of
+// each system's package manager. Systems can be filtered like for
+// /metrics.
+//
+//	GET /api/v1/packages?name=openssl&below=3.0.13&selector=env=prod&group=web
+func FindPackages(c *gin.Context) {
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	below := strings.TrimSpace(c.Query("below"))
+	filter, err := parseSystemFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt("userID")
+	systems, err := db.GlobalStore.GetSystems(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch systems"})
+		return
+	}
+	selected := make(map[int]string)
+	for _, s := range filter.Apply(systems) {
+		selected[s.ID] = s.Name
+	}
+	packages, err := db.GlobalStore.FindInstalledPackages(userID, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch packages"})
+		return
+	}
+
+	managers := make(map[int]string)
+	result := []systemPackage{}
+	for _, p := range packages {
+		systemName, ok := selected[p.SystemID]
+		if !ok {
+			continue
+		}
+		manager, ok := managers[p.SystemID]
+		if !ok {
+			if inv, err := db.GlobalStore.GetInventory(p.SystemID); err == nil {
+				manager = inv.Manager
+			}
+			managers[p.SystemID] = manager
+		}
+		if below != "" && inventory.Compare(manager, p.Version, below) >= 0 {
+			continue
+		}
+		result = append(result, systemPackage{SystemName: systemName, Manager: manager, InstalledPackage: p})
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].SystemName < result[j].SystemName })
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":     name,
+		"below":    below,
+		"packages": result,
+	})
+}
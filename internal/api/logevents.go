@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/logtail"
+)
+
+const (
+	defaultLogEventHours = 24
+	defaultLogEventLimit = 200
+	maxLogEventLimit     = 5000
+	// maxIngestLogEvents caps the events stored from one ingest, as many as
+	// an agent buffers.
+	maxIngestLogEvents = logtail.MaxPending
+	// maxSecurityLogins is how many of the latest logins the security
+	// summary lists.
+	maxSecurityLogins = 50
+)
+
+// recordLogEvents stores the events an agent extracted from its logs since
+// its previous ingest.
+func recordLogEvents(systemID int, events []logtail.Event) {
+	if len(events) > maxIngestLogEvents {
+		events = events[len(events)-maxIngestLogEvents:]
+	}
+	now := time.Now().UTC()
+	rows := make([]db.LogEvent, 0, len(events))
+	for _, e := range events {
+		if e.Source == "" || e.Event == "" {
+			continue
+		}
+		// Agent clocks can be off; never store events from the future
+		at := e.Time
+		if at.IsZero() || at.After(now) {
+			at = now
+		}
+		rows = append(rows, db.LogEvent{
+			SystemID:  systemID,
+			Timestamp: at,
+			Source:    e.Source,
+			Event:     e.Event,
+			Fields:    e.Fields,
+			Message:   e.Message,
+		})
+	}
+	if len(rows) == 0 {
+		return
+	}
+	if err := db.GlobalStore.AddLogEvents(rows); err != nil {
+		logger.Warn("Failed to save log events", "system_id", systemID, "error", err)
+	}
+}
+
+// sinceHours returns the start of the window given by the hours parameter,
+// responding with an error if it is invalid.
+func sinceHours(c *gin.Context, def int) (time.Time, bool) {
+	hours := def
+	if v := c.Query("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be a positive number"})
+			return time.Time{}, false
+		}
+		hours = n
+	}
+	return time.Now().UTC().Add(-time.Duration(hours) * time.Hour), true
+}
+
+// GetLogEvents returns the latest events extracted from the logs of a
+// system, optionally of one source and of some event types.
+//
+//	GET /api/v1/systems/:id/log-events?source=auth&event=login_failed,invalid_user&hours=24&limit=200
+func GetLogEvents(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	since, ok := sinceHours(c, defaultLogEventHours)
+	if !ok {
+		return
+	}
+	q := db.LogEventQuery{
+		Since:  since,
+		Source: strings.TrimSpace(c.Query("source")),
+		Events: splitQueryList(c.Query("event")),
+		Limit:  defaultLogEventLimit,
+	}
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= maxLogEventLimit {
+		q.Limit = v
+	}
+	events, err := db.GlobalStore.GetLogEvents(system.ID, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch log events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"since":  since,
+		"limit":  q.Limit,
+		"events": events,
+	})
+}
+
+type fail2BanSummary struct {
+	TotalBans int            `json:"total_bans"`
+	BansByIP  map[string]int `json:"bans_by_ip"`
+	Jails     []string       `json:"jails"`
+}
+
+type authLog struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	IP      string    `json:"ip"`
+	Message string    `json:"message"`
+	Success bool      `json:"success"`
+}
+
+// GetSecuritySummary summarizes the fail2ban bans and lists the latest SSH
+// logins of a system, from the events of the auth and fail2ban presets of
+// any of its log sources.
+//
+//	GET /api/v1/systems/:id/security?hours=24
+func GetSecuritySummary(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	since, ok := sinceHours(c, defaultLogEventHours)
+	if !ok {
+		return
+	}
+	bans, err := db.GlobalStore.GetLogEvents(system.ID, db.LogEventQuery{Since: since, Events: []string{logtail.EventBan}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch log events"})
+		return
+	}
+	logins, err := db.GlobalStore.GetLogEvents(system.ID, db.LogEventQuery{
+		Since:  since,
+		Events: []string{logtail.EventLoginAccepted, logtail.EventLoginFailed, logtail.EventInvalidUser},
+		Limit:  maxSecurityLogins,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch log events"})
+		return
+	}
+
+	fail2ban := fail2BanSummary{BansByIP: make(map[string]int), Jails: []string{}}
+	jails := make(map[string]bool)
+	for _, e := range bans {
+		fail2ban.TotalBans++
+		if ip := e.Fields["ip"]; ip != "" {
+			fail2ban.BansByIP[ip]++
+		}
+		if jail := e.Fields["jail"]; jail != "" && !jails[jail] {
+			jails[jail] = true
+			fail2ban.Jails = append(fail2ban.Jails, jail)
+		}
+	}
+	sort.Strings(fail2ban.Jails)
+
+	auth := make([]authLog, 0, len(logins))
+	for _, e := range logins {
+		auth = append(auth, authLog{
+			Time:    e.Timestamp,
+			User:    e.Fields["user"],
+			IP:      e.Fields["ip"],
+			Message: e.Message,
+			Success: e.Event == logtail.EventLoginAccepted,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"since":    since,
+		"fail2ban": fail2ban,
+		"logins":   auth,
+	})
+}
+
+// splitQueryList splits a comma separated query parameter, dropping empty
+// items.
+func splitQueryList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
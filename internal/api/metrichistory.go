@@ -0,0 +1,201 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/anomaly"
+	"github.com/user/server-moni/internal/config"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/metrics"
+)
+
+const defaultMetricHistoryHours = 24
+
+var (
+	metricSampleMu   sync.Mutex
+	lastMetricSample = make(map[int]time.Time)
+)
+
+// recordMetricHistory stores the headline metrics of a system once per
+// config.AppConfig.MetricHistoryInterval, aligned to UTC.
+func recordMetricHistory(systemID int, m metrics.SystemMetrics) {
+	interval := config.AppConfig.MetricHistoryInterval
+	if interval <= 0 {
+		return
+	}
+	now := time.Now().UTC()
+
+	metricSampleMu.Lock()
+	if !lastMetricSample[systemID].Before(now.Truncate(interval)) {
+		metricSampleMu.Unlock()
+		return
+	}
+	last := lastMetricSample[systemID]
+	lastMetricSample[systemID] = now
+	metricSampleMu.Unlock()
+
+	values := metrics.HistoryValues(m)
+	samples := make([]db.MetricSample, 0, len(values))
+	for _, name := range metrics.HistoryMetrics {
+		if v, ok := values[name]; ok {
+			samples = append(samples, db.MetricSample{SystemID: systemID, Metric: name, Timestamp: now, Value: v})
+		}
+	}
+	if err := db.GlobalStore.AddMetricSamples(samples); err != nil {
+		logger.Warn("Failed to save metric history", "system_id", systemID, "error", err)
+		// Retry on the next ingest
+		metricSampleMu.Lock()
+		lastMetricSample[systemID] = last
+		metricSampleMu.Unlock()
+	}
+}
+
+func forgetMetricHistory(systemID int) {
+	metricSampleMu.Lock()
+	delete(lastMetricSample, systemID)
+	metricSampleMu.Unlock()
+}
+
+// StartHistorySweeper deletes metric samples, check results, process
+// samples and log events older than the retention period every hour.
+func StartHistorySweeper(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		for range ticker.C {
+			cutoff := time.Now().Add(-retention)
+			n, err := db.GlobalStore.DeleteMetricSamplesBefore(cutoff)
+			if err != nil {
+				logger.Error("Failed to sweep metric history", "error", err)
+			} else if n > 0 {
+				logger.Info("Swept metric history", "count", n)
+			}
+			n, err = db.GlobalStore.DeleteCheckResultsBefore(cutoff)
+			if err != nil {
+				logger.Error("Failed to sweep check results", "error", err)
+			} else if n > 0 {
+				logger.Info("Swept check results", "count", n)
+			}
+			n, err = db.GlobalStore.DeleteProcessSamplesBefore(cutoff)
+			if err != nil {
+				logger.Error("Failed to sweep process history", "error", err)
+			} else if n > 0 {
+				logger.Info("Swept process history", "count", n)
+			}
+			n, err = db.GlobalStore.DeleteLogEventsBefore(cutoff)
+			if err != nil {
+				logger.Error("Failed to sweep log events", "error", err)
+			} else if n > 0 {
+				logger.Info("Swept log events", "count", n)
+			}
+		}
+	}()
+}
+
+// GetMetricHistory returns the stored samples of one metric of a system,
+// each scored by the anomaly detector.
+//
+//	GET /api/v1/systems/:id/metric-history?metric=cpu&hours=24&detector=rolling&sigma=3&window=30&min_samples=10
+func GetMetricHistory(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	metric := c.Query("metric")
+	if !metrics.IsHistoryMetric(metric) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "metric must be one of " + strings.Join(metrics.HistoryMetrics, ", ")})
+		return
+	}
+	hours := defaultMetricHistoryHours
+	if v := c.Query("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be a positive number"})
+			return
+		}
+		hours = n
+	}
+	opts, ok := bindAnomalyOptions(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	since := now.Add(-time.Duration(hours) * time.Hour)
+	// Load enough history before the range to score its first samples
+	from := since.Add(-2 * time.Duration(opts.Window) * config.AppConfig.MetricHistoryInterval)
+	if opts.Detector == anomaly.DetectorSeasonal {
+		from = now.Add(-config.AppConfig.MetricHistoryRetention)
+	}
+	samples, err := db.GlobalStore.GetMetricSamples(system.ID, metric, from, time.Time{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch metric history"})
+		return
+	}
+
+	points := make([]anomaly.Point, len(samples))
+	for i, s := range samples {
+		points[i] = anomaly.Point{Time: s.Timestamp, Value: s.Value}
+	}
+	scores := []anomaly.Score{}
+	anomalies := 0
+	for _, s := range anomaly.Detect(points, opts) {
+		if s.Timestamp.Before(since) {
+			continue
+		}
+		if s.Anomaly {
+			anomalies++
+		}
+		scores = append(scores, s)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"system_id": system.ID,
+		"metric":    metric,
+		"interval":  config.AppConfig.MetricHistoryInterval.String(),
+		"since":     since,
+		"detector":  opts,
+		"anomalies": anomalies,
+		"samples":   scores,
+	})
+}
+
+// bindAnomalyOptions reads detector, sigma, window and min_samples from the
+// query on top of anomaly.DefaultOptions, writing an error response if they
+// are invalid.
+func bindAnomalyOptions(c *gin.Context) (anomaly.Options, bool) {
+	opts := anomaly.DefaultOptions()
+	if v := c.Query("detector"); v != "" {
+		opts.Detector = v
+	}
+	var err error
+	if v := c.Query("sigma"); v != "" {
+		if opts.Sigma, err = strconv.ParseFloat(v, 64); err != nil {
+			opts.Sigma = 0
+		}
+	}
+	if v := c.Query("window"); v != "" {
+		if opts.Window, err = strconv.Atoi(v); err != nil {
+			opts.Window = 0
+		}
+	}
+	if v := c.Query("min_samples"); v != "" {
+		if opts.MinSamples, err = strconv.Atoi(v); err != nil {
+			opts.MinSamples = 0
+		}
+	}
+	// Unparsable numbers are zeroed above and rejected here
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return opts, false
+	}
+	return opts, true
+}
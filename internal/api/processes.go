@@ -0,0 +1,278 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/config"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/metrics"
+	"github.com/user/server-moni/internal/procwatch"
+)
+
+const (
+	AuditProcessWatchCreate = "process_watch.create"
+	AuditProcessWatchUpdate = "process_watch.update"
+	AuditProcessWatchDelete = "process_watch.delete"
+)
+
+const defaultProcessHistoryHours = 24
+
+var (
+	processSampleMu   sync.Mutex
+	lastProcessSample = make(map[int]time.Time)
+)
+
+// bindProcessWatch parses and validates a watch body, writing an error
+// response if it is invalid.
+func bindProcessWatch(c *gin.Context) (*db.ProcessWatch, bool) {
+	var w procwatch.Watch
+	if err := c.BindJSON(&w); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err := w.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &db.ProcessWatch{Name: w.Name, Process: w.Process, Cmdline: w.Cmdline, User: w.User, PIDFile: w.PIDFile}, true
+}
+
+// syncProcessWatches drops the stats an agent sent for watches its system
+// no longer has, records the rest once per
+// config.AppConfig.MetricHistoryInterval and returns the watches the agent
+// should report from now on.
+func syncProcessWatches(systemID int, m *metrics.SystemMetrics) ([]procwatch.Watch, error) {
+	stored, err := db.GlobalStore.GetProcessWatches(systemID)
+	if err != nil {
+		logger.Warn("Failed to load process watches", "system_id", systemID, "error", err)
+		return nil, err
+	}
+
+	known := make(map[int]bool, len(stored))
+	watches := make([]procwatch.Watch, 0, len(stored))
+	for _, w := range stored {
+		known[w.ID] = true
+		watches = append(watches, procwatch.Watch{ID: w.ID, Name: w.Name, Process: w.Process, Cmdline: w.Cmdline, User: w.User, PIDFile: w.PIDFile})
+	}
+	reported := m.WatchedProcesses[:0]
+	for _, s := range m.WatchedProcesses {
+		if known[s.WatchID] {
+			reported = append(reported, s)
+		}
+	}
+	m.WatchedProcesses = reported
+	recordProcessHistory(systemID, reported)
+	return watches, nil
+}
+
+// recordProcessHistory stores the stats of the watches of a system once per
+// config.AppConfig.MetricHistoryInterval, like recordMetricHistory.
+func recordProcessHistory(systemID int, stats []procwatch.Stats) {
+	interval := config.AppConfig.MetricHistoryInterval
+	if interval <= 0 || len(stats) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+
+	processSampleMu.Lock()
+	if !lastProcessSample[systemID].Before(now.Truncate(interval)) {
+		processSampleMu.Unlock()
+		return
+	}
+	last := lastProcessSample[systemID]
+	lastProcessSample[systemID] = now
+	processSampleMu.Unlock()
+
+	samples := make([]db.ProcessSample, 0, len(stats))
+	for _, s := range stats {
+		samples = append(samples, db.ProcessSample{
+			WatchID:    s.WatchID,
+			SystemID:   systemID,
+			Timestamp:  now,
+			Instances:  s.Instances,
+			CPUPercent: s.CPUPercent,
+			RSSBytes:   s.RSSBytes,
+			Threads:    int(s.Threads),
+			OpenFDs:    int(s.OpenFDs),
+			ReadRate:   s.ReadRate,
+			WriteRate:  s.WriteRate,
+		})
+	}
+	if err := db.GlobalStore.AddProcessSamples(samples); err != nil {
+		logger.Warn("Failed to save process history", "system_id", systemID, "error", err)
+		// Retry on the next ingest
+		processSampleMu.Lock()
+		lastProcessSample[systemID] = last
+		processSampleMu.Unlock()
+	}
+}
+
+func forgetProcessHistory(systemID int) {
+	processSampleMu.Lock()
+	delete(lastProcessSample, systemID)
+	processSampleMu.Unlock()
+}
+
+// ownedProcessWatch loads the watch in the :id parameter, writing an error
+// response unless it belongs to a system of the caller.
+func ownedProcessWatch(c *gin.Context) (*db.ProcessWatch, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+	watch, err := db.GlobalStore.GetProcessWatch(id)
+	if err == nil {
+		var system *db.System
+		system, err = db.GlobalStore.GetSystem(watch.SystemID)
+		if err == nil && system.UserID != c.GetInt("userID") {
+			err = sql.ErrNoRows
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Process watch not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch process watch"})
+		return nil, false
+	}
+	return watch, true
+}
+
+type processWatchStatus struct {
+	db.ProcessWatch
+	Latest *procwatch.Stats `json:"latest"` // nil until the agent has reported it
+}
+
+// GetProcessWatches lists the watches of a system with the stats its agent
+// last reported for them.
+//
+//	GET /api/v1/systems/:id/process-watches
+func GetProcessWatches(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	stored, err := db.GlobalStore.GetProcessWatches(system.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch process watches"})
+		return
+	}
+	latest := make(map[int]procwatch.Stats)
+	if m, ok := metrics.GlobalStore.Get(strconv.Itoa(system.ID)); ok {
+		for _, s := range m.WatchedProcesses {
+			latest[s.WatchID] = s
+		}
+	}
+	list := make([]processWatchStatus, 0, len(stored))
+	for _, w := range stored {
+		status := processWatchStatus{ProcessWatch: w}
+		if s, ok := latest[w.ID]; ok {
+			status.Latest = &s
+		}
+		list = append(list, status)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func CreateProcessWatch(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	watch, ok := bindProcessWatch(c)
+	if !ok {
+		return
+	}
+	watch.SystemID = system.ID
+	id, err := db.GlobalStore.CreateProcessWatch(watch)
+	recordAudit(c, auditEvent{Action: AuditProcessWatchCreate, TargetType: "process_watch", TargetID: strconv.FormatInt(id, 10), Details: system.Name + ": " + watch.Name, Err: err})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create process watch"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func UpdateProcessWatch(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	watch, ok := bindProcessWatch(c)
+	if !ok {
+		return
+	}
+	watch.ID = id
+	err = db.GlobalStore.UpdateProcessWatch(watch, c.GetInt("userID"))
+	recordAudit(c, auditEvent{Action: AuditProcessWatchUpdate, TargetType: "process_watch", TargetID: c.Param("id"), Details: watch.Name, Err: err})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Process watch not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update process watch"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func DeleteProcessWatch(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	err = db.GlobalStore.DeleteProcessWatch(id, c.GetInt("userID"))
+	recordAudit(c, auditEvent{Action: AuditProcessWatchDelete, TargetType: "process_watch", TargetID: c.Param("id"), Err: err})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Process watch not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete process watch"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// GetProcessHistory returns the recorded stats of a watch over the last
+// hours.
+//
+//	GET /api/v1/process-watches/:id/history?hours=24
+func GetProcessHistory(c *gin.Context) {
+	watch, ok := ownedProcessWatch(c)
+	if !ok {
+		return
+	}
+	hours := defaultProcessHistoryHours
+	if v := c.Query("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be a positive number"})
+			return
+		}
+		hours = n
+	}
+	since := time.Now().UTC().Add(-time.Duration(hours) * time.Hour)
+	samples, err := db.GlobalStore.GetProcessSamples(watch.ID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch process history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"watch":    watch,
+		"since":    since,
+		"interval": config.AppConfig.MetricHistoryInterval.String(),
+		"samples":  samples,
+	})
+}
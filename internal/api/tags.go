@@ -0,0 +1,261 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/tags"
+)
+
+const (
+	AuditSystemTags  = "system.tags_update"
+	AuditGroupCreate = "group.create"
+	AuditGroupUpdate = "group.update"
+	AuditGroupDelete = "group.delete"
+)
+
+// systemFilter narrows a list of systems using the "selector" (tag selector
+// expression, e.g. env=prod,role!=db) and "group" (group name) query
+// parameters shared by the listing endpoints.
+type systemFilter struct {
+	selector *tags.Selector
+	group    string
+}
+
+func parseSystemFilter(c *gin.Context) (*systemFilter, error) {
+	sel, err := tags.ParseSelector(c.Query("selector"))
+	if err != nil {
+		return nil, err
+	}
+	return &systemFilter{selector: sel, group: strings.TrimSpace(c.Query("group"))}, nil
+}
+
+// Active reports whether the request asked for any filtering.
+func (f *systemFilter) Active() bool {
+	return !f.selector.Empty() || f.group != ""
+}
+
+func (f *systemFilter) Match(s *db.System) bool {
+	if f.group != "" {
+		found := false
+		for _, g := range s.Groups {
+			if g == f.group {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.selector.Matches(s.Tags)
+}
+
+func (f *systemFilter) Apply(systems []db.System) []db.System {
+	result := []db.System{}
+	for i := range systems {
+		if f.Match(&systems[i]) {
+			result = append(result, systems[i])
+		}
+	}
+	return result
+}
+
+// ownedSystem loads the system named by the :id parameter and checks that it
+// belongs to the caller, writing an error response if not.
+func ownedSystem(c *gin.Context) (*db.System, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+	system, err := db.GlobalStore.GetSystem(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "System not found"})
+		return nil, false
+	}
+	if system.UserID != c.GetInt("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return system, true
+}
+
+// Tag Handlers
+
+func GetSystemTags(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	userTags, err := db.GlobalStore.GetSystemTags(system.ID, db.TagSourceUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+	agentTags, err := db.GlobalStore.GetSystemTags(system.ID, db.TagSourceAgent)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user":      userTags,
+		"agent":     agentTags,
+		"effective": system.Tags,
+	})
+}
+
+// SetSystemTags replaces the user-defined tags of a system. Tags reported by
+// the agent are kept but overridden by user tags with the same key.
+func SetSystemTags(c *gin.Context) {
+	system, ok := ownedSystem(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Tags map[string]string `json:"tags"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for k, v := range req.Tags {
+		if err := tags.Validate(k, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := db.GlobalStore.SetSystemTags(system.ID, db.TagSourceUser, req.Tags)
+	recordAudit(c, auditEvent{Action: AuditSystemTags, TargetType: "system", TargetID: strconv.Itoa(system.ID), Details: tags.Format(req.Tags), Err: err})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tags"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// agentTagCache holds the last tag set each agent reported so the database
+// is only written when it changes.
+var agentTagCache sync.Map // system ID -> formatted tags
+
+func syncAgentTags(system *db.System, reported map[string]string) {
+	valid := make(map[string]string, len(reported))
+	for k, v := range reported {
+		if err := tags.Validate(k, v); err == nil {
+			valid[k] = v
+		}
+	}
+	formatted := tags.Format(valid)
+	if prev, ok := agentTagCache.Load(system.ID); ok && prev.(string) == formatted {
+		return
+	}
+	if err := db.GlobalStore.SetSystemTags(system.ID, db.TagSourceAgent, valid); err != nil {
+		logger.Error("Failed to store agent tags", "system_id", system.ID, "error", err)
+		return
+	}
+	agentTagCache.Store(system.ID, formatted)
+}
+
+// Group Handlers
+
+func GetGroups(c *gin.Context) {
+	groups, err := db.GlobalStore.GetGroups(c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+type groupRequest struct {
+	Name      string `json:"name"`
+	SystemIDs []int  `json:"system_ids"`
+}
+
+// bindGroup parses a group body and checks that every member system belongs
+// to the caller.
+func bindGroup(c *gin.Context) (*groupRequest, bool) {
+	var req groupRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return nil, false
+	}
+	userID := c.GetInt("userID")
+	for _, id := range req.SystemIDs {
+		s, err := db.GlobalStore.GetSystem(id)
+		if err != nil || s.UserID != userID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown system " + strconv.Itoa(id)})
+			return nil, false
+		}
+	}
+	return &req, true
+}
+
+func CreateGroup(c *gin.Context) {
+	req, ok := bindGroup(c)
+	if !ok {
+		return
+	}
+	id, err := db.GlobalStore.CreateGroup(c.GetInt("userID"), req.Name, req.SystemIDs)
+	recordAudit(c, auditEvent{Action: AuditGroupCreate, TargetType: "group", TargetID: strconv.FormatInt(id, 10), Details: req.Name, Err: err})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group (name might be taken)"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+func UpdateGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	req, ok := bindGroup(c)
+	if !ok {
+		return
+	}
+	err = db.GlobalStore.UpdateGroup(id, c.GetInt("userID"), req.Name, req.SystemIDs)
+	recordAudit(c, auditEvent{Action: AuditGroupUpdate, TargetType: "group", TargetID: c.Param("id"), Details: req.Name, Err: err})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func DeleteGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	err = db.GlobalStore.DeleteGroup(id, c.GetInt("userID"))
+	recordAudit(c, auditEvent{Action: AuditGroupDelete, TargetType: "group", TargetID: c.Param("id"), Err: err})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
+	"github.com/user/server-moni/internal/mail"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinPasswordLength = 8
+
+	resetTokenTTL  = time.Hour
+	verifyTokenTTL = 48 * time.Hour
+)
+
+var (
+	ErrInvalidPassword  = errors.New("current password is incorrect")
+	ErrWeakPassword     = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrInvalidToken     = errors.New("token is invalid or has expired")
+	ErrEmailNotVerified = errors.New("email address has not been verified")
+)
+
+// ChangePassword replaces the password of a logged in user after checking
+// the current one. All other sessions of the user are revoked.
+func ChangePassword(userID int, currentSessionID, current, next string) error {
+	user, err := db.GlobalStore.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)); err != nil {
+		return ErrInvalidPassword
+	}
+	if err := SetPassword(userID, next); err != nil {
+		return err
+	}
+	_, err = db.GlobalStore.DeleteUserSessions(userID, currentSessionID)
+	return err
+}
+
+// SetPassword hashes and stores a new password without any further checks
+// beyond the minimum length.
+func SetPassword(userID int, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return db.GlobalStore.UpdateUserPassword(userID, string(hashed))
+}
+
+// RequestPasswordReset mails a single-use reset link if the email belongs to
+// an account. Unknown addresses are silently ignored so the endpoint cannot
+// be used to discover accounts.
+func RequestPasswordReset(email, baseURL string) error {
+	user, err := db.GlobalStore.GetUserByEmail(email)
+	if err != nil {
+		logger.Info("Password reset requested for unknown email")
+		return nil
+	}
+
+	if err := db.GlobalStore.InvalidateUserTokens(user.ID, db.TokenPasswordReset); err != nil {
+		return err
+	}
+	token, err := issueUserToken(user.ID, db.TokenPasswordReset, resetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(baseURL, "/") + "/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("A password reset was requested for your Server Monitor account.\n\n"+
+		"Open the link below within %s to choose a new password:\n\n%s\n\n"+
+		"If you did not request this, you can ignore this email.\n", resetTokenTTL, link)
+	return mail.Send(user.Email, "Reset your Server Monitor password", body)
+}
+
+// ResetPassword sets a new password using a reset token and revokes every
+// session of the account. It returns the ID of the account, if the token
+// identified one.
+func ResetPassword(token, password string) (int, error) {
+	if len(password) < MinPasswordLength {
+		return 0, ErrWeakPassword
+	}
+	userID, err := db.GlobalStore.ConsumeUserToken(hashToken(token), db.TokenPasswordReset)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	if err := SetPassword(userID, password); err != nil {
+		return userID, err
+	}
+	_, err = db.GlobalStore.DeleteUserSessions(userID, "")
+	return userID, err
+}
+
+// SendVerification mails an email verification link to the user.
+func SendVerification(userID int, email, baseURL string) error {
+	if err := db.GlobalStore.InvalidateUserTokens(userID, db.TokenEmailVerify); err != nil {
+		return err
+	}
+	token, err := issueUserToken(userID, db.TokenEmailVerify, verifyTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(baseURL, "/") + "/api/v1/auth/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Welcome to Server Monitor.\n\nConfirm your email address by opening the link below:\n\n%s\n", link)
+	return mail.Send(email, "Verify your Server Monitor email", body)
+}
+
+// VerifyEmail marks the owner of a verification token as verified and
+// returns their ID.
+func VerifyEmail(token string) (int, error) {
+	userID, err := db.GlobalStore.ConsumeUserToken(hashToken(token), db.TokenEmailVerify)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return userID, db.GlobalStore.SetEmailVerified(userID)
+}
+
+// GeneratePassword returns a random password suitable for handing to a user
+// who is expected to change it.
+func GeneratePassword() (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	return token[:16], nil
+}
+
+func issueUserToken(userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if err := db.GlobalStore.CreateUserToken(hashToken(token), userID, purpose, time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,89 +1,283 @@
 package auth
 
 import (
-
-	"log"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/user/server-moni/internal/config"
 	"github.com/user/server-moni/internal/db"
+	"github.com/user/server-moni/internal/logger"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Register(email, password string) error {
+const (
+	SessionCookie = "session"
+	CSRFCookie    = "csrf_token"
+	CSRFHeader    = "X-CSRF-Token"
+
+	// Sliding expiry is only written back once per interval to avoid a DB
+	// write on every request.
+	touchInterval = time.Minute
+)
+
+// Register creates an account. When email verification is required the
+// account starts unverified and a verification link is mailed to it.
+func Register(email, password, baseURL string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
-	return db.CreateUser(email, string(hashedPassword))
+
+	verified := !config.AppConfig.RequireEmailVerification
+	id, err := db.GlobalStore.CreateUser(email, string(hashedPassword), verified)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		if err := SendVerification(int(id), email, baseURL); err != nil {
+			logger.Error("Failed to send verification email", "user_id", id, "error", err)
+		}
+	}
+	return nil
 }
 
-func Login(email, password string) (string, error) {
-	user, err := db.GetUserByEmail(email)
+// Login verifies the credentials and opens a new session for the client.
+func Login(email, password, ip, userAgent string) (*db.Session, error) {
+	user, err := db.GlobalStore.GetUserByEmail(email)
 	if err != nil {
-		return "", err // User not found
+		return nil, err // User not found
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", err // Invalid password
+		return nil, err // Invalid password
+	}
+
+	if !user.EmailVerified && config.AppConfig.RequireEmailVerification {
+		return nil, ErrEmailNotVerified
+	}
+
+	return newSession(user.ID, ip, userAgent, time.Time{})
+}
+
+// Refresh replaces a session with a freshly issued one, keeping the owner
+// and client details. The new session keeps the creation time of the old
+// one, so refreshing does not escape the absolute lifetime.
+func Refresh(old *db.Session, ip, userAgent string) (*db.Session, error) {
+	s, err := newSession(old.UserID, ip, userAgent, old.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.GlobalStore.DeleteSession(old.Token); err != nil {
+		return nil, err
 	}
+	return s, nil
+}
 
-	// Generate Session Token
-	token := uuid.New().String()
-	expiresAt := time.Now().Add(24 * time.Hour) // 1 day session
+func Logout(token string) error {
+	return db.GlobalStore.DeleteSession(token)
+}
+
+// newSession issues a session. createdAt is when the client logged in, zero
+// for a new login.
+func newSession(userID int, ip, userAgent string, createdAt time.Time) (*db.Session, error) {
+	csrf, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	s := &db.Session{
+		ID:         uuid.New().String(),
+		Token:      uuid.New().String(),
+		UserID:     userID,
+		CSRFToken:  csrf,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  createdAt,
+		LastUsedAt: now,
+		ExpiresAt:  sessionExpiry(createdAt, now),
+	}
+	if err := db.GlobalStore.CreateSession(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
 
-	if err := db.CreateSession(token, user.ID, expiresAt); err != nil {
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
+	return hex.EncodeToString(b), nil
+}
 
-	return token, nil
+func sessionTTL() time.Duration {
+	if config.AppConfig.SessionTTL > 0 {
+		return config.AppConfig.SessionTTL
+	}
+	return 24 * time.Hour
 }
 
-func Logout(token string) error {
-	return db.DeleteSession(token)
+func sessionMaxAge() time.Duration {
+	if config.AppConfig.SessionMaxAge > 0 {
+		return config.AppConfig.SessionMaxAge
+	}
+	return 30 * 24 * time.Hour
 }
 
-// Middleware to protect routes and inject UserID
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		log.Printf("AuthMiddleware: Received Header: %s", authHeader)
+// sessionExpiry extends a session used at now by the idle timeout, but not
+// past the absolute lifetime counted from createdAt.
+func sessionExpiry(createdAt, now time.Time) time.Time {
+	expiresAt := now.Add(sessionTTL())
+	if limit := createdAt.Add(sessionMaxAge()); !createdAt.IsZero() && expiresAt.After(limit) {
+		return limit
+	}
+	return expiresAt
+}
 
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			return
-		}
+// SetSessionCookies stores the session in an HttpOnly cookie, plus a
+// script-readable CSRF cookie the SPA echoes back in the X-CSRF-Token header.
+func SetSessionCookies(c *gin.Context, s *db.Session) {
+	maxAge := int(time.Until(s.ExpiresAt).Seconds())
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(SessionCookie, s.Token, maxAge, "/", "", secure, true)
+	c.SetCookie(CSRFCookie, s.CSRFToken, maxAge, "/", "", secure, false)
+}
 
+func ClearSessionCookies(c *gin.Context) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(SessionCookie, "", -1, "/", "", secure, true)
+	c.SetCookie(CSRFCookie, "", -1, "/", "", secure, false)
+}
+
+// RequestToken extracts the session token from the Authorization header or,
+// failing that, the session cookie. fromCookie reports which one was used.
+func RequestToken(c *gin.Context) (token string, fromCookie bool, ok bool) {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			log.Printf("AuthMiddleware: Invalid format. Parts: %v", parts)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+			return "", false, false
+		}
+		return parts[1], false, true
+	}
+	if cookie, err := c.Cookie(SessionCookie); err == nil && cookie != "" {
+		return cookie, true, true
+	}
+	return "", false, false
+}
+
+// StartSessionSweeper periodically deletes expired sessions and account
+// tokens.
+func StartSessionSweeper(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			n, err := db.GlobalStore.DeleteExpiredSessions()
+			if err != nil {
+				logger.Error("Failed to sweep expired sessions", "error", err)
+				continue
+			}
+			if n > 0 {
+				logger.Info("Swept expired sessions", "count", n)
+			}
+			if _, err := db.GlobalStore.DeleteExpiredUserTokens(); err != nil {
+				logger.Error("Failed to sweep expired user tokens", "error", err)
+			}
+		}
+	}()
+}
+
+// Middleware to protect routes and inject UserID
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, fromCookie, ok := RequestToken(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
 			return
 		}
 
-		token := parts[1]
-		session, err := db.GetSession(token)
+		session, err := db.GlobalStore.GetSession(token)
 		if err != nil {
-			log.Printf("AuthMiddleware: Session lookup failed for token %s: %v", token, err)
+			logger.Debug("AuthMiddleware: session lookup failed", "ip", c.ClientIP(), "error", err)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			return
 		}
 
-		if time.Now().After(session.ExpiresAt) {
-			log.Printf("AuthMiddleware: Session expired. ExpiresAt: %v, Now: %v", session.ExpiresAt, time.Now())
-			db.DeleteSession(token)
+		now := time.Now().UTC()
+		if now.After(session.ExpiresAt) || (!session.CreatedAt.IsZero() && now.After(session.CreatedAt.Add(sessionMaxAge()))) {
+			logger.Debug("AuthMiddleware: session expired", "session_id", session.ID, "expires_at", session.ExpiresAt)
+			db.GlobalStore.DeleteSession(token)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
 			return
 		}
 
+		// Cookie sessions are sent automatically by the browser, so state
+		// changing requests must prove they can read the CSRF cookie.
+		if fromCookie && !isSafeMethod(c.Request.Method) {
+			header := c.GetHeader(CSRFHeader)
+			if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(session.CSRFToken)) != 1 {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+				return
+			}
+		}
+
+		if now.Sub(session.LastUsedAt) > touchInterval {
+			expiresAt := sessionExpiry(session.CreatedAt, now)
+			if err := db.GlobalStore.TouchSession(token, now, expiresAt); err != nil {
+				logger.Warn("Failed to extend session", "session_id", session.ID, "error", err)
+			} else {
+				session.LastUsedAt = now
+				session.ExpiresAt = expiresAt
+				if fromCookie {
+					SetSessionCookies(c, session)
+				}
+			}
+		}
+
 		// Set UserID in context
 		c.Set("userID", session.UserID)
+		c.Set("session", session)
 		c.Next()
 	}
 }
 
-// InitAuth is no longer needed for Master Key, but we keep it empty or remove it.
-// We'll remove it to clean up.
+// AdminMiddleware restricts a route to the accounts listed in
+// config.AppConfig.AdminEmails. It must run after AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := db.GlobalStore.GetUserByID(c.GetInt("userID"))
+		if err != nil || !IsAdmin(user.Email) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Administrator access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// IsAdmin reports whether an account has administrator access.
+func IsAdmin(email string) bool {
+	for _, admin := range config.AppConfig.AdminEmails {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/user/server-moni/internal/config"
+	"github.com/user/server-moni/internal/db"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	config.AppConfig.SessionTTL = 24 * time.Hour
+	config.AppConfig.SessionMaxAge = 30 * 24 * time.Hour
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	if got, want := sessionExpiry(created, created.Add(time.Hour)), created.Add(25*time.Hour); !got.Equal(want) {
+		t.Errorf("expiry of a young session = %v, want %v", got, want)
+	}
+	// Within a day of the absolute lifetime the idle timeout is cut short
+	if got, want := sessionExpiry(created, created.Add(29*24*time.Hour+time.Hour)), created.Add(30*24*time.Hour); !got.Equal(want) {
+		t.Errorf("expiry of an old session = %v, want %v", got, want)
+	}
+	// Sessions from before creation times were recorded
+	now := created.Add(90 * 24 * time.Hour)
+	if got, want := sessionExpiry(time.Time{}, now), now.Add(24*time.Hour); !got.Equal(want) {
+		t.Errorf("expiry without a creation time = %v, want %v", got, want)
+	}
+}
+
+func TestRefreshKeepsMaxAge(t *testing.T) {
+	store, err := db.Open(filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	db.GlobalStore = store
+	config.AppConfig.SessionTTL = 24 * time.Hour
+	config.AppConfig.SessionMaxAge = 30 * 24 * time.Hour
+
+	id, err := store.CreateUser("refresh@example.com", "hash", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Logged in 29 days and 12 hours ago, refreshed ever since
+	created := time.Now().UTC().Add(-(29*24 + 12) * time.Hour).Truncate(time.Second)
+	old := &db.Session{
+		ID:         "old",
+		Token:      "old-token",
+		UserID:     int(id),
+		CreatedAt:  created,
+		LastUsedAt: time.Now().UTC().Add(-time.Hour),
+		ExpiresAt:  time.Now().UTC().Add(23 * time.Hour),
+	}
+	if err := store.CreateSession(old); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Refresh(old, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Token == old.Token {
+		t.Error("the refreshed session kept the old token")
+	}
+	if _, err := store.GetSession(old.Token); err == nil {
+		t.Error("the old session still exists")
+	}
+
+	saved, err := store.GetSession(s.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := created.Add(30 * 24 * time.Hour)
+	if !saved.CreatedAt.Equal(created) {
+		t.Errorf("created at = %v, want the original %v", saved.CreatedAt, created)
+	}
+	if !saved.ExpiresAt.Equal(limit) {
+		t.Errorf("expires at = %v, want the original max age %v", saved.ExpiresAt, limit)
+	}
+}
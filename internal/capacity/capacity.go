@@ -0,0 +1,101 @@
+// Package capacity derives growth trends and disk-full forecasts from
+// filesystem capacity snapshots.
+package capacity
+
+import (
+	"sort"
+	"time"
+)
+
+// Point is the usage of one filesystem at one time.
+type Point struct {
+	Time  time.Time
+	Used  uint64
+	Total uint64
+}
+
+// Trend describes how fast a filesystem is filling up.
+type Trend struct {
+	Samples       int       `json:"samples"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	BytesPerDay   float64   `json:"bytes_per_day"`   // Least-squares slope of used bytes
+	PercentPerDay float64   `json:"percent_per_day"` // The same, relative to the latest size
+	Change        int64     `json:"change"`          // Used bytes, last minus first sample
+}
+
+// Growth fits a line through the used bytes of the points, which must be
+// in chronological order. It needs at least two points spanning some time;
+// otherwise ok is false.
+func Growth(points []Point) (t Trend, ok bool) {
+	t.Samples = len(points)
+	if len(points) < 2 {
+		return t, false
+	}
+	first, last := points[0], points[len(points)-1]
+	t.From, t.To = first.Time, last.Time
+	t.Change = int64(last.Used) - int64(first.Used)
+
+	slope, ok := slopePerDay(points)
+	if !ok {
+		return t, false
+	}
+	t.BytesPerDay = slope
+	if last.Total > 0 {
+		t.PercentPerDay = slope / float64(last.Total) * 100
+	}
+	return t, true
+}
+
+// slopePerDay is the least-squares slope of used bytes over time, in bytes
+// per day. Both axes are taken relative to the first point to keep the
+// sums small.
+func slopePerDay(points []Point) (float64, bool) {
+	n := float64(len(points))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, p := range points {
+		x, y := days(points[0], p), used(points[0], p)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denom, true
+}
+
+// medianSlopePerDay is the Theil-Sen estimator: the median of the slopes
+// between every pair of points. A cleanup or a one-off spike moves a few
+// pairwise slopes but not their median.
+func medianSlopePerDay(points []Point) (float64, bool) {
+	slopes := make([]float64, 0, len(points)*(len(points)-1)/2)
+	for i := range points {
+		for j := i + 1; j < len(points); j++ {
+			dx := days(points[i], points[j])
+			if dx == 0 {
+				continue
+			}
+			slopes = append(slopes, used(points[i], points[j])/dx)
+		}
+	}
+	if len(slopes) == 0 {
+		return 0, false
+	}
+	sort.Float64s(slopes)
+	mid := len(slopes) / 2
+	if len(slopes)%2 == 1 {
+		return slopes[mid], true
+	}
+	return (slopes[mid-1] + slopes[mid]) / 2, true
+}
+
+func days(from, to Point) float64 {
+	return to.Time.Sub(from.Time).Hours() / 24
+}
+
+func used(from, to Point) float64 {
+	return float64(to.Used) - float64(from.Used)
+}
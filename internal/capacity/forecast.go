@@ -0,0 +1,79 @@
+package capacity
+
+import (
+	"fmt"
+	"time"
+)
+
+// Regression methods for forecasts
+const (
+	MethodLinear = "linear" // Least squares; follows every sample
+	MethodRobust = "robust" // Theil-Sen; ignores cleanups and one-off spikes
+)
+
+// MinForecastSamples is the number of snapshots needed before a mount is
+// forecast at all; two points always fit a line perfectly.
+const MinForecastSamples = 3
+
+// Forecast predicts when a filesystem runs out of space at its current
+// growth rate.
+type Forecast struct {
+	Method        string     `json:"method"`
+	Samples       int        `json:"samples"`
+	BytesPerDay   float64    `json:"bytes_per_day"`
+	Used          uint64     `json:"used"`            // At the latest sample
+	Total         uint64     `json:"total"`           // At the latest sample
+	DaysUntilFull *float64   `json:"days_until_full"` // null when usage is flat or shrinking
+	FullAt        *time.Time `json:"full_at"`
+}
+
+// ParseMethod validates a method name; empty selects MethodRobust.
+func ParseMethod(method string) (string, error) {
+	switch method {
+	case "":
+		return MethodRobust, nil
+	case MethodLinear, MethodRobust:
+		return method, nil
+	}
+	return "", fmt.Errorf("method must be %s or %s", MethodLinear, MethodRobust)
+}
+
+// Predict extrapolates the growth of the points, which must be in
+// chronological order, from the latest sample to the size of the
+// filesystem. ok is false with fewer than MinForecastSamples points.
+func Predict(points []Point, method string, now time.Time) (f Forecast, ok bool) {
+	f.Method = method
+	f.Samples = len(points)
+	if len(points) < MinForecastSamples {
+		return f, false
+	}
+	last := points[len(points)-1]
+	f.Used, f.Total = last.Used, last.Total
+
+	if method == MethodLinear {
+		f.BytesPerDay, ok = slopePerDay(points)
+	} else {
+		f.BytesPerDay, ok = medianSlopePerDay(points)
+	}
+	if !ok {
+		return f, false
+	}
+	if f.BytesPerDay <= 0 || last.Total == 0 {
+		return f, true
+	}
+
+	remaining := float64(last.Total) - float64(last.Used)
+	d := remaining/f.BytesPerDay - now.Sub(last.Time).Hours()/24
+	if d < 0 {
+		d = 0
+	}
+	at := now.Add(time.Duration(d * 24 * float64(time.Hour))).UTC()
+	f.DaysUntilFull, f.FullAt = &d, &at
+	return f, true
+}
+
+// FullWithin reports whether the forecast predicts the filesystem to be full
+// within the given number of days.
+func (f Forecast) FullWithin(days float64) bool {
+	return f.DaysUntilFull != nil && *f.DaysUntilFull <= days
+}
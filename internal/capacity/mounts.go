@@ -0,0 +1,45 @@
+package capacity
+
+import (
+	"time"
+
+	"github.com/user/server-moni/internal/db"
+)
+
+// Mount is the snapshot history of one filesystem of a system.
+type Mount struct {
+	SystemID   int
+	Mountpoint string
+	History    []db.DiskHistory // Chronological
+}
+
+// Latest returns the most recent snapshot.
+func (m Mount) Latest() db.DiskHistory {
+	return m.History[len(m.History)-1]
+}
+
+func (m Mount) Points() []Point {
+	points := make([]Point, len(m.History))
+	for i, h := range m.History {
+		points[i] = Point{Time: h.Timestamp, Used: h.Used, Total: h.Total}
+	}
+	return points
+}
+
+// LoadMounts reads the stored disk history of a system since the given time,
+// grouped per mountpoint. An empty mountpoint selects every mount.
+func LoadMounts(systemID int, mountpoint string, since time.Time) ([]Mount, error) {
+	history, err := db.GlobalStore.GetDiskHistory(systemID, mountpoint, since)
+	if err != nil {
+		return nil, err
+	}
+	mounts := []Mount{}
+	for _, h := range history {
+		if len(mounts) == 0 || mounts[len(mounts)-1].Mountpoint != h.Mountpoint {
+			mounts = append(mounts, Mount{SystemID: systemID, Mountpoint: h.Mountpoint})
+		}
+		m := &mounts[len(mounts)-1]
+		m.History = append(m.History, h)
+	}
+	return mounts, nil
+}
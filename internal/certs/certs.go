@@ -0,0 +1,240 @@
+// Package certs inspects TLS certificates, either served by endpoints or
+// stored in local files, so agents can report when they expire.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Where a certificate was found
+const (
+	SourceEndpoint = "endpoint" // Location is host:port
+	SourceFile     = "file"     // Location is a file path
+)
+
+const (
+	handshakeTimeout = 10 * time.Second
+	maxFileSize      = 1 << 20
+)
+
+// fileExtensions are the files picked up when scanning a directory.
+// Files named explicitly are read whatever their extension.
+var fileExtensions = []string{".pem", ".crt", ".cer", ".der"}
+
+// Certificate describes the leaf certificate of an endpoint or file.
+type Certificate struct {
+	Source      string    `json:"source"`
+	Location    string    `json:"location"`
+	Subject     string    `json:"subject,omitempty"`
+	SANs        []string  `json:"sans,omitempty"` // DNS names, IP addresses, emails and URIs
+	Issuer      string    `json:"issuer,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"` // SHA-256, hex
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	DaysLeft    float64   `json:"days_left"`   // Negative once expired, as of the scan
+	ChainValid  bool      `json:"chain_valid"` // Verified against the system roots (and host name for endpoints)
+	ChainError  string    `json:"chain_error,omitempty"`
+	Error       string    `json:"error,omitempty"` // The certificate could not be read; other fields are empty
+}
+
+// DaysUntilExpiry returns the days left at now, negative once expired.
+func (c Certificate) DaysUntilExpiry(now time.Time) float64 {
+	return c.NotAfter.Sub(now).Hours() / 24
+}
+
+// Inspect reads the certificates of every endpoint (host:port, the port
+// defaults to 443) and path (a file or a directory scanned recursively).
+func Inspect(ctx context.Context, endpoints, paths []string) []Certificate {
+	var certs []Certificate
+	for _, e := range endpoints {
+		certs = append(certs, inspectEndpoint(ctx, e))
+	}
+	for _, p := range paths {
+		certs = append(certs, inspectPath(p)...)
+	}
+	return certs
+}
+
+func inspectEndpoint(ctx context.Context, addr string) Certificate {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "443")
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	c := Certificate{Source: SourceEndpoint, Location: addr}
+
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	// Verification happens below so that expired or untrusted certificates
+	// are still described
+	config := &tls.Config{InsecureSkipVerify: true}
+	if net.ParseIP(host) == nil {
+		config.ServerName = host
+	}
+	dialer := &tls.Dialer{Config: config}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	defer conn.Close()
+
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		c.Error = "no certificate presented"
+		return c
+	}
+	describe(&c, chain, host)
+	return c
+}
+
+func inspectPath(path string) []Certificate {
+	info, err := os.Stat(path)
+	if err != nil {
+		return []Certificate{{Source: SourceFile, Location: path, Error: err.Error()}}
+	}
+	if !info.IsDir() {
+		return []Certificate{inspectFile(path)}
+	}
+
+	// Keep one entry per leaf: cert.pem and fullchain.pem hold the same
+	// one, and the file with the longer chain verifies best
+	var certs []Certificate
+	chains := make(map[string]int)
+	index := make(map[string]int)
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !hasExtension(p) {
+			return nil
+		}
+		chain, err := readChain(p)
+		if err != nil || len(chain) == 0 {
+			return nil
+		}
+		// Files starting with a CA are chains or bundles, not certificates
+		// anyone serves
+		if chain[0].IsCA {
+			return nil
+		}
+		c := Certificate{Source: SourceFile, Location: p}
+		describe(&c, chain, "")
+		if i, ok := index[c.Fingerprint]; ok {
+			if len(chain) > chains[c.Fingerprint] {
+				certs[i] = c
+				chains[c.Fingerprint] = len(chain)
+			}
+			return nil
+		}
+		index[c.Fingerprint] = len(certs)
+		chains[c.Fingerprint] = len(chain)
+		certs = append(certs, c)
+		return nil
+	})
+	return certs
+}
+
+func inspectFile(path string) Certificate {
+	c := Certificate{Source: SourceFile, Location: path}
+	chain, err := readChain(path)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	if len(chain) == 0 {
+		c.Error = "no certificate found"
+		return c
+	}
+	describe(&c, chain, "")
+	return c
+}
+
+func hasExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range fileExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// readChain parses the PEM or DER certificates in a file, leaf first.
+func readChain(path string) ([]*x509.Certificate, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxFileSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxFileSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		return x509.ParseCertificates(data)
+	}
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		// Private keys and parameters in the same file are skipped
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// describe fills c from a chain, leaf first, verifying it against the
+// system roots and host unless host is empty.
+func describe(c *Certificate, chain []*x509.Certificate, host string) {
+	leaf := chain[0]
+	now := time.Now()
+	sum := sha256.Sum256(leaf.Raw)
+
+	c.Subject = leaf.Subject.String()
+	c.Issuer = leaf.Issuer.String()
+	c.Fingerprint = hex.EncodeToString(sum[:])
+	c.NotBefore = leaf.NotBefore.UTC()
+	c.NotAfter = leaf.NotAfter.UTC()
+	c.DaysLeft = c.DaysUntilExpiry(now)
+	c.SANs = append(c.SANs, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		c.SANs = append(c.SANs, ip.String())
+	}
+	c.SANs = append(c.SANs, leaf.EmailAddresses...)
+	for _, u := range leaf.URIs {
+		c.SANs = append(c.SANs, u.String())
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates, CurrentTime: now})
+	c.ChainValid = err == nil
+	if err != nil {
+		c.ChainError = err.Error()
+	}
+}
@@ -0,0 +1,48 @@
+package certs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often a Watcher rescans. Certificates change
+// rarely and reporting the days left needs no more precision.
+const DefaultInterval = time.Hour
+
+// Watcher rescans a fixed set of endpoints and paths in the background and
+// keeps the latest results.
+type Watcher struct {
+	endpoints []string
+	paths     []string
+
+	mu     sync.RWMutex
+	latest []Certificate
+}
+
+func NewWatcher(endpoints, paths []string) *Watcher {
+	return &Watcher{endpoints: endpoints, paths: paths}
+}
+
+// Start scans right away and then every interval.
+func (w *Watcher) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			certs := Inspect(context.Background(), w.endpoints, w.paths)
+			w.mu.Lock()
+			w.latest = certs
+			w.mu.Unlock()
+			<-ticker.C
+		}
+	}()
+}
+
+// Latest returns the results of the last scan, nil before the first one
+// completes.
+func (w *Watcher) Latest() []Certificate {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.latest
+}
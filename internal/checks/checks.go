@@ -0,0 +1,154 @@
+// Package checks defines synthetic uptime checks and runs them. Checks are
+// assigned to a system on the server, handed to its agent in the ingest
+// response, run by the agent on their interval, and their results are sent
+// back with the next ingest.
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Check types
+const (
+	TypeHTTP = "http" // Target is an http:// or https:// URL
+	TypeTCP  = "tcp"  // Target is host:port
+	TypeICMP = "icmp" // Target is a host
+	TypeDNS  = "dns"  // Target is a name to resolve
+)
+
+const (
+	DefaultInterval = 60 // Seconds
+	DefaultTimeout  = 10 // Seconds
+	MinInterval     = 5
+)
+
+// Definition is a check as agents receive it.
+type Definition struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Target   string  `json:"target"`
+	Interval int     `json:"interval"` // Seconds between runs
+	Timeout  int     `json:"timeout"`  // Seconds
+	Options  Options `json:"options"`
+}
+
+// Options refine what counts as up, per check type.
+type Options struct {
+	// HTTP
+	Method          string            `json:"method,omitempty"`           // Defaults to GET
+	Headers         map[string]string `json:"headers,omitempty"`          // Sent with the request
+	ExpectedStatus  int               `json:"expected_status,omitempty"`  // 0 accepts any 2xx or 3xx
+	BodyRegex       string            `json:"body_regex,omitempty"`       // Must match the first MiB of the body
+	ExpectedHeaders map[string]string `json:"expected_headers,omitempty"` // Response headers that must contain the values
+
+	// DNS
+	RecordType string `json:"record_type,omitempty"` // A (default), AAAA, CNAME, MX, NS or TXT
+	Expected   string `json:"expected,omitempty"`    // A value that must be among the answers
+}
+
+// Result is the outcome of one run of a check.
+type Result struct {
+	CheckID    int       `json:"check_id"`
+	Time       time.Time `json:"time"`
+	Up         bool      `json:"up"`
+	LatencyMS  float64   `json:"latency_ms"`
+	StatusCode int       `json:"status_code,omitempty"` // HTTP only
+	Error      string    `json:"error,omitempty"`       // Why the check is down
+}
+
+var recordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT"}
+
+// Validate checks a definition before it is stored, filling in defaults.
+func (d *Definition) Validate() error {
+	d.Name = strings.TrimSpace(d.Name)
+	d.Target = strings.TrimSpace(d.Target)
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	if d.Target == "" {
+		return errors.New("target is required")
+	}
+	if d.Interval == 0 {
+		d.Interval = DefaultInterval
+	}
+	if d.Timeout == 0 {
+		d.Timeout = min(DefaultTimeout, d.Interval)
+	}
+	if d.Interval < MinInterval {
+		return fmt.Errorf("interval must be at least %d seconds", MinInterval)
+	}
+	if d.Timeout < 1 || d.Timeout > d.Interval {
+		return errors.New("timeout must be between 1 second and the interval")
+	}
+
+	o := &d.Options
+	switch d.Type {
+	case TypeHTTP:
+		u, err := url.Parse(d.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("target must be an http:// or https:// URL")
+		}
+		o.Method = strings.ToUpper(o.Method)
+		switch o.Method {
+		case "":
+			o.Method = http.MethodGet
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodPatch:
+		default:
+			return fmt.Errorf("unsupported method %q", o.Method)
+		}
+		if o.ExpectedStatus != 0 && (o.ExpectedStatus < 100 || o.ExpectedStatus > 599) {
+			return errors.New("expected_status must be an HTTP status code")
+		}
+		if o.BodyRegex != "" {
+			if _, err := regexp.Compile(o.BodyRegex); err != nil {
+				return fmt.Errorf("invalid body_regex: %v", err)
+			}
+		}
+	case TypeTCP:
+		host, port, err := net.SplitHostPort(d.Target)
+		if err != nil || host == "" || port == "" {
+			return errors.New("target must be host:port")
+		}
+	case TypeICMP, TypeDNS:
+		if strings.ContainsAny(d.Target, "/: ") && net.ParseIP(d.Target) == nil {
+			return errors.New("target must be a host name or IP address")
+		}
+		if d.Type == TypeDNS {
+			o.RecordType = strings.ToUpper(o.RecordType)
+			if o.RecordType == "" {
+				o.RecordType = "A"
+			}
+			if !contains(recordTypes, o.RecordType) {
+				return fmt.Errorf("record_type must be one of %s", strings.Join(recordTypes, ", "))
+			}
+		}
+	default:
+		return errors.New("type must be http, tcp, icmp or dns")
+	}
+
+	// Drop options that do not apply, so stored checks stay tidy
+	if d.Type != TypeHTTP {
+		o.Method, o.Headers, o.ExpectedStatus, o.BodyRegex, o.ExpectedHeaders = "", nil, 0, "", nil
+	}
+	if d.Type != TypeDNS {
+		o.RecordType, o.Expected = "", ""
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package checks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+var icmpSeq atomic.Uint32
+
+// runICMP sends one echo request and waits for its reply. It uses an
+// unprivileged ICMP socket where the kernel allows it (Linux with
+// net.ipv4.ping_group_range, macOS) and falls back to a raw socket, which
+// needs root or CAP_NET_RAW.
+func runICMP(ctx context.Context, d Definition) error {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, d.Target)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("%s has no addresses", d.Target)
+	}
+	ip := ips[0].IP
+	for _, a := range ips {
+		if a.IP.To4() != nil {
+			ip = a.IP
+			break
+		}
+	}
+
+	v4 := ip.To4() != nil
+	network, raw, proto := "udp6", "ip6:ipv6-icmp", 58
+	var request, reply icmp.Type = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	if v4 {
+		network, raw, proto = "udp4", "ip4:icmp", 1
+		request, reply = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	}
+
+	privileged := false
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		if conn, err = icmp.ListenPacket(raw, ""); err != nil {
+			return fmt.Errorf("opening ICMP socket: %w", err)
+		}
+		privileged = true
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	seq := int(icmpSeq.Add(1) & 0xffff)
+	msg := icmp.Message{Type: request, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("server-moni")}}
+	packet, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if privileged {
+		dst = &net.IPAddr{IP: ip}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.WriteTo(packet, dst); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return errors.New("no echo reply")
+			}
+			return err
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || m.Type != reply {
+			continue
+		}
+		echo, ok := m.Body.(*icmp.Echo)
+		// Unprivileged sockets rewrite the ID and only see their own replies
+		if !ok || echo.Seq != seq || (privileged && echo.ID != id) {
+			continue
+		}
+		return nil
+	}
+}
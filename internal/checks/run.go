@@ -0,0 +1,165 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxBody is how much of an HTTP response body is matched against BodyRegex.
+const maxBody = 1 << 20
+
+// Run executes a check once. It never fails; problems are reported as a
+// down result.
+func Run(ctx context.Context, d Definition) Result {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(d.Timeout)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	r := Result{CheckID: d.ID, Time: start.UTC()}
+	var err error
+	switch d.Type {
+	case TypeHTTP:
+		r.StatusCode, err = runHTTP(ctx, d)
+	case TypeTCP:
+		err = runTCP(ctx, d)
+	case TypeICMP:
+		err = runICMP(ctx, d)
+	case TypeDNS:
+		err = runDNS(ctx, d)
+	default:
+		err = fmt.Errorf("unknown check type %q", d.Type)
+	}
+	r.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	r.Up = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// httpClient does not follow redirects so a 301 can be expected, and keeps
+// no connections so every run measures a full request.
+var httpClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	Transport: &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+	},
+}
+
+func runHTTP(ctx context.Context, d Definition) (int, error) {
+	o := d.Options
+	req, err := http.NewRequestWithContext(ctx, o.Method, d.Target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "server-moni-check")
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if o.ExpectedStatus != 0 && resp.StatusCode != o.ExpectedStatus {
+		return resp.StatusCode, fmt.Errorf("status %d, expected %d", resp.StatusCode, o.ExpectedStatus)
+	}
+	if o.ExpectedStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 400) {
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	for k, v := range o.ExpectedHeaders {
+		if got := resp.Header.Get(k); !strings.Contains(got, v) {
+			return resp.StatusCode, fmt.Errorf("header %s is %q, expected it to contain %q", k, got, v)
+		}
+	}
+	if o.BodyRegex != "" {
+		re, err := regexp.Compile(o.BodyRegex)
+		if err != nil {
+			return resp.StatusCode, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+		if err != nil {
+			return resp.StatusCode, fmt.Errorf("reading body: %v", err)
+		}
+		if !re.Match(body) {
+			return resp.StatusCode, fmt.Errorf("body does not match %q", o.BodyRegex)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func runTCP(ctx context.Context, d Definition) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", d.Target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func runDNS(ctx context.Context, d Definition) error {
+	var answers []string
+	var err error
+	r := net.DefaultResolver
+	switch d.Options.RecordType {
+	case "A", "AAAA", "":
+		var ips []net.IPAddr
+		ips, err = r.LookupIPAddr(ctx, d.Target)
+		for _, ip := range ips {
+			if (ip.IP.To4() != nil) == (d.Options.RecordType != "AAAA") {
+				answers = append(answers, ip.IP.String())
+			}
+		}
+	case "CNAME":
+		var cname string
+		if cname, err = r.LookupCNAME(ctx, d.Target); err == nil {
+			answers = append(answers, cname)
+		}
+	case "MX":
+		var mx []*net.MX
+		mx, err = r.LookupMX(ctx, d.Target)
+		for _, m := range mx {
+			answers = append(answers, m.Host)
+		}
+	case "NS":
+		var ns []*net.NS
+		ns, err = r.LookupNS(ctx, d.Target)
+		for _, n := range ns {
+			answers = append(answers, n.Host)
+		}
+	case "TXT":
+		answers, err = r.LookupTXT(ctx, d.Target)
+	default:
+		err = fmt.Errorf("unsupported record type %q", d.Options.RecordType)
+	}
+	if err != nil {
+		return err
+	}
+	if len(answers) == 0 {
+		return fmt.Errorf("no %s records", d.Options.RecordType)
+	}
+	if want := d.Options.Expected; want != "" {
+		for _, a := range answers {
+			if strings.TrimSuffix(a, ".") == strings.TrimSuffix(want, ".") {
+				return nil
+			}
+		}
+		return errors.New("answers " + strings.Join(answers, ", ") + " do not include " + want)
+	}
+	return nil
+}
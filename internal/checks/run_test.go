@@ -0,0 +1,111 @@
+package checks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			if r.Header.Get("X-Token") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"status":"ok","version":"1.2.3"}`))
+		case "/moved":
+			http.Redirect(w, r, "/health", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	auth := map[string]string{"X-Token": "secret"}
+	tests := []struct {
+		name    string
+		path    string
+		options Options
+		up      bool
+		status  int
+		err     string
+	}{
+		{"ok", "/health", Options{Headers: auth}, true, 200, ""},
+		{"missing header", "/health", Options{}, false, 401, "status 401"},
+		{"not found", "/missing", Options{}, false, 404, "status 404"},
+		{"expected status", "/moved", Options{ExpectedStatus: 301}, true, 301, ""},
+		{"unexpected status", "/health", Options{Headers: auth, ExpectedStatus: 204}, false, 200, "expected 204"},
+		{"body matches", "/health", Options{Headers: auth, BodyRegex: `"status":"ok"`}, true, 200, ""},
+		{"body does not match", "/health", Options{Headers: auth, BodyRegex: `"status":"degraded"`}, false, 200, "body does not match"},
+		{"header matches", "/health", Options{Headers: auth, ExpectedHeaders: map[string]string{"Content-Type": "application/json"}}, true, 200, ""},
+		{"header does not match", "/health", Options{Headers: auth, ExpectedHeaders: map[string]string{"Content-Type": "text/html"}}, false, 200, "header Content-Type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Definition{ID: 1, Name: tt.name, Type: TypeHTTP, Target: srv.URL + tt.path, Options: tt.options}
+			if err := d.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			r := Run(context.Background(), d)
+			if r.Up != tt.up || r.StatusCode != tt.status {
+				t.Errorf("up = %v, status = %d, want %v, %d (error %q)", r.Up, r.StatusCode, tt.up, tt.status, r.Error)
+			}
+			if !strings.Contains(r.Error, tt.err) || (tt.err == "") != (r.Error == "") {
+				t.Errorf("error = %q, want it to contain %q", r.Error, tt.err)
+			}
+			if r.CheckID != 1 || r.Time.IsZero() {
+				t.Errorf("result = %+v", r)
+			}
+		})
+	}
+}
+
+func TestRunHTTPDown(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	target := srv.URL
+	srv.Close()
+
+	d := Definition{Name: "down", Type: TypeHTTP, Target: target}
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if r := Run(context.Background(), d); r.Up || r.StatusCode != 0 || r.Error == "" {
+		t.Errorf("result of a closed server = %+v", r)
+	}
+}
+
+func TestRunTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	target := ln.Addr().String()
+
+	d := Definition{Name: "tcp", Type: TypeTCP, Target: target}
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if r := Run(context.Background(), d); !r.Up || r.Error != "" || r.LatencyMS < 0 {
+		t.Errorf("result of a listening port = %+v", r)
+	}
+
+	ln.Close()
+	if r := Run(context.Background(), d); r.Up || r.Error == "" {
+		t.Errorf("result of a closed port = %+v", r)
+	}
+}
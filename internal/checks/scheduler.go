@@ -0,0 +1,116 @@
+package checks
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// MaxPending caps the results buffered while the server is unreachable;
+// the oldest are dropped first.
+const MaxPending = 1000
+
+// Scheduler runs a set of checks on their intervals and buffers the results
+// until they are collected for the next ingest.
+type Scheduler struct {
+	mu      sync.Mutex
+	checks  map[int]Definition
+	next    map[int]time.Time
+	running map[int]bool
+	pending []Result
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		checks:  make(map[int]Definition),
+		next:    make(map[int]time.Time),
+		running: make(map[int]bool),
+	}
+}
+
+// Update replaces the set of checks. Unchanged checks keep their schedule;
+// new and changed ones run right away.
+func (s *Scheduler) Update(defs []Definition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[int]bool, len(defs))
+	for _, d := range defs {
+		seen[d.ID] = true
+		if old, ok := s.checks[d.ID]; ok && reflect.DeepEqual(old, d) {
+			continue
+		}
+		s.checks[d.ID] = d
+		s.next[d.ID] = time.Time{}
+	}
+	for id := range s.checks {
+		if !seen[id] {
+			delete(s.checks, id)
+			delete(s.next, id)
+		}
+	}
+}
+
+// Run starts due checks every second until ctx is done. A check never
+// overlaps with its previous run.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		s.startDue(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) startDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, d := range s.checks {
+		if s.running[id] || now.Before(s.next[id]) {
+			continue
+		}
+		s.running[id] = true
+		s.next[id] = now.Add(time.Duration(d.Interval) * time.Second)
+		go func(d Definition) {
+			r := Run(ctx, d)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(s.running, d.ID)
+			if _, ok := s.checks[d.ID]; ok {
+				s.add(r)
+			}
+		}(d)
+	}
+}
+
+// Drain returns and clears the buffered results.
+func (s *Scheduler) Drain() []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := s.pending
+	s.pending = nil
+	return results
+}
+
+// Requeue puts back results that could not be delivered.
+func (s *Scheduler) Requeue(results []Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(results, s.pending...)
+	s.trim()
+}
+
+func (s *Scheduler) add(r Result) {
+	s.pending = append(s.pending, r)
+	s.trim()
+}
+
+func (s *Scheduler) trim() {
+	if len(s.pending) > MaxPending {
+		s.pending = s.pending[len(s.pending)-MaxPending:]
+	}
+}
@@ -3,12 +3,45 @@ package config
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	Port        string
-	DatabaseURL string
+	DatabaseURL string // SQLite file path, or a postgres:// URL
 	Service     string // install, uninstall, start, stop
+
+	// Skip applying pending schema migrations on start. The server then
+	// refuses to start until `server migrate up` has been run.
+	DisableAutoMigrate bool
+
+	// Sessions
+	SessionTTL           time.Duration // Idle timeout, extended on every request
+	SessionMaxAge        time.Duration // Absolute lifetime regardless of activity
+	SessionSweepInterval time.Duration // How often expired sessions are purged
+
+	// Capacity history
+	DiskHistoryInterval time.Duration // One snapshot of every mount per system per interval
+
+	// Metric history, the input of anomaly detection
+	MetricHistoryInterval  time.Duration // One sample of every headline metric per system per interval; 0 disables
+	MetricHistoryRetention time.Duration
+
+	// Alerting
+	AlertInterval time.Duration // How often alert rules are evaluated; 0 disables them
+
+	// Accounts
+	PublicURL                string // Base URL used in emailed links; derived from the request if empty
+	RequireEmailVerification bool
+	AdminEmails              []string // Accounts allowed to use the admin API (backups, exports)
+
+	// Outgoing mail (password resets, verification)
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
 }
 
 var AppConfig Config
@@ -16,15 +49,80 @@ var AppConfig Config
 func Load() {
 	// Defaults
 	AppConfig.Port = "8080"
-	AppConfig.DatabaseURL = "server-moni.db"
+	AppConfig.DatabaseURL = "data/server-moni.db"
 
 	// Flags
 	flag.StringVar(&AppConfig.Port, "port", "8080", "Server Port")
+	flag.StringVar(&AppConfig.DatabaseURL, "database-url", AppConfig.DatabaseURL, "SQLite database file, or a postgres:// connection URL")
+	flag.BoolVar(&AppConfig.DisableAutoMigrate, "disable-auto-migrate", false, "Do not apply database migrations on start")
 	flag.StringVar(&AppConfig.Service, "service", "", "Service action: install, uninstall, start, stop")
+	flag.DurationVar(&AppConfig.SessionTTL, "session-ttl", 24*time.Hour, "Session idle timeout")
+	flag.DurationVar(&AppConfig.SessionMaxAge, "session-max-age", 30*24*time.Hour, "Maximum session lifetime")
+	flag.DurationVar(&AppConfig.SessionSweepInterval, "session-sweep-interval", time.Hour, "Interval between expired session cleanups")
+	flag.StringVar(&AppConfig.PublicURL, "public-url", "", "Public base URL of the dashboard, used in emailed links")
+	flag.BoolVar(&AppConfig.RequireEmailVerification, "require-email-verification", false, "Require new users to verify their email before logging in")
+	flag.DurationVar(&AppConfig.DiskHistoryInterval, "disk-history-interval", 24*time.Hour, "Interval between disk capacity snapshots per system")
+	flag.DurationVar(&AppConfig.MetricHistoryInterval, "metric-history-interval", 5*time.Minute, "Interval between stored samples of the headline metrics per system (0 disables)")
+	flag.DurationVar(&AppConfig.MetricHistoryRetention, "metric-history-retention", 5*7*24*time.Hour, "How long stored metric samples, check results, process samples and log events are kept")
+	flag.DurationVar(&AppConfig.AlertInterval, "alert-interval", time.Minute, "Interval between alert rule evaluations (0 disables alerting)")
+	adminEmails := flag.String("admin-emails", "", "Comma separated emails of accounts with administrator access")
 	flag.Parse()
 
 	// Env Overrides
 	if envPort := os.Getenv("PORT"); envPort != "" {
 		AppConfig.Port = envPort
 	}
+	if v := os.Getenv("DATABASE_URL"); v != "" {
+		AppConfig.DatabaseURL = v
+	}
+	if os.Getenv("AUTO_MIGRATE") == "false" {
+		AppConfig.DisableAutoMigrate = true
+	}
+	if v := os.Getenv("PUBLIC_URL"); v != "" {
+		AppConfig.PublicURL = v
+	}
+	if os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true" {
+		AppConfig.RequireEmailVerification = true
+	}
+	if v := os.Getenv("ADMIN_EMAILS"); v != "" && *adminEmails == "" {
+		*adminEmails = v
+	}
+	for _, email := range strings.Split(*adminEmails, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			AppConfig.AdminEmails = append(AppConfig.AdminEmails, email)
+		}
+	}
+	AppConfig.SMTPHost = os.Getenv("SMTP_HOST")
+	AppConfig.SMTPPort = os.Getenv("SMTP_PORT")
+	if AppConfig.SMTPPort == "" {
+		AppConfig.SMTPPort = "587"
+	}
+	AppConfig.SMTPUsername = os.Getenv("SMTP_USERNAME")
+	AppConfig.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	AppConfig.SMTPFrom = os.Getenv("SMTP_FROM")
+	if v := os.Getenv("DISK_HISTORY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			AppConfig.DiskHistoryInterval = d
+		}
+	}
+	if v := os.Getenv("METRIC_HISTORY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			AppConfig.MetricHistoryInterval = d
+		}
+	}
+	if v := os.Getenv("METRIC_HISTORY_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			AppConfig.MetricHistoryRetention = d
+		}
+	}
+	if v := os.Getenv("ALERT_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			AppConfig.AlertInterval = d
+		}
+	}
+	if v := os.Getenv("SESSION_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			AppConfig.SessionTTL = d
+		}
+	}
 }
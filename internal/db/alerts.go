@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Alert Rules
+
+// AlertRule fires for every system matching Selector and Group on which its
+// condition holds. Params are specific to the condition, see internal/alerts.
+type AlertRule struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"user_id"`
+	Name      string          `json:"name"`
+	Condition string          `json:"condition"`
+	Params    json.RawMessage `json:"params"`
+	Selector  string          `json:"selector"` // Tag selector, empty for all systems
+	Group     string          `json:"group"`    // Group name, empty for all systems
+	Enabled   bool            `json:"enabled"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+const alertRuleColumns = "id, user_id, name, condition, params, selector, group_name, enabled, created_at"
+
+func (s *sqlStore) CreateAlertRule(r *AlertRule) (int64, error) {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	return s.insert("INSERT INTO alert_rules (user_id, name, condition, params, selector, group_name, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		r.UserID, r.Name, r.Condition, jsonObject(r.Params), r.Selector, r.Group, r.Enabled, r.CreatedAt.UTC())
+}
+
+// UpdateAlertRule replaces everything but the owner and creation time of the
+// rule with r.ID, returning sql.ErrNoRows if r.UserID does not own it.
+func (s *sqlStore) UpdateAlertRule(r *AlertRule) error {
+	res, err := s.exec("UPDATE alert_rules SET name = ?, condition = ?, params = ?, selector = ?, group_name = ?, enabled = ? WHERE id = ? AND user_id = ?",
+		r.Name, r.Condition, jsonObject(r.Params), r.Selector, r.Group, r.Enabled, r.ID, r.UserID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteAlertRule(id, userID int) error {
+	res, err := s.exec("DELETE FROM alert_rules WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *sqlStore) GetAlertRules(userID int) ([]AlertRule, error) {
+	return s.queryAlertRules("SELECT "+alertRuleColumns+" FROM alert_rules WHERE user_id = ? ORDER BY id", userID)
+}
+
+// GetEnabledAlertRules returns the enabled rules of all users.
+func (s *sqlStore) GetEnabledAlertRules() ([]AlertRule, error) {
+	return s.queryAlertRules("SELECT "+alertRuleColumns+" FROM alert_rules WHERE enabled = ? ORDER BY id", true)
+}
+
+func (s *sqlStore) queryAlertRules(query string, args ...any) ([]AlertRule, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []AlertRule{}
+	for rows.Next() {
+		var r AlertRule
+		var params string
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Name, &r.Condition, &params, &r.Selector, &r.Group, &r.Enabled, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Params = json.RawMessage(params)
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func jsonObject(p json.RawMessage) string {
+	if len(p) == 0 {
+		return "{}"
+	}
+	return string(p)
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// Audit Log
+
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserID     int       `json:"user_id"` // Account the entry belongs to (0 if none)
+	Actor      string    `json:"actor"`   // Who acted: a user email or "system:<id>" for agents
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Result     string    `json:"result"` // success or failure
+	Details    string    `json:"details"`
+}
+
+type AuditFilter struct {
+	UserID     int
+	Actor      string
+	Action     string // Exact match, or a prefix when it ends with "*" (e.g. "auth.*")
+	TargetType string
+	TargetID   string
+	Result     string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+func (s *sqlStore) AddAuditEntry(e *AuditEntry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+	id, err := s.insert(`INSERT INTO audit_log (created_at, user_id, actor, action, target_type, target_id, ip, user_agent, result, details)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.CreatedAt, e.UserID, e.Actor, e.Action, e.TargetType, e.TargetID, e.IP, e.UserAgent, e.Result, e.Details)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	return nil
+}
+
+// QueryAuditLog returns the entries matching the filter, newest first, along
+// with the total number of matches ignoring Limit and Offset.
+func (s *sqlStore) QueryAuditLog(f AuditFilter) ([]AuditEntry, int, error) {
+	where := []string{"user_id = ?"}
+	args := []any{f.UserID}
+
+	if f.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, f.Actor)
+	}
+	if strings.HasSuffix(f.Action, "*") {
+		where = append(where, "action LIKE ?")
+		args = append(args, strings.TrimSuffix(f.Action, "*")+"%")
+	} else if f.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.TargetType != "" {
+		where = append(where, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		where = append(where, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.Result != "" {
+		where = append(where, "result = ?")
+		args = append(args, f.Result)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+	clause := " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := s.queryRow("SELECT COUNT(*) FROM audit_log"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT id, created_at, user_id, actor, action, target_type, target_id, ip, user_agent, result, details FROM audit_log" +
+		clause + " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit, f.Offset)
+	}
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.UserID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &e.IP, &e.UserAgent, &e.Result, &e.Details); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
@@ -0,0 +1,375 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Backups, restores and the portable JSON export
+
+// ExportFormat identifies export documents; ExportVersion is bumped when
+// their layout changes incompatibly.
+const (
+	ExportFormat  = "server-moni-export"
+	ExportVersion = 1
+)
+
+// ErrBackupUnsupported is returned by Backup on backends that have their own
+// tooling for consistent snapshots (pg_dump for PostgreSQL).
+var ErrBackupUnsupported = errors.New("online backup is only supported for SQLite; use pg_dump, or export for a portable copy")
+
+// Export is a portable copy of the account data of an instance, including
+// alert rules, synthetic checks and process watches. It carries no sessions,
+// tokens, audit entries, metric history, check results, process samples,
+// software inventories or log events.
+type Export struct {
+	Format         string            `json:"format"`
+	Version        int               `json:"version"`
+	SchemaVersion  int               `json:"schema_version"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Config         map[string]string `json:"config"`
+	Users          []ExportUser      `json:"users"`
+	Systems        []ExportSystem    `json:"systems"`
+	Groups         []Group           `json:"groups"`
+	AlertRules     []AlertRule       `json:"alert_rules"`
+	Checks         []Check           `json:"checks"`
+	ProcessWatches []ProcessWatch    `json:"process_watches"`
+}
+
+type ExportUser struct {
+	ID            int       `json:"id"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"password_hash"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type ExportSystem struct {
+	ID        int               `json:"id"`
+	UserID    int               `json:"user_id"`
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	APIKey    string            `json:"api_key"`
+	CreatedAt time.Time         `json:"created_at"`
+	UserTags  map[string]string `json:"user_tags"`
+	AgentTags map[string]string `json:"agent_tags"`
+}
+
+// Backup writes a consistent snapshot of the database to path while it
+// stays in use. path must not exist yet.
+func (s *sqlStore) Backup(path string) error {
+	if s.dialect.name != "sqlite" {
+		return ErrBackupUnsupported
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	_, err := s.db.Exec("VACUUM INTO ?", path)
+	return err
+}
+
+// IntegrityCheck verifies the database file is not corrupt.
+func (s *sqlStore) IntegrityCheck() error {
+	if s.dialect.name != "sqlite" {
+		return nil
+	}
+	rows, err := s.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (s *sqlStore) Export() (*Export, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	e := &Export{
+		Format:         ExportFormat,
+		Version:        ExportVersion,
+		SchemaVersion:  version,
+		CreatedAt:      time.Now().UTC(),
+		Config:         make(map[string]string),
+		Users:          []ExportUser{},
+		Systems:        []ExportSystem{},
+		Groups:         []Group{},
+		AlertRules:     []AlertRule{},
+		Checks:         []Check{},
+		ProcessWatches: []ProcessWatch{},
+	}
+
+	rows, err := s.query("SELECT key, value FROM config ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.Config[k] = v
+	}
+	rows.Close()
+
+	rows, err = s.query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var u ExportUser
+		if err := rows.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.EmailVerified, &u.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.Users = append(e.Users, u)
+	}
+	rows.Close()
+
+	index := make(map[int]int)
+	rows, err = s.query("SELECT id, user_id, name, url, api_key, created_at FROM systems ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		sys := ExportSystem{UserTags: map[string]string{}, AgentTags: map[string]string{}}
+		if err := rows.Scan(&sys.ID, &sys.UserID, &sys.Name, &sys.URL, &sys.APIKey, &sys.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[sys.ID] = len(e.Systems)
+		e.Systems = append(e.Systems, sys)
+	}
+	rows.Close()
+
+	rows, err = s.query("SELECT system_id, source, key, value FROM system_tags")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var source, k, v string
+		if err := rows.Scan(&id, &source, &k, &v); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i, ok := index[id]
+		if !ok {
+			continue
+		}
+		if source == TagSourceAgent {
+			e.Systems[i].AgentTags[k] = v
+		} else {
+			e.Systems[i].UserTags[k] = v
+		}
+	}
+	rows.Close()
+
+	for _, u := range e.Users {
+		groups, err := s.GetGroups(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		e.Groups = append(e.Groups, groups...)
+	}
+
+	if e.AlertRules, err = s.queryAlertRules("SELECT " + alertRuleColumns + " FROM alert_rules ORDER BY id"); err != nil {
+		return nil, err
+	}
+	if e.Checks, err = s.queryChecks("SELECT " + checkColumns + " FROM checks ORDER BY id"); err != nil {
+		return nil, err
+	}
+	if e.ProcessWatches, err = s.queryProcessWatches("SELECT " + processWatchColumns + " FROM process_watches ORDER BY id"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Import loads an export into an empty database, keeping all IDs so agents
+// and links keep working. The schema must already be migrated.
+func (s *sqlStore) Import(e *Export) error {
+	if e.Format != ExportFormat {
+		return fmt.Errorf("not an export document (format %q)", e.Format)
+	}
+	if e.Version > ExportVersion {
+		return fmt.Errorf("export version %d is newer than this binary supports (%d)", e.Version, ExportVersion)
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var users int
+	if err := tx.queryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+		return err
+	}
+	if users > 0 {
+		return errors.New("the target database already has users; import into an empty database")
+	}
+
+	for k, v := range e.Config {
+		if _, err := tx.exec("INSERT INTO config (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", k, v); err != nil {
+			return err
+		}
+	}
+	for _, u := range e.Users {
+		if _, err := tx.exec("INSERT INTO users ("+userColumns+") VALUES (?, ?, ?, ?, ?)",
+			u.ID, u.Email, u.PasswordHash, u.EmailVerified, u.CreatedAt.UTC()); err != nil {
+			return fmt.Errorf("user %s: %w", u.Email, err)
+		}
+	}
+	for _, sys := range e.Systems {
+		if _, err := tx.exec("INSERT INTO systems (id, user_id, name, url, api_key, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+			sys.ID, sys.UserID, sys.Name, sys.URL, sys.APIKey, sys.CreatedAt.UTC()); err != nil {
+			return fmt.Errorf("system %s: %w", sys.Name, err)
+		}
+		for source, tags := range map[string]map[string]string{TagSourceUser: sys.UserTags, TagSourceAgent: sys.AgentTags} {
+			for k, v := range tags {
+				if _, err := tx.exec("INSERT INTO system_tags (system_id, source, key, value) VALUES (?, ?, ?, ?)", sys.ID, source, k, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, g := range e.Groups {
+		if _, err := tx.exec("INSERT INTO system_groups (id, user_id, name, created_at) VALUES (?, ?, ?, ?)", g.ID, g.UserID, g.Name, g.CreatedAt.UTC()); err != nil {
+			return fmt.Errorf("group %s: %w", g.Name, err)
+		}
+		for _, sid := range g.SystemIDs {
+			if _, err := tx.exec("INSERT INTO system_group_members (group_id, system_id) VALUES (?, ?) ON CONFLICT DO NOTHING", g.ID, sid); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, r := range e.AlertRules {
+		if _, err := tx.exec("INSERT INTO alert_rules ("+alertRuleColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			r.ID, r.UserID, r.Name, r.Condition, jsonObject(r.Params), r.Selector, r.Group, r.Enabled, r.CreatedAt.UTC()); err != nil {
+			return fmt.Errorf("alert rule %s: %w", r.Name, err)
+		}
+	}
+	for _, c := range e.Checks {
+		if _, err := tx.exec("INSERT INTO checks ("+checkColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			c.ID, c.SystemID, c.Name, c.Type, c.Target, c.Interval, c.Timeout, jsonObject(c.Options), c.Enabled, c.CreatedAt.UTC()); err != nil {
+			return fmt.Errorf("check %s: %w", c.Name, err)
+		}
+	}
+	for _, w := range e.ProcessWatches {
+		if _, err := tx.exec("INSERT INTO process_watches ("+processWatchColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			w.ID, w.SystemID, w.Name, w.Process, w.Cmdline, w.User, w.PIDFile, w.CreatedAt.UTC()); err != nil {
+			return fmt.Errorf("process watch %s: %w", w.Name, err)
+		}
+	}
+
+	// Identity columns do not advance when IDs are inserted explicitly
+	if s.dialect.name == "postgres" {
+		for _, table := range []string{"users", "systems", "system_groups", "alert_rules", "checks", "process_watches"} {
+			if _, err := tx.exec("SELECT setval(pg_get_serial_sequence('" + table + "', 'id'), COALESCE((SELECT MAX(id) FROM " + table + "), 0) + 1, false)"); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// RestoreSQLite replaces the SQLite database at target with the snapshot at
+// source after checking that the snapshot is intact and not from a newer
+// release. The previous database is kept next to it with a .pre-restore
+// suffix. The server must not be running against target.
+func RestoreSQLite(source, target string) error {
+	if strings.HasPrefix(target, "postgres://") || strings.HasPrefix(target, "postgresql://") {
+		return errors.New("restore only supports SQLite databases; use pg_restore for PostgreSQL")
+	}
+	source = strings.TrimPrefix(source, "sqlite://")
+	target = strings.TrimPrefix(target, "sqlite://")
+	if _, err := os.Stat(source); err != nil {
+		return err
+	}
+
+	snapshot, err := openSQLite(source)
+	if err != nil {
+		return err
+	}
+	err = snapshot.IntegrityCheck()
+	if err == nil {
+		var version int
+		version, err = snapshot.SchemaVersion()
+		if err == nil && version > SchemaVersion {
+			err = ErrSchemaTooNew{Database: version, Binary: SchemaVersion}
+		}
+	}
+	snapshot.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+
+	// Copy next to the target first so the final swap is a rename
+	tmp := target + ".restore-tmp"
+	if err := copyFile(source, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := os.Stat(target); err == nil {
+		if err := os.Rename(target, target+".pre-restore"); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		os.Remove(target + suffix)
+	}
+	return os.Rename(tmp, target)
+}
+
+func copyFile(src, dst string) error {
+	if dir := filepath.Dir(dst); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Synthetic Checks
+
+// Check is a synthetic check run by the agent of a system. Options are
+// specific to the type, see internal/checks.
+type Check struct {
+	ID        int             `json:"id"`
+	SystemID  int             `json:"system_id"`
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Target    string          `json:"target"`
+	Interval  int             `json:"interval"` // Seconds
+	Timeout   int             `json:"timeout"`  // Seconds
+	Options   json.RawMessage `json:"options"`
+	Enabled   bool            `json:"enabled"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type CheckResult struct {
+	CheckID    int       `json:"check_id"`
+	SystemID   int       `json:"system_id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Up         bool      `json:"up"`
+	LatencyMS  float64   `json:"latency_ms"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error"`
+}
+
+const checkColumns = "id, system_id, name, type, target, interval_seconds, timeout_seconds, options, enabled, created_at"
+
+func (s *sqlStore) CreateCheck(c *Check) (int64, error) {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now().UTC()
+	}
+	return s.insert("INSERT INTO checks (system_id, name, type, target, interval_seconds, timeout_seconds, options, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		c.SystemID, c.Name, c.Type, c.Target, c.Interval, c.Timeout, jsonObject(c.Options), c.Enabled, c.CreatedAt.UTC())
+}
+
+// UpdateCheck replaces the definition of the check with c.ID, keeping its
+// system. It returns sql.ErrNoRows unless the system belongs to userID.
+func (s *sqlStore) UpdateCheck(c *Check, userID int) error {
+	res, err := s.exec(`UPDATE checks SET name = ?, type = ?, target = ?, interval_seconds = ?, timeout_seconds = ?, options = ?, enabled = ?
+		WHERE id = ? AND system_id IN (SELECT id FROM systems WHERE user_id = ?)`,
+		c.Name, c.Type, c.Target, c.Interval, c.Timeout, jsonObject(c.Options), c.Enabled, c.ID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteCheck removes a check and its results, returning sql.ErrNoRows
+// unless its system belongs to userID.
+func (s *sqlStore) DeleteCheck(id, userID int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var systemID int
+	err = tx.queryRow("SELECT c.system_id FROM checks c JOIN systems s ON s.id = c.system_id WHERE c.id = ? AND s.user_id = ?", id, userID).Scan(&systemID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM check_results WHERE check_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM checks WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetCheck(id int) (*Check, error) {
+	checks, err := s.queryChecks("SELECT "+checkColumns+" FROM checks WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(checks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &checks[0], nil
+}
+
+func (s *sqlStore) GetChecks(systemID int) ([]Check, error) {
+	return s.queryChecks("SELECT "+checkColumns+" FROM checks WHERE system_id = ? ORDER BY name, id", systemID)
+}
+
+func (s *sqlStore) queryChecks(query string, args ...any) ([]Check, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := []Check{}
+	for rows.Next() {
+		var c Check
+		var options string
+		if err := rows.Scan(&c.ID, &c.SystemID, &c.Name, &c.Type, &c.Target, &c.Interval, &c.Timeout, &options, &c.Enabled, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		c.Options = json.RawMessage(options)
+		checks = append(checks, c)
+	}
+	return checks, rows.Err()
+}
+
+func (s *sqlStore) AddCheckResults(results []CheckResult) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range results {
+		if _, err := tx.exec("INSERT INTO check_results (check_id, system_id, timestamp, up, latency_ms, status_code, error) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			r.CheckID, r.SystemID, r.Timestamp.UTC(), r.Up, r.LatencyMS, r.StatusCode, r.Error); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const checkResultColumns = "check_id, system_id, timestamp, up, latency_ms, status_code, error"
+
+// GetCheckResults returns the results of a check since the given time, in
+// chronological order.
+func (s *sqlStore) GetCheckResults(checkID int, since time.Time) ([]CheckResult, error) {
+	return s.queryCheckResults("SELECT "+checkResultColumns+" FROM check_results WHERE check_id = ? AND timestamp >= ? ORDER BY timestamp", checkID, since.UTC())
+}
+
+// LastCheckResults returns up to n of the latest results of a check, newest
+// first.
+func (s *sqlStore) LastCheckResults(checkID, n int) ([]CheckResult, error) {
+	return s.queryCheckResults("SELECT "+checkResultColumns+" FROM check_results WHERE check_id = ? ORDER BY timestamp DESC LIMIT ?", checkID, n)
+}
+
+func (s *sqlStore) DeleteCheckResultsBefore(cutoff time.Time) (int64, error) {
+	res, err := s.exec("DELETE FROM check_results WHERE timestamp < ?", cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *sqlStore) queryCheckResults(query string, args ...any) ([]CheckResult, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []CheckResult{}
+	for rows.Next() {
+		var r CheckResult
+		if err := rows.Scan(&r.CheckID, &r.SystemID, &r.Timestamp, &r.Up, &r.LatencyMS, &r.StatusCode, &r.Error); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
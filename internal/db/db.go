@@ -2,22 +2,9 @@ package db
 
 import (
 	"database/sql"
-	"log"
-	"os"
 	"time"
-
-	_ "modernc.org/sqlite"
 )
 
-var DB *sql.DB
-
-type User struct {
-	ID           int       `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-}
-
 type System struct {
 	ID        int       `json:"id"`
 	UserID    int       `json:"user_id"`
@@ -25,79 +12,30 @@ type System struct {
 	URL       string    `json:"url"`
 	APIKey    string    `json:"api_key"`
 	CreatedAt time.Time `json:"created_at"`
-}
-
-func InitDB() {
-	os.MkdirAll("data", 0755)
-	dbPath := "data/server-moni.db"
-	
-	var err error
-	DB, err = sql.Open("sqlite", dbPath)
-	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
-	}
-
-	createConfigTable := `CREATE TABLE IF NOT EXISTS config (
-		key TEXT PRIMARY KEY,
-		value TEXT
-	);`
 
-	createUsersTable := `CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		email TEXT UNIQUE NOT NULL,
-		password_hash TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createSystemsTable := `CREATE TABLE IF NOT EXISTS systems (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		name TEXT NOT NULL,
-		url TEXT NOT NULL,
-		api_key TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);`
-
-	if _, err := DB.Exec(createConfigTable); err != nil {
-		log.Fatalf("Failed to create config table: %v", err)
-	}
-
-	if _, err := DB.Exec(createUsersTable); err != nil {
-		log.Fatalf("Failed to create users table: %v", err)
-	}
-
-	if _, err := DB.Exec(createSystemsTable); err != nil {
-		log.Fatalf("Failed to create systems table: %v", err)
-	}
-
-	InitSessionsTable()
-	InitDiskHistoryTable()
+	Tags   map[string]string `json:"tags"`   // Effective tags (user tags override agent tags)
+	Groups []string          `json:"groups"` // Names of the groups the system belongs to
 }
 
-func GetConfig(key string) (string, error) {
+func (s *sqlStore) GetConfig(key string) (string, error) {
 	var value string
-	err := DB.QueryRow("SELECT value FROM config WHERE key = ?", key).Scan(&value)
+	err := s.queryRow("SELECT value FROM config WHERE key = ?", key).Scan(&value)
 	return value, err
 }
 
-func SetConfig(key, value string) error {
-	_, err := DB.Exec("INSERT OR REPLACE INTO config (key, value) VALUES (?, ?)", key, value)
+func (s *sqlStore) SetConfig(key, value string) error {
+	_, err := s.exec("INSERT INTO config (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value", key, value)
 	return err
 }
 
 // System Management
 
-func AddSystem(userID int, name, url, apiKey string) (int64, error) {
-	res, err := DB.Exec("INSERT INTO systems (user_id, name, url, api_key) VALUES (?, ?, ?, ?)", userID, name, url, apiKey)
-	if err != nil {
-		return 0, err
-	}
-	return res.LastInsertId()
+func (s *sqlStore) AddSystem(userID int, name, url, apiKey string) (int64, error) {
+	return s.insert("INSERT INTO systems (user_id, name, url, api_key) VALUES (?, ?, ?, ?)", userID, name, url, apiKey)
 }
 
-func GetSystems(userID int) ([]System, error) {
-	rows, err := DB.Query("SELECT id, user_id, name, url, api_key, created_at FROM systems WHERE user_id = ? ORDER BY created_at DESC", userID)
+func (s *sqlStore) GetSystems(userID int) ([]System, error) {
+	rows, err := s.query("SELECT id, user_id, name, url, api_key, created_at FROM systems WHERE user_id = ? ORDER BY created_at DESC", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -105,144 +43,220 @@ func GetSystems(userID int) ([]System, error) {
 
 	var systems []System
 	for rows.Next() {
-		var s System
-		if err := rows.Scan(&s.ID, &s.UserID, &s.Name, &s.URL, &s.APIKey, &s.CreatedAt); err != nil {
+		var sys System
+		if err := rows.Scan(&sys.ID, &sys.UserID, &sys.Name, &sys.URL, &sys.APIKey, &sys.CreatedAt); err != nil {
 			return nil, err
 		}
-		systems = append(systems, s)
+		systems = append(systems, sys)
 	}
-	return systems, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return systems, s.loadSystemTags(systems)
 }
 
-func GetSystem(id int) (*System, error) {
-	var s System
-	err := DB.QueryRow("SELECT id, user_id, name, url, api_key, created_at FROM systems WHERE id = ?", id).Scan(&s.ID, &s.UserID, &s.Name, &s.URL, &s.APIKey, &s.CreatedAt)
+func (s *sqlStore) GetSystem(id int) (*System, error) {
+	var sys System
+	err := s.queryRow("SELECT id, user_id, name, url, api_key, created_at FROM systems WHERE id = ?", id).Scan(&sys.ID, &sys.UserID, &sys.Name, &sys.URL, &sys.APIKey, &sys.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
-	return &s, nil
+	systems := []System{sys}
+	if err := s.loadSystemTags(systems); err != nil {
+		return nil, err
+	}
+	return &systems[0], nil
 }
 
-func GetSystemByAPIKey(apiKey string) (*System, error) {
-	var s System
-	err := DB.QueryRow("SELECT id, user_id, name, url, api_key, created_at FROM systems WHERE api_key = ?", apiKey).Scan(&s.ID, &s.UserID, &s.Name, &s.URL, &s.APIKey, &s.CreatedAt)
+func (s *sqlStore) GetSystemByAPIKey(apiKey string) (*System, error) {
+	var sys System
+	err := s.queryRow("SELECT id, user_id, name, url, api_key, created_at FROM systems WHERE api_key = ?", apiKey).Scan(&sys.ID, &sys.UserID, &sys.Name, &sys.URL, &sys.APIKey, &sys.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
-	return &s, nil
-}
-
-func DeleteSystem(id, userID int) error {
-	_, err := DB.Exec("DELETE FROM systems WHERE id = ? AND user_id = ?", id, userID)
-	return err
-}
-
-// User Management
-
-func CreateUser(email, passwordHash string) error {
-	_, err := DB.Exec("INSERT INTO users (email, password_hash) VALUES (?, ?)", email, passwordHash)
-	return err
+	return &sys, nil
 }
 
-func GetUserByEmail(email string) (*User, error) {
-	var u User
-	err := DB.QueryRow("SELECT id, email, password_hash, created_at FROM users WHERE email = ?", email).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt)
+func (s *sqlStore) DeleteSystem(id, userID int) error {
+	tx, err := s.begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &u, nil
-}
+	defer tx.Rollback()
 
-func GetUserByID(id int) (*User, error) {
-	var u User
-	err := DB.QueryRow("SELECT id, email, password_hash, created_at FROM users WHERE id = ?", id).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt)
+	var owner int
+	err = tx.queryRow("SELECT user_id FROM systems WHERE id = ?", id).Scan(&owner)
+	if err == sql.ErrNoRows || (err == nil && owner != userID) {
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := deleteSystemTags(tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM disk_history WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM metric_samples WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM check_results WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM checks WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM process_samples WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM process_watches WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM packages WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM inventories WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM log_events WHERE system_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM systems WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		return err
 	}
-	return &u, nil
+	return tx.Commit()
 }
 
-// Session Management
+// Disk History
 
-type Session struct {
-	Token     string    `json:"token"`
-	UserID    int       `json:"user_id"`
-	ExpiresAt time.Time `json:"expires_at"`
+// DiskHistory is a capacity snapshot of one filesystem of a system.
+type DiskHistory struct {
+	ID          int64     `json:"id"`
+	SystemID    int       `json:"system_id"`
+	Mountpoint  string    `json:"mountpoint"`
+	Timestamp   time.Time `json:"timestamp"`
+	UsedPercent float64   `json:"used_percent"`
+	Total       uint64    `json:"total"`
+	Used        uint64    `json:"used"`
 }
 
-func InitSessionsTable() {
-	createTable := `CREATE TABLE IF NOT EXISTS sessions (
-		token TEXT PRIMARY KEY,
-		user_id INTEGER NOT NULL,
-		expires_at DATETIME NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);`
-	if _, err := DB.Exec(createTable); err != nil {
-		log.Fatalf("Failed to create sessions table: %v", err)
+// AddDiskHistory stores a set of snapshots, typically every mount of a
+// system taken at the same time.
+func (s *sqlStore) AddDiskHistory(entries []DiskHistory) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
 	}
-}
+	defer tx.Rollback()
 
-func CreateSession(token string, userID int, expiresAt time.Time) error {
-	_, err := DB.Exec("INSERT INTO sessions (token, user_id, expires_at) VALUES (?, ?, ?)", token, userID, expiresAt)
-	return err
+	for _, h := range entries {
+		if h.Timestamp.IsZero() {
+			h.Timestamp = time.Now()
+		}
+		if _, err := tx.exec("INSERT INTO disk_history (system_id, mountpoint, timestamp, used_percent, total, used) VALUES (?, ?, ?, ?, ?, ?)",
+			h.SystemID, h.Mountpoint, h.Timestamp.UTC(), h.UsedPercent, h.Total, h.Used); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func GetSession(token string) (*Session, error) {
-	var s Session
-	err := DB.QueryRow("SELECT token, user_id, expires_at FROM sessions WHERE token = ?", token).Scan(&s.Token, &s.UserID, &s.ExpiresAt)
+// GetDiskHistory returns the snapshots of a system taken at or after since,
+// ordered by mountpoint and time. An empty mountpoint selects all mounts.
+func (s *sqlStore) GetDiskHistory(systemID int, mountpoint string, since time.Time) ([]DiskHistory, error) {
+	query := "SELECT id, system_id, mountpoint, timestamp, used_percent, total, used FROM disk_history WHERE system_id = ? AND timestamp >= ?"
+	args := []any{systemID, since.UTC()}
+	if mountpoint != "" {
+		query += " AND mountpoint = ?"
+		args = append(args, mountpoint)
+	}
+	rows, err := s.query(query+" ORDER BY mountpoint, timestamp", args...)
 	if err != nil {
 		return nil, err
 	}
-	return &s, nil
+	defer rows.Close()
+
+	history := []DiskHistory{}
+	for rows.Next() {
+		var h DiskHistory
+		if err := rows.Scan(&h.ID, &h.SystemID, &h.Mountpoint, &h.Timestamp, &h.UsedPercent, &h.Total, &h.Used); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
 }
 
-func DeleteSession(token string) error {
-	_, err := DB.Exec("DELETE FROM sessions WHERE token = ?", token)
-	return err
+// LastDiskHistory returns when the latest snapshot of a system was taken, or
+// the zero time if there is none.
+func (s *sqlStore) LastDiskHistory(systemID int) (time.Time, error) {
+	var t time.Time
+	err := s.queryRow("SELECT timestamp FROM disk_history WHERE system_id = ? ORDER BY timestamp DESC LIMIT 1", systemID).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return t, err
 }
 
-// Disk History
+// Metric History
 
-type DiskHistory struct {
-	ID          int64     `json:"id"`
-	Timestamp   time.Time `json:"timestamp"`
-	UsedPercent float64   `json:"used_percent"`
-	Total       uint64    `json:"total"`
-	Used        uint64    `json:"used"`
+// MetricSample is one value of a headline metric series of a system, see
+// metrics.HistoryMetrics.
+type MetricSample struct {
+	SystemID  int       `json:"system_id"`
+	Metric    string    `json:"metric"`
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
 }
 
-func InitDiskHistoryTable() {
-	createTable := `CREATE TABLE IF NOT EXISTS disk_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-		used_percent REAL,
-		total INTEGER,
-		used INTEGER
-	);`
-	if _, err := DB.Exec(createTable); err != nil {
-		log.Printf("Failed to create disk_history table: %v", err)
+func (s *sqlStore) AddMetricSamples(samples []MetricSample) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
 	}
-}
+	defer tx.Rollback()
 
-func AddDiskHistory(usedPercent float64, total, used uint64) error {
-	_, err := DB.Exec("INSERT INTO disk_history (used_percent, total, used) VALUES (?, ?, ?)", usedPercent, total, used)
-	return err
+	for _, m := range samples {
+		if _, err := tx.exec("INSERT INTO metric_samples (system_id, metric, timestamp, value) VALUES (?, ?, ?, ?)",
+			m.SystemID, m.Metric, m.Timestamp.UTC(), m.Value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func GetDiskHistory(limit int) ([]DiskHistory, error) {
-	rows, err := DB.Query("SELECT id, timestamp, used_percent, total, used FROM disk_history ORDER BY timestamp DESC LIMIT ?", limit)
+// GetMetricSamples returns the samples of one metric of a system taken in
+// [from, to), in chronological order. A zero to leaves the range open.
+func (s *sqlStore) GetMetricSamples(systemID int, metric string, from, to time.Time) ([]MetricSample, error) {
+	query := "SELECT system_id, metric, timestamp, value FROM metric_samples WHERE system_id = ? AND metric = ? AND timestamp >= ?"
+	args := []any{systemID, metric, from.UTC()}
+	if !to.IsZero() {
+		query += " AND timestamp < ?"
+		args = append(args, to.UTC())
+	}
+	rows, err := s.query(query+" ORDER BY timestamp", args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var history []DiskHistory
+	samples := []MetricSample{}
 	for rows.Next() {
-		var h DiskHistory
-		if err := rows.Scan(&h.ID, &h.Timestamp, &h.UsedPercent, &h.Total, &h.Used); err != nil {
+		var m MetricSample
+		if err := rows.Scan(&m.SystemID, &m.Metric, &m.Timestamp, &m.Value); err != nil {
 			return nil, err
 		}
-		history = append(history, h)
+		samples = append(samples, m)
+	}
+	return samples, rows.Err()
+}
+
+// DeleteMetricSamplesBefore drops samples older than the retention cutoff.
+func (s *sqlStore) DeleteMetricSamplesBefore(cutoff time.Time) (int64, error) {
+	res, err := s.exec("DELETE FROM metric_samples WHERE timestamp < ?", cutoff.UTC())
+	if err != nil {
+		return 0, err
 	}
-	return history, nil
+	return res.RowsAffected()
 }
@@ -0,0 +1,100 @@
+package db
+
+import "time"
+
+// Software Inventory
+
+// SoftwareInventory is the latest inventory uploaded by the agent of a
+// system, see internal/inventory. Its packages are stored apart.
+type SoftwareInventory struct {
+	SystemID        int       `json:"system_id"`
+	CollectedAt     time.Time `json:"collected_at"`
+	Manager         string    `json:"manager"`
+	PendingUpdates  int       `json:"pending_updates"`
+	SecurityUpdates int       `json:"security_updates"`
+	UpdatesError    string    `json:"updates_error,omitempty"`
+	RunningKernel   string    `json:"running_kernel,omitempty"`
+	InstalledKernel string    `json:"installed_kernel,omitempty"`
+	RebootRequired  bool      `json:"reboot_required"`
+}
+
+// InstalledPackage is a package of the inventory of a system.
+type InstalledPackage struct {
+	SystemID  int    `json:"system_id"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Arch      string `json:"arch,omitempty"`
+	Available string `json:"available,omitempty"`
+	Security  bool   `json:"security,omitempty"`
+}
+
+// SaveInventory replaces the inventory of inv.SystemID and its packages.
+func (s *sqlStore) SaveInventory(inv *SoftwareInventory, packages []InstalledPackage) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.exec("DELETE FROM packages WHERE system_id = ?", inv.SystemID); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM inventories WHERE system_id = ?", inv.SystemID); err != nil {
+		return err
+	}
+	if _, err := tx.exec(`INSERT INTO inventories (system_id, collected_at, manager, pending_updates, security_updates, updates_error, running_kernel, installed_kernel, reboot_required)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		inv.SystemID, inv.CollectedAt.UTC(), inv.Manager, inv.PendingUpdates, inv.SecurityUpdates, inv.UpdatesError, inv.RunningKernel, inv.InstalledKernel, inv.RebootRequired); err != nil {
+		return err
+	}
+	for _, p := range packages {
+		if _, err := tx.exec("INSERT INTO packages (system_id, name, version, arch, available, security) VALUES (?, ?, ?, ?, ?, ?)",
+			inv.SystemID, p.Name, p.Version, p.Arch, p.Available, p.Security); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetInventory returns the inventory of a system, or sql.ErrNoRows if its
+// agent hasn't uploaded one.
+func (s *sqlStore) GetInventory(systemID int) (*SoftwareInventory, error) {
+	var inv SoftwareInventory
+	err := s.queryRow(`SELECT system_id, collected_at, manager, pending_updates, security_updates, updates_error, running_kernel, installed_kernel, reboot_required
+		FROM inventories WHERE system_id = ?`, systemID).Scan(
+		&inv.SystemID, &inv.CollectedAt, &inv.Manager, &inv.PendingUpdates, &inv.SecurityUpdates, &inv.UpdatesError, &inv.RunningKernel, &inv.InstalledKernel, &inv.RebootRequired)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (s *sqlStore) GetInstalledPackages(systemID int) ([]InstalledPackage, error) {
+	return s.queryPackages("SELECT system_id, name, version, arch, available, security FROM packages WHERE system_id = ? ORDER BY name, arch", systemID)
+}
+
+// FindInstalledPackages returns the packages with a name across the
+// systems of a user, ordered by system.
+func (s *sqlStore) FindInstalledPackages(userID int, name string) ([]InstalledPackage, error) {
+	return s.queryPackages(`SELECT p.system_id, p.name, p.version, p.arch, p.available, p.security
+		FROM packages p JOIN systems s ON s.id = p.system_id
+		WHERE p.name = ? AND s.user_id = ? ORDER BY p.system_id, p.arch`, name, userID)
+}
+
+func (s *sqlStore) queryPackages(query string, args ...any) ([]InstalledPackage, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packages := []InstalledPackage{}
+	for rows.Next() {
+		var p InstalledPackage
+		if err := rows.Scan(&p.SystemID, &p.Name, &p.Version, &p.Arch, &p.Available, &p.Security); err != nil {
+			return nil, err
+		}
+		packages = append(packages, p)
+	}
+	return packages, rows.Err()
+}
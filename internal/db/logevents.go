@@ -0,0 +1,101 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Log Events
+
+// LogEvent is an event the agent of a system extracted from its logs, see
+// internal/logtail.
+type LogEvent struct {
+	SystemID  int               `json:"system_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Source    string            `json:"source"`
+	Event     string            `json:"event"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Message   string            `json:"message"`
+}
+
+// LogEventQuery selects the log events of a system. Empty fields match
+// everything.
+type LogEventQuery struct {
+	Since  time.Time
+	Source string
+	Events []string
+	Limit  int // At most this many, the newest; 0 for all
+}
+
+func (s *sqlStore) AddLogEvents(events []LogEvent) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range events {
+		fields, err := json.Marshal(e.Fields)
+		if err != nil {
+			return err
+		}
+		if e.Fields == nil {
+			fields = []byte("{}")
+		}
+		if _, err := tx.exec("INSERT INTO log_events (system_id, timestamp, source, event, fields, message) VALUES (?, ?, ?, ?, ?, ?)",
+			e.SystemID, e.Timestamp.UTC(), e.Source, e.Event, string(fields), e.Message); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetLogEvents returns the log events of a system matching q, newest first.
+func (s *sqlStore) GetLogEvents(systemID int, q LogEventQuery) ([]LogEvent, error) {
+	query := "SELECT system_id, timestamp, source, event, fields, message FROM log_events WHERE system_id = ? AND timestamp >= ?"
+	args := []any{systemID, q.Since.UTC()}
+	if q.Source != "" {
+		query += " AND source = ?"
+		args = append(args, q.Source)
+	}
+	if len(q.Events) > 0 {
+		query += " AND event IN (?" + strings.Repeat(", ?", len(q.Events)-1) + ")"
+		for _, e := range q.Events {
+			args = append(args, e)
+		}
+	}
+	query += " ORDER BY timestamp DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []LogEvent{}
+	for rows.Next() {
+		var e LogEvent
+		var fields string
+		if err := rows.Scan(&e.SystemID, &e.Timestamp, &e.Source, &e.Event, &fields, &e.Message); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(fields), &e.Fields); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *sqlStore) DeleteLogEventsBefore(cutoff time.Time) (int64, error) {
+	res, err := s.exec("DELETE FROM log_events WHERE timestamp < ?", cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
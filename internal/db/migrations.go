@@ -0,0 +1,287 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SchemaVersion is the schema version this binary expects. Every dialect
+// defines exactly this many migrations, numbered from 1, with the same
+// meaning for each version number.
+const SchemaVersion = 12
+
+// Migration describes one schema version and whether it has been applied.
+type Migration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+}
+
+// migration is a single dialect-specific schema change. Each one runs in
+// its own transaction together with its schema_migrations bookkeeping.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sqlTx) error
+	down    func(tx *sqlTx) error
+}
+
+// Every dialect must define the same versions; a gap or mismatch is a
+// programming error caught at startup.
+func init() {
+	for name, ms := range map[string][]migration{"sqlite": sqliteMigrations, "postgres": postgresMigrations} {
+		if len(ms) != SchemaVersion {
+			panic(fmt.Sprintf("db: %s defines %d migrations, SchemaVersion is %d", name, len(ms), SchemaVersion))
+		}
+		for i, m := range ms {
+			if m.version != i+1 || m.up == nil || m.down == nil {
+				panic(fmt.Sprintf("db: %s migration %d is out of order or incomplete", name, i+1))
+			}
+		}
+	}
+}
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// binary. Running against it could corrupt data the older code does not
+// understand.
+type ErrSchemaTooNew struct {
+	Database, Binary int
+}
+
+func (e ErrSchemaTooNew) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than this binary supports (%d); upgrade the server or roll back with a newer binary", e.Database, e.Binary)
+}
+
+// ErrSchemaOutdated is returned when migrations are pending and automatic
+// migration is disabled.
+type ErrSchemaOutdated struct {
+	Database, Binary int
+}
+
+func (e ErrSchemaOutdated) Error() string {
+	return fmt.Sprintf("database schema version %d is older than this binary expects (%d); run `server migrate up`", e.Database, e.Binary)
+}
+
+// statements returns a migration step that runs the given statements in order.
+func statements(stmts ...string) func(tx *sqlTx) error {
+	return func(tx *sqlTx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.tx.Exec(stmt); err != nil {
+				return fmt.Errorf("%w\n%s", err, stmt)
+			}
+		}
+		return nil
+	}
+}
+
+// steps chains migration steps.
+func steps(fns ...func(tx *sqlTx) error) func(tx *sqlTx) error {
+	return func(tx *sqlTx) error {
+		for _, fn := range fns {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (s *sqlStore) ensureMigrationsTable() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at ` + s.dialect.timestampType + ` NOT NULL
+	)`)
+	return err
+}
+
+func (s *sqlStore) appliedMigrations() (map[int]Migration, error) {
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	rows, err := s.query("SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]Migration)
+	for rows.Next() {
+		m := Migration{Applied: true}
+		if err := rows.Scan(&m.Version, &m.Name, &m.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[m.Version] = m
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the highest migration applied to the database, or 0
+// for an empty database.
+func (s *sqlStore) SchemaVersion() (int, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// MigrationStatus lists every migration known to this binary, plus any
+// applied by a newer one.
+func (s *sqlStore) MigrationStatus() ([]Migration, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]Migration, 0, len(s.dialect.migrations))
+	for _, m := range s.dialect.migrations {
+		if a, ok := applied[m.version]; ok {
+			status = append(status, a)
+			continue
+		}
+		status = append(status, Migration{Version: m.version, Name: m.name})
+	}
+	for v := SchemaVersion + 1; ; v++ {
+		a, ok := applied[v]
+		if !ok {
+			break
+		}
+		status = append(status, a)
+	}
+	return status, nil
+}
+
+// MigrateUp applies pending migrations up to and including target (0 means
+// the latest) and returns the ones it applied.
+func (s *sqlStore) MigrateUp(target int) ([]Migration, error) {
+	if target <= 0 || target > SchemaVersion {
+		target = SchemaVersion
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > SchemaVersion {
+		return nil, ErrSchemaTooNew{Database: current, Binary: SchemaVersion}
+	}
+
+	var done []Migration
+	for _, m := range s.dialect.migrations {
+		if m.version <= current || m.version > target {
+			continue
+		}
+		now := time.Now().UTC()
+		err := s.inTx(func(tx *sqlTx) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			_, err := tx.exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.version, m.name, now)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		done = append(done, Migration{Version: m.version, Name: m.name, Applied: true, AppliedAt: now})
+	}
+	return done, nil
+}
+
+// MigrateDown reverts applied migrations, newest first, until the database
+// is at the target version, and returns the ones it reverted. Reverting
+// drops the tables and columns the migrations created, with their data.
+func (s *sqlStore) MigrateDown(target int) ([]Migration, error) {
+	if target < 0 {
+		target = 0
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > SchemaVersion {
+		return nil, ErrSchemaTooNew{Database: current, Binary: SchemaVersion}
+	}
+
+	var done []Migration
+	for i := len(s.dialect.migrations) - 1; i >= 0; i-- {
+		m := s.dialect.migrations[i]
+		if m.version > current || m.version <= target {
+			continue
+		}
+		err := s.inTx(func(tx *sqlTx) error {
+			if err := m.down(tx); err != nil {
+				return err
+			}
+			_, err := tx.exec("DELETE FROM schema_migrations WHERE version = ?", m.version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("revert migration %d (%s): %w", m.version, m.name, err)
+		}
+		done = append(done, Migration{Version: m.version, Name: m.name})
+	}
+	return done, nil
+}
+
+// CheckSchema verifies the database is exactly at the version this binary
+// expects without changing it.
+func (s *sqlStore) CheckSchema() error {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	switch {
+	case current > SchemaVersion:
+		return ErrSchemaTooNew{Database: current, Binary: SchemaVersion}
+	case current < SchemaVersion:
+		return ErrSchemaOutdated{Database: current, Binary: SchemaVersion}
+	}
+	return nil
+}
+
+func (s *sqlStore) inTx(fn func(tx *sqlTx) error) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backfillSessionIDs gives sessions created before sessions had a public ID
+// one, so they can be listed and revoked.
+func backfillSessionIDs(tx *sqlTx) error {
+	rows, err := tx.query("SELECT token FROM sessions WHERE id IS NULL")
+	if err != nil {
+		return err
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+
+	now := time.Now().UTC()
+	for _, token := range tokens {
+		if _, err := tx.exec("UPDATE sessions SET id = ?, created_at = ?, last_used_at = ? WHERE token = ?", uuid.New().String(), now, now, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package db
+
+import (
+	"database/sql"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func openPostgres(url string) (Store, error) {
+	conn, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &sqlStore{
+		db: conn,
+		dialect: dialect{
+			name:           "postgres",
+			numberedParams: true,
+			timestampType:  "TIMESTAMPTZ",
+			migrations:     postgresMigrations,
+		},
+	}, nil
+}
+
+// Versions match sqliteMigrations one for one. Databases created before
+// migrations were introduced already have the full schema, so every up step
+// tolerates existing objects.
+var postgresMigrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS config (
+				key TEXT PRIMARY KEY,
+				value TEXT
+			);`,
+			`CREATE TABLE IF NOT EXISTS users (
+				id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				email TEXT UNIQUE NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			);`,
+			`CREATE TABLE IF NOT EXISTS systems (
+				id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				name TEXT NOT NULL,
+				url TEXT NOT NULL,
+				api_key TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_systems_api_key ON systems(api_key)",
+			`CREATE TABLE IF NOT EXISTS sessions (
+				token TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				expires_at TIMESTAMPTZ NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS disk_history (
+				id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				timestamp TIMESTAMPTZ NOT NULL DEFAULT now(),
+				used_percent DOUBLE PRECISION,
+				total BIGINT,
+				used BIGINT
+			);`,
+		),
+		down: statements(
+			"DROP TABLE IF EXISTS disk_history",
+			"DROP TABLE IF EXISTS sessions",
+			"DROP TABLE IF EXISTS systems",
+			"DROP TABLE IF EXISTS users",
+			"DROP TABLE IF EXISTS config",
+		),
+	},
+	{
+		version: 2,
+		name:    "session metadata and email verification",
+		up: steps(
+			statements(
+				"ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE",
+				"ALTER TABLE sessions ADD COLUMN IF NOT EXISTS id TEXT UNIQUE",
+				"ALTER TABLE sessions ADD COLUMN IF NOT EXISTS csrf_token TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE sessions ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ",
+				"ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ",
+			),
+			backfillSessionIDs,
+			statements("CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)"),
+		),
+		down: statements(
+			"DROP INDEX IF EXISTS idx_sessions_user",
+			`ALTER TABLE sessions DROP COLUMN IF EXISTS last_used_at, DROP COLUMN IF EXISTS created_at,
+				DROP COLUMN IF EXISTS user_agent, DROP COLUMN IF EXISTS ip,
+				DROP COLUMN IF EXISTS csrf_token, DROP COLUMN IF EXISTS id`,
+			"ALTER TABLE users DROP COLUMN IF EXISTS email_verified",
+		),
+	},
+	{
+		version: 3,
+		name:    "user tokens",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS user_tokens (
+				token_hash TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				purpose TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL,
+				used_at TIMESTAMPTZ
+			);`,
+		),
+		down: statements("DROP TABLE IF EXISTS user_tokens"),
+	},
+	{
+		version: 4,
+		name:    "audit log",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				created_at TIMESTAMPTZ NOT NULL,
+				user_id INTEGER NOT NULL DEFAULT 0,
+				actor TEXT NOT NULL,
+				action TEXT NOT NULL,
+				target_type TEXT NOT NULL DEFAULT '',
+				target_id TEXT NOT NULL DEFAULT '',
+				ip TEXT NOT NULL DEFAULT '',
+				user_agent TEXT NOT NULL DEFAULT '',
+				result TEXT NOT NULL,
+				details TEXT NOT NULL DEFAULT ''
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_audit_user_time ON audit_log(user_id, created_at)",
+			// The audit log is append-only: reject any attempt to rewrite history
+			`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit_log is append-only';
+			END;
+			$$ LANGUAGE plpgsql;`,
+			"DROP TRIGGER IF EXISTS audit_log_no_modify ON audit_log",
+			`CREATE TRIGGER audit_log_no_modify BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();`,
+		),
+		down: statements(
+			"DROP TABLE IF EXISTS audit_log",
+			"DROP FUNCTION IF EXISTS audit_log_append_only()",
+		),
+	},
+	{
+		version: 5,
+		name:    "system tags and groups",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS system_tags (
+				system_id INTEGER NOT NULL REFERENCES systems(id),
+				source TEXT NOT NULL,
+				key TEXT NOT NULL,
+				value TEXT NOT NULL,
+				PRIMARY KEY(system_id, source, key)
+			);`,
+			`CREATE TABLE IF NOT EXISTS system_groups (
+				id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				name TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+				UNIQUE(user_id, name)
+			);`,
+			`CREATE TABLE IF NOT EXISTS system_group_members (
+				group_id INTEGER NOT NULL REFERENCES system_groups(id),
+				system_id INTEGER NOT NULL REFERENCES systems(id),
+				PRIMARY KEY(group_id, system_id)
+			);`,
+		),
+		down: statements(
+			"DROP TABLE IF EXISTS system_group_members",
+			"DROP TABLE IF EXISTS system_groups",
+			"DROP TABLE IF EXISTS system_tags",
+		),
+	},
+	{
+		version: 6,
+		name:    "per-system disk history",
+		up: statements(
+			"ALTER TABLE disk_history ADD COLUMN IF NOT EXISTS system_id INTEGER NOT NULL DEFAULT 0",
+			"ALTER TABLE disk_history ADD COLUMN IF NOT EXISTS mountpoint TEXT NOT NULL DEFAULT ''",
+			"CREATE INDEX IF NOT EXISTS idx_disk_history_system ON disk_history(system_id, mountpoint, timestamp)",
+		),
+		down: statements(
+			"DROP INDEX IF EXISTS idx_disk_history_system",
+			"ALTER TABLE disk_history DROP COLUMN IF EXISTS mountpoint, DROP COLUMN IF EXISTS system_id",
+		),
+	},
+	{
+		version: 7,
+		name:    "alert rules",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS alert_rules (
+				id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				name TEXT NOT NULL,
+				condition TEXT NOT NULL,
+				params TEXT NOT NULL DEFAULT '{}',
+				selector TEXT NOT NULL DEFAULT '',
+				group_name TEXT NOT NULL DEFAULT '',
+				enabled BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMPTZ NOT NULL
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_alert_rules_user ON alert_rules(user_id)",
+		),
+		down: statements("DROP TABLE IF EXISTS alert_rules"),
+	},
+	{
+		version: 8,
+		name:    "metric history",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS metric_samples (
+				system_id INTEGER NOT NULL,
+				metric TEXT NOT NULL,
+				timestamp TIMESTAMPTZ NOT NULL,
+				value DOUBLE PRECISION NOT NULL
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_metric_samples_series ON metric_samples(system_id, metric, timestamp)",
+			"CREATE INDEX IF NOT EXISTS idx_metric_samples_time ON metric_samples(timestamp)",
+		),
+		down: statements("DROP TABLE IF EXISTS metric_samples"),
+	},
+	{
+		version: 9,
+		name:    "synthetic checks",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS checks (
+				id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				system_id INTEGER NOT NULL REFERENCES systems(id),
+				name TEXT NOT NULL,
+				type TEXT NOT NULL,
+				target TEXT NOT NULL,
+				interval_seconds INTEGER NOT NULL,
+				timeout_seconds INTEGER NOT NULL,
+				options TEXT NOT NULL DEFAULT '{}',
+				enabled BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMPTZ NOT NULL
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_checks_system ON checks(system_id)",
+			`CREATE TABLE IF NOT EXISTS check_results (
+				check_id INTEGER NOT NULL,
+				system_id INTEGER NOT NULL,
+				timestamp TIMESTAMPTZ NOT NULL,
+				up BOOLEAN NOT NULL,
+				latency_ms DOUBLE PRECISION NOT NULL,
+				status_code INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT ''
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_check_results_check ON check_results(check_id, timestamp)",
+			"CREATE INDEX IF NOT EXISTS idx_check_results_time ON check_results(timestamp)",
+		),
+		down: statements("DROP TABLE IF EXISTS check_results", "DROP TABLE IF EXISTS checks"),
+	},
+	{
+		version: 10,
+		name:    "process watches",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS process_watches (
+				id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+				system_id INTEGER NOT NULL REFERENCES systems(id),
+				name TEXT NOT NULL,
+				process TEXT NOT NULL DEFAULT '',
+				cmdline TEXT NOT NULL DEFAULT '',
+				user_name TEXT NOT NULL DEFAULT '',
+				pidfile TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_process_watches_system ON process_watches(system_id)",
+			`CREATE TABLE IF NOT EXISTS process_samples (
+				watch_id INTEGER NOT NULL,
+				system_id INTEGER NOT NULL,
+				timestamp TIMESTAMPTZ NOT NULL,
+				instances INTEGER NOT NULL,
+				cpu_percent DOUBLE PRECISION NOT NULL,
+				rss_bytes BIGINT NOT NULL,
+				threads INTEGER NOT NULL,
+				open_fds INTEGER NOT NULL,
+				read_rate BIGINT NOT NULL,
+				write_rate BIGINT NOT NULL
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_process_samples_watch ON process_samples(watch_id, timestamp)",
+			"CREATE INDEX IF NOT EXISTS idx_process_samples_time ON process_samples(timestamp)",
+		),
+		down: statements("DROP TABLE IF EXISTS process_samples", "DROP TABLE IF EXISTS process_watches"),
+	},
+	{
+		version: 11,
+		name:    "software inventory",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS inventories (
+				system_id INTEGER PRIMARY KEY REFERENCES systems(id),
+				collected_at TIMESTAMPTZ NOT NULL,
+				manager TEXT NOT NULL,
+				pending_updates INTEGER NOT NULL,
+				security_updates INTEGER NOT NULL,
+				updates_error TEXT NOT NULL DEFAULT '',
+				running_kernel TEXT NOT NULL DEFAULT '',
+				installed_kernel TEXT NOT NULL DEFAULT '',
+				reboot_required BOOLEAN NOT NULL DEFAULT FALSE
+			);`,
+			`CREATE TABLE IF NOT EXISTS packages (
+				system_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				version TEXT NOT NULL,
+				arch TEXT NOT NULL DEFAULT '',
+				available TEXT NOT NULL DEFAULT '',
+				security BOOLEAN NOT NULL DEFAULT FALSE
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_packages_system ON packages(system_id)",
+			"CREATE INDEX IF NOT EXISTS idx_packages_name ON packages(name)",
+		),
+		down: statements("DROP TABLE IF EXISTS packages", "DROP TABLE IF EXISTS inventories"),
+	},
+	{
+		version: 12,
+		name:    "log events",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS log_events (
+				system_id INTEGER NOT NULL,
+				timestamp TIMESTAMPTZ NOT NULL,
+				source TEXT NOT NULL,
+				event TEXT NOT NULL,
+				fields TEXT NOT NULL DEFAULT '{}',
+				message TEXT NOT NULL DEFAULT ''
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_log_events_system ON log_events(system_id, timestamp)",
+			"CREATE INDEX IF NOT EXISTS idx_log_events_time ON log_events(timestamp)",
+		),
+		down: statements("DROP TABLE IF EXISTS log_events"),
+	},
+}
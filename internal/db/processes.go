@@ -0,0 +1,164 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Process Watches
+
+// ProcessWatch selects processes the agent of a system always reports, see
+// internal/procwatch.
+type ProcessWatch struct {
+	ID        int       `json:"id"`
+	SystemID  int       `json:"system_id"`
+	Name      string    `json:"name"`
+	Process   string    `json:"process"`
+	Cmdline   string    `json:"cmdline"`
+	User      string    `json:"user"`
+	PIDFile   string    `json:"pidfile"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProcessSample is a point of the history of a watch, aggregated over its
+// instances.
+type ProcessSample struct {
+	WatchID    int       `json:"watch_id"`
+	SystemID   int       `json:"system_id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Instances  int       `json:"instances"`
+	CPUPercent float64   `json:"cpu_percent"`
+	RSSBytes   uint64    `json:"rss_bytes"`
+	Threads    int       `json:"threads"`
+	OpenFDs    int       `json:"open_fds"`
+	ReadRate   uint64    `json:"read_rate"`
+	WriteRate  uint64    `json:"write_rate"`
+}
+
+const processWatchColumns = "id, system_id, name, process, cmdline, user_name, pidfile, created_at"
+
+func (s *sqlStore) CreateProcessWatch(w *ProcessWatch) (int64, error) {
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now().UTC()
+	}
+	return s.insert("INSERT INTO process_watches (system_id, name, process, cmdline, user_name, pidfile, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		w.SystemID, w.Name, w.Process, w.Cmdline, w.User, w.PIDFile, w.CreatedAt.UTC())
+}
+
+// UpdateProcessWatch replaces the criteria of the watch with w.ID, keeping
+// its system. It returns sql.ErrNoRows unless the system belongs to userID.
+func (s *sqlStore) UpdateProcessWatch(w *ProcessWatch, userID int) error {
+	res, err := s.exec(`UPDATE process_watches SET name = ?, process = ?, cmdline = ?, user_name = ?, pidfile = ?
+		WHERE id = ? AND system_id IN (SELECT id FROM systems WHERE user_id = ?)`,
+		w.Name, w.Process, w.Cmdline, w.User, w.PIDFile, w.ID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteProcessWatch removes a watch and its history, returning
+// sql.ErrNoRows unless its system belongs to userID.
+func (s *sqlStore) DeleteProcessWatch(id, userID int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var systemID int
+	err = tx.queryRow("SELECT w.system_id FROM process_watches w JOIN systems s ON s.id = w.system_id WHERE w.id = ? AND s.user_id = ?", id, userID).Scan(&systemID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM process_samples WHERE watch_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("DELETE FROM process_watches WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetProcessWatch(id int) (*ProcessWatch, error) {
+	watches, err := s.queryProcessWatches("SELECT "+processWatchColumns+" FROM process_watches WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(watches) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &watches[0], nil
+}
+
+func (s *sqlStore) GetProcessWatches(systemID int) ([]ProcessWatch, error) {
+	return s.queryProcessWatches("SELECT "+processWatchColumns+" FROM process_watches WHERE system_id = ? ORDER BY name, id", systemID)
+}
+
+func (s *sqlStore) queryProcessWatches(query string, args ...any) ([]ProcessWatch, error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watches := []ProcessWatch{}
+	for rows.Next() {
+		var w ProcessWatch
+		if err := rows.Scan(&w.ID, &w.SystemID, &w.Name, &w.Process, &w.Cmdline, &w.User, &w.PIDFile, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+func (s *sqlStore) AddProcessSamples(samples []ProcessSample) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range samples {
+		if _, err := tx.exec("INSERT INTO process_samples (watch_id, system_id, timestamp, instances, cpu_percent, rss_bytes, threads, open_fds, read_rate, write_rate) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			p.WatchID, p.SystemID, p.Timestamp.UTC(), p.Instances, p.CPUPercent, int64(p.RSSBytes), p.Threads, p.OpenFDs, int64(p.ReadRate), int64(p.WriteRate)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetProcessSamples returns the history of a watch since the given time, in
+// chronological order.
+func (s *sqlStore) GetProcessSamples(watchID int, since time.Time) ([]ProcessSample, error) {
+	rows, err := s.query("SELECT watch_id, system_id, timestamp, instances, cpu_percent, rss_bytes, threads, open_fds, read_rate, write_rate FROM process_samples WHERE watch_id = ? AND timestamp >= ? ORDER BY timestamp",
+		watchID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []ProcessSample{}
+	for rows.Next() {
+		var p ProcessSample
+		var rss, read, write int64
+		if err := rows.Scan(&p.WatchID, &p.SystemID, &p.Timestamp, &p.Instances, &p.CPUPercent, &rss, &p.Threads, &p.OpenFDs, &read, &write); err != nil {
+			return nil, err
+		}
+		p.RSSBytes, p.ReadRate, p.WriteRate = uint64(rss), uint64(read), uint64(write)
+		samples = append(samples, p)
+	}
+	return samples, rows.Err()
+}
+
+func (s *sqlStore) DeleteProcessSamplesBefore(cutoff time.Time) (int64, error) {
+	res, err := s.exec("DELETE FROM process_samples WHERE timestamp < ?", cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
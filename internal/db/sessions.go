@@ -0,0 +1,106 @@
+package db
+
+import (
+	"time"
+)
+
+// Session Management
+
+type Session struct {
+	ID         string    `json:"id"`
+	Token      string    `json:"-"`
+	UserID     int       `json:"user_id"`
+	CSRFToken  string    `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+const sessionColumns = "id, token, user_id, csrf_token, ip, user_agent, created_at, last_used_at, expires_at"
+
+func (s *sqlStore) CreateSession(sess *Session) error {
+	_, err := s.exec("INSERT INTO sessions ("+sessionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		sess.ID, sess.Token, sess.UserID, sess.CSRFToken, sess.IP, sess.UserAgent, sess.CreatedAt, sess.LastUsedAt, sess.ExpiresAt)
+	return err
+}
+
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	var s Session
+	var createdAt, lastUsedAt *time.Time
+	if err := row.Scan(&s.ID, &s.Token, &s.UserID, &s.CSRFToken, &s.IP, &s.UserAgent, &createdAt, &lastUsedAt, &s.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if createdAt != nil {
+		s.CreatedAt = *createdAt
+	}
+	if lastUsedAt != nil {
+		s.LastUsedAt = *lastUsedAt
+	}
+	return &s, nil
+}
+
+func (s *sqlStore) GetSession(token string) (*Session, error) {
+	return scanSession(s.queryRow("SELECT "+sessionColumns+" FROM sessions WHERE token = ?", token))
+}
+
+// GetUserSessions returns the unexpired sessions of a user, most recently used first.
+func (s *sqlStore) GetUserSessions(userID int) ([]Session, error) {
+	rows, err := s.query("SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY last_used_at DESC", userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *sess)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity on a session and slides its expiry forward.
+func (s *sqlStore) TouchSession(token string, lastUsedAt, expiresAt time.Time) error {
+	_, err := s.exec("UPDATE sessions SET last_used_at = ?, expires_at = ? WHERE token = ?", lastUsedAt, expiresAt, token)
+	return err
+}
+
+func (s *sqlStore) DeleteSession(token string) error {
+	_, err := s.exec("DELETE FROM sessions WHERE token = ?", token)
+	return err
+}
+
+// DeleteUserSession revokes a session by its public ID. It reports whether a
+// session owned by the user was found.
+func (s *sqlStore) DeleteUserSession(userID int, id string) (bool, error) {
+	res, err := s.exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteUserSessions revokes every session of a user except the one with the
+// given ID (pass "" to revoke all of them).
+func (s *sqlStore) DeleteUserSessions(userID int, exceptID string) (int64, error) {
+	res, err := s.exec("DELETE FROM sessions WHERE user_id = ? AND id != ?", userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpiredSessions removes sessions whose expiry is in the past.
+func (s *sqlStore) DeleteExpiredSessions() (int64, error) {
+	res, err := s.exec("DELETE FROM sessions WHERE expires_at < ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,369 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+func openSQLite(path string) (Store, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{
+		db: conn,
+		dialect: dialect{
+			name:          "sqlite",
+			timestampType: "DATETIME",
+			migrations:    sqliteMigrations,
+		},
+	}, nil
+}
+
+// Databases created before migrations were introduced have some or all of
+// these tables and columns already, so every up step tolerates existing
+// objects.
+var sqliteMigrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS config (
+				key TEXT PRIMARY KEY,
+				value TEXT
+			);`,
+			`CREATE TABLE IF NOT EXISTS users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				email TEXT UNIQUE NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);`,
+			`CREATE TABLE IF NOT EXISTS systems (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				url TEXT NOT NULL,
+				api_key TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(user_id) REFERENCES users(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS sessions (
+				token TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				expires_at DATETIME NOT NULL,
+				FOREIGN KEY(user_id) REFERENCES users(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS disk_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+				used_percent REAL,
+				total INTEGER,
+				used INTEGER
+			);`,
+		),
+		down: statements(
+			"DROP TABLE IF EXISTS disk_history",
+			"DROP TABLE IF EXISTS sessions",
+			"DROP TABLE IF EXISTS systems",
+			"DROP TABLE IF EXISTS users",
+			"DROP TABLE IF EXISTS config",
+		),
+	},
+	{
+		version: 2,
+		name:    "session metadata and email verification",
+		// Existing accounts predate email verification and are treated as
+		// verified.
+		up: steps(
+			sqliteAddColumns(
+				"users", "email_verified INTEGER NOT NULL DEFAULT 1",
+				"sessions", "id TEXT",
+				"sessions", "csrf_token TEXT NOT NULL DEFAULT ''",
+				"sessions", "ip TEXT NOT NULL DEFAULT ''",
+				"sessions", "user_agent TEXT NOT NULL DEFAULT ''",
+				"sessions", "created_at DATETIME",
+				"sessions", "last_used_at DATETIME",
+			),
+			backfillSessionIDs,
+			statements("CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)"),
+		),
+		down: statements(
+			"DROP INDEX IF EXISTS idx_sessions_user",
+			"ALTER TABLE sessions DROP COLUMN last_used_at",
+			"ALTER TABLE sessions DROP COLUMN created_at",
+			"ALTER TABLE sessions DROP COLUMN user_agent",
+			"ALTER TABLE sessions DROP COLUMN ip",
+			"ALTER TABLE sessions DROP COLUMN csrf_token",
+			"ALTER TABLE sessions DROP COLUMN id",
+			"ALTER TABLE users DROP COLUMN email_verified",
+		),
+	},
+	{
+		version: 3,
+		name:    "user tokens",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS user_tokens (
+				token_hash TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				purpose TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME,
+				FOREIGN KEY(user_id) REFERENCES users(id)
+			);`,
+		),
+		down: statements("DROP TABLE IF EXISTS user_tokens"),
+	},
+	{
+		version: 4,
+		name:    "audit log",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				created_at DATETIME NOT NULL,
+				user_id INTEGER NOT NULL DEFAULT 0,
+				actor TEXT NOT NULL,
+				action TEXT NOT NULL,
+				target_type TEXT NOT NULL DEFAULT '',
+				target_id TEXT NOT NULL DEFAULT '',
+				ip TEXT NOT NULL DEFAULT '',
+				user_agent TEXT NOT NULL DEFAULT '',
+				result TEXT NOT NULL,
+				details TEXT NOT NULL DEFAULT ''
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_audit_user_time ON audit_log(user_id, created_at)",
+			// The audit log is append-only: reject any attempt to rewrite history
+			`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+			`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+		),
+		down: statements(
+			"DROP TRIGGER IF EXISTS audit_log_no_delete",
+			"DROP TRIGGER IF EXISTS audit_log_no_update",
+			"DROP TABLE IF EXISTS audit_log",
+		),
+	},
+	{
+		version: 5,
+		name:    "system tags and groups",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS system_tags (
+				system_id INTEGER NOT NULL,
+				source TEXT NOT NULL,
+				key TEXT NOT NULL,
+				value TEXT NOT NULL,
+				PRIMARY KEY(system_id, source, key),
+				FOREIGN KEY(system_id) REFERENCES systems(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS system_groups (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE(user_id, name),
+				FOREIGN KEY(user_id) REFERENCES users(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS system_group_members (
+				group_id INTEGER NOT NULL,
+				system_id INTEGER NOT NULL,
+				PRIMARY KEY(group_id, system_id),
+				FOREIGN KEY(group_id) REFERENCES system_groups(id),
+				FOREIGN KEY(system_id) REFERENCES systems(id)
+			);`,
+		),
+		down: statements(
+			"DROP TABLE IF EXISTS system_group_members",
+			"DROP TABLE IF EXISTS system_groups",
+			"DROP TABLE IF EXISTS system_tags",
+		),
+	},
+	{
+		version: 6,
+		name:    "per-system disk history",
+		// Rows recorded by agents before this version belong to no system
+		up: steps(
+			sqliteAddColumns(
+				"disk_history", "system_id INTEGER NOT NULL DEFAULT 0",
+				"disk_history", "mountpoint TEXT NOT NULL DEFAULT ''",
+			),
+			statements("CREATE INDEX IF NOT EXISTS idx_disk_history_system ON disk_history(system_id, mountpoint, timestamp)"),
+		),
+		down: statements(
+			"DROP INDEX IF EXISTS idx_disk_history_system",
+			"ALTER TABLE disk_history DROP COLUMN mountpoint",
+			"ALTER TABLE disk_history DROP COLUMN system_id",
+		),
+	},
+	{
+		version: 7,
+		name:    "alert rules",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS alert_rules (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				condition TEXT NOT NULL,
+				params TEXT NOT NULL DEFAULT '{}',
+				selector TEXT NOT NULL DEFAULT '',
+				group_name TEXT NOT NULL DEFAULT '',
+				enabled INTEGER NOT NULL DEFAULT 1,
+				created_at DATETIME NOT NULL,
+				FOREIGN KEY(user_id) REFERENCES users(id)
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_alert_rules_user ON alert_rules(user_id)",
+		),
+		down: statements("DROP TABLE IF EXISTS alert_rules"),
+	},
+	{
+		version: 8,
+		name:    "metric history",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS metric_samples (
+				system_id INTEGER NOT NULL,
+				metric TEXT NOT NULL,
+				timestamp DATETIME NOT NULL,
+				value REAL NOT NULL
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_metric_samples_series ON metric_samples(system_id, metric, timestamp)",
+			"CREATE INDEX IF NOT EXISTS idx_metric_samples_time ON metric_samples(timestamp)",
+		),
+		down: statements("DROP TABLE IF EXISTS metric_samples"),
+	},
+	{
+		version: 9,
+		name:    "synthetic checks",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS checks (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				system_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				type TEXT NOT NULL,
+				target TEXT NOT NULL,
+				interval_seconds INTEGER NOT NULL,
+				timeout_seconds INTEGER NOT NULL,
+				options TEXT NOT NULL DEFAULT '{}',
+				enabled INTEGER NOT NULL DEFAULT 1,
+				created_at DATETIME NOT NULL,
+				FOREIGN KEY(system_id) REFERENCES systems(id)
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_checks_system ON checks(system_id)",
+			`CREATE TABLE IF NOT EXISTS check_results (
+				check_id INTEGER NOT NULL,
+				system_id INTEGER NOT NULL,
+				timestamp DATETIME NOT NULL,
+				up INTEGER NOT NULL,
+				latency_ms REAL NOT NULL,
+				status_code INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT ''
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_check_results_check ON check_results(check_id, timestamp)",
+			"CREATE INDEX IF NOT EXISTS idx_check_results_time ON check_results(timestamp)",
+		),
+		down: statements("DROP TABLE IF EXISTS check_results", "DROP TABLE IF EXISTS checks"),
+	},
+	{
+		version: 10,
+		name:    "process watches",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS process_watches (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				system_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				process TEXT NOT NULL DEFAULT '',
+				cmdline TEXT NOT NULL DEFAULT '',
+				user_name TEXT NOT NULL DEFAULT '',
+				pidfile TEXT NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL,
+				FOREIGN KEY(system_id) REFERENCES systems(id)
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_process_watches_system ON process_watches(system_id)",
+			`CREATE TABLE IF NOT EXISTS process_samples (
+				watch_id INTEGER NOT NULL,
+				system_id INTEGER NOT NULL,
+				timestamp DATETIME NOT NULL,
+				instances INTEGER NOT NULL,
+				cpu_percent REAL NOT NULL,
+				rss_bytes INTEGER NOT NULL,
+				threads INTEGER NOT NULL,
+				open_fds INTEGER NOT NULL,
+				read_rate INTEGER NOT NULL,
+				write_rate INTEGER NOT NULL
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_process_samples_watch ON process_samples(watch_id, timestamp)",
+			"CREATE INDEX IF NOT EXISTS idx_process_samples_time ON process_samples(timestamp)",
+		),
+		down: statements("DROP TABLE IF EXISTS process_samples", "DROP TABLE IF EXISTS process_watches"),
+	},
+	{
+		version: 11,
+		name:    "software inventory",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS inventories (
+				system_id INTEGER PRIMARY KEY,
+				collected_at DATETIME NOT NULL,
+				manager TEXT NOT NULL,
+				pending_updates INTEGER NOT NULL,
+				security_updates INTEGER NOT NULL,
+				updates_error TEXT NOT NULL DEFAULT '',
+				running_kernel TEXT NOT NULL DEFAULT '',
+				installed_kernel TEXT NOT NULL DEFAULT '',
+				reboot_required INTEGER NOT NULL DEFAULT 0,
+				FOREIGN KEY(system_id) REFERENCES systems(id)
+			);`,
+			`CREATE TABLE IF NOT EXISTS packages (
+				system_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				version TEXT NOT NULL,
+				arch TEXT NOT NULL DEFAULT '',
+				available TEXT NOT NULL DEFAULT '',
+				security INTEGER NOT NULL DEFAULT 0
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_packages_system ON packages(system_id)",
+			"CREATE INDEX IF NOT EXISTS idx_packages_name ON packages(name)",
+		),
+		down: statements("DROP TABLE IF EXISTS packages", "DROP TABLE IF EXISTS inventories"),
+	},
+	{
+		version: 12,
+		name:    "log events",
+		up: statements(
+			`CREATE TABLE IF NOT EXISTS log_events (
+				system_id INTEGER NOT NULL,
+				timestamp DATETIME NOT NULL,
+				source TEXT NOT NULL,
+				event TEXT NOT NULL,
+				fields TEXT NOT NULL DEFAULT '{}',
+				message TEXT NOT NULL DEFAULT ''
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_log_events_system ON log_events(system_id, timestamp)",
+			"CREATE INDEX IF NOT EXISTS idx_log_events_time ON log_events(timestamp)",
+		),
+		down: statements("DROP TABLE IF EXISTS log_events"),
+	},
+}
+
+// sqliteAddColumns adds (table, definition) pairs of columns, skipping the
+// ones that already exist. SQLite has no ADD COLUMN IF NOT EXISTS.
+func sqliteAddColumns(pairs ...string) func(tx *sqlTx) error {
+	return func(tx *sqlTx) error {
+		for i := 0; i+1 < len(pairs); i += 2 {
+			table, definition := pairs[i], pairs[i+1]
+			_, err := tx.tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + definition)
+			if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+				return fmt.Errorf("add column to %s: %w", table, err)
+			}
+		}
+		return nil
+	}
+}
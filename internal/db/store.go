@@ -0,0 +1,298 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/server-moni/internal/config"
+)
+
+// DefaultDatabaseURL is used when config.AppConfig.DatabaseURL is empty.
+const DefaultDatabaseURL = "data/server-moni.db"
+
+// Store is the persistence layer of the server. It is implemented for SQLite
+// and PostgreSQL; Open picks one from the database URL.
+type Store interface {
+	ConfigStore
+	UserStore
+	SessionStore
+	SystemStore
+	AuditStore
+	HistoryStore
+	AlertStore
+	CheckStore
+	ProcessStore
+	InventoryStore
+	LogEventStore
+	Migrator
+	MaintenanceStore
+	// Driver returns the name of the backend ("sqlite" or "postgres").
+	Driver() string
+	Close() error
+}
+
+// Migrator manages the schema version, see migrations.go.
+type Migrator interface {
+	SchemaVersion() (int, error)
+	MigrationStatus() ([]Migration, error)
+	MigrateUp(target int) ([]Migration, error)
+	MigrateDown(target int) ([]Migration, error)
+	CheckSchema() error
+}
+
+// MaintenanceStore covers backups and the portable export, see backup.go.
+type MaintenanceStore interface {
+	Backup(path string) error
+	IntegrityCheck() error
+	Export() (*Export, error)
+	Import(e *Export) error
+}
+
+type ConfigStore interface {
+	GetConfig(key string) (string, error)
+	SetConfig(key, value string) error
+}
+
+type UserStore interface {
+	CreateUser(email, passwordHash string, verified bool) (int64, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserByID(id int) (*User, error)
+	UpdateUserPassword(userID int, passwordHash string) error
+	SetEmailVerified(userID int) error
+
+	CreateUserToken(tokenHash string, userID int, purpose string, expiresAt time.Time) error
+	ConsumeUserToken(tokenHash, purpose string) (int, error)
+	InvalidateUserTokens(userID int, purpose string) error
+	DeleteExpiredUserTokens() (int64, error)
+}
+
+type SessionStore interface {
+	CreateSession(s *Session) error
+	GetSession(token string) (*Session, error)
+	GetUserSessions(userID int) ([]Session, error)
+	TouchSession(token string, lastUsedAt, expiresAt time.Time) error
+	DeleteSession(token string) error
+	DeleteUserSession(userID int, id string) (bool, error)
+	DeleteUserSessions(userID int, exceptID string) (int64, error)
+	DeleteExpiredSessions() (int64, error)
+}
+
+type SystemStore interface {
+	AddSystem(userID int, name, url, apiKey string) (int64, error)
+	GetSystems(userID int) ([]System, error)
+	GetSystem(id int) (*System, error)
+	GetSystemByAPIKey(apiKey string) (*System, error)
+	DeleteSystem(id, userID int) error
+
+	SetSystemTags(systemID int, source string, tags map[string]string) error
+	GetSystemTags(systemID int, source string) (map[string]string, error)
+
+	CreateGroup(userID int, name string, systemIDs []int) (int64, error)
+	UpdateGroup(id, userID int, name string, systemIDs []int) error
+	DeleteGroup(id, userID int) error
+	GetGroups(userID int) ([]Group, error)
+}
+
+type AuditStore interface {
+	AddAuditEntry(e *AuditEntry) error
+	QueryAuditLog(f AuditFilter) ([]AuditEntry, int, error)
+}
+
+type HistoryStore interface {
+	AddDiskHistory(entries []DiskHistory) error
+	GetDiskHistory(systemID int, mountpoint string, since time.Time) ([]DiskHistory, error)
+	LastDiskHistory(systemID int) (time.Time, error)
+
+	AddMetricSamples(samples []MetricSample) error
+	GetMetricSamples(systemID int, metric string, from, to time.Time) ([]MetricSample, error)
+	DeleteMetricSamplesBefore(cutoff time.Time) (int64, error)
+}
+
+type AlertStore interface {
+	CreateAlertRule(r *AlertRule) (int64, error)
+	UpdateAlertRule(r *AlertRule) error
+	DeleteAlertRule(id, userID int) error
+	GetAlertRules(userID int) ([]AlertRule, error)
+	GetEnabledAlertRules() ([]AlertRule, error)
+}
+
+type CheckStore interface {
+	CreateCheck(c *Check) (int64, error)
+	UpdateCheck(c *Check, userID int) error
+	DeleteCheck(id, userID int) error
+	GetCheck(id int) (*Check, error)
+	GetChecks(systemID int) ([]Check, error)
+
+	AddCheckResults(results []CheckResult) error
+	GetCheckResults(checkID int, since time.Time) ([]CheckResult, error)
+	LastCheckResults(checkID, n int) ([]CheckResult, error)
+	DeleteCheckResultsBefore(cutoff time.Time) (int64, error)
+}
+
+type ProcessStore interface {
+	CreateProcessWatch(w *ProcessWatch) (int64, error)
+	UpdateProcessWatch(w *ProcessWatch, userID int) error
+	DeleteProcessWatch(id, userID int) error
+	GetProcessWatch(id int) (*ProcessWatch, error)
+	GetProcessWatches(systemID int) ([]ProcessWatch, error)
+
+	AddProcessSamples(samples []ProcessSample) error
+	GetProcessSamples(watchID int, since time.Time) ([]ProcessSample, error)
+	DeleteProcessSamplesBefore(cutoff time.Time) (int64, error)
+}
+
+type InventoryStore interface {
+	SaveInventory(inv *SoftwareInventory, packages []InstalledPackage) error
+	GetInventory(systemID int) (*SoftwareInventory, error)
+	GetInstalledPackages(systemID int) ([]InstalledPackage, error)
+	FindInstalledPackages(userID int, name string) ([]InstalledPackage, error)
+}
+
+type LogEventStore interface {
+	AddLogEvents(events []LogEvent) error
+	GetLogEvents(systemID int, q LogEventQuery) ([]LogEvent, error)
+	DeleteLogEventsBefore(cutoff time.Time) (int64, error)
+}
+
+// GlobalStore is the store opened by InitDB.
+var GlobalStore Store
+
+// InitDB opens the database configured in config.AppConfig.DatabaseURL and
+// brings its schema up to date, or only verifies it when automatic migration
+// is disabled. It exits the process on failure, including when the database
+// was migrated by a newer binary.
+func InitDB() {
+	url := config.AppConfig.DatabaseURL
+	if url == "" {
+		url = DefaultDatabaseURL
+	}
+
+	store, err := Open(url)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	if config.AppConfig.DisableAutoMigrate {
+		err = store.CheckSchema()
+	} else {
+		var applied []Migration
+		applied, err = store.MigrateUp(0)
+		for _, m := range applied {
+			log.Printf("Applied database migration %d (%s)", m.Version, m.Name)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	GlobalStore = store
+}
+
+// Open connects to a database without touching its schema. URLs starting
+// with postgres:// or postgresql:// select PostgreSQL; anything else is a
+// SQLite file path, optionally prefixed with sqlite://.
+func Open(url string) (Store, error) {
+	switch {
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return openPostgres(url)
+	default:
+		return openSQLite(strings.TrimPrefix(url, "sqlite://"))
+	}
+}
+
+// dialect captures the differences between the supported databases. All
+// queries are written with ? placeholders and rebound when needed.
+type dialect struct {
+	name           string
+	numberedParams bool // $1, $2, ... instead of ?
+	timestampType  string
+	migrations     []migration
+}
+
+// sqlStore implements Store on top of database/sql.
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (s *sqlStore) Driver() string { return s.dialect.name }
+
+func (s *sqlStore) Close() error { return s.db.Close() }
+
+// SQL exposes the underlying connection for maintenance tasks that fall
+// outside the Store interface.
+func (s *sqlStore) SQL() *sql.DB { return s.db }
+
+// rebind converts ? placeholders to the dialect's parameter syntax.
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numberedParams {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) exec(query string, args ...any) (sql.Result, error) {
+	return s.db.Exec(s.rebind(query), args...)
+}
+
+func (s *sqlStore) query(query string, args ...any) (*sql.Rows, error) {
+	return s.db.Query(s.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(query string, args ...any) *sql.Row {
+	return s.db.QueryRow(s.rebind(query), args...)
+}
+
+// insert runs an INSERT ... RETURNING id statement and returns the new ID.
+// LastInsertId is not supported by every driver.
+func (s *sqlStore) insert(query string, args ...any) (int64, error) {
+	var id int64
+	err := s.queryRow(query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// sqlTx wraps a transaction with the same rebinding helpers.
+type sqlTx struct {
+	tx *sql.Tx
+	s  *sqlStore
+}
+
+func (s *sqlStore) begin() (*sqlTx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx: tx, s: s}, nil
+}
+
+func (t *sqlTx) exec(query string, args ...any) (sql.Result, error) {
+	return t.tx.Exec(t.s.rebind(query), args...)
+}
+
+func (t *sqlTx) query(query string, args ...any) (*sql.Rows, error) {
+	return t.tx.Query(t.s.rebind(query), args...)
+}
+
+func (t *sqlTx) queryRow(query string, args ...any) *sql.Row {
+	return t.tx.QueryRow(t.s.rebind(query), args...)
+}
+
+func (t *sqlTx) insert(query string, args ...any) (int64, error) {
+	var id int64
+	err := t.tx.QueryRow(t.s.rebind(query+" RETURNING id"), args...).Scan(&id)
+	return id, err
+}
+
+func (t *sqlTx) Commit() error   { return t.tx.Commit() }
+func (t *sqlTx) Rollback() error { return t.tx.Rollback() }
@@ -0,0 +1,1116 @@
+// Package storetest is a conformance suite for db.Store implementations.
+// Every backend must pass the same checks. go test runs them against a
+// temporary SQLite file, and against PostgreSQL when STORETEST_POSTGRES_URL
+// names a scratch database.
+package storetest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/user/server-moni/internal/db"
+)
+
+// Check is a single named conformance check.
+type Check struct {
+	Name string
+	Run  func(s db.Store) error
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Checks lists the conformance checks in the order they run. Later checks
+// may rely on rows created by earlier ones, so they must run in order
+// against the same store.
+var Checks = []Check{
+	{"config", checkConfig},
+	{"users", checkUsers},
+	{"user_tokens", checkUserTokens},
+	{"sessions", checkSessions},
+	{"systems", checkSystems},
+	{"tags", checkTags},
+	{"groups", checkGroups},
+	{"audit", checkAudit},
+	{"disk_history", checkDiskHistory},
+	{"metric_samples", checkMetricSamples},
+	{"alert_rules", checkAlertRules},
+	{"checks", checkChecks},
+	{"process_watches", checkProcessWatches},
+	{"inventory", checkInventory},
+	{"log_events", checkLogEvents},
+	{"export", checkExport},
+	{"backup", checkBackup},
+	{"delete_system", checkDeleteSystem},
+}
+
+// Run migrates the schema up, all the way down and up again, then runs
+// every check.
+func Run(s db.Store) []Result {
+	results := []Result{{Name: "migrations", Err: checkMigrations(s)}}
+	if results[0].Err != nil {
+		return results
+	}
+	for _, c := range Checks {
+		results = append(results, Result{Name: c.Name, Err: c.Run(s)})
+	}
+	return results
+}
+
+const (
+	testEmail    = "storetest@example.com"
+	testAPIKey   = "storetest-api-key"
+	testTokenTTL = time.Hour
+)
+
+func expect(cond bool, format string, args ...any) error {
+	if cond {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func testUser(s db.Store) (*db.User, error) {
+	return s.GetUserByEmail(testEmail)
+}
+
+func testSystem(s db.Store) (*db.System, error) {
+	return s.GetSystemByAPIKey(testAPIKey)
+}
+
+func checkMigrations(s db.Store) error {
+	if _, err := s.MigrateUp(0); err != nil {
+		return err
+	}
+	if _, err := s.MigrateDown(0); err != nil {
+		return err
+	}
+	if v, err := s.SchemaVersion(); err != nil || v != 0 {
+		return fmt.Errorf("after down: version %d, err %v", v, err)
+	}
+	// One step at a time to exercise partial upgrades
+	for target := 1; target <= db.SchemaVersion; target++ {
+		applied, err := s.MigrateUp(target)
+		if err != nil {
+			return err
+		}
+		if len(applied) != 1 || applied[0].Version != target {
+			return fmt.Errorf("migrate up to %d applied %+v", target, applied)
+		}
+	}
+	if applied, err := s.MigrateUp(0); err != nil || len(applied) != 0 {
+		return fmt.Errorf("migrate up is not idempotent: applied %+v, err %v", applied, err)
+	}
+	if err := s.CheckSchema(); err != nil {
+		return err
+	}
+	status, err := s.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	for _, m := range status {
+		if !m.Applied || m.AppliedAt.IsZero() {
+			return fmt.Errorf("migration %d not recorded as applied", m.Version)
+		}
+	}
+	return nil
+}
+
+func checkConfig(s db.Store) error {
+	if _, err := s.GetConfig("storetest"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("missing key: want sql.ErrNoRows, got %v", err)
+	}
+	if err := s.SetConfig("storetest", "a"); err != nil {
+		return err
+	}
+	// Setting an existing key replaces its value
+	if err := s.SetConfig("storetest", "b"); err != nil {
+		return err
+	}
+	v, err := s.GetConfig("storetest")
+	if err != nil {
+		return err
+	}
+	return expect(v == "b", "value = %q, want %q", v, "b")
+}
+
+func checkUsers(s db.Store) error {
+	id, err := s.CreateUser(testEmail, "hash1", false)
+	if err != nil {
+		return err
+	}
+	if _, err := s.CreateUser(testEmail, "hash2", true); err == nil {
+		return fmt.Errorf("duplicate email accepted")
+	}
+
+	u, err := s.GetUserByID(int(id))
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(u.Email == testEmail, "email = %q", u.Email),
+		expect(u.PasswordHash == "hash1", "password hash = %q", u.PasswordHash),
+		expect(!u.EmailVerified, "new user should not be verified"),
+		expect(!u.CreatedAt.IsZero(), "created_at not set"),
+	); err != nil {
+		return err
+	}
+
+	if err := s.UpdateUserPassword(u.ID, "hash3"); err != nil {
+		return err
+	}
+	if err := s.SetEmailVerified(u.ID); err != nil {
+		return err
+	}
+	u, err = s.GetUserByEmail(testEmail)
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(u.ID == int(id), "id = %d, want %d", u.ID, id),
+		expect(u.PasswordHash == "hash3", "password hash not updated"),
+		expect(u.EmailVerified, "email not verified"),
+	); err != nil {
+		return err
+	}
+
+	if _, err := s.GetUserByEmail("missing@example.com"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("missing user: want sql.ErrNoRows, got %v", err)
+	}
+	return nil
+}
+
+func checkUserTokens(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(testTokenTTL)
+	if err := s.CreateUserToken("token-a", u.ID, db.TokenPasswordReset, expires); err != nil {
+		return err
+	}
+
+	// Wrong purpose, then a valid consume, then a replay
+	if _, err := s.ConsumeUserToken("token-a", db.TokenEmailVerify); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("wrong purpose: want sql.ErrNoRows, got %v", err)
+	}
+	userID, err := s.ConsumeUserToken("token-a", db.TokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	if userID != u.ID {
+		return fmt.Errorf("consumed token belongs to %d, want %d", userID, u.ID)
+	}
+	if _, err := s.ConsumeUserToken("token-a", db.TokenPasswordReset); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("replayed token: want sql.ErrNoRows, got %v", err)
+	}
+
+	if err := s.CreateUserToken("token-b", u.ID, db.TokenPasswordReset, expires); err != nil {
+		return err
+	}
+	if err := s.InvalidateUserTokens(u.ID, db.TokenPasswordReset); err != nil {
+		return err
+	}
+	if _, err := s.ConsumeUserToken("token-b", db.TokenPasswordReset); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("invalidated token: want sql.ErrNoRows, got %v", err)
+	}
+
+	if err := s.CreateUserToken("token-c", u.ID, db.TokenEmailVerify, time.Now().Add(-time.Minute)); err != nil {
+		return err
+	}
+	if _, err := s.ConsumeUserToken("token-c", db.TokenEmailVerify); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("expired token: want sql.ErrNoRows, got %v", err)
+	}
+	n, err := s.DeleteExpiredUserTokens()
+	if err != nil {
+		return err
+	}
+	return expect(n >= 1, "deleted %d expired tokens, want at least 1", n)
+}
+
+func checkSessions(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	newSession := func(id string, expires time.Time) *db.Session {
+		return &db.Session{
+			ID: id, Token: "token-" + id, UserID: u.ID, CSRFToken: "csrf-" + id,
+			IP: "192.0.2.1", UserAgent: "storetest",
+			CreatedAt: now, LastUsedAt: now, ExpiresAt: expires,
+		}
+	}
+	for _, sess := range []*db.Session{
+		newSession("s1", now.Add(time.Hour)),
+		newSession("s2", now.Add(time.Hour)),
+		newSession("s3", now.Add(time.Hour)),
+		newSession("expired", now.Add(-time.Hour)),
+	} {
+		if err := s.CreateSession(sess); err != nil {
+			return err
+		}
+	}
+
+	got, err := s.GetSession("token-s1")
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(got.ID == "s1" && got.UserID == u.ID, "session = %+v", got),
+		expect(got.CSRFToken == "csrf-s1", "csrf token = %q", got.CSRFToken),
+		expect(got.ExpiresAt.Equal(now.Add(time.Hour)), "expires_at = %v", got.ExpiresAt),
+	); err != nil {
+		return err
+	}
+
+	later := now.Add(time.Minute)
+	if err := s.TouchSession("token-s2", later, later.Add(time.Hour)); err != nil {
+		return err
+	}
+	list, err := s.GetUserSessions(u.ID)
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(list) == 3, "listed %d sessions, want 3 unexpired", len(list)),
+		expect(len(list) > 0 && list[0].ID == "s2", "most recently used session should come first"),
+	); err != nil {
+		return err
+	}
+
+	if ok, err := s.DeleteUserSession(u.ID+1, "s3"); err != nil || ok {
+		return fmt.Errorf("revoked another user's session (ok=%v, err=%v)", ok, err)
+	}
+	if ok, err := s.DeleteUserSession(u.ID, "s3"); err != nil || !ok {
+		return fmt.Errorf("revoke own session: ok=%v, err=%v", ok, err)
+	}
+	n, err := s.DeleteExpiredSessions()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return fmt.Errorf("deleted %d expired sessions, want 1", n)
+	}
+	n, err = s.DeleteUserSessions(u.ID, "s1")
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return fmt.Errorf("revoked %d other sessions, want 1", n)
+	}
+	if err := s.DeleteSession("token-s1"); err != nil {
+		return err
+	}
+	if _, err := s.GetSession("token-s1"); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("deleted session: want sql.ErrNoRows, got %v", err)
+	}
+	return nil
+}
+
+func checkSystems(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	id, err := s.AddSystem(u.ID, "storetest-1", "http://192.0.2.10:8080", testAPIKey)
+	if err != nil {
+		return err
+	}
+	if _, err := s.AddSystem(u.ID, "storetest-2", "http://192.0.2.11:8080", testAPIKey+"-2"); err != nil {
+		return err
+	}
+
+	sys, err := s.GetSystem(int(id))
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(sys.Name == "storetest-1" && sys.UserID == u.ID, "system = %+v", sys),
+		expect(sys.Tags != nil && sys.Groups != nil, "tags and groups should be initialized"),
+	); err != nil {
+		return err
+	}
+	byKey, err := s.GetSystemByAPIKey(testAPIKey)
+	if err != nil {
+		return err
+	}
+	if byKey.ID != int(id) {
+		return fmt.Errorf("api key lookup returned system %d, want %d", byKey.ID, id)
+	}
+
+	systems, err := s.GetSystems(u.ID)
+	if err != nil {
+		return err
+	}
+	if len(systems) != 2 {
+		return fmt.Errorf("listed %d systems, want 2", len(systems))
+	}
+	others, err := s.GetSystems(u.ID + 1)
+	if err != nil {
+		return err
+	}
+	return expect(len(others) == 0, "another user sees %d systems", len(others))
+}
+
+func checkTags(s db.Store) error {
+	sys, err := testSystem(s)
+	if err != nil {
+		return err
+	}
+	if err := s.SetSystemTags(sys.ID, db.TagSourceAgent, map[string]string{"env": "staging", "role": "web"}); err != nil {
+		return err
+	}
+	if err := s.SetSystemTags(sys.ID, db.TagSourceUser, map[string]string{"env": "prod"}); err != nil {
+		return err
+	}
+	// Replacing a source's tags drops keys that are no longer present
+	if err := s.SetSystemTags(sys.ID, db.TagSourceAgent, map[string]string{"env": "staging"}); err != nil {
+		return err
+	}
+
+	agent, err := s.GetSystemTags(sys.ID, db.TagSourceAgent)
+	if err != nil {
+		return err
+	}
+	if len(agent) != 1 || agent["env"] != "staging" {
+		return fmt.Errorf("agent tags = %v", agent)
+	}
+
+	sys, err = s.GetSystem(sys.ID)
+	if err != nil {
+		return err
+	}
+	return firstErr(
+		expect(sys.Tags["env"] == "prod", "user tag should override agent tag, got env=%q", sys.Tags["env"]),
+		expect(len(sys.Tags) == 1, "effective tags = %v", sys.Tags),
+	)
+}
+
+func checkGroups(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	systems, err := s.GetSystems(u.ID)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(systems))
+	for _, sys := range systems {
+		ids = append(ids, sys.ID)
+	}
+
+	gid, err := s.CreateGroup(u.ID, "web", append(ids, ids[0]))
+	if err != nil {
+		return err
+	}
+	if _, err := s.CreateGroup(u.ID, "web", nil); err == nil {
+		return fmt.Errorf("duplicate group name accepted")
+	}
+	other, err := s.CreateGroup(u.ID, "db", ids[:1])
+	if err != nil {
+		return err
+	}
+
+	groups, err := s.GetGroups(u.ID)
+	if err != nil {
+		return err
+	}
+	if len(groups) != 2 || groups[0].Name != "db" || len(groups[1].SystemIDs) != len(ids) {
+		return fmt.Errorf("groups = %+v", groups)
+	}
+
+	if err := s.UpdateGroup(int(gid), u.ID+1, "stolen", nil); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("update another user's group: want sql.ErrNoRows, got %v", err)
+	}
+	if err := s.UpdateGroup(int(gid), u.ID, "frontend", ids[:1]); err != nil {
+		return err
+	}
+	sys, err := s.GetSystem(ids[0])
+	if err != nil {
+		return err
+	}
+	if len(sys.Groups) != 2 || sys.Groups[0] != "db" || sys.Groups[1] != "frontend" {
+		return fmt.Errorf("system groups = %v", sys.Groups)
+	}
+
+	if err := s.DeleteGroup(int(other), u.ID+1); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("delete another user's group: want sql.ErrNoRows, got %v", err)
+	}
+	if err := s.DeleteGroup(int(other), u.ID); err != nil {
+		return err
+	}
+	groups, err = s.GetGroups(u.ID)
+	if err != nil {
+		return err
+	}
+	return expect(len(groups) == 1 && groups[0].Name == "frontend", "groups after delete = %+v", groups)
+}
+
+func checkAudit(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	start := time.Now().UTC().Add(-time.Second)
+	for _, action := range []string{"auth.login", "auth.logout", "system.create"} {
+		e := &db.AuditEntry{UserID: u.ID, Actor: testEmail, Action: action, Result: "success"}
+		if err := s.AddAuditEntry(e); err != nil {
+			return err
+		}
+		if e.ID == 0 || e.CreatedAt.IsZero() {
+			return fmt.Errorf("entry ID or timestamp not set: %+v", e)
+		}
+	}
+
+	entries, total, err := s.QueryAuditLog(db.AuditFilter{UserID: u.ID, Action: "auth.*", Since: start, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(total == 2, "total = %d, want 2", total),
+		expect(len(entries) == 1 && entries[0].Action == "auth.logout", "newest auth entry = %+v", entries),
+	); err != nil {
+		return err
+	}
+	entries, _, err = s.QueryAuditLog(db.AuditFilter{UserID: u.ID, Until: start})
+	if err != nil {
+		return err
+	}
+	if len(entries) != 0 {
+		return fmt.Errorf("until filter returned %d entries", len(entries))
+	}
+
+	// The audit log must reject changes to existing entries
+	raw, ok := s.(interface{ SQL() *sql.DB })
+	if !ok {
+		return nil
+	}
+	for _, stmt := range []string{
+		fmt.Sprintf("UPDATE audit_log SET actor = 'tampered' WHERE user_id = %d", u.ID),
+		fmt.Sprintf("DELETE FROM audit_log WHERE user_id = %d", u.ID),
+	} {
+		if _, err := raw.SQL().Exec(stmt); err == nil {
+			return fmt.Errorf("audit log is not append-only: %q succeeded", stmt)
+		}
+	}
+	return nil
+}
+
+func checkDiskHistory(s db.Store) error {
+	sys, err := testSystem(s)
+	if err != nil {
+		return err
+	}
+	if last, err := s.LastDiskHistory(sys.ID); err != nil || !last.IsZero() {
+		return fmt.Errorf("last snapshot before any = %v, %v; want zero time", last, err)
+	}
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	var entries []db.DiskHistory
+	for i, used := range []uint64{100, 200, 300} {
+		at := day.AddDate(0, 0, i)
+		entries = append(entries,
+			db.DiskHistory{SystemID: sys.ID, Mountpoint: "/", Timestamp: at, UsedPercent: float64(used) / 10, Total: 1000, Used: used},
+			db.DiskHistory{SystemID: sys.ID, Mountpoint: "/var", Timestamp: at, UsedPercent: 50, Total: 2000, Used: 1000},
+		)
+	}
+	if err := s.AddDiskHistory(entries); err != nil {
+		return err
+	}
+
+	all, err := s.GetDiskHistory(sys.ID, "", time.Time{})
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(all) == 6, "got %d history rows, want 6", len(all)),
+		expect(len(all) == 6 && all[0].Mountpoint == "/" && all[5].Mountpoint == "/var", "rows not ordered by mountpoint: %+v", all),
+	); err != nil {
+		return err
+	}
+	recent, err := s.GetDiskHistory(sys.ID, "/", day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(recent) == 2, "got %d rows for / since day 2, want 2", len(recent)),
+		expect(len(recent) == 2 && recent[0].Used == 200 && recent[1].Used == 300, "rows = %+v", recent),
+		expect(len(recent) == 2 && recent[0].Timestamp.Equal(day.AddDate(0, 0, 1)), "timestamp = %v", recent),
+	); err != nil {
+		return err
+	}
+	last, err := s.LastDiskHistory(sys.ID)
+	if err != nil {
+		return err
+	}
+	return expect(last.Equal(day.AddDate(0, 0, 2)), "last snapshot = %v, want %v", last, day.AddDate(0, 0, 2))
+}
+
+func checkMetricSamples(s db.Store) error {
+	sys, err := testSystem(s)
+	if err != nil {
+		return err
+	}
+	start := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	var samples []db.MetricSample
+	for i := 0; i < 3; i++ {
+		at := start.Add(time.Duration(i) * time.Hour)
+		samples = append(samples,
+			db.MetricSample{SystemID: sys.ID, Metric: "cpu", Timestamp: at, Value: float64(10 * (i + 1))},
+			db.MetricSample{SystemID: sys.ID, Metric: "load1", Timestamp: at, Value: 0.5},
+		)
+	}
+	if err := s.AddMetricSamples(samples); err != nil {
+		return err
+	}
+
+	cpu, err := s.GetMetricSamples(sys.ID, "cpu", start, time.Time{})
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(cpu) == 3, "got %d cpu samples, want 3", len(cpu)),
+		expect(len(cpu) == 3 && cpu[0].Value == 10 && cpu[2].Value == 30, "samples not in order: %+v", cpu),
+		expect(len(cpu) == 3 && cpu[0].Timestamp.Equal(start), "timestamp = %v, want %v", cpu[0].Timestamp, start),
+	); err != nil {
+		return err
+	}
+	// The upper bound is exclusive
+	window, err := s.GetMetricSamples(sys.ID, "cpu", start.Add(time.Hour), start.Add(2*time.Hour))
+	if err != nil {
+		return err
+	}
+	if len(window) != 1 || window[0].Value != 20 {
+		return fmt.Errorf("samples in [1h, 2h) = %+v", window)
+	}
+
+	n, err := s.DeleteMetricSamplesBefore(start.Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	left, err := s.GetMetricSamples(sys.ID, "load1", time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	return firstErr(
+		expect(n == 2, "deleted %d samples, want 2", n),
+		expect(len(left) == 2, "%d load1 samples left, want 2", len(left)),
+	)
+}
+
+func checkAlertRules(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	rule := &db.AlertRule{
+		UserID:    u.ID,
+		Name:      "disk filling",
+		Condition: "disk_full",
+		Params:    json.RawMessage(`{"within_days":7}`),
+		Selector:  "env=prod",
+		Enabled:   true,
+	}
+	id, err := s.CreateAlertRule(rule)
+	if err != nil {
+		return err
+	}
+	off := &db.AlertRule{UserID: u.ID, Name: "disabled", Condition: "threshold"}
+	offID, err := s.CreateAlertRule(off)
+	if err != nil {
+		return err
+	}
+
+	rule.ID, rule.Name, rule.Group = int(id), "disk full soon", "web"
+	if err := s.UpdateAlertRule(rule); err != nil {
+		return err
+	}
+	other := *rule
+	other.UserID++
+	if err := s.UpdateAlertRule(&other); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("update of another user's rule: want sql.ErrNoRows, got %v", err)
+	}
+	if err := s.DeleteAlertRule(int(offID), u.ID+1); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("delete of another user's rule: want sql.ErrNoRows, got %v", err)
+	}
+
+	rules, err := s.GetAlertRules(u.ID)
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(rules) == 2, "got %d rules, want 2", len(rules)),
+		expect(len(rules) == 2 && rules[0].Name == "disk full soon" && rules[0].Group == "web" && rules[0].Selector == "env=prod", "rule = %+v", rules),
+		expect(len(rules) == 2 && string(rules[0].Params) == `{"within_days":7}`, "params = %s", rules[0].Params),
+		expect(len(rules) == 2 && string(rules[1].Params) == "{}" && !rules[1].Enabled, "disabled rule = %+v", rules[1]),
+	); err != nil {
+		return err
+	}
+	enabled, err := s.GetEnabledAlertRules()
+	if err != nil {
+		return err
+	}
+	if len(enabled) != 1 || enabled[0].ID != int(id) {
+		return fmt.Errorf("enabled rules = %+v", enabled)
+	}
+	return s.DeleteAlertRule(int(offID), u.ID)
+}
+
+func checkChecks(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	sys, err := testSystem(s)
+	if err != nil {
+		return err
+	}
+	web := &db.Check{
+		SystemID: sys.ID,
+		Name:     "web",
+		Type:     "http",
+		Target:   "http://localhost/",
+		Interval: 60,
+		Timeout:  10,
+		Options:  json.RawMessage(`{"method":"GET"}`),
+		Enabled:  true,
+	}
+	id, err := s.CreateCheck(web)
+	if err != nil {
+		return err
+	}
+	ssh := &db.Check{SystemID: sys.ID, Name: "ssh", Type: "tcp", Target: "localhost:22", Interval: 30, Timeout: 5}
+	sshID, err := s.CreateCheck(ssh)
+	if err != nil {
+		return err
+	}
+
+	web.ID, web.Target = int(id), "https://localhost/"
+	if err := s.UpdateCheck(web, u.ID); err != nil {
+		return err
+	}
+	if err := s.UpdateCheck(web, u.ID+1); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("update of another user's check: want sql.ErrNoRows, got %v", err)
+	}
+	if err := s.DeleteCheck(int(sshID), u.ID+1); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("delete of another user's check: want sql.ErrNoRows, got %v", err)
+	}
+
+	checks, err := s.GetChecks(sys.ID)
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(checks) == 2, "got %d checks, want 2", len(checks)),
+		expect(len(checks) == 2 && checks[0].Name == "ssh" && string(checks[0].Options) == "{}" && !checks[0].Enabled, "check = %+v", checks),
+		expect(len(checks) == 2 && checks[1].Target == "https://localhost/" && string(checks[1].Options) == `{"method":"GET"}`, "check = %+v", checks),
+	); err != nil {
+		return err
+	}
+
+	start := time.Now().UTC().Truncate(time.Minute).Add(-3 * time.Minute)
+	var results []db.CheckResult
+	for i := 0; i < 3; i++ {
+		results = append(results,
+			db.CheckResult{CheckID: int(id), SystemID: sys.ID, Timestamp: start.Add(time.Duration(i) * time.Minute), Up: i != 1, LatencyMS: 1.5, StatusCode: 200},
+			db.CheckResult{CheckID: int(sshID), SystemID: sys.ID, Timestamp: start.Add(time.Duration(i) * time.Minute), Error: "connection refused"},
+		)
+	}
+	if err := s.AddCheckResults(results); err != nil {
+		return err
+	}
+	got, err := s.GetCheckResults(int(id), start.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(got) == 2, "got %d results, want 2", len(got)),
+		expect(len(got) == 2 && !got[0].Up && got[1].Up && got[1].StatusCode == 200, "results not in order: %+v", got),
+	); err != nil {
+		return err
+	}
+	last, err := s.LastCheckResults(int(id), 1)
+	if err != nil {
+		return err
+	}
+	if len(last) != 1 || !last[0].Timestamp.Equal(start.Add(2*time.Minute)) {
+		return fmt.Errorf("last result = %+v", last)
+	}
+
+	n, err := s.DeleteCheckResultsBefore(start.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if n != 2 {
+		return fmt.Errorf("deleted %d results, want 2", n)
+	}
+	if err := s.DeleteCheck(int(sshID), u.ID); err != nil {
+		return err
+	}
+	left, err := s.GetCheckResults(int(sshID), time.Time{})
+	if err != nil {
+		return err
+	}
+	return expect(len(left) == 0, "%d results of deleted check remain", len(left))
+}
+
+func checkProcessWatches(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	sys, err := testSystem(s)
+	if err != nil {
+		return err
+	}
+	nginx := &db.ProcessWatch{SystemID: sys.ID, Name: "nginx", Process: "nginx", User: "www-data"}
+	id, err := s.CreateProcessWatch(nginx)
+	if err != nil {
+		return err
+	}
+	cron := &db.ProcessWatch{SystemID: sys.ID, Name: "cron", PIDFile: "/run/crond.pid"}
+	cronID, err := s.CreateProcessWatch(cron)
+	if err != nil {
+		return err
+	}
+
+	nginx.ID, nginx.Cmdline = int(id), "master process"
+	if err := s.UpdateProcessWatch(nginx, u.ID); err != nil {
+		return err
+	}
+	if err := s.UpdateProcessWatch(nginx, u.ID+1); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("update of another user's process watch: want sql.ErrNoRows, got %v", err)
+	}
+	if err := s.DeleteProcessWatch(int(cronID), u.ID+1); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("delete of another user's process watch: want sql.ErrNoRows, got %v", err)
+	}
+
+	watches, err := s.GetProcessWatches(sys.ID)
+	if err != nil {
+		return err
+	}
+	got, err := s.GetProcessWatch(int(id))
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(watches) == 2, "got %d process watches, want 2", len(watches)),
+		expect(len(watches) == 2 && watches[0].Name == "cron" && watches[0].PIDFile == "/run/crond.pid", "process watch = %+v", watches),
+		expect(got.Cmdline == "master process" && got.User == "www-data" && got.SystemID == sys.ID, "process watch = %+v", got),
+	); err != nil {
+		return err
+	}
+
+	start := time.Now().UTC().Truncate(time.Minute).Add(-3 * time.Minute)
+	var samples []db.ProcessSample
+	for i := 0; i < 3; i++ {
+		samples = append(samples,
+			db.ProcessSample{WatchID: int(id), SystemID: sys.ID, Timestamp: start.Add(time.Duration(i) * time.Minute), Instances: i, CPUPercent: 1.5, RSSBytes: 1 << 33, Threads: 4, OpenFDs: 12, ReadRate: 1024},
+			db.ProcessSample{WatchID: int(cronID), SystemID: sys.ID, Timestamp: start.Add(time.Duration(i) * time.Minute), Instances: 1},
+		)
+	}
+	if err := s.AddProcessSamples(samples); err != nil {
+		return err
+	}
+	history, err := s.GetProcessSamples(int(id), start.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(history) == 2, "got %d samples, want 2", len(history)),
+		expect(len(history) == 2 && history[0].Instances == 1 && history[1].Instances == 2, "samples not in order: %+v", history),
+		expect(len(history) == 2 && history[1].RSSBytes == 1<<33 && history[1].ReadRate == 1024 && history[1].OpenFDs == 12, "sample = %+v", history),
+	); err != nil {
+		return err
+	}
+
+	n, err := s.DeleteProcessSamplesBefore(start.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if n != 2 {
+		return fmt.Errorf("deleted %d samples, want 2", n)
+	}
+	if err := s.DeleteProcessWatch(int(cronID), u.ID); err != nil {
+		return err
+	}
+	left, err := s.GetProcessSamples(int(cronID), time.Time{})
+	if err != nil {
+		return err
+	}
+	return expect(len(left) == 0, "%d samples of deleted process watch remain", len(left))
+}
+
+func checkInventory(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	sys, err := testSystem(s)
+	if err != nil {
+		return err
+	}
+	if _, err := s.GetInventory(sys.ID); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("inventory before upload: want sql.ErrNoRows, got %v", err)
+	}
+
+	collected := time.Now().UTC().Truncate(time.Second)
+	inv := &db.SoftwareInventory{SystemID: sys.ID, CollectedAt: collected.Add(-time.Hour), Manager: "dpkg", PendingUpdates: 3}
+	if err := s.SaveInventory(inv, []db.InstalledPackage{{Name: "bash", Version: "5.2.15-2"}}); err != nil {
+		return err
+	}
+	// A new upload replaces the previous one
+	inv = &db.SoftwareInventory{
+		SystemID: sys.ID, CollectedAt: collected, Manager: "dpkg", PendingUpdates: 1, SecurityUpdates: 1,
+		RunningKernel: "6.1.0-13-amd64", InstalledKernel: "6.1.0-18-amd64", RebootRequired: true,
+	}
+	packages := []db.InstalledPackage{
+		{Name: "openssl", Version: "3.0.11-1~deb12u2", Arch: "amd64", Available: "3.0.13-1~deb12u1", Security: true},
+		{Name: "libc6", Version: "2.36-9+deb12u4", Arch: "i386"},
+		{Name: "libc6", Version: "2.36-9+deb12u4", Arch: "amd64"},
+	}
+	if err := s.SaveInventory(inv, packages); err != nil {
+		return err
+	}
+
+	got, err := s.GetInventory(sys.ID)
+	if err != nil {
+		return err
+	}
+	installed, err := s.GetInstalledPackages(sys.ID)
+	if err != nil {
+		return err
+	}
+	found, err := s.FindInstalledPackages(u.ID, "openssl")
+	if err != nil {
+		return err
+	}
+	other, err := s.FindInstalledPackages(u.ID+1, "openssl")
+	if err != nil {
+		return err
+	}
+	return firstErr(
+		expect(got.CollectedAt.Equal(collected) && got.PendingUpdates == 1 && got.SecurityUpdates == 1, "inventory = %+v", got),
+		expect(got.RebootRequired && got.InstalledKernel == "6.1.0-18-amd64", "inventory = %+v", got),
+		expect(len(installed) == 3, "got %d packages, want 3", len(installed)),
+		expect(len(installed) == 3 && installed[0].Name == "libc6" && installed[0].Arch == "amd64" && installed[2].Name == "openssl", "packages not in order: %+v", installed),
+		expect(len(found) == 1 && found[0].SystemID == sys.ID && found[0].Security && found[0].Available == "3.0.13-1~deb12u1", "found = %+v", found),
+		expect(len(other) == 0, "found another user's packages: %+v", other),
+	)
+}
+
+func checkLogEvents(s db.Store) error {
+	sys, err := testSystem(s)
+	if err != nil {
+		return err
+	}
+	start := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	events := []db.LogEvent{
+		{SystemID: sys.ID, Timestamp: start, Source: "auth", Event: "login_failed", Fields: map[string]string{"user": "root", "ip": "2001:db8::1"}, Message: "Failed password for root"},
+		{SystemID: sys.ID, Timestamp: start.Add(time.Minute), Source: "auth", Event: "login_accepted", Fields: map[string]string{"user": "admin"}},
+		{SystemID: sys.ID, Timestamp: start.Add(2 * time.Minute), Source: "fail2ban", Event: "ban"},
+	}
+	if err := s.AddLogEvents(events); err != nil {
+		return err
+	}
+
+	all, err := s.GetLogEvents(sys.ID, db.LogEventQuery{})
+	if err != nil {
+		return err
+	}
+	logins, err := s.GetLogEvents(sys.ID, db.LogEventQuery{Source: "auth", Events: []string{"login_failed", "login_accepted"}, Limit: 1})
+	if err != nil {
+		return err
+	}
+	recent, err := s.GetLogEvents(sys.ID, db.LogEventQuery{Since: start.Add(time.Minute)})
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(len(all) == 3 && all[0].Event == "ban" && all[2].Fields["ip"] == "2001:db8::1", "events not newest first: %+v", all),
+		expect(len(all) == 3 && all[2].Message == "Failed password for root" && all[2].Timestamp.Equal(start), "event = %+v", all),
+		expect(len(logins) == 1 && logins[0].Event == "login_accepted" && logins[0].Fields["user"] == "admin", "logins = %+v", logins),
+		expect(len(recent) == 2, "got %d events since, want 2", len(recent)),
+	); err != nil {
+		return err
+	}
+
+	n, err := s.DeleteLogEventsBefore(start.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return fmt.Errorf("deleted %d log events, want 1", n)
+	}
+	return nil
+}
+
+func checkExport(s db.Store) error {
+	e, err := s.Export()
+	if err != nil {
+		return err
+	}
+	if err := firstErr(
+		expect(e.Format == db.ExportFormat && e.SchemaVersion == db.SchemaVersion, "header = %s v%d", e.Format, e.SchemaVersion),
+		expect(len(e.Users) == 1 && e.Users[0].PasswordHash == "hash3", "users = %+v", e.Users),
+		expect(len(e.Systems) == 2, "exported %d systems, want 2", len(e.Systems)),
+		expect(len(e.Groups) == 1, "exported %d groups, want 1", len(e.Groups)),
+		expect(len(e.AlertRules) == 1, "exported %d alert rules, want 1", len(e.AlertRules)),
+		expect(len(e.Checks) == 1, "exported %d checks, want 1", len(e.Checks)),
+		expect(len(e.ProcessWatches) == 1, "exported %d process watches, want 1", len(e.ProcessWatches)),
+		expect(e.Config["storetest"] == "b", "config = %v", e.Config),
+	); err != nil {
+		return err
+	}
+	for _, sys := range e.Systems {
+		if sys.APIKey == testAPIKey && (sys.UserTags["env"] != "prod" || sys.AgentTags["env"] != "staging") {
+			return fmt.Errorf("system tags = user %v, agent %v", sys.UserTags, sys.AgentTags)
+		}
+	}
+	// Importing into a database that already has users is refused
+	if err := s.Import(e); err == nil {
+		return fmt.Errorf("import into a non-empty database succeeded")
+	}
+	return nil
+}
+
+func checkBackup(s db.Store) error {
+	dir, err := os.MkdirTemp("", "storetest-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	err = s.Backup(path)
+	if errors.Is(err, db.ErrBackupUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	snapshot, err := db.Open(path)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	if err := snapshot.IntegrityCheck(); err != nil {
+		return err
+	}
+	if err := snapshot.CheckSchema(); err != nil {
+		return err
+	}
+	if _, err := snapshot.GetUserByEmail(testEmail); err != nil {
+		return fmt.Errorf("snapshot is missing data: %v", err)
+	}
+	return expect(s.Backup(path) != nil, "backup overwrote an existing file")
+}
+
+func checkDeleteSystem(s db.Store) error {
+	u, err := testUser(s)
+	if err != nil {
+		return err
+	}
+	sys, err := testSystem(s)
+	if err != nil {
+		return err
+	}
+
+	// Deleting another user's system is a no-op
+	if err := s.DeleteSystem(sys.ID, u.ID+1); err != nil {
+		return err
+	}
+	if _, err := s.GetSystem(sys.ID); err != nil {
+		return fmt.Errorf("system deleted by another user: %v", err)
+	}
+
+	if err := s.DeleteSystem(sys.ID, u.ID); err != nil {
+		return err
+	}
+	if _, err := s.GetSystem(sys.ID); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("deleted system: want sql.ErrNoRows, got %v", err)
+	}
+	tags, err := s.GetSystemTags(sys.ID, db.TagSourceUser)
+	if err != nil {
+		return err
+	}
+	if len(tags) != 0 {
+		return fmt.Errorf("tags of deleted system remain: %v", tags)
+	}
+	history, err := s.GetDiskHistory(sys.ID, "", time.Time{})
+	if err != nil {
+		return err
+	}
+	if len(history) != 0 {
+		return fmt.Errorf("%d disk history rows of deleted system remain", len(history))
+	}
+	samples, err := s.GetMetricSamples(sys.ID, "cpu", time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	if len(samples) != 0 {
+		return fmt.Errorf("%d metric samples of deleted system remain", len(samples))
+	}
+	checks, err := s.GetChecks(sys.ID)
+	if err != nil {
+		return err
+	}
+	if len(checks) != 0 {
+		return fmt.Errorf("%d checks of deleted system remain", len(checks))
+	}
+	watches, err := s.GetProcessWatches(sys.ID)
+	if err != nil {
+		return err
+	}
+	if len(watches) != 0 {
+		return fmt.Errorf("%d process watches of deleted system remain", len(watches))
+	}
+	packages, err := s.GetInstalledPackages(sys.ID)
+	if err != nil {
+		return err
+	}
+	if len(packages) != 0 {
+		return fmt.Errorf("%d packages of deleted system remain", len(packages))
+	}
+	if _, err := s.GetInventory(sys.ID); !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("inventory of deleted system: want sql.ErrNoRows, got %v", err)
+	}
+	events, err := s.GetLogEvents(sys.ID, db.LogEventQuery{})
+	if err != nil {
+		return err
+	}
+	if len(events) != 0 {
+		return fmt.Errorf("%d log events of deleted system remain", len(events))
+	}
+	groups, err := s.GetGroups(u.ID)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		for _, id := range g.SystemIDs {
+			if id == sys.ID {
+				return fmt.Errorf("deleted system is still a member of %q", g.Name)
+			}
+		}
+	}
+	return nil
+}
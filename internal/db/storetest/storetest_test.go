@@ -0,0 +1,43 @@
+package storetest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/user/server-moni/internal/db"
+)
+
+// postgresURLEnv names an empty scratch PostgreSQL database to run the
+// suite against; the PostgreSQL test is skipped without it.
+const postgresURLEnv = "STORETEST_POSTGRES_URL"
+
+func TestSQLite(t *testing.T) {
+	runSuite(t, filepath.Join(t.TempDir(), "storetest.db"))
+}
+
+func TestPostgres(t *testing.T) {
+	url := os.Getenv(postgresURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", postgresURLEnv)
+	}
+	runSuite(t, url)
+}
+
+func runSuite(t *testing.T, url string) {
+	store, err := db.Open(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range Run(store) {
+		t.Run(r.Name, func(t *testing.T) {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+		})
+	}
+}
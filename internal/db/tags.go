@@ -0,0 +1,223 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// System Tags and Groups
+
+const (
+	TagSourceUser  = "user"
+	TagSourceAgent = "agent"
+)
+
+type Group struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	SystemIDs []int     `json:"system_ids"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SetSystemTags replaces all tags of a system from one source.
+func (s *sqlStore) SetSystemTags(systemID int, source string, tags map[string]string) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.exec("DELETE FROM system_tags WHERE system_id = ? AND source = ?", systemID, source); err != nil {
+		return err
+	}
+	for k, v := range tags {
+		if _, err := tx.exec("INSERT INTO system_tags (system_id, source, key, value) VALUES (?, ?, ?, ?)", systemID, source, k, v); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSystemTags returns the tags of a system from one source.
+func (s *sqlStore) GetSystemTags(systemID int, source string) (map[string]string, error) {
+	rows, err := s.query("SELECT key, value FROM system_tags WHERE system_id = ? AND source = ?", systemID, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		tags[k] = v
+	}
+	return tags, rows.Err()
+}
+
+// loadSystemTags fills in the effective tags and group names of the given
+// systems. Tags set by a user override tags of the same key reported by the
+// agent.
+func (s *sqlStore) loadSystemTags(systems []System) error {
+	if len(systems) == 0 {
+		return nil
+	}
+	index := make(map[int]*System, len(systems))
+	ids := make([]any, 0, len(systems))
+	for i := range systems {
+		systems[i].Tags = make(map[string]string)
+		systems[i].Groups = []string{}
+		index[systems[i].ID] = &systems[i]
+		ids = append(ids, systems[i].ID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	// Agent tags first so user tags overwrite them
+	rows, err := s.query("SELECT system_id, key, value FROM system_tags WHERE system_id IN ("+placeholders+") ORDER BY CASE source WHEN 'agent' THEN 0 ELSE 1 END", ids...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var k, v string
+		if err := rows.Scan(&id, &k, &v); err != nil {
+			rows.Close()
+			return err
+		}
+		index[id].Tags[k] = v
+	}
+	rows.Close()
+
+	rows, err = s.query(`SELECT m.system_id, g.name FROM system_group_members m
+		JOIN system_groups g ON g.id = m.group_id
+		WHERE m.system_id IN (`+placeholders+`) ORDER BY g.name`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		index[id].Groups = append(index[id].Groups, name)
+	}
+	return rows.Err()
+}
+
+func deleteSystemTags(tx *sqlTx, systemID int) error {
+	if _, err := tx.exec("DELETE FROM system_tags WHERE system_id = ?", systemID); err != nil {
+		return err
+	}
+	_, err := tx.exec("DELETE FROM system_group_members WHERE system_id = ?", systemID)
+	return err
+}
+
+// Groups
+
+func (s *sqlStore) CreateGroup(userID int, name string, systemIDs []int) (int64, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.insert("INSERT INTO system_groups (user_id, name) VALUES (?, ?)", userID, name)
+	if err != nil {
+		return 0, err
+	}
+	for _, sid := range systemIDs {
+		if _, err := tx.exec("INSERT INTO system_group_members (group_id, system_id) VALUES (?, ?) ON CONFLICT DO NOTHING", id, sid); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// UpdateGroup renames a group and replaces its members.
+func (s *sqlStore) UpdateGroup(id, userID int, name string, systemIDs []int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.exec("UPDATE system_groups SET name = ? WHERE id = ? AND user_id = ?", name, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.exec("DELETE FROM system_group_members WHERE group_id = ?", id); err != nil {
+		return err
+	}
+	for _, sid := range systemIDs {
+		if _, err := tx.exec("INSERT INTO system_group_members (group_id, system_id) VALUES (?, ?) ON CONFLICT DO NOTHING", id, sid); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) DeleteGroup(id, userID int) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Members first, the group row is referenced by them
+	if _, err := tx.exec("DELETE FROM system_group_members WHERE group_id IN (SELECT id FROM system_groups WHERE id = ? AND user_id = ?)", id, userID); err != nil {
+		return err
+	}
+	res, err := tx.exec("DELETE FROM system_groups WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetGroups(userID int) ([]Group, error) {
+	rows, err := s.query("SELECT id, user_id, name, created_at FROM system_groups WHERE user_id = ? ORDER BY name", userID)
+	if err != nil {
+		return nil, err
+	}
+	groups := []Group{}
+	index := make(map[int]int)
+	for rows.Next() {
+		g := Group{SystemIDs: []int{}}
+		if err := rows.Scan(&g.ID, &g.UserID, &g.Name, &g.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[g.ID] = len(groups)
+		groups = append(groups, g)
+	}
+	rows.Close()
+
+	rows, err = s.query(`SELECT m.group_id, m.system_id FROM system_group_members m
+		JOIN system_groups g ON g.id = m.group_id WHERE g.user_id = ? ORDER BY m.system_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var gid, sid int
+		if err := rows.Scan(&gid, &sid); err != nil {
+			return nil, err
+		}
+		if i, ok := index[gid]; ok {
+			groups[i].SystemIDs = append(groups[i].SystemIDs, sid)
+		}
+	}
+	return groups, rows.Err()
+}
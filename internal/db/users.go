@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// User Management
+
+type User struct {
+	ID            int       `json:"id"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"-"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+const userColumns = "id, email, password_hash, email_verified, created_at"
+
+// CreateUser inserts a user and returns its ID.
+func (s *sqlStore) CreateUser(email, passwordHash string, verified bool) (int64, error) {
+	return s.insert("INSERT INTO users (email, password_hash, email_verified) VALUES (?, ?, ?)", email, passwordHash, verified)
+}
+
+func (s *sqlStore) GetUserByEmail(email string) (*User, error) {
+	var u User
+	err := s.queryRow("SELECT "+userColumns+" FROM users WHERE email = ?", email).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.EmailVerified, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *sqlStore) GetUserByID(id int) (*User, error) {
+	var u User
+	err := s.queryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.EmailVerified, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *sqlStore) UpdateUserPassword(userID int, passwordHash string) error {
+	_, err := s.exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID)
+	return err
+}
+
+func (s *sqlStore) SetEmailVerified(userID int) error {
+	_, err := s.exec("UPDATE users SET email_verified = ? WHERE id = ?", true, userID)
+	return err
+}
+
+// User Tokens (password reset, email verification)
+
+const (
+	TokenPasswordReset = "password_reset"
+	TokenEmailVerify   = "email_verify"
+)
+
+// CreateUserToken stores a single-use token. Only the hash of the token is
+// kept so a leaked database cannot be used to reset passwords.
+func (s *sqlStore) CreateUserToken(tokenHash string, userID int, purpose string, expiresAt time.Time) error {
+	_, err := s.exec("INSERT INTO user_tokens (token_hash, user_id, purpose, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		tokenHash, userID, purpose, time.Now().UTC(), expiresAt.UTC())
+	return err
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns the
+// user it belongs to. It returns sql.ErrNoRows if the token is not valid.
+func (s *sqlStore) ConsumeUserToken(tokenHash, purpose string) (int, error) {
+	now := time.Now().UTC()
+	res, err := s.exec("UPDATE user_tokens SET used_at = ? WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?",
+		now, tokenHash, purpose, now)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return 0, err
+	}
+
+	var userID int
+	err = s.queryRow("SELECT user_id FROM user_tokens WHERE token_hash = ?", tokenHash).Scan(&userID)
+	return userID, err
+}
+
+// InvalidateUserTokens marks all outstanding tokens of a purpose as used, so
+// that requesting a new reset link revokes the previous ones.
+func (s *sqlStore) InvalidateUserTokens(userID int, purpose string) error {
+	_, err := s.exec("UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL", time.Now().UTC(), userID, purpose)
+	return err
+}
+
+// DeleteExpiredUserTokens removes tokens that can no longer be used.
+func (s *sqlStore) DeleteExpiredUserTokens() (int64, error) {
+	res, err := s.exec("DELETE FROM user_tokens WHERE expires_at < ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,92 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+const apkInstalled = "/lib/apk/db/installed"
+
+func apkPackages(ctx context.Context) ([]Package, error) {
+	f, err := os.Open(apkInstalled)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseAPKInstalled(f)
+}
+
+// parseAPKInstalled reads the apk database: paragraphs of "X:value" lines,
+// with P the name, V the version and A the architecture.
+func parseAPKInstalled(r io.Reader) ([]Package, error) {
+	var packages []Package
+	var p Package
+	flush := func() {
+		if p.Name != "" && p.Version != "" {
+			packages = append(packages, p)
+		}
+		p = Package{}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		switch line[0] {
+		case 'P':
+			p.Name = line[2:]
+		case 'V':
+			p.Version = line[2:]
+		case 'A':
+			p.Arch = line[2:]
+		}
+	}
+	flush()
+	return packages, scanner.Err()
+}
+
+// apkUpdates lists the packages with a newer version in the cached
+// indexes. apk has no security advisories, so none are marked security.
+func apkUpdates(ctx context.Context) (map[string]update, error) {
+	out, err := run(ctx, "apk", "version", "-l", "<")
+	if err != nil {
+		return nil, err
+	}
+	return parseAPKVersion(bytes.NewReader(out)), nil
+}
+
+// parseAPKVersion reads the lines of apk version, e.g.
+//
+//	openssl-3.1.4-r1              < 3.1.4-r5
+func parseAPKVersion(r io.Reader) map[string]update {
+	updates := make(map[string]update)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[1] != "<" {
+			continue
+		}
+		// The name is what precedes the version and release
+		pkgver := fields[0]
+		i := strings.LastIndexByte(pkgver, '-')
+		if i < 0 {
+			continue
+		}
+		j := strings.LastIndexByte(pkgver[:i], '-')
+		if j < 0 {
+			continue
+		}
+		updates[pkgver[:j]] = update{version: fields[2]}
+	}
+	return updates
+}
@@ -0,0 +1,138 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// manager reads the database of a package manager and asks it for the
+// pending updates.
+type manager struct {
+	name     string
+	database []string // Any of these exists when the manager is in use
+	packages func(ctx context.Context) ([]Package, error)
+	updates  func(ctx context.Context) (map[string]update, error)
+}
+
+var managers = []manager{
+	{name: ManagerDpkg, database: []string{dpkgStatus}, packages: dpkgPackages, updates: aptUpdates},
+	{name: ManagerRPM, database: []string{"/var/lib/rpm", "/usr/lib/sysimage/rpm"}, packages: rpmPackages, updates: dnfUpdates},
+	{name: ManagerAPK, database: []string{apkInstalled}, packages: apkPackages, updates: apkUpdates},
+}
+
+// Collect lists the packages of the first package manager found. Failing
+// to get the pending updates, e.g. without network access to the
+// repositories, is reported in UpdatesError rather than as an error.
+func Collect(ctx context.Context) (*Inventory, error) {
+	m, ok := detectManager()
+	if !ok {
+		return nil, errors.New("no dpkg, rpm or apk package database found")
+	}
+	packages, err := m.packages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Arch < packages[j].Arch
+	})
+	inv := &Inventory{Manager: m.name, Packages: packages}
+
+	if updates, err := m.updates(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		inv.UpdatesError = err.Error()
+	} else {
+		applyUpdates(inv, updates)
+	}
+
+	inv.RunningKernel = runningKernel()
+	inv.InstalledKernel = newestKernel()
+	inv.RebootRequired = rebootRequired(inv.RunningKernel, inv.InstalledKernel)
+	inv.CollectedAt = time.Now().UTC()
+	return inv, nil
+}
+
+func detectManager() (manager, bool) {
+	for _, m := range managers {
+		for _, path := range m.database {
+			if _, err := os.Stat(path); err == nil {
+				return m, true
+			}
+		}
+	}
+	return manager{}, false
+}
+
+func runningKernel() string {
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// newestKernel returns the newest kernel with modules installed, or "" when
+// there are none, e.g. in a container.
+func newestKernel() string {
+	entries, err := os.ReadDir("/lib/modules")
+	if err != nil {
+		return ""
+	}
+	newest := ""
+	for _, e := range entries {
+		// Only kernels, not leftover directories of removed ones
+		if _, err := os.Stat(filepath.Join("/lib/modules", e.Name(), "modules.dep")); err != nil {
+			continue
+		}
+		if newest == "" || compareRPM(e.Name(), newest) > 0 {
+			newest = e.Name()
+		}
+	}
+	return newest
+}
+
+// rebootRequired reports whether Debian's update-notifier asks for a
+// reboot, or a newer kernel than the running one is installed.
+func rebootRequired(running, installed string) bool {
+	if _, err := os.Stat("/var/run/reboot-required"); err == nil {
+		return true
+	}
+	return running != "" && installed != "" && compareRPM(installed, running) > 0
+}
+
+// run runs a command with untranslated output and returns its stdout. The
+// error includes the last line of stderr, which explains most failures.
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := lastLine(stderr.String()); msg != "" {
+			return out, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return out, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package inventory
+
+import (
+	"context"
+	"errors"
+)
+
+// Collect is only supported on Linux.
+func Collect(ctx context.Context) (*Inventory, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,117 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+const dpkgStatus = "/var/lib/dpkg/status"
+
+func dpkgPackages(ctx context.Context) ([]Package, error) {
+	f, err := os.Open(dpkgStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseDpkgStatus(f)
+}
+
+// parseDpkgStatus reads the installed packages of the dpkg status file:
+// paragraphs of "Field: value" lines separated by blank lines.
+func parseDpkgStatus(r io.Reader) ([]Package, error) {
+	var packages []Package
+	var p Package
+	installed := false
+	flush := func() {
+		if installed && p.Name != "" && p.Version != "" {
+			packages = append(packages, p)
+		}
+		p, installed = Package{}, false
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue // Continuation, e.g. of Description
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch name {
+		case "Package":
+			p.Name = value
+		case "Version":
+			p.Version = value
+		case "Architecture":
+			p.Arch = value
+		case "Status":
+			// Want, flag and state, e.g. "install ok installed"
+			fields := strings.Fields(value)
+			installed = len(fields) == 3 && fields[2] == "installed"
+		}
+	}
+	flush()
+	return packages, scanner.Err()
+}
+
+// aptUpdates simulates an upgrade with apt-get, from the package lists of
+// the last apt-get update. It takes no lock so it runs alongside apt.
+func aptUpdates(ctx context.Context) (map[string]update, error) {
+	out, err := run(ctx, "apt-get", "-s", "-o", "Debug::NoLocking=1", "dist-upgrade")
+	if err != nil {
+		return nil, err
+	}
+	return parseAptSimulation(bytes.NewReader(out)), nil
+}
+
+// parseAptSimulation reads the Inst lines of a simulated upgrade, e.g.
+//
+//	Inst openssl [3.0.2-0ubuntu1.10] (3.0.2-0ubuntu1.12 Ubuntu:22.04/jammy-updates, Ubuntu:22.04/jammy-security [amd64])
+//
+// An update is a security one when it comes from a security archive.
+func parseAptSimulation(r io.Reader) map[string]update {
+	updates := make(map[string]update)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(scanner.Text(), "Inst ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 3 || !strings.HasPrefix(fields[1], "[") {
+			continue // A new package, not an update
+		}
+		_, details, ok := strings.Cut(rest, "(")
+		if !ok {
+			continue
+		}
+		details, _, _ = strings.Cut(details, ")")
+		version, origins, _ := strings.Cut(details, " ")
+		arch := ""
+		if i := strings.LastIndex(origins, "["); i >= 0 {
+			arch = strings.Trim(origins[i:], "[]")
+		}
+		u := update{
+			version:  version,
+			security: strings.Contains(origins, "-security") || strings.Contains(origins, "Debian-Security"),
+		}
+		name, _, _ := strings.Cut(fields[0], ":") // Multiarch, e.g. libc6:i386
+		if arch != "" {
+			updates[name+"."+arch] = u
+		} else {
+			updates[name] = u
+		}
+	}
+	return updates
+}
@@ -0,0 +1,92 @@
+// Package inventory lists the packages installed on a host from the dpkg,
+// rpm or apk database, along with the updates the package manager has
+// pending and whether the host runs its newest kernel.
+//
+// Agents collect an inventory on a slow schedule and upload it to the
+// server apart from the metrics, which only carry its Summary.
+package inventory
+
+import "time"
+
+// Package managers, named after their database
+const (
+	ManagerDpkg = "dpkg"
+	ManagerRPM  = "rpm"
+	ManagerAPK  = "apk"
+)
+
+// Package is an installed package.
+type Package struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"` // In the format of the manager, e.g. 1:3.0.2-0ubuntu1.12 for dpkg
+	Arch      string `json:"arch,omitempty"`
+	Available string `json:"available,omitempty"` // Version of the pending update, if any
+	Security  bool   `json:"security,omitempty"`  // The pending update fixes a security issue
+}
+
+// Inventory is the software installed on a host.
+type Inventory struct {
+	CollectedAt     time.Time `json:"collected_at"`
+	Manager         string    `json:"manager"`
+	Packages        []Package `json:"packages"` // Sorted by name
+	PendingUpdates  int       `json:"pending_updates"`
+	SecurityUpdates int       `json:"security_updates"`
+	UpdatesError    string    `json:"updates_error,omitempty"` // Why the pending updates are unknown
+	RunningKernel   string    `json:"running_kernel,omitempty"`
+	InstalledKernel string    `json:"installed_kernel,omitempty"` // Newest kernel in /lib/modules
+	RebootRequired  bool      `json:"reboot_required"`
+}
+
+// Summary is the part of an inventory reported with every snapshot.
+type Summary struct {
+	CollectedAt     time.Time `json:"collected_at"`
+	Manager         string    `json:"manager"`
+	Packages        int       `json:"packages"`
+	PendingUpdates  int       `json:"pending_updates"`
+	SecurityUpdates int       `json:"security_updates"`
+	UpdatesError    string    `json:"updates_error,omitempty"`
+	RunningKernel   string    `json:"running_kernel,omitempty"`
+	InstalledKernel string    `json:"installed_kernel,omitempty"`
+	RebootRequired  bool      `json:"reboot_required"`
+}
+
+func (inv *Inventory) Summary() *Summary {
+	return &Summary{
+		CollectedAt:     inv.CollectedAt,
+		Manager:         inv.Manager,
+		Packages:        len(inv.Packages),
+		PendingUpdates:  inv.PendingUpdates,
+		SecurityUpdates: inv.SecurityUpdates,
+		UpdatesError:    inv.UpdatesError,
+		RunningKernel:   inv.RunningKernel,
+		InstalledKernel: inv.InstalledKernel,
+		RebootRequired:  inv.RebootRequired,
+	}
+}
+
+// update is a pending update reported by the package manager.
+type update struct {
+	version  string
+	security bool
+}
+
+// applyUpdates marks the packages with a pending update and counts them.
+// Updates of packages that are not installed, i.e. new dependencies, are
+// not counted.
+func applyUpdates(inv *Inventory, updates map[string]update) {
+	for i := range inv.Packages {
+		p := &inv.Packages[i]
+		u, ok := updates[p.Name+"."+p.Arch]
+		if !ok {
+			u, ok = updates[p.Name]
+		}
+		if !ok {
+			continue
+		}
+		p.Available, p.Security = u.version, u.security
+		inv.PendingUpdates++
+		if u.security {
+			inv.SecurityUpdates++
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// rpmFormat prints name, [epoch:]version-release and arch, tab separated.
+const rpmFormat = `%{NAME}\t%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\t%{ARCH}\n`
+
+func rpmPackages(ctx context.Context) ([]Package, error) {
+	out, err := run(ctx, "rpm", "-qa", "--queryformat", rpmFormat)
+	if err != nil {
+		return nil, err
+	}
+	var packages []Package
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 || fields[0] == "gpg-pubkey" {
+			continue // Imported keys are listed as packages
+		}
+		arch := fields[2]
+		if arch == "(none)" {
+			arch = ""
+		}
+		packages = append(packages, Package{Name: fields[0], Version: fields[1], Arch: arch})
+	}
+	return packages, scanner.Err()
+}
+
+// dnfUpdates asks dnf, or yum on older systems, for the available updates
+// and the ones with a security advisory. Both only read cached metadata.
+func dnfUpdates(ctx context.Context) (map[string]update, error) {
+	tool := "dnf"
+	if _, err := exec.LookPath(tool); err != nil {
+		tool = "yum"
+	}
+	out, err := run(ctx, tool, "-q", "-C", "check-update")
+	// Exit code 100 means there are updates
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 100) {
+		return nil, err
+	}
+	updates := parseCheckUpdate(bytes.NewReader(out))
+
+	out, err = run(ctx, tool, "-q", "-C", "updateinfo", "list", "--security")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range parseUpdateInfo(bytes.NewReader(out)) {
+		if u, ok := updates[name]; ok {
+			u.security = true
+			updates[name] = u
+		}
+	}
+	return updates, nil
+}
+
+// parseCheckUpdate reads the "name.arch version repository" lines of
+// dnf check-update, up to the list of obsoleted packages.
+func parseCheckUpdate(r io.Reader) map[string]update {
+	updates := make(map[string]update)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.Contains(fields[0], ".") {
+			continue
+		}
+		updates[fields[0]] = update{version: fields[1]}
+	}
+	return updates
+}
+
+// parseUpdateInfo returns the name.arch of the packages listed by
+// updateinfo list, e.g.
+//
+//	FEDORA-2024-1d2e3f4a5b Important/Sec. openssl-libs-1:3.1.4-4.fc39.x86_64
+func parseUpdateInfo(r io.Reader) []string {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		nevra := fields[2]
+		dot := strings.LastIndexByte(nevra, '.')
+		if dot < 0 {
+			continue
+		}
+		// Drop -version-release
+		nev := nevra[:dot]
+		i := strings.LastIndexByte(nev, '-')
+		if i < 0 {
+			continue
+		}
+		j := strings.LastIndexByte(nev[:i], '-')
+		if j < 0 {
+			continue
+		}
+		names = append(names, nev[:j]+nevra[dot:])
+	}
+	return names
+}
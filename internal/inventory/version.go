@@ -0,0 +1,305 @@
+package inventory
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Compare orders two versions by the rules of a package manager. It
+// returns -1, 0 or 1 as a is older than, the same as or newer than b.
+func Compare(manager, a, b string) int {
+	switch manager {
+	case ManagerDpkg:
+		return compareDpkg(a, b)
+	case ManagerAPK:
+		return compareAPK(a, b)
+	default:
+		return compareEVR(a, b)
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isAlpha(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+// splitEpoch splits the [epoch:] prefix of a dpkg or rpm version.
+func splitEpoch(v string) (int, string) {
+	if e, rest, ok := strings.Cut(v, ":"); ok {
+		if n, err := strconv.Atoi(e); err == nil {
+			return n, rest
+		}
+	}
+	return 0, v
+}
+
+// splitRevision splits a version at its last hyphen, into the upstream
+// version and the dpkg revision or rpm release.
+func splitRevision(v string) (string, string) {
+	if i := strings.LastIndexByte(v, '-'); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+// compareDpkg compares [epoch:]upstream[-revision] versions as dpkg does,
+// see deb-version(7).
+func compareDpkg(a, b string) int {
+	ea, va := splitEpoch(a)
+	eb, vb := splitEpoch(b)
+	if ea != eb {
+		return sign(ea - eb)
+	}
+	ua, ra := splitRevision(va)
+	ub, rb := splitRevision(vb)
+	if c := dpkgVerRevCmp(ua, ub); c != 0 {
+		return c
+	}
+	return dpkgVerRevCmp(ra, rb)
+}
+
+// dpkgOrder weighs a character of the non-digit part of a version: ~ sorts
+// before the end of the string, which sorts before letters, which sort
+// before everything else.
+func dpkgOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+func dpkgVerRevCmp(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isDigit(a[i]) || j < len(b) && !isDigit(b[j]) {
+			if c := dpkgOrder(a, i) - dpkgOrder(b, j); c != 0 {
+				return sign(c)
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		first := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if first == 0 {
+				first = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if first != 0 {
+			return sign(first)
+		}
+	}
+	return 0
+}
+
+// compareEVR compares [epoch:]version[-release] versions as rpm does.
+func compareEVR(a, b string) int {
+	ea, va := splitEpoch(a)
+	eb, vb := splitEpoch(b)
+	if ea != eb {
+		return sign(ea - eb)
+	}
+	ua, ra := splitRevision(va)
+	ub, rb := splitRevision(vb)
+	if c := compareRPM(ua, ub); c != 0 || ra == "" || rb == "" {
+		return c
+	}
+	return compareRPM(ra, rb)
+}
+
+// compareRPM is rpmvercmp: versions are compared by segments of digits or
+// letters, numerically or lexically; a numeric segment is newer than a
+// letter one. ~ sorts before anything, even the end of the version, and ^
+// after the end but before anything else.
+func compareRPM(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSep := func(c byte) bool { return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^' }
+	for len(a) > 0 || len(b) > 0 {
+		for len(a) > 0 && isSep(a[0]) {
+			a = a[1:]
+		}
+		for len(b) > 0 && isSep(b[0]) {
+			b = b[1:]
+		}
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			switch {
+			case a == "":
+				return -1
+			case b == "":
+				return 1
+			case !strings.HasPrefix(a, "^"):
+				return 1
+			case !strings.HasPrefix(b, "^"):
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		numeric := isDigit(a[0])
+		take := func(s string) (string, string) {
+			i := 0
+			for i < len(s) && (numeric && isDigit(s[i]) || !numeric && isAlpha(s[i])) {
+				i++
+			}
+			return s[:i], s[i:]
+		}
+		var sa, sb string
+		sa, a = take(a)
+		sb, b = take(b)
+		if sb == "" {
+			// Segments of different types
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			sa, sb = strings.TrimLeft(sa, "0"), strings.TrimLeft(sb, "0")
+			if len(sa) != len(sb) {
+				return sign(len(sa) - len(sb))
+			}
+		}
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	}
+	return 1
+}
+
+// apkSuffixes rank the suffixes of apk versions: pre-releases sort before
+// the release, patch levels after.
+var apkSuffixes = map[string]int{
+	"alpha": -4, "beta": -3, "pre": -2, "rc": -1,
+	"cvs": 1, "svn": 2, "git": 3, "hg": 4, "p": 5,
+}
+
+type apkVersion struct {
+	numbers  []string
+	letter   byte
+	suffixes [][2]int // Rank and number
+	revision int
+}
+
+// parseAPK parses versions such as 1.2.3a_rc1_p2-r4, see apk-package(5).
+func parseAPK(v string) (apkVersion, bool) {
+	var p apkVersion
+	if i := strings.LastIndex(v, "-r"); i >= 0 {
+		n, err := strconv.Atoi(v[i+2:])
+		if err != nil {
+			return p, false
+		}
+		p.revision, v = n, v[:i]
+	}
+	parts := strings.Split(v, "_")
+	base := parts[0]
+	if base != "" && isAlpha(base[len(base)-1]) {
+		p.letter, base = base[len(base)-1], base[:len(base)-1]
+	}
+	for _, n := range strings.Split(base, ".") {
+		if n == "" || strings.TrimLeft(n, "0123456789") != "" {
+			return p, false
+		}
+		p.numbers = append(p.numbers, n)
+	}
+	for _, s := range parts[1:] {
+		name := strings.TrimRight(s, "0123456789")
+		rank, ok := apkSuffixes[name]
+		if !ok {
+			return p, false
+		}
+		n, _ := strconv.Atoi(s[len(name):])
+		p.suffixes = append(p.suffixes, [2]int{rank, n})
+	}
+	return p, true
+}
+
+// compareAPK compares apk versions, falling back to rpm's rules for the
+// ones that don't follow the format.
+func compareAPK(a, b string) int {
+	pa, okA := parseAPK(a)
+	pb, okB := parseAPK(b)
+	if !okA || !okB {
+		return compareRPM(a, b)
+	}
+	for i := 0; i < len(pa.numbers) && i < len(pb.numbers); i++ {
+		if c := compareRPM(pa.numbers[i], pb.numbers[i]); c != 0 {
+			return c
+		}
+	}
+	if len(pa.numbers) != len(pb.numbers) {
+		return sign(len(pa.numbers) - len(pb.numbers))
+	}
+	if pa.letter != pb.letter {
+		return sign(int(pa.letter) - int(pb.letter))
+	}
+	for i := 0; i < len(pa.suffixes) || i < len(pb.suffixes); i++ {
+		var sa, sb [2]int // A missing suffix ranks as the release
+		if i < len(pa.suffixes) {
+			sa = pa.suffixes[i]
+		}
+		if i < len(pb.suffixes) {
+			sb = pb.suffixes[i]
+		}
+		if sa[0] != sb[0] {
+			return sign(sa[0] - sb[0])
+		}
+		if sa[1] != sb[1] {
+			return sign(sa[1] - sb[1])
+		}
+	}
+	return sign(pa.revision - pb.revision)
+}
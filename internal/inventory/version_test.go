@@ -0,0 +1,69 @@
+package inventory
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		manager, a, b string
+		want          int
+	}{
+		// dpkg, see deb-version(7)
+		{ManagerDpkg, "3.0.2-0ubuntu1.10", "3.0.13", -1},
+		{ManagerDpkg, "3.0.13-0ubuntu3.1", "3.0.13", 1},
+		{ManagerDpkg, "1.0~rc1", "1.0", -1},
+		{ManagerDpkg, "1.0~rc1", "1.0~rc2", -1},
+		{ManagerDpkg, "1.0~~", "1.0~", -1},
+		{ManagerDpkg, "1.0", "1.0a", -1},
+		{ManagerDpkg, "1.0a", "1.0+b1", -1},
+		{ManagerDpkg, "1:1.0", "2.0", 1},
+		{ManagerDpkg, "1:3.0.13", "3.0.13", 1},
+		{ManagerDpkg, "0:1.0", "1.0", 0},
+		{ManagerDpkg, "1.0-1", "1.0-2", -1},
+		{ManagerDpkg, "1.0-2", "1.0-10", -1},
+		{ManagerDpkg, "1.0-1ubuntu1", "1.0-1", 1},
+		{ManagerDpkg, "1.01", "1.1", 0},
+		{ManagerDpkg, "2.36.1-8+deb11u1", "2.36.1-8", 1},
+		{ManagerDpkg, "1.2.3", "1.2.3", 0},
+
+		// rpm's rpmvercmp
+		{ManagerRPM, "3.0.7-27.el9", "3.0.13", -1},
+		{ManagerRPM, "3.0.7-27.el9", "3.0.7", 0}, // The query has no release
+		{ManagerRPM, "3.0.7-27.el9", "3.0.7-28.el9", -1},
+		{ManagerRPM, "3.0.7-27.el9_4", "3.0.7-27.el9", 1},
+		{ManagerRPM, "1:1.0-1", "2.0-1", 1},
+		{ManagerRPM, "1.0~rc1", "1.0", -1},
+		{ManagerRPM, "1.0~rc1", "1.0~rc2", -1},
+		{ManagerRPM, "1.0^git1", "1.0", 1},
+		{ManagerRPM, "1.0^git1", "1.0.1", -1},
+		{ManagerRPM, "1.0~rc1^git1", "1.0~rc1", 1},
+		{ManagerRPM, "1.0a", "1.0.1", -1},
+		{ManagerRPM, "1.10", "1.9", 1},
+		{ManagerRPM, "1.010", "1.10", 0},
+		{ManagerRPM, "1.0", "1_0", 0},
+		{ManagerRPM, "2.0", "2.0.0", -1},
+
+		// apk, see apk-package(5)
+		{ManagerAPK, "3.1.4-r5", "3.1.5-r0", -1},
+		{ManagerAPK, "3.1.4-r5", "3.1.4-r10", -1},
+		{ManagerAPK, "3.1.4", "3.1.4-r0", 0},
+		{ManagerAPK, "1.0_rc1", "1.0", -1},
+		{ManagerAPK, "1.0", "1.0_p1", -1},
+		{ManagerAPK, "1.0_rc1", "1.0_p1", -1},
+		{ManagerAPK, "1.0_alpha2", "1.0_beta1", -1},
+		{ManagerAPK, "1.0_rc1", "1.0_rc2", -1},
+		{ManagerAPK, "1.0_p1", "1.0_p1-r1", -1},
+		{ManagerAPK, "1.0a", "1.0", 1},
+		{ManagerAPK, "1.0a", "1.0b", -1},
+		{ManagerAPK, "1.0b", "1.0.1", -1},
+		{ManagerAPK, "1.2", "1.10", -1},
+		{ManagerAPK, "1.0_git20240101", "1.0", 1},
+	}
+	for _, tt := range tests {
+		if got := Compare(tt.manager, tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: Compare(%q, %q) = %d, want %d", tt.manager, tt.a, tt.b, got, tt.want)
+		}
+		if got := Compare(tt.manager, tt.b, tt.a); got != -tt.want {
+			t.Errorf("%s: Compare(%q, %q) = %d, want %d", tt.manager, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package logtail
+
+import "os"
+
+// fileID is 0 where os.FileInfo carries no file number; a saved offset is
+// then trusted if the file is at least as long.
+func fileID(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,240 @@
+package logtail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxJournalEntries bounds the entries read from the journal in one poll,
+// so a backlog is worked through over several polls.
+const maxJournalEntries = 10000
+
+// maxJournalEntry is the longest journal entry handled; longer ones are
+// skipped.
+const maxJournalEntry = 1 << 20
+
+// priorityPattern matches the priorities journalctl -p accepts: a level or
+// a range of levels, by name or number.
+var priorityPattern = regexp.MustCompile(`^(emerg|alert|crit|err|warning|notice|info|debug|[0-7])(\.\.(emerg|alert|crit|err|warning|notice|info|debug|[0-7]))?$`)
+
+// JournalFilter selects the entries of the systemd journal a source reads.
+// Entries are read with journalctl, which must be installed.
+type JournalFilter struct {
+	Units       []string `json:"units,omitempty"`       // As journalctl -u, e.g. ssh.service
+	Identifiers []string `json:"identifiers,omitempty"` // Syslog identifiers as journalctl -t, e.g. sshd
+	Priority    string   `json:"priority,omitempty"`    // As journalctl -p, e.g. warning or 0..4
+	Directory   string   `json:"directory,omitempty"`   // Journal files to read instead of the local journal, e.g. the host's mounted in a container
+}
+
+func (f *JournalFilter) validate() error {
+	if f.Priority != "" && !priorityPattern.MatchString(f.Priority) {
+		return fmt.Errorf("invalid journal priority %q", f.Priority)
+	}
+	return nil
+}
+
+// args returns the journalctl arguments selecting the entries after the
+// cursor or, without one, since the given time.
+func (f *JournalFilter) args(cursor string, since time.Time) []string {
+	args := []string{"--output=json", "--no-pager", "--quiet"}
+	if f.Directory != "" {
+		args = append(args, "--directory="+f.Directory)
+	}
+	for _, u := range f.Units {
+		args = append(args, "--unit="+u)
+	}
+	for _, id := range f.Identifiers {
+		args = append(args, "--identifier="+id)
+	}
+	if f.Priority != "" {
+		args = append(args, "--priority="+f.Priority)
+	}
+	if cursor != "" {
+		return append(args, "--after-cursor="+cursor)
+	}
+	return append(args, "--since=@"+strconv.FormatInt(since.Unix(), 10))
+}
+
+// journalAvailable reports whether the local journal can be read.
+func journalAvailable() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/journal")
+	return err == nil
+}
+
+// pollJournal handles the journal entries of a source written since the
+// previous poll. Without a saved cursor it starts from when the tailer was
+// created, so the journal's history is not replayed.
+func (t *Tailer) pollJournal(ctx context.Context, s *source) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "journalctl", s.Journal.args(s.cursor, s.since)...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C", "SYSTEMD_COLORS=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(stdout, 64<<10)
+	read := 0
+	for read < maxJournalEntries {
+		data, err := readLine(r, maxJournalEntry)
+		var entry journalEntry
+		if len(data) > 0 && json.Unmarshal(data, &entry) == nil {
+			if c := entry.field("__CURSOR"); c != "" {
+				s.cursor = c
+			}
+			at := entry.time()
+			if s.Format == FormatJSON {
+				t.handle(s, entry.json(), at)
+			} else {
+				t.handle(s, entry.line(at), at)
+			}
+			read++
+		}
+		if err != nil {
+			break
+		}
+	}
+	if read == maxJournalEntries {
+		cancel() // The rest is read by the next poll
+		cmd.Wait()
+		return nil
+	}
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+			msg = msg[i+1:]
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		if read == 0 && strings.Contains(msg, "cursor") {
+			// Start over from now rather than failing on every poll
+			s.cursor, s.since = "", time.Now()
+		}
+		return errors.New("journalctl: " + msg)
+	}
+	return nil
+}
+
+// readLine reads a line without its newline. A line longer than max is
+// skipped and returned as nil.
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	skip := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !skip && len(line)+len(chunk) > max+1 {
+			skip, line = true, nil
+		}
+		if !skip {
+			line = append(line, chunk...)
+		}
+		if err != bufio.ErrBufferFull {
+			return bytes.TrimSuffix(line, []byte("\n")), err
+		}
+	}
+}
+
+// journalEntry is an entry as journalctl --output=json writes it. Values
+// are strings, arrays of bytes for binary data, or arrays of either for
+// fields that occur more than once.
+type journalEntry map[string]json.RawMessage
+
+// field returns the value of a field, the first one if it occurs more than
+// once.
+func (e journalEntry) field(name string) string {
+	raw, ok := e[name]
+	if !ok {
+		return ""
+	}
+	var str string
+	if json.Unmarshal(raw, &str) == nil {
+		return str
+	}
+	var codes []int
+	if json.Unmarshal(raw, &codes) == nil {
+		data := make([]byte, len(codes))
+		for i, c := range codes {
+			data[i] = byte(c)
+		}
+		return strings.ToValidUTF8(string(data), "\uFFFD")
+	}
+	var values []json.RawMessage
+	if json.Unmarshal(raw, &values) == nil && len(values) > 0 {
+		return journalEntry{name: values[0]}.field(name)
+	}
+	return ""
+}
+
+// json writes the entry with every field as a string, for the rules of
+// JSON sources.
+func (e journalEntry) json() string {
+	fields := make(map[string]string, len(e))
+	for name := range e {
+		fields[name] = e.field(name)
+	}
+	data, _ := json.Marshal(fields)
+	return string(data)
+}
+
+// time returns when the entry was written, or now if it says not.
+func (e journalEntry) time() time.Time {
+	us, err := strconv.ParseInt(e.field("__REALTIME_TIMESTAMP"), 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.UnixMicro(us)
+}
+
+// line writes the entry as a syslog line with an RFC 3339 timestamp, the
+// format of the files the presets parse:
+//
+//	2024-05-01T10:00:00.123456+02:00 host sshd[812]: Accepted publickey for ...
+func (e journalEntry) line(at time.Time) string {
+	ident := e.field("SYSLOG_IDENTIFIER")
+	if ident == "" {
+		ident = e.field("_COMM")
+	}
+	pid := e.field("SYSLOG_PID")
+	if pid == "" {
+		pid = e.field("_PID")
+	}
+	var b strings.Builder
+	b.WriteString(at.Format(time.RFC3339Nano))
+	if host := e.field("_HOSTNAME"); host != "" {
+		b.WriteString(" " + host)
+	}
+	b.WriteString(" " + ident)
+	if pid != "" {
+		b.WriteString("[" + pid + "]")
+	}
+	b.WriteString(": " + e.field("MESSAGE"))
+	return b.String()
+}
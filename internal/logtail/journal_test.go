@@ -0,0 +1,208 @@
+package logtail
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// journalEntries reads the entries of a fixture written by journalctl
+// --output=json.
+func journalEntries(t *testing.T, name string) []journalEntry {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []journalEntry
+	r := bufio.NewReader(f)
+	for {
+		data, err := readLine(r, maxJournalEntry)
+		if len(data) > 0 {
+			var entry journalEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, entry)
+		}
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	input := "first\n" + long + "\n" + strings.Repeat("y", 40) + "\n\nlast"
+	// A buffer smaller than the lines, so they are read in chunks
+	r := bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	want := []string{"first", "", strings.Repeat("y", 40), "", "last"}
+	for i, w := range want {
+		data, err := readLine(r, 64)
+		if string(data) != w {
+			t.Errorf("line %d = %q, want %q", i, data, w)
+		}
+		if i < len(want)-1 && err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if i == len(want)-1 && err != io.EOF {
+			t.Errorf("error after the last line = %v, want EOF", err)
+		}
+	}
+
+	// A line of exactly max is kept
+	r = bufio.NewReaderSize(strings.NewReader(long[:64]+"\n"), 16)
+	if data, err := readLine(r, 64); len(data) != 64 || err != nil {
+		t.Errorf("line of max bytes = %d bytes, %v", len(data), err)
+	}
+}
+
+func TestJournalEntryField(t *testing.T) {
+	var e journalEntry
+	err := json.Unmarshal([]byte(`{
+		"MESSAGE": "hello",
+		"BINARY": [104, 105, 10],
+		"INVALID": [104, 255, 105],
+		"REPEATED": ["first", "second"],
+		"REPEATED_BINARY": [[104, 105], "second"],
+		"EMPTY": [],
+		"NUMBER": 5
+	}`), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, want string
+	}{
+		{"MESSAGE", "hello"},
+		{"BINARY", "hi\n"},
+		{"INVALID", "h�i"},
+		{"REPEATED", "first"},
+		{"REPEATED_BINARY", "hi"},
+		{"EMPTY", ""},
+		{"NUMBER", ""},
+		{"MISSING", ""},
+	}
+	for _, tt := range tests {
+		if got := e.field(tt.name); got != tt.want {
+			t.Errorf("field(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(e.json()), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["BINARY"] != "hi\n" || fields["REPEATED"] != "first" || len(fields) != len(e) {
+		t.Errorf("json() = %v", fields)
+	}
+}
+
+func TestJournalEntryTime(t *testing.T) {
+	e := journalEntry{"__REALTIME_TIMESTAMP": json.RawMessage(`"1714550400123456"`)}
+	if got, want := e.time(), time.Date(2024, 5, 1, 8, 0, 0, 123456000, time.UTC); !got.Equal(want) {
+		t.Errorf("time = %v, want %v", got, want)
+	}
+	before := time.Now()
+	if got := (journalEntry{}).time(); got.Before(before) || got.After(time.Now()) {
+		t.Errorf("time without a timestamp = %v, want now", got)
+	}
+}
+
+func TestJournalEntryLine(t *testing.T) {
+	entries := journalEntries(t, "journal.json")
+	if len(entries) != 6 {
+		t.Fatalf("got %d entries, want 6", len(entries))
+	}
+	at := time.Date(2024, 5, 1, 8, 0, 0, 123456000, time.FixedZone("", 2*60*60))
+	tests := []struct {
+		entry journalEntry
+		want  string
+	}{
+		// MESSAGE as an array of bytes
+		{entries[0], "2024-05-01T08:00:00.123456+02:00 web1 sshd[812]: Accepted publickey for deploy from 203.0.113.7 port 50122 ssh2: ED25519 SHA256:abc"},
+		// The command and pid of the process without SYSLOG_ fields
+		{entries[2], "2024-05-01T08:00:00.123456+02:00 web1 sshd[920]: Failed password for invalid user admin from ::ffff:198.51.100.23 port 40022 ssh2"},
+		{entries[4], "2024-05-01T08:00:00.123456+02:00 web1 sudo:    alice : TTY=pts/1 ; PWD=/home/alice ; USER=postgres ; COMMAND=/usr/bin/psql"},
+		{journalEntry{"MESSAGE": json.RawMessage(`"started"`), "_COMM": json.RawMessage(`"app"`)}, "2024-05-01T08:00:00.123456+02:00 app: started"},
+	}
+	for i, tt := range tests {
+		if got := tt.entry.line(at); got != tt.want {
+			t.Errorf("line %d = %q, want %q", i, got, tt.want)
+		}
+	}
+}
+
+// TestJournalMatchesFile checks that the auth preset finds the same events
+// in the journal as in the log file the same messages were written to.
+func TestJournalMatchesFile(t *testing.T) {
+	s := compiled(t, Source{Preset: PresetAuth, Path: "testdata/auth.log"})
+	now := time.Date(2024, 5, 2, 0, 0, 0, 0, time.Local)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "auth.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	// The lines of auth.log that journal.json has entries for
+	fileLines := []string{lines[0], lines[1], lines[2], lines[6], lines[7], lines[11]}
+
+	entries := journalEntries(t, "journal.json")
+	if len(entries) != len(fileLines) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(fileLines))
+	}
+	events := 0
+	for i, entry := range entries {
+		line := entry.line(entry.time())
+		_, got, gotOK := s.parse(line, now)
+		_, want, wantOK := s.parse(fileLines[i], now)
+		if gotOK != wantOK {
+			t.Errorf("entry %d: matched = %v, the file line %v\n%s\n%s", i, gotOK, wantOK, line, fileLines[i])
+			continue
+		}
+		if !gotOK {
+			continue
+		}
+		events++
+		if got.Event != want.Event || !reflect.DeepEqual(got.Fields, want.Fields) || !got.Time.Equal(want.Time) {
+			t.Errorf("entry %d = %s %v at %v, from the file %s %v at %v", i, got.Event, got.Fields, got.Time, want.Event, want.Fields, want.Time)
+		}
+	}
+	if events != 5 {
+		t.Errorf("got %d events, want 5", events)
+	}
+}
+
+func TestJournalFilterArgs(t *testing.T) {
+	f := JournalFilter{Units: []string{"ssh.service"}, Identifiers: []string{"sudo"}, Priority: "0..4", Directory: "/host/var/log/journal"}
+	if err := f.validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"--output=json", "--no-pager", "--quiet", "--directory=/host/var/log/journal", "--unit=ssh.service", "--identifier=sudo", "--priority=0..4", "--after-cursor=s=abc;i=6"}
+	if got := f.args("s=abc;i=6", time.Time{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+	since := time.Unix(1714550400, 0)
+	if got := (&JournalFilter{}).args("", since); got[len(got)-1] != "--since=@1714550400" {
+		t.Errorf("args without a cursor = %q", got)
+	}
+
+	for _, p := range []string{"warning", "err..emerg", "3", "warn", "0..9", "info;"} {
+		f := JournalFilter{Priority: p}
+		valid := p == "warning" || p == "err..emerg" || p == "3"
+		if err := f.validate(); (err == nil) != valid {
+			t.Errorf("validate priority %q = %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package logtail follows log files and the systemd journal on the agent
+// and extracts events from their lines. A source is a file, a glob of
+// files or a filter of journal entries, with rules that match lines by
+// regular expression or, for JSON lines, by field; every match is counted
+// and, unless the rule only counts, becomes an Event that is shipped to the
+// server with the next push.
+//
+// Files are followed across rotation by inode and across restarts by the
+// offsets saved in a state file, the journal by the cursor of the last
+// entry read. The auth and fail2ban presets replace the parsing of
+// /var/log/auth.log and fail2ban.log, and read the same messages from the
+// journal on hosts that log nowhere else.
+package logtail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Formats of a source
+const (
+	FormatRegex = "regex" // Rules match the line with a regular expression
+	FormatJSON  = "json"  // Lines are JSON objects; rules match their fields
+)
+
+// MaxPending caps the events buffered while the server is unreachable; the
+// oldest are dropped first.
+const MaxPending = 1000
+
+// maxMessage is the length lines are cut to in events.
+const maxMessage = 512
+
+// Config lists the sources to follow, as read from the -log-config file.
+type Config struct {
+	StateFile string   `json:"state_file,omitempty"` // Where offsets are saved; without one they are lost on restart
+	Sources   []Source `json:"sources"`
+}
+
+// Source is a log file, a glob of log files or entries of the journal, and
+// how to parse them.
+type Source struct {
+	Name       string         `json:"name"`
+	Path       string         `json:"path,omitempty"`        // File or glob; defaults to the preset's
+	Journal    *JournalFilter `json:"journal,omitempty"`     // Read the systemd journal instead of files
+	Preset     string         `json:"preset,omitempty"`      // auth or fail2ban; its rules come before the source's own
+	Format     string         `json:"format,omitempty"`      // regex (default) or json
+	Rules      []Rule         `json:"rules,omitempty"`       // The first matching rule wins
+	TimeField  string         `json:"time_field,omitempty"`  // Named group or JSON field with the time; by default a leading timestamp
+	TimeLayout string         `json:"time_layout,omitempty"` // Go layout of the time; by default RFC 3339, syslog and "2006-01-02 15:04:05" are recognized
+}
+
+// Rule turns matching lines into events of one type.
+type Rule struct {
+	Event     string            `json:"event"`                // Type of the events, e.g. login_failed
+	Pattern   string            `json:"pattern,omitempty"`    // Regular expression; its named groups become fields
+	Match     map[string]string `json:"match,omitempty"`      // For JSON lines, regular expressions the fields must match
+	Fields    []string          `json:"fields,omitempty"`     // For JSON lines, the fields to keep; by default all scalar ones
+	CountOnly bool              `json:"count_only,omitempty"` // Only count the matches, e.g. for noisy access logs
+
+	pattern *regexp.Regexp
+	match   map[string]*regexp.Regexp
+}
+
+// Event is a log line a rule matched.
+type Event struct {
+	Time    time.Time         `json:"time"`
+	Source  string            `json:"source"`
+	Event   string            `json:"event"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Message string            `json:"message"` // The line, cut to 512 bytes
+}
+
+// SourceStats are the counters of a source since the agent started.
+type SourceStats struct {
+	Name   string            `json:"name"`
+	Path   string            `json:"path,omitempty"`
+	Files  int               `json:"files"` // Files matching the path
+	Lines  uint64            `json:"lines"`
+	Events map[string]uint64 `json:"events"`          // Matches by event type, including count-only rules
+	Error  string            `json:"error,omitempty"` // Why the source could not be read
+}
+
+// LoadConfig reads a JSON config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// DefaultConfig follows the files of the presets, or reads their entries
+// from the journal on hosts that have no such files.
+func DefaultConfig() *Config {
+	cfg := &Config{}
+	journal := journalAvailable()
+	for _, name := range []string{PresetAuth, PresetFail2Ban} {
+		if path, ok := presetPath(name); ok {
+			cfg.Sources = append(cfg.Sources, Source{Name: name, Preset: name, Path: path})
+		} else if journal {
+			cfg.Sources = append(cfg.Sources, Source{Name: name, Preset: name, Journal: &JournalFilter{}})
+		}
+	}
+	return cfg
+}
+
+// compile validates a source, applying its preset, and compiles its rules.
+func (s *Source) compile() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		s.Name = s.Preset
+	}
+	if s.Name == "" {
+		return errors.New("source without a name")
+	}
+	if s.Preset != "" {
+		p, ok := presets[s.Preset]
+		if !ok {
+			return fmt.Errorf("source %s: unknown preset %q", s.Name, s.Preset)
+		}
+		if s.Format != "" && s.Format != p.Format {
+			return fmt.Errorf("source %s: preset %s reads %s lines", s.Name, s.Preset, p.Format)
+		}
+		s.Format = p.Format
+		s.Rules = append(append([]Rule(nil), p.Rules...), s.Rules...)
+		if s.Journal != nil {
+			if len(s.Journal.Units) == 0 && len(s.Journal.Identifiers) == 0 {
+				s.Journal.Units, s.Journal.Identifiers = p.Journal.Units, p.Journal.Identifiers
+			}
+		} else if s.Path == "" {
+			s.Path, _ = presetPath(s.Preset)
+		}
+	}
+	if s.Journal != nil {
+		if s.Path != "" {
+			return fmt.Errorf("source %s: a source reads a path or the journal, not both", s.Name)
+		}
+		if err := s.Journal.validate(); err != nil {
+			return fmt.Errorf("source %s: %w", s.Name, err)
+		}
+	} else if s.Path == "" {
+		return fmt.Errorf("source %s: path or journal is required", s.Name)
+	}
+	if s.Format == "" {
+		s.Format = FormatRegex
+	}
+	if s.Format != FormatRegex && s.Format != FormatJSON {
+		return fmt.Errorf("source %s: format must be regex or json", s.Name)
+	}
+	if len(s.Rules) == 0 {
+		return fmt.Errorf("source %s: no rules", s.Name)
+	}
+	for i := range s.Rules {
+		if err := s.Rules[i].compile(s.Format); err != nil {
+			return fmt.Errorf("source %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) compile(format string) error {
+	if r.Event == "" {
+		return errors.New("rule without an event")
+	}
+	if format == FormatRegex {
+		if r.Pattern == "" {
+			return fmt.Errorf("rule %s: pattern is required", r.Event)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %s: %v", r.Event, err)
+		}
+		r.pattern = re
+		return nil
+	}
+	if r.Pattern != "" {
+		return fmt.Errorf("rule %s: JSON rules match fields, not a pattern", r.Event)
+	}
+	r.match = make(map[string]*regexp.Regexp, len(r.Match))
+	for field, expr := range r.Match {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("rule %s: field %s: %v", r.Event, field, err)
+		}
+		r.match[field] = re
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package logtail
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonTimeFields hold the time of JSON lines when the source names none.
+var jsonTimeFields = []string{"time", "timestamp", "@timestamp", "ts"}
+
+// Layouts of the leading timestamps recognized by default: rsyslog's
+// high-precision format, the date and time of most daemons, fail2ban's
+// with milliseconds after a comma, and the classic syslog one, which has no
+// year.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05,999",
+	"2006-01-02T15:04:05.999999999",
+	time.Stamp,
+}
+
+// parse matches a line against the rules of the source. Lines without a
+// time of their own get now.
+func (s *Source) parse(line string, now time.Time) (*Rule, Event, bool) {
+	if s.Format == FormatJSON {
+		return s.parseJSON(line, now)
+	}
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		m := r.pattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ev := Event{Source: s.Name, Event: r.Event, Message: truncate(line)}
+		for j, name := range r.pattern.SubexpNames() {
+			if name != "" && m[j] != "" {
+				if ev.Fields == nil {
+					ev.Fields = make(map[string]string)
+				}
+				ev.Fields[name] = m[j]
+			}
+		}
+		if s.TimeField != "" {
+			ev.Time = parseTime(ev.Fields[s.TimeField], s.TimeLayout, now)
+		} else {
+			ev.Time = leadingTime(line, s.TimeLayout, now)
+		}
+		normalizeIP(ev.Fields)
+		return r, ev, true
+	}
+	return nil, Event{}, false
+}
+
+func (s *Source) parseJSON(line string, now time.Time) (*Rule, Event, bool) {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return nil, Event{}, false
+	}
+	values := make(map[string]string, len(obj))
+	for k, v := range obj {
+		if str, ok := scalar(v); ok {
+			values[k] = str
+		}
+	}
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		matched := true
+		for field, re := range r.match {
+			v, ok := values[field]
+			if !ok || !re.MatchString(v) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		ev := Event{Source: s.Name, Event: r.Event, Message: truncate(line), Fields: values}
+		if len(r.Fields) > 0 {
+			ev.Fields = make(map[string]string, len(r.Fields))
+			for _, f := range r.Fields {
+				if v, ok := values[f]; ok {
+					ev.Fields[f] = v
+				}
+			}
+		}
+		ev.Time = now
+		fields := jsonTimeFields
+		if s.TimeField != "" {
+			fields = []string{s.TimeField}
+		}
+		for _, f := range fields {
+			if v, ok := values[f]; ok {
+				ev.Time = parseTime(v, s.TimeLayout, now)
+				break
+			}
+		}
+		normalizeIP(ev.Fields)
+		return r, ev, true
+	}
+	return nil, Event{}, false
+}
+
+// scalar formats a JSON string, number or boolean.
+func scalar(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// parseTime parses a time with the layout, or by default one of
+// timeLayouts or Unix seconds. It returns now if the time can't be parsed.
+func parseTime(value, layout string, now time.Time) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return now
+	}
+	layouts := timeLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	} else if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(secs*1e9))
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l, value, time.Local); err == nil {
+			return withYear(t, now)
+		}
+	}
+	return now
+}
+
+// leadingTime parses the timestamp a line starts with, trying the
+// layout's length of the line or, by default, each of timeLayouts.
+func leadingTime(line, layout string, now time.Time) time.Time {
+	if layout != "" {
+		if len(line) >= len(layout) {
+			if t, err := time.ParseInLocation(layout, line[:len(layout)], time.Local); err == nil {
+				return withYear(t, now)
+			}
+		}
+		return now
+	}
+	// RFC 3339 and the others that have no space in them
+	first, _, _ := strings.Cut(line, " ")
+	if t, err := time.Parse(time.RFC3339Nano, first); err == nil {
+		return t
+	}
+	if len(line) >= 19 && line[4] == '-' && line[10] == ' ' {
+		end := 19
+		if len(line) > end && (line[end] == ',' || line[end] == '.') {
+			end++
+			for end < len(line) && line[end] >= '0' && line[end] <= '9' {
+				end++
+			}
+		}
+		value := strings.Replace(line[:end], ",", ".", 1)
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", value, time.Local); err == nil {
+			return t
+		}
+	}
+	if len(line) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, line[:len(time.Stamp)], time.Local); err == nil {
+			return withYear(t, now)
+		}
+	}
+	return now
+}
+
+// withYear completes a time parsed without a year, as syslog writes them,
+// with the year that puts it closest before now: a December line read in
+// January is from the previous year. A day of slack covers clock skew.
+func withYear(t, now time.Time) time.Time {
+	if t.Year() != 0 {
+		return t
+	}
+	y := time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if y.After(now.Add(24 * time.Hour)) {
+		y = y.AddDate(-1, 0, 0)
+	}
+	return y
+}
+
+// normalizeIP checks the ip field, dropping it if it is no address, and
+// writes IPv4-mapped IPv6 addresses as IPv4.
+func normalizeIP(fields map[string]string) {
+	v, ok := fields["ip"]
+	if !ok {
+		return
+	}
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		delete(fields, "ip")
+		return
+	}
+	fields["ip"] = addr.Unmap().String()
+}
+
+func truncate(line string) string {
+	if len(line) <= maxMessage {
+		return line
+	}
+	return strings.ToValidUTF8(line[:maxMessage], "")
+}
@@ -0,0 +1,163 @@
+package logtail
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// parseFile matches every line of a fixture against a source and returns
+// the events.
+func parseFile(t *testing.T, s *Source, name string, now time.Time) []Event {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if _, ev, ok := s.parse(scanner.Text(), now); ok {
+			events = append(events, ev)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func compiled(t *testing.T, s Source) *Source {
+	t.Helper()
+	if err := s.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return &s
+}
+
+func TestAuthPreset(t *testing.T) {
+	s := compiled(t, Source{Preset: PresetAuth, Path: "testdata/auth.log"})
+	now := time.Date(2024, 5, 2, 0, 0, 0, 0, time.Local)
+	events := parseFile(t, s, "auth.log", now)
+
+	want := []struct {
+		event  string
+		fields map[string]string
+	}{
+		{EventLoginAccepted, map[string]string{"method": "publickey", "user": "deploy", "ip": "203.0.113.7", "port": "50122"}},
+		// sshd-session, as OpenSSH 9.8 and later log, from an IPv6 address
+		{EventLoginAccepted, map[string]string{"method": "password", "user": "alice", "ip": "2001:db8::42", "port": "61001"}},
+		// IPv4-mapped addresses are written as IPv4
+		{EventLoginFailed, map[string]string{"method": "password", "user": "admin", "ip": "198.51.100.23", "port": "40022"}},
+		{EventLoginFailed, map[string]string{"method": "publickey", "user": "root", "ip": "fe80::1", "port": "40023"}},
+		{EventInvalidUser, map[string]string{"user": "oracle", "ip": "198.51.100.23"}},
+		// sudo with and without a pid
+		{EventSudo, map[string]string{"user": "deploy", "target": "root", "command": "/usr/bin/systemctl restart nginx"}},
+		{EventSudo, map[string]string{"user": "alice", "target": "postgres", "command": "/usr/bin/psql"}},
+		{EventSudoFailed, map[string]string{"user": "mallory"}},
+		{EventSudoFailed, map[string]string{"user": "eve"}},
+		{EventLoginAccepted, map[string]string{"method": "publickey", "user": "bob", "ip": "192.0.2.10", "port": "50200"}},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		ev := events[i]
+		if ev.Source != PresetAuth || ev.Event != w.event || !reflect.DeepEqual(ev.Fields, w.fields) {
+			t.Errorf("event %d = %s %v, want %s %v", i, ev.Event, ev.Fields, w.event, w.fields)
+		}
+	}
+
+	if want := time.Date(2024, 5, 1, 8, 0, 0, 123456000, time.UTC); !events[0].Time.Equal(want) {
+		t.Errorf("time of an RFC 3339 line = %v, want %v", events[0].Time, want)
+	}
+	if want := time.Date(2024, 5, 1, 10, 5, 0, 0, time.Local); !events[9].Time.Equal(want) {
+		t.Errorf("time of a syslog line = %v, want %v", events[9].Time, want)
+	}
+}
+
+func TestFail2BanPreset(t *testing.T) {
+	s := compiled(t, Source{Preset: PresetFail2Ban, Path: "testdata/fail2ban.log"})
+	events := parseFile(t, s, "fail2ban.log", time.Now())
+
+	want := []struct {
+		event, jail, ip string
+	}{
+		{EventBan, "sshd", "198.51.100.23"},
+		{EventBan, "sshd", "2001:db8::bad"},
+		{EventBan, "nginx-limit-req", "203.0.113.99"},
+		{EventUnban, "sshd", "198.51.100.23"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		ev := events[i]
+		if ev.Event != w.event || ev.Fields["jail"] != w.jail || ev.Fields["ip"] != w.ip {
+			t.Errorf("event %d = %s %v, want %s in %s of %s", i, ev.Event, ev.Fields, w.event, w.jail, w.ip)
+		}
+	}
+	// Milliseconds after a comma
+	if want := time.Date(2024, 5, 1, 10, 10, 0, 123000000, time.Local); !events[0].Time.Equal(want) {
+		t.Errorf("time = %v, want %v", events[0].Time, want)
+	}
+}
+
+func TestWithYear(t *testing.T) {
+	stamp := func(s string) time.Time {
+		t.Helper()
+		ts, err := time.ParseInLocation(time.Stamp, s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		now  time.Time
+		want time.Time
+	}{
+		{"same day", stamp("May  1 10:00:00"), time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{"December line read on New Year's Day", stamp("Dec 31 23:59:58"), time.Date(2025, 1, 1, 0, 0, 5, 0, time.UTC), time.Date(2024, 12, 31, 23, 59, 58, 0, time.UTC)},
+		{"agent clock a little behind", stamp("Jan  1 00:00:30"), time.Date(2024, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)},
+		{"within the day of slack", stamp("May  2 08:00:00"), time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)},
+		{"has a year", time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := withYear(tt.t, tt.now); !got.Equal(tt.want) {
+			t.Errorf("%s: withYear = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeIP(t *testing.T) {
+	tests := []struct {
+		ip, want string
+		ok       bool
+	}{
+		{"192.0.2.1", "192.0.2.1", true},
+		{"2001:db8::42", "2001:db8::42", true},
+		{"2001:0db8:0000:0000:0000:0000:0000:0042", "2001:db8::42", true},
+		{"::ffff:198.51.100.23", "198.51.100.23", true},
+		{"::1", "::1", true},
+		{"1.2.3", "", false},
+		{"::::", "", false},
+	}
+	for _, tt := range tests {
+		fields := map[string]string{"ip": tt.ip}
+		normalizeIP(fields)
+		got, ok := fields["ip"]
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("normalizeIP(%q) = %q, %v, want %q, %v", tt.ip, got, ok, tt.want, tt.ok)
+		}
+	}
+	fields := map[string]string{"user": "root"}
+	if normalizeIP(fields); len(fields) != 1 {
+		t.Errorf("fields without an ip = %v", fields)
+	}
+}
@@ -0,0 +1,69 @@
+package logtail
+
+import "os"
+
+// Built-in presets
+const (
+	PresetAuth     = "auth"     // sshd logins and sudo from auth.log or secure
+	PresetFail2Ban = "fail2ban" // Bans and unbans from fail2ban.log
+)
+
+// Event types of the presets
+const (
+	EventLoginAccepted = "login_accepted"
+	EventLoginFailed   = "login_failed"
+	EventInvalidUser   = "invalid_user"
+	EventSudo          = "sudo"
+	EventSudoFailed    = "sudo_failed"
+	EventBan           = "ban"
+	EventUnban         = "unban"
+)
+
+// ipPattern matches IPv4 and IPv6 addresses, which are checked when the
+// field is normalized.
+const ipPattern = `(?P<ip>[0-9A-Fa-f:.]+)`
+
+type preset struct {
+	Format  string
+	Paths   []string      // The first that exists is the default path
+	Journal JournalFilter // The default filter of journal sources
+	Rules   []Rule
+}
+
+var presets = map[string]preset{
+	PresetAuth: {
+		Format:  FormatRegex,
+		Paths:   []string{"/var/log/auth.log", "/var/log/secure"},
+		Journal: JournalFilter{Identifiers: []string{"sshd", "sshd-session", "sudo"}},
+		Rules: []Rule{
+			// sshd-session logs the authentication since OpenSSH 9.8
+			{Event: EventLoginAccepted, Pattern: `sshd(?:-session)?\[\d+\]: Accepted (?P<method>\S+) for (?P<user>\S+) from ` + ipPattern + ` port (?P<port>\d+)`},
+			{Event: EventLoginFailed, Pattern: `sshd(?:-session)?\[\d+\]: Failed (?P<method>\S+) for (?:invalid user )?(?P<user>\S*) from ` + ipPattern + ` port (?P<port>\d+)`},
+			{Event: EventInvalidUser, Pattern: `sshd(?:-session)?\[\d+\]: Invalid user (?P<user>\S*) from ` + ipPattern},
+			{Event: EventSudoFailed, Pattern: `sudo(?:\[\d+\])?: +(?P<user>\S+) : (?:\d+ incorrect password attempts?|user NOT in sudoers)`},
+			{Event: EventSudo, Pattern: `sudo(?:\[\d+\])?: +(?P<user>\S+) : .*USER=(?P<target>\S+) ; COMMAND=(?P<command>.*)$`},
+		},
+	},
+	PresetFail2Ban: {
+		Format: FormatRegex,
+		Paths:  []string{"/var/log/fail2ban.log"},
+		// The unit's entries, whether fail2ban logs to syslog, the journal or stderr
+		Journal: JournalFilter{Units: []string{"fail2ban.service"}},
+		Rules: []Rule{
+			{Event: EventBan, Pattern: `fail2ban\.actions\s*\[\d+\]:\s+\w+\s+\[(?P<jail>[^\]]+)\]\s+(?:Restore )?Ban ` + ipPattern},
+			{Event: EventUnban, Pattern: `fail2ban\.actions\s*\[\d+\]:\s+\w+\s+\[(?P<jail>[^\]]+)\]\s+Unban ` + ipPattern},
+		},
+	},
+}
+
+// presetPath returns the first existing default path of a preset, or the
+// first path and false if none exists.
+func presetPath(name string) (string, bool) {
+	paths := presets[name].Paths
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return paths[0], false
+}
@@ -0,0 +1,61 @@
+package logtail
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// fileState is the saved position in a file, or in the journal for the
+// entries of a journal source.
+type fileState struct {
+	Inode  uint64 `json:"inode"` // 0 where files have no inode number
+	Offset int64  `json:"offset"`
+	Cursor string `json:"cursor,omitempty"` // Of the last journal entry read
+}
+
+// journalKey is the key of the state of a journal source.
+func journalKey(source string) string {
+	return "journal:" + source
+}
+
+func loadState(path string) (map[string]fileState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state map[string]fileState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// saveState writes the state to a temporary file renamed over the old one,
+// so a crash never leaves it half written.
+func saveState(path string, state map[string]fileState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func sameState(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,381 @@
+package logtail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxReadPerPoll bounds the bytes read from a file in one poll, so a
+	// huge backlog is worked through over several polls.
+	maxReadPerPoll = 8 << 20
+	// maxLine is the length beyond which a line without a newline is
+	// handled as it is.
+	maxLine = 64 << 10
+	// rotateGrace is how long a rotated file is still read.
+	rotateGrace = time.Minute
+)
+
+// compressedExts are the extensions of rotated logs compressed by
+// logrotate, which a glob such as fail2ban.log* also matches.
+var compressedExts = []string{".gz", ".xz", ".bz2", ".zst"}
+
+// Tailer follows the files of a set of sources.
+type Tailer struct {
+	sources   []*source
+	stateFile string
+	saved     map[string]fileState // Offsets as last loaded or saved
+	polled    bool                 // Files first found later are read from the start
+	saveErr   error                // Last error saving the state, logged once by the caller
+
+	mu      sync.Mutex
+	pending []Event
+}
+
+type source struct {
+	Source
+	files  []*tailedFile
+	cursor string    // Of the last journal entry read
+	since  time.Time // Where journal sources without a cursor start
+	stats  SourceStats
+}
+
+// tailedFile is an open log file and how far it has been read.
+type tailedFile struct {
+	path    string
+	f       *os.File
+	info    os.FileInfo
+	offset  int64     // Bytes read
+	partial []byte    // Read but not up to a newline yet
+	gone    time.Time // When the path stopped leading to the file, e.g. on rotation
+}
+
+// NewTailer validates the sources and loads the saved offsets. A state file
+// that can't be read is ignored; files are then read from their end.
+func NewTailer(cfg *Config) (*Tailer, error) {
+	t := &Tailer{stateFile: cfg.StateFile}
+	now := time.Now()
+	names := make(map[string]bool)
+	for _, s := range cfg.Sources {
+		if err := s.compile(); err != nil {
+			return nil, err
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("duplicate source %s", s.Name)
+		}
+		names[s.Name] = true
+		t.sources = append(t.sources, &source{
+			Source: s,
+			since:  now,
+			stats:  SourceStats{Name: s.Name, Path: s.Path, Events: make(map[string]uint64)},
+		})
+	}
+	if t.stateFile != "" {
+		t.saved, _ = loadState(t.stateFile)
+	}
+	for _, s := range t.sources {
+		if s.Journal != nil {
+			s.cursor = t.saved[journalKey(s.Name)].Cursor
+		}
+	}
+	return t, nil
+}
+
+// Poll reads what was appended to every file since the previous poll and
+// saves the offsets. It fails only when no source could be read.
+func (t *Tailer) Poll(ctx context.Context) error {
+	now := time.Now()
+	failed := 0
+	for _, s := range t.sources {
+		var err error
+		if s.Journal != nil {
+			err = t.pollJournal(ctx, s)
+		} else {
+			err = t.pollSource(ctx, s, now)
+		}
+		t.mu.Lock()
+		s.stats.Files = s.current()
+		s.stats.Error = ""
+		if err != nil {
+			s.stats.Error = err.Error()
+			failed++
+		}
+		t.mu.Unlock()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	t.polled = true
+	t.saveErr = t.save()
+	if failed > 0 && failed == len(t.sources) {
+		return errors.New("no log source could be read")
+	}
+	return nil
+}
+
+// SaveError returns the error of the last attempt to save the offsets.
+func (t *Tailer) SaveError() error {
+	return t.saveErr
+}
+
+// pollSource matches the files of a source to the ones it has open by
+// identity rather than path, so a file renamed by rotation to a name the
+// glob also matches is not read again. A file no path leads to anymore is
+// still read for rotateGrace, for what its writer adds before reopening
+// the log. Compressed files a glob matches are left out.
+func (t *Tailer) pollSource(ctx context.Context, s *source, now time.Time) error {
+	paths := []string{s.Path}
+	if strings.ContainsAny(s.Path, "*?[") {
+		var err error
+		if paths, err = filepath.Glob(s.Path); err != nil {
+			return err
+		}
+		paths = slices.DeleteFunc(paths, compressed)
+	}
+	infos := make(map[string]os.FileInfo, len(paths))
+	var lastErr error
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if info.Mode().IsRegular() {
+			infos[path] = info
+		}
+	}
+
+	files := s.files[:0]
+	for _, tf := range s.files {
+		tf.path = ""
+		for path, info := range infos {
+			if os.SameFile(tf.info, info) {
+				tf.path, tf.info, tf.gone = path, info, time.Time{}
+				delete(infos, path)
+				break
+			}
+		}
+		if tf.path == "" && tf.gone.IsZero() {
+			tf.gone = now
+		}
+		if tf.path != "" && tf.info.Size() < tf.offset {
+			// Truncated in place, e.g. by logrotate's copytruncate
+			tf.offset, tf.partial = 0, nil
+		}
+		t.read(s, tf, now)
+		if tf.path == "" && now.Sub(tf.gone) > rotateGrace {
+			t.flushPartial(s, tf, now)
+			tf.f.Close()
+			continue
+		}
+		files = append(files, tf)
+	}
+	s.files = files
+
+	// New files, in the order of their paths
+	newPaths := make([]string, 0, len(infos))
+	for path := range infos {
+		newPaths = append(newPaths, path)
+	}
+	sort.Strings(newPaths)
+	for _, path := range newPaths {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		// Open can race a rotation; the file opened is the one to follow
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			lastErr = err
+			continue
+		}
+		tf := &tailedFile{path: path, f: f, info: info, offset: t.startOffset(path, info)}
+		s.files = append(s.files, tf)
+		t.read(s, tf, now)
+	}
+
+	if s.current() == 0 {
+		if lastErr != nil {
+			return lastErr
+		}
+		return errors.New("no files match " + s.Path)
+	}
+	return nil
+}
+
+// compressed reports whether a path has the extension of a compressed log.
+func compressed(path string) bool {
+	return slices.Contains(compressedExts, filepath.Ext(path))
+}
+
+// current counts the files a path of the source leads to.
+func (s *source) current() int {
+	n := 0
+	for _, tf := range s.files {
+		if tf.path != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// startOffset is where a newly opened file is read from: the saved offset
+// if it is the same file, possibly renamed while the agent was stopped, the
+// end for files that were there before the agent first ran, so history is
+// not replayed, and otherwise the start.
+func (t *Tailer) startOffset(path string, info os.FileInfo) int64 {
+	id := fileID(info)
+	st, ok := t.saved[path]
+	if ok && st.Inode == id && st.Offset <= info.Size() {
+		return st.Offset
+	}
+	if id != 0 {
+		for _, st := range t.saved {
+			if st.Inode == id && st.Offset <= info.Size() {
+				return st.Offset
+			}
+		}
+	}
+	if !ok && !t.polled {
+		return info.Size()
+	}
+	return 0
+}
+
+// read handles the complete lines appended to a file, up to
+// maxReadPerPoll bytes.
+func (t *Tailer) read(s *source, tf *tailedFile, now time.Time) {
+	buf := make([]byte, 64<<10)
+	for total := 0; total < maxReadPerPoll; {
+		n, err := tf.f.ReadAt(buf, tf.offset)
+		if n > 0 {
+			total += n
+			tf.offset += int64(n)
+			data := append(tf.partial, buf[:n]...)
+			for {
+				i := bytes.IndexByte(data, '\n')
+				if i < 0 {
+					break
+				}
+				t.handle(s, string(data[:i]), now)
+				data = data[i+1:]
+			}
+			if len(data) > maxLine {
+				t.handle(s, string(data), now)
+				data = nil
+			}
+			tf.partial = append([]byte(nil), data...)
+		}
+		if err != nil || n == 0 {
+			return // io.EOF, or an I/O error retried on the next poll
+		}
+	}
+}
+
+// flushPartial handles the last line of a rotated file, which has no
+// newline if the writer was stopped halfway.
+func (t *Tailer) flushPartial(s *source, tf *tailedFile, now time.Time) {
+	if len(tf.partial) > 0 {
+		t.handle(s, string(tf.partial), now)
+		tf.partial = nil
+	}
+}
+
+// handle counts a line and records the event of the rule it matches.
+func (t *Tailer) handle(s *source, line string, now time.Time) {
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return
+	}
+	rule, ev, ok := s.parse(line, now)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s.stats.Lines++
+	if !ok {
+		return
+	}
+	s.stats.Events[ev.Event]++
+	if rule.CountOnly {
+		return
+	}
+	t.pending = append(t.pending, ev)
+	t.trim()
+}
+
+// Stats returns the counters of every source, in the order of the config.
+func (t *Tailer) Stats() []SourceStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make([]SourceStats, 0, len(t.sources))
+	for _, s := range t.sources {
+		st := s.stats
+		st.Events = make(map[string]uint64, len(s.stats.Events))
+		for k, v := range s.stats.Events {
+			st.Events[k] = v
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+// Drain returns and clears the buffered events, oldest first.
+func (t *Tailer) Drain() []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := t.pending
+	t.pending = nil
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// Requeue puts back events that could not be delivered.
+func (t *Tailer) Requeue(events []Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(events, t.pending...)
+	t.trim()
+}
+
+func (t *Tailer) trim() {
+	if len(t.pending) > MaxPending {
+		t.pending = t.pending[len(t.pending)-MaxPending:]
+	}
+}
+
+// save writes the offset of every open file, up to its last complete line,
+// and the cursor of every journal source, when one moved.
+func (t *Tailer) save() error {
+	state := make(map[string]fileState)
+	for _, s := range t.sources {
+		if s.cursor != "" {
+			state[journalKey(s.Name)] = fileState{Cursor: s.cursor}
+		}
+		for _, tf := range s.files {
+			if tf.path != "" {
+				state[tf.path] = fileState{Inode: fileID(tf.info), Offset: tf.offset - int64(len(tf.partial))}
+			}
+		}
+	}
+	if t.stateFile == "" || sameState(state, t.saved) {
+		return nil
+	}
+	if err := saveState(t.stateFile, state); err != nil {
+		return err
+	}
+	t.saved = state
+	return nil
+}
@@ -0,0 +1,191 @@
+//go:build unix
+
+package logtail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// hitSource turns lines such as "hit 3" into events with the number as
+// field n.
+func hitSource(path string) Source {
+	return Source{Name: "app", Path: path, Rules: []Rule{{Event: "hit", Pattern: `hit (?P<n>\d+)`}}}
+}
+
+func newTestTailer(t *testing.T, cfg *Config) *Tailer {
+	t.Helper()
+	tl, err := NewTailer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, s := range tl.sources {
+			for _, tf := range s.files {
+				tf.f.Close()
+			}
+		}
+	})
+	return tl
+}
+
+// poll polls the tailer and returns the numbers of the events it found.
+func poll(t *testing.T, tl *Tailer) []string {
+	t.Helper()
+	if err := tl.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	hits := []string{}
+	for _, ev := range tl.Drain() {
+		hits = append(hits, ev.Fields["n"])
+	}
+	return hits
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectHits(t *testing.T, step string, got []string, want ...string) {
+	t.Helper()
+	if want == nil {
+		want = []string{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: hits = %v, want %v", step, got, want)
+	}
+}
+
+func TestTailerRotation(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	appendFile(t, log, "hit 0\n")
+	tl := newTestTailer(t, &Config{Sources: []Source{hitSource(filepath.Join(dir, "app.log*"))}})
+
+	// What was there before the first poll is history
+	expectHits(t, "first poll", poll(t, tl))
+
+	appendFile(t, log, "hit 1\nhit 2") // The writer is halfway through a line
+	expectHits(t, "append", poll(t, tl), "1")
+
+	// logrotate renames the log, the writer finishes its line and reopens
+	appendFile(t, log, "\n")
+	if err := os.Rename(log, log+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, log+".1", "hit 3\n")
+	appendFile(t, log, "hit 4\n")
+	// An older rotation compressed, which the glob matches too
+	appendFile(t, log+".2.gz", "hit 99\n")
+	expectHits(t, "rotation", poll(t, tl), "2", "3", "4")
+
+	// Renamed once more, the file is still the one already read
+	if err := os.Rename(log+".1", log+".2"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, log, "hit 5\n")
+	expectHits(t, "second rotation", poll(t, tl), "5")
+
+	st := tl.Stats()[0]
+	if st.Files != 2 || st.Lines != 5 || st.Events["hit"] != 5 || st.Error != "" {
+		t.Errorf("stats = %+v, want 2 files and 5 lines", st)
+	}
+}
+
+func TestTailerRenamedFileGrace(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	appendFile(t, log, "")
+	tl := newTestTailer(t, &Config{Sources: []Source{hitSource(log)}})
+	expectHits(t, "first poll", poll(t, tl))
+
+	// Without a glob, the rotated file is still read for rotateGrace
+	if err := os.Rename(log, log+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, log+".1", "hit 1\n")
+	appendFile(t, log, "hit 2\n")
+	expectHits(t, "rotation", poll(t, tl), "1", "2")
+	if st := tl.Stats()[0]; st.Files != 1 {
+		t.Errorf("files = %d, want 1", st.Files)
+	}
+}
+
+func TestTailerCopyTruncate(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	appendFile(t, log, "hit 0 from before the agent\n")
+	tl := newTestTailer(t, &Config{Sources: []Source{hitSource(log)}})
+	expectHits(t, "first poll", poll(t, tl))
+
+	appendFile(t, log, "hit 1\n")
+	expectHits(t, "append", poll(t, tl), "1")
+
+	// logrotate's copytruncate empties the file in place
+	if err := os.Truncate(log, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, log, "hit 2\n")
+	expectHits(t, "truncate", poll(t, tl), "2")
+	appendFile(t, log, "hit 3\n")
+	expectHits(t, "append after truncate", poll(t, tl), "3")
+}
+
+func TestTailerRestart(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+	state := filepath.Join(dir, "state", "logtail.json")
+	cfg := func() *Config {
+		return &Config{StateFile: state, Sources: []Source{hitSource(filepath.Join(dir, "app.log*"))}}
+	}
+	appendFile(t, log, "hit 0\n")
+
+	tl := newTestTailer(t, cfg())
+	expectHits(t, "first run", poll(t, tl))
+	appendFile(t, log, "hit 1\nhit 2")
+	expectHits(t, "first run", poll(t, tl), "1")
+	if err := tl.SaveError(); err != nil {
+		t.Fatal(err)
+	}
+
+	// While the agent is stopped, the writer finishes its line, the log is
+	// rotated and the new one written to
+	appendFile(t, log, "\nhit 3\n")
+	if err := os.Rename(log, log+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, log, "hit 4\n")
+
+	// The partial line was not saved as read, the renamed file is found by
+	// inode, and the new log is read from its start; files are opened in
+	// the order of their paths
+	tl = newTestTailer(t, cfg())
+	expectHits(t, "restart", poll(t, tl), "4", "2", "3")
+
+	saved, err := loadState(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := saved[log]; st.Offset != int64(len("hit 4\n")) || st.Inode == 0 {
+		t.Errorf("saved state of %s = %+v", log, st)
+	}
+
+	// A state file that can't be read is ignored
+	if err := os.WriteFile(state, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, log, "hit 5\n")
+	tl = newTestTailer(t, cfg())
+	expectHits(t, "broken state", poll(t, tl))
+}
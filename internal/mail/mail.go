@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/user/server-moni/internal/config"
+)
+
+// Enabled reports whether an SMTP server has been configured.
+func Enabled() bool {
+	return config.AppConfig.SMTPHost != "" && config.AppConfig.SMTPFrom != ""
+}
+
+// Send delivers a plain text email through the configured SMTP server.
+func Send(to, subject, body string) error {
+	if !Enabled() {
+		return fmt.Errorf("smtp not configured")
+	}
+	cfg := config.AppConfig
+
+	// Reject header injection through the recipient or subject
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid header value")
+	}
+
+	msg := strings.Join([]string{
+		"From: " + cfg.SMTPFrom,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	addr := net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort)
+	return smtp.SendMail(addr, auth, cfg.SMTPFrom, []string{to}, []byte(msg))
+}
@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"log"
-	"strings"
 	"sync"
 	"time"
 	"os"
 	"io"
+	"path"
+	"slices"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
@@ -18,27 +19,48 @@ import (
 	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
-	"github.com/shirou/gopsutil/v3/process"
 	"bytes"
 	"fmt"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/user/server-moni/internal/certs"
+	"github.com/user/server-moni/internal/inventory"
+	"github.com/user/server-moni/internal/logtail"
+	"github.com/user/server-moni/internal/procwatch"
+	"github.com/user/server-moni/internal/systemd"
 )
 
+// Collector gathers the metrics of the host it runs on. Start runs each
+// subsystem on its own schedule; Snapshot returns the latest results.
 type Collector struct {
-	lastNetIO    []net.IOCountersStat
-	lastDiskIO   map[string]disk.IOCountersStat
-	lastTime     time.Time
+	mu     sync.RWMutex
+	latest SystemMetrics
+
+	// Rate state, only touched by the subsystem that owns it
+	lastNetIO    map[string]net.IOCountersStat
+	lastNetTime  time.Time
+	disks        diskState
+	kernel       kernelState
+	vm           vmState
+	sockets      socketState
+
 	dockerClient *client.Client
 
 	// Caching for heavy operations
 	diskUsageMutex  sync.RWMutex
 	cachedDiskUsage []FolderSize
+
+	certWatcher *certs.Watcher       // nil when no certificates are watched
+	services    *systemd.Collector   // nil when units are not collected
+	procWatcher *procwatch.Watcher   // nil when no processes are watched
+	processes   *processTracker
+	inventory   *inventory.Inventory // Latest run of the inventory subsystem, guarded by mu
+	logTailer   *logtail.Tailer      // nil when no logs are tailed
 }
 
 func NewCollector() *Collector {
 	c := &Collector{
-		lastDiskIO: make(map[string]disk.IOCountersStat),
-		lastTime:   time.Now(),
+		disks:     diskState{writable: make(map[string]bool)},
+		processes: newProcessTracker(),
 	}
 
 	// Init Docker Client
@@ -60,223 +82,269 @@ func NewCollector() *Collector {
 	return c
 }
 
-func (c *Collector) Collect() SystemMetrics {
-	now := time.Now()
-	timeDiff := now.Sub(c.lastTime).Seconds()
-
-	var metrics SystemMetrics
-
-	// Host Info
-	h, _ := host.Info()
-	metrics.HostInfo = h
+func (c *Collector) collectHost(ctx context.Context) error {
+	h, err := host.InfoWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	c.update(func(m *SystemMetrics) { m.HostInfo = h })
+	return nil
+}
 
-	// CPU
-	// Use 1s interval to get accurate reading, preventing 100% spikes
-	cpuPerc, _ := cpu.Percent(1*time.Second, true)
-	
+func (c *Collector) collectCPU(ctx context.Context) error {
+	// Usage since the previous run, so the scheduler's interval is the
+	// sampling window and nothing blocks
+	cpuPerc, err := cpu.PercentWithContext(ctx, 0, true)
+	if err != nil {
+		return err
+	}
 	var total float64
 	for _, p := range cpuPerc {
 		total += p
 	}
+	var cpuTotal float64
 	if len(cpuPerc) > 0 {
-		metrics.CPUTotal = total / float64(len(cpuPerc))
+		cpuTotal = total / float64(len(cpuPerc))
 	}
-	metrics.CPU = cpuPerc
-	
-	l, _ := load.Avg()
-	metrics.LoadAvg = l
+	l, _ := load.AvgWithContext(ctx)
+
+	c.update(func(m *SystemMetrics) {
+		m.CPU = cpuPerc
+		m.CPUTotal = cpuTotal
+		m.LoadAvg = l
+	})
+	return nil
+}
 
-	// Memory
-	m, _ := mem.VirtualMemory()
-	s, _ := mem.SwapMemory()
-	metrics.Memory = &ExtendedMemoryStat{
-		VirtualMemoryStat: m,
-		Buffers:           m.Buffers,
-		Cached:            m.Cached,
+func (c *Collector) collectMemory(ctx context.Context) error {
+	vm, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return err
 	}
-	metrics.Swap = s
+	swap, _ := mem.SwapMemoryWithContext(ctx)
+	vmStats := c.vm.readVMStats(time.Now())
+	c.update(func(m *SystemMetrics) {
+		m.Memory = &ExtendedMemoryStat{
+			VirtualMemoryStat: vm,
+			Buffers:           vm.Buffers,
+			Cached:            vm.Cached,
+			VM:                vmStats,
+		}
+		m.Swap = swap
+	})
+	return nil
+}
 
-	// Disks (Usage & I/O)
-	parts, _ := disk.Partitions(true)
+func (c *Collector) collectDisks(ctx context.Context) error {
+	now := time.Now()
+	elapsed := now.Sub(c.disks.at).Seconds()
+	if c.disks.at.IsZero() {
+		elapsed = 0
+	}
+
+	parts, err := disk.PartitionsWithContext(ctx, true)
+	if err != nil {
+		return err
+	}
 	var disks []DiskInfo
-	ioCounters, _ := disk.IOCounters()
+	counters, _ := readDiskCounters(ctx)
+	devices := mountDevices()
 
 	log.Printf("DEBUG: Found %d partitions", len(parts))
 	for _, p := range parts {
 		log.Printf("DEBUG: Checking partition: %s (%s)", p.Mountpoint, p.Fstype)
-		// Filter out Docker bind mounts and irrelevant system paths
-		if p.Mountpoint == "/etc/hostname" || 
-		   p.Mountpoint == "/etc/hosts" || 
-		   p.Mountpoint == "/etc/resolv.conf" ||
-		   strings.HasPrefix(p.Mountpoint, "/dev") ||
-		   strings.HasPrefix(p.Mountpoint, "/sys") ||
-		   strings.HasPrefix(p.Mountpoint, "/proc") ||
-		   strings.HasPrefix(p.Mountpoint, "/run") ||
-		   p.Fstype == "tmpfs" ||
-		   p.Fstype == "devtmpfs" ||
-		   p.Fstype == "squashfs" ||
-		   (p.Fstype == "overlay" && p.Mountpoint != "/") {
+		if !c.disks.filter.MatchMount(p.Mountpoint, p.Fstype) {
 			continue
 		}
 
-		u, err := disk.Usage(p.Mountpoint)
+		u, err := disk.UsageWithContext(ctx, p.Mountpoint)
 		if err != nil {
 			log.Printf("DEBUG: Failed to get usage for %s: %v", p.Mountpoint, err)
 			continue
 		}
 
-		// Calculate I/O Rates
-		var rRate, wRate uint64
-		deviceName := p.Device
-		if strings.HasPrefix(deviceName, "/dev/") {
-			deviceName = strings.TrimPrefix(deviceName, "/dev/")
+		dInfo := DiskInfo{
+			Path:              p.Mountpoint,
+			Fstype:            p.Fstype,
+			Total:             u.Total,
+			Used:              u.Used,
+			Free:              u.Free,
+			UsedPercent:       u.UsedPercent,
+			InodesTotal:       u.InodesTotal,
+			InodesUsed:        u.InodesUsed,
+			InodesUsedPercent: u.InodesUsedPercent,
+			ReadOnly:          slices.Contains(p.Opts, "ro"),
 		}
 
-		if curIO, ok := ioCounters[deviceName]; ok {
-			if prevIO, ok := c.lastDiskIO[deviceName]; ok && timeDiff > 0 {
-				rRate = uint64(float64(curIO.ReadBytes-prevIO.ReadBytes) / timeDiff)
-				wRate = uint64(float64(curIO.WriteBytes-prevIO.WriteBytes) / timeDiff)
+		// I/O rates of the device behind the mount, partitions included
+		kernel := mountDevice(devices, p)
+		if cur, ok := counters[kernel]; ok {
+			dInfo.Device = deviceName(kernel)
+			if d, ok := c.disks.deviceStats(kernel, cur, elapsed); ok {
+				dInfo.ReadRate, dInfo.WriteRate = d.ReadRate, d.WriteRate
 			}
-			c.lastDiskIO[deviceName] = curIO
 		}
 
-		dInfo := DiskInfo{
-			Path:        p.Mountpoint,
-			Total:       u.Total,
-			Used:        u.Used,
-			Free:        u.Free,
-			UsedPercent: u.UsedPercent,
-			ReadRate:    rRate,
-			WriteRate:   wRate,
+		if dInfo.ReadOnly {
+			dInfo.Remounted = c.disks.writable[p.Mountpoint]
+		} else {
+			c.disks.writable[p.Mountpoint] = true
 		}
 		log.Printf("DEBUG: Added partition: %s", p.Mountpoint)
 		disks = append(disks, dInfo)
 	}
-	metrics.Disks = disks
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	blockDevices := c.disks.blockDevices(counters, elapsed)
+	c.disks.at, c.disks.last = now, counters
+	c.update(func(m *SystemMetrics) {
+		m.Disks = disks
+		m.BlockDevices = blockDevices
+	})
+	return nil
+}
+
+func (c *Collector) collectNetwork(ctx context.Context) error {
+	now := time.Now()
+	timeDiff := now.Sub(c.lastNetTime).Seconds()
 
-	// Network
-	netIO, _ := net.IOCounters(true)
+	netIO, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	links := interfaceLinks()
 	var netStats NetworkStats
 	var totalRecv, totalSent uint64
 
-	if timeDiff > 0 {
+	counters := make(map[string]net.IOCountersStat, len(netIO))
+	for _, cur := range netIO {
+		counters[cur.Name] = cur
+		prev, found := c.lastNetIO[cur.Name]
+		if !found || timeDiff <= 0 {
+			continue
+		}
 		// Calculate Net Rates
-		for _, cur := range netIO {
-			var prev net.IOCountersStat
-			found := false
-			for _, p := range c.lastNetIO {
-				if p.Name == cur.Name {
-					prev = p
-					found = true
-					break
-				}
-			}
-
-			if found {
-				rRate := uint64(float64(cur.BytesRecv-prev.BytesRecv) / timeDiff)
-				sRate := uint64(float64(cur.BytesSent-prev.BytesSent) / timeDiff)
-				netStats.Interfaces = append(netStats.Interfaces, NetInterface{
-					Name:     cur.Name,
-					RecvRate: rRate,
-					SentRate: sRate,
-				})
-				totalRecv += rRate
-				totalSent += sRate
-			}
+		iface := NetInterface{
+			Name:        cur.Name,
+			RecvRate:    uint64(rate(prev.BytesRecv, cur.BytesRecv, timeDiff)),
+			SentRate:    uint64(rate(prev.BytesSent, cur.BytesSent, timeDiff)),
+			RecvPackets: rate(prev.PacketsRecv, cur.PacketsRecv, timeDiff),
+			SentPackets: rate(prev.PacketsSent, cur.PacketsSent, timeDiff),
+			RecvErrors:  rate(prev.Errin, cur.Errin, timeDiff),
+			SentErrors:  rate(prev.Errout, cur.Errout, timeDiff),
+			RecvDrops:   rate(prev.Dropin, cur.Dropin, timeDiff),
+			SentDrops:   rate(prev.Dropout, cur.Dropout, timeDiff),
 		}
+		if l, ok := links[cur.Name]; ok {
+			iface.State, iface.Speed = l.state, l.speed
+		}
+		netStats.Interfaces = append(netStats.Interfaces, iface)
+		totalRecv += iface.RecvRate
+		totalSent += iface.SentRate
 	}
 	netStats.TotalRecv = totalRecv
 	netStats.TotalSent = totalSent
-	c.lastNetIO = netIO
-	metrics.Network = netStats
-
-	// Processes (Top 20 by CPU)
-	procs, _ := process.Processes()
-	var procInfos []ProcessInfo
-	for _, p := range procs {
-		cpuP, _ := p.CPUPercent()
-		if cpuP < 0.1 {
-			continue
-		} // Optimization
-
-		name, _ := p.Name()
-		memP, _ := p.MemoryPercent()
-		username, _ := p.Username()
-
-		procInfos = append(procInfos, ProcessInfo{
-			PID:      p.Pid,
-			Name:     name,
-			CPU:      cpuP,
-			Mem:      memP,
-			Username: username,
-		})
-	}
+	c.lastNetIO = counters
+	c.lastNetTime = now
+	c.update(func(m *SystemMetrics) { m.Network = netStats })
+	return nil
+}
 
-	// Sort procInfos by CPU (desc)
-	for i := 0; i < len(procInfos); i++ {
-		for j := i + 1; j < len(procInfos); j++ {
-			if procInfos[i].CPU < procInfos[j].CPU {
-				procInfos[i], procInfos[j] = procInfos[j], procInfos[i]
-			}
+func (c *Collector) collectProcesses(ctx context.Context) error {
+	// The memory percentage needs the total, which the memory subsystem may
+	// not have read yet
+	var totalMemory uint64
+	c.mu.RLock()
+	if c.latest.Memory != nil && c.latest.Memory.VirtualMemoryStat != nil {
+		totalMemory = c.latest.Memory.Total
+	}
+	c.mu.RUnlock()
+	if totalMemory == 0 {
+		if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+			totalMemory = vm.Total
 		}
 	}
-	if len(procInfos) > 20 {
-		procInfos = procInfos[:20]
+
+	procs, tree := c.processes.collect(time.Now(), totalMemory)
+	var watched []procwatch.Stats
+	if c.procWatcher != nil {
+		watched = c.procWatcher.Collect()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.update(func(m *SystemMetrics) {
+		m.Processes = procs
+		m.ProcessTree = tree
+		m.WatchedProcesses = watched
+	})
+	return nil
+}
+
+func (c *Collector) collectContainers(ctx context.Context) error {
+	if c.dockerClient == nil {
+		return nil
+	}
+	containers, err := c.dockerClient.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return err
 	}
-	metrics.Processes = procInfos
 
-	// Docker Containers
 	var containerInfos []ContainerInfo
-	if c.dockerClient != nil {
-		containers, err := c.dockerClient.ContainerList(context.Background(), container.ListOptions{All: true})
-		if err == nil {
-			for _, ctr := range containers {
-				name := "unknown"
-				if len(ctr.Names) > 0 {
-					name = ctr.Names[0]
-				}
+	for _, ctr := range containers {
+		name := "unknown"
+		if len(ctr.Names) > 0 {
+			name = ctr.Names[0]
+		}
 
-				var cpuPercent float64
-				var memUsage, memLimit uint64
-
-				if ctr.State == "running" {
-					stats, err := c.dockerClient.ContainerStats(context.Background(), ctr.ID, false)
-					if err == nil {
-						var statsData map[string]interface{}
-						if err := json.NewDecoder(stats.Body).Decode(&statsData); err == nil {
-							if mem, ok := statsData["memory_stats"].(map[string]interface{}); ok {
-								if usage, ok := mem["usage"].(float64); ok {
-									memUsage = uint64(usage)
-								}
-								if limit, ok := mem["limit"].(float64); ok {
-									memLimit = uint64(limit)
-								}
-							}
+		var cpuPercent float64
+		var memUsage, memLimit uint64
+
+		if ctr.State == "running" {
+			stats, err := c.dockerClient.ContainerStats(ctx, ctr.ID, false)
+			if err == nil {
+				var statsData map[string]interface{}
+				if err := json.NewDecoder(stats.Body).Decode(&statsData); err == nil {
+					if mem, ok := statsData["memory_stats"].(map[string]interface{}); ok {
+						if usage, ok := mem["usage"].(float64); ok {
+							memUsage = uint64(usage)
+						}
+						if limit, ok := mem["limit"].(float64); ok {
+							memLimit = uint64(limit)
 						}
-						stats.Body.Close()
 					}
 				}
-
-				containerInfos = append(containerInfos, ContainerInfo{
-					ID:          ctr.ID,
-					Name:        name,
-					Image:       ctr.Image,
-					State:       ctr.State,
-					Status:      ctr.Status,
-					Created:     ctr.Created,
-					CPUPercent:  cpuPercent,
-					MemoryUsage: memUsage,
-					MemoryLimit: memLimit,
-				})
+				stats.Body.Close()
 			}
 		}
-	}
-	metrics.Containers = containerInfos
 
-	c.lastTime = now
-	metrics.LastUpdate = now
+		containerInfos = append(containerInfos, ContainerInfo{
+			ID:          ctr.ID,
+			Name:        name,
+			Image:       ctr.Image,
+			State:       ctr.State,
+			Status:      ctr.Status,
+			Created:     ctr.Created,
+			CPUPercent:  cpuPercent,
+			MemoryUsage: memUsage,
+			MemoryLimit: memLimit,
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.update(func(m *SystemMetrics) { m.Containers = containerInfos })
+	return nil
+}
 
-	return metrics
+func (c *Collector) collectServices(ctx context.Context) error {
+	units, err := c.services.Collect(ctx)
+	if err != nil {
+		return nil // Logged by the systemd collector
+	}
+	c.update(func(m *SystemMetrics) { m.Services = units })
+	return nil
 }
 
 func (c *Collector) GetContainerLogs(containerID string, tail string) (string, error) {
@@ -317,6 +385,46 @@ func (c *Collector) GetContainerLogs(containerID string, tail string) (string, e
 	return buf.String(), nil
 }
 
+// WatchCertificates reports the latest results of w in every snapshot.
+func (c *Collector) WatchCertificates(w *certs.Watcher) {
+	c.certWatcher = w
+}
+
+// CollectServices reports the systemd units read by s, on the schedule of
+// the services subsystem.
+func (c *Collector) CollectServices(s *systemd.Collector) {
+	c.services = s
+}
+
+// SetDiskFilter selects the mounts and block devices the disk subsystem
+// reports.
+func (c *Collector) SetDiskFilter(f DiskFilter) error {
+	for _, p := range append(slices.Clone(f.Include), f.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid disk pattern %q: %v", p, err)
+		}
+	}
+	c.disks.filter = f
+	return nil
+}
+
+// SetProcessOptions selects the processes the processes subsystem reports.
+func (c *Collector) SetProcessOptions(o ProcessOptions) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	c.processes.mu.Lock()
+	c.processes.opts = o
+	c.processes.mu.Unlock()
+	return nil
+}
+
+// WatchProcesses reports the processes matching the watches of w, on the
+// schedule of the processes subsystem.
+func (c *Collector) WatchProcesses(w *procwatch.Watcher) {
+	c.procWatcher = w
+}
+
 // StartBackgroundTasks starts periodic heavy tasks
 func (c *Collector) StartBackgroundTasks() {
 	go func() {
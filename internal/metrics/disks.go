@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDiskExclude leaves out pseudo filesystems, container bind mounts
+// and loop and RAM devices.
+var DefaultDiskExclude = []string{
+	"/dev", "/sys", "/proc", "/run",
+	"/etc/hostname", "/etc/hosts", "/etc/resolv.conf",
+	"/var/lib/docker", "/var/lib/containers",
+	"tmpfs", "devtmpfs", "squashfs",
+	"loop*", "ram*", "zram*",
+}
+
+// DiskFilter selects mounts and block devices with shell patterns. Patterns
+// starting with / match mount points, excluded ones along with the mounts
+// below them; other patterns match filesystem types and block device names.
+type DiskFilter struct {
+	Include []string // Everything when empty
+	Exclude []string // Defaults to DefaultDiskExclude; empty but not nil for none
+}
+
+func (f DiskFilter) exclude() []string {
+	if f.Exclude == nil {
+		return DefaultDiskExclude
+	}
+	return f.Exclude
+}
+
+// MatchMount reports whether a mount point with a filesystem type is
+// reported.
+func (f DiskFilter) MatchMount(mountpoint, fstype string) bool {
+	match := func(patterns []string, below bool) bool {
+		for _, p := range patterns {
+			switch {
+			case !strings.HasPrefix(p, "/"):
+				if matchName(p, fstype) {
+					return true
+				}
+			case below:
+				if MatchMountPattern(p, mountpoint) {
+					return true
+				}
+			case matchName(p, mountpoint):
+				return true
+			}
+		}
+		return false
+	}
+	return (len(f.Include) == 0 || match(f.Include, false)) && !match(f.exclude(), true)
+}
+
+// MatchDevice reports whether a block device, by kernel or mapped name, is
+// reported.
+func (f DiskFilter) MatchDevice(names ...string) bool {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			if strings.HasPrefix(p, "/") {
+				continue
+			}
+			for _, name := range names {
+				if matchName(p, name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return (!hasNamePattern(f.Include) || match(f.Include)) && !match(f.exclude())
+}
+
+func hasNamePattern(patterns []string) bool {
+	for _, p := range patterns {
+		if !strings.HasPrefix(p, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchName(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// MatchMountPattern reports whether a shell pattern matches a mount point
+// or one of its parent directories, so "/var" matches /var/lib too.
+func MatchMountPattern(pattern, p string) bool {
+	for {
+		if matchName(pattern, p) {
+			return true
+		}
+		if p == "/" || p == "." || p == "" {
+			return false
+		}
+		p = path.Dir(p)
+	}
+}
+
+// diskCounters are the cumulative I/O counters of a block device. Times are
+// in milliseconds.
+type diskCounters struct {
+	reads, writes         uint64
+	readBytes, writeBytes uint64
+	readTime, writeTime   uint64
+	ioTime                uint64 // Time spent with I/O in flight
+	weightedTime          uint64 // ioTime weighted by the number in flight
+}
+
+// diskState keeps the counters the disk subsystem computes rates from and
+// the mounts seen writable, to tell a read-only remount.
+type diskState struct {
+	filter   DiskFilter
+	at       time.Time
+	last     map[string]diskCounters
+	writable map[string]bool
+}
+
+// deviceStats computes the rates of a device since the previous
+// collection. It returns false for a device not seen before.
+func (s *diskState) deviceStats(name string, cur diskCounters, elapsed float64) (BlockDevice, bool) {
+	last, ok := s.last[name]
+	if !ok || elapsed <= 0 {
+		return BlockDevice{}, false
+	}
+	d := BlockDevice{
+		ReadIOPS:   rate(last.reads, cur.reads, elapsed),
+		WriteIOPS:  rate(last.writes, cur.writes, elapsed),
+		ReadRate:   uint64(rate(last.readBytes, cur.readBytes, elapsed)),
+		WriteRate:  uint64(rate(last.writeBytes, cur.writeBytes, elapsed)),
+		QueueDepth: rate(last.weightedTime, cur.weightedTime, elapsed) / 1000,
+		// Milliseconds busy per second, as a percentage
+		Utilization: min(rate(last.ioTime, cur.ioTime, elapsed)/10, 100),
+	}
+	if cur.reads > last.reads && cur.readTime >= last.readTime {
+		d.ReadAwait = float64(cur.readTime-last.readTime) / float64(cur.reads-last.reads)
+	}
+	if cur.writes > last.writes && cur.writeTime >= last.writeTime {
+		d.WriteAwait = float64(cur.writeTime-last.writeTime) / float64(cur.writes-last.writes)
+	}
+	return d, true
+}
+
+// blockDevices returns the stats of the whole devices the filter selects,
+// sorted by name.
+func (s *diskState) blockDevices(counters map[string]diskCounters, elapsed float64) []BlockDevice {
+	var devices []BlockDevice
+	for _, kernel := range wholeDevices(counters) {
+		name := deviceName(kernel)
+		if !s.filter.MatchDevice(kernel, name) {
+			continue
+		}
+		d, ok := s.deviceStats(kernel, counters[kernel], elapsed)
+		if !ok {
+			continue
+		}
+		d.Name, d.Kernel = name, kernel
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices
+}
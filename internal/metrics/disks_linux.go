@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// readDiskCounters reads the counters of every block device and partition
+// from /proc/diskstats.
+func readDiskCounters(ctx context.Context) (map[string]diskCounters, error) {
+	f, err := os.Open(filepath.Join(procRoot, "diskstats"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseDiskstats(f)
+}
+
+// parseDiskstats parses /proc/diskstats, see the kernel's
+// Documentation/admin-guide/iostats.rst. Sectors are 512 bytes whatever the
+// device's sector size.
+func parseDiskstats(r io.Reader) (map[string]diskCounters, error) {
+	counters := make(map[string]diskCounters)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		var v [11]uint64
+		for i := range v {
+			v[i], _ = strconv.ParseUint(fields[i+3], 10, 64)
+		}
+		counters[fields[2]] = diskCounters{
+			reads:        v[0],
+			readBytes:    v[2] * 512,
+			readTime:     v[3],
+			writes:       v[4],
+			writeBytes:   v[6] * 512,
+			writeTime:    v[7],
+			ioTime:       v[9],
+			weightedTime: v[10],
+		}
+	}
+	return counters, scanner.Err()
+}
+
+// wholeDevices returns the devices of /sys/block, which lists disks, device
+// mapper and md devices but not their partitions.
+func wholeDevices(counters map[string]diskCounters) []string {
+	entries, err := os.ReadDir(filepath.Join(sysRoot, "block"))
+	if err != nil {
+		names := make([]string, 0, len(counters))
+		for name := range counters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	var names []string
+	for _, e := range entries {
+		if _, ok := counters[e.Name()]; ok {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// deviceName maps a device mapper device such as dm-0 to its name, e.g.
+// the LVM volume vg0-root. Other devices keep their kernel name.
+func deviceName(kernel string) string {
+	if strings.HasPrefix(kernel, "dm-") {
+		data, err := os.ReadFile(filepath.Join(sysRoot, "block", kernel, "dm", "name"))
+		if name := strings.TrimSpace(string(data)); err == nil && name != "" {
+			return name
+		}
+	}
+	return kernel
+}
+
+// mountDevices maps every mount point to the kernel name of its block
+// device, by the device number in mountinfo rather than the device path,
+// which may be a /dev/mapper or /dev/disk/by-* link or missing in a
+// container.
+func mountDevices() map[string]string {
+	f, err := os.Open(filepath.Join(procRoot, "1", "mountinfo"))
+	if err != nil {
+		if f, err = os.Open(filepath.Join(procRoot, "self", "mountinfo")); err != nil {
+			return nil
+		}
+	}
+	defer f.Close()
+
+	devices := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		link, err := os.Readlink(filepath.Join(sysRoot, "dev", "block", fields[2]))
+		if err != nil {
+			continue // Not a block device
+		}
+		devices[unescapeMountinfo(fields[4])] = filepath.Base(link)
+	}
+	return devices
+}
+
+// unescapeMountinfo undoes the octal escapes of spaces, tabs, newlines and
+// backslashes in mountinfo paths.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// mountDevice returns the kernel name of the device of a mount.
+func mountDevice(devices map[string]string, p disk.PartitionStat) string {
+	if kernel, ok := devices[p.Mountpoint]; ok {
+		return kernel
+	}
+	if resolved, err := filepath.EvalSymlinks(p.Device); err == nil {
+		return filepath.Base(resolved)
+	}
+	return strings.TrimPrefix(p.Device, "/dev/")
+}
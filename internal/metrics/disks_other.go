@@ -0,0 +1,49 @@
+//go:build !linux
+
+package metrics
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func readDiskCounters(ctx context.Context) (map[string]diskCounters, error) {
+	io, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counters := make(map[string]diskCounters, len(io))
+	for name, c := range io {
+		counters[name] = diskCounters{
+			reads:        c.ReadCount,
+			writes:       c.WriteCount,
+			readBytes:    c.ReadBytes,
+			writeBytes:   c.WriteBytes,
+			readTime:     c.ReadTime,
+			writeTime:    c.WriteTime,
+			ioTime:       c.IoTime,
+			weightedTime: c.WeightedIO,
+		}
+	}
+	return counters, nil
+}
+
+func wholeDevices(counters map[string]diskCounters) []string {
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func deviceName(kernel string) string { return kernel }
+
+func mountDevices() map[string]string { return nil }
+
+func mountDevice(devices map[string]string, p disk.PartitionStat) string {
+	return strings.TrimPrefix(p.Device, "/dev/")
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"github.com/user/server-moni/internal/inventory"
+)
+
+// collectInventory lists the installed packages and pending updates. The
+// snapshot only carries the summary; the agent uploads the whole inventory
+// separately, see Inventory.
+func (c *Collector) collectInventory(ctx context.Context) error {
+	inv, err := inventory.Collect(ctx)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.inventory = inv
+	c.mu.Unlock()
+	c.update(func(m *SystemMetrics) { m.Inventory = inv.Summary() })
+	return nil
+}
+
+// Inventory returns the latest software inventory, nil before the first
+// one is collected.
+func (c *Collector) Inventory() *inventory.Inventory {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.inventory
+}
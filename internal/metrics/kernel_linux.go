@@ -0,0 +1,323 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kernelState keeps the counters the kernel subsystem computes rates from.
+type kernelState struct {
+	at      time.Time
+	cpus    map[string]cpuCounters
+	stat    kernelStat
+	cgroups map[string]cgroupCounters
+}
+
+// cpuCounters are the user, nice, system, idle, iowait, irq, softirq and
+// steal times of a cpu line of /proc/stat, in clock ticks.
+type cpuCounters [8]uint64
+
+type kernelStat struct {
+	cpus                       []string // In file order, "cpu" first
+	times                      map[string]cpuCounters
+	ctxt, intr, forks          uint64
+	procsRunning, procsBlocked uint64
+}
+
+type cgroupCounters struct {
+	usage, throttled uint64 // Microseconds
+	read, write      uint64 // Bytes
+}
+
+type cgroupSample struct {
+	name     string
+	counters cgroupCounters
+	memory   uint64
+	limit    uint64
+	pids     uint64
+	pressure *Pressure
+}
+
+// collectKernel reads pressure stall information, the CPU time breakdown,
+// scheduler counters and the usage of the top-level cgroups.
+func (c *Collector) collectKernel(ctx context.Context) error {
+	now := time.Now()
+	stat, err := readKernelStat(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return err
+	}
+	pressureDir := filepath.Join(procRoot, "pressure")
+	pressure := readPressure(filepath.Join(pressureDir, "cpu"), filepath.Join(pressureDir, "memory"), filepath.Join(pressureDir, "io"))
+	samples := readCgroups(filepath.Join(sysRoot, "fs", "cgroup"))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	prev := c.kernel
+	elapsed := now.Sub(prev.at).Seconds()
+	if prev.at.IsZero() {
+		elapsed = 0
+	}
+
+	var times []CPUTimes
+	for _, name := range stat.cpus {
+		cur := stat.times[name]
+		last, ok := prev.cpus[name]
+		if !ok {
+			continue
+		}
+		if t, ok := cpuTimesBetween(name, last, cur); ok {
+			times = append(times, t)
+		}
+	}
+
+	var kernel *KernelStats
+	if elapsed > 0 {
+		kernel = &KernelStats{
+			ContextSwitches: rate(prev.stat.ctxt, stat.ctxt, elapsed),
+			Interrupts:      rate(prev.stat.intr, stat.intr, elapsed),
+			Forks:           rate(prev.stat.forks, stat.forks, elapsed),
+			ProcsRunning:    stat.procsRunning,
+			ProcsBlocked:    stat.procsBlocked,
+		}
+	}
+
+	counters := make(map[string]cgroupCounters, len(samples))
+	var cgroups []CgroupUsage
+	for _, s := range samples {
+		counters[s.name] = s.counters
+		u := CgroupUsage{Name: s.name, MemoryBytes: s.memory, MemoryLimit: s.limit, Pids: s.pids, Pressure: s.pressure}
+		if last, ok := prev.cgroups[s.name]; ok && elapsed > 0 {
+			// Microseconds over seconds: divide by 1e6, times 100 percent
+			u.CPUPercent = rate(last.usage, s.counters.usage, elapsed) / 1e4
+			u.ThrottledPercent = rate(last.throttled, s.counters.throttled, elapsed) / 1e4
+			u.ReadRate = uint64(rate(last.read, s.counters.read, elapsed))
+			u.WriteRate = uint64(rate(last.write, s.counters.write, elapsed))
+		}
+		cgroups = append(cgroups, u)
+	}
+
+	c.kernel = kernelState{at: now, cpus: stat.times, stat: stat, cgroups: counters}
+	c.update(func(m *SystemMetrics) {
+		m.Pressure = pressure
+		m.CPUTimes = times
+		m.Kernel = kernel
+		m.Cgroups = cgroups
+	})
+	return nil
+}
+
+func cpuTimesBetween(name string, last, cur cpuCounters) (CPUTimes, bool) {
+	var delta [8]float64
+	var total float64
+	for i := range cur {
+		if cur[i] >= last[i] {
+			delta[i] = float64(cur[i] - last[i])
+		}
+		total += delta[i]
+	}
+	if total == 0 {
+		return CPUTimes{}, false
+	}
+	pct := func(i int) float64 { return 100 * delta[i] / total }
+	return CPUTimes{
+		CPU:     name,
+		User:    pct(0),
+		Nice:    pct(1),
+		System:  pct(2),
+		Idle:    pct(3),
+		IOWait:  pct(4),
+		IRQ:     pct(5),
+		SoftIRQ: pct(6),
+		Steal:   pct(7),
+	}, true
+}
+
+// readKernelStat parses /proc/stat, see proc(5).
+func readKernelStat(path string) (kernelStat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return kernelStat{}, err
+	}
+	defer f.Close()
+
+	stat := kernelStat{times: make(map[string]cpuCounters)}
+	scanner := bufio.NewScanner(f)
+	// The intr line lists every interrupt and can be long
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		key := fields[0]
+		switch {
+		case strings.HasPrefix(key, "cpu"):
+			var t cpuCounters
+			for i := range t {
+				if i+1 < len(fields) {
+					t[i], _ = strconv.ParseUint(fields[i+1], 10, 64)
+				}
+			}
+			stat.cpus = append(stat.cpus, key)
+			stat.times[key] = t
+		case key == "ctxt":
+			stat.ctxt, _ = strconv.ParseUint(fields[1], 10, 64)
+		case key == "intr":
+			stat.intr, _ = strconv.ParseUint(fields[1], 10, 64)
+		case key == "processes":
+			stat.forks, _ = strconv.ParseUint(fields[1], 10, 64)
+		case key == "procs_running":
+			stat.procsRunning, _ = strconv.ParseUint(fields[1], 10, 64)
+		case key == "procs_blocked":
+			stat.procsBlocked, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return kernelStat{}, err
+	}
+	if len(stat.cpus) == 0 {
+		return kernelStat{}, errors.New("no cpu lines in " + path)
+	}
+	return stat, nil
+}
+
+// readPressure reads the cpu, memory and io pressure files of the system
+// (/proc/pressure) or of a cgroup. It returns nil if none can be read.
+func readPressure(cpuPath, memoryPath, ioPath string) *Pressure {
+	p := &Pressure{
+		CPU:    readPressureFile(cpuPath),
+		Memory: readPressureFile(memoryPath),
+		IO:     readPressureFile(ioPath),
+	}
+	if p.CPU == nil && p.Memory == nil && p.IO == nil {
+		return nil
+	}
+	return p
+}
+
+// readPressureFile parses lines such as
+//
+//	some avg10=0.12 avg60=0.05 avg300=0.01 total=123456
+func readPressureFile(path string) *PressureLine {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var line PressureLine
+	found := false
+	for _, l := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+		var s PressureStat
+		for _, f := range fields[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			switch k {
+			case "avg10":
+				s.Avg10, _ = strconv.ParseFloat(v, 64)
+			case "avg60":
+				s.Avg60, _ = strconv.ParseFloat(v, 64)
+			case "avg300":
+				s.Avg300, _ = strconv.ParseFloat(v, 64)
+			case "total":
+				s.Total, _ = strconv.ParseUint(v, 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			line.Some, found = s, true
+		case "full":
+			line.Full = &s
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &line
+}
+
+// readCgroups reads the top-level groups of a cgroup v2 hierarchy, sorted
+// by name. It returns nil on the legacy (v1) hierarchy.
+func readCgroups(root string) []cgroupSample {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	var samples []cgroupSample
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, e.Name())
+		s := cgroupSample{name: e.Name()}
+		s.memory, _ = readUintFile(filepath.Join(dir, "memory.current"))
+		s.limit, _ = readUintFile(filepath.Join(dir, "memory.max")) // "max" leaves it at 0
+		s.pids, _ = readUintFile(filepath.Join(dir, "pids.current"))
+		s.counters.usage, s.counters.throttled = readCgroupCPU(filepath.Join(dir, "cpu.stat"))
+		s.counters.read, s.counters.write = readCgroupIO(filepath.Join(dir, "io.stat"))
+		s.pressure = readPressure(filepath.Join(dir, "cpu.pressure"), filepath.Join(dir, "memory.pressure"), filepath.Join(dir, "io.pressure"))
+		samples = append(samples, s)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].name < samples[j].name })
+	return samples
+}
+
+// readCgroupCPU returns usage_usec and throttled_usec from cpu.stat.
+func readCgroupCPU(path string) (usage, throttled uint64) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+	for _, l := range strings.Split(string(data), "\n") {
+		k, v, _ := strings.Cut(l, " ")
+		switch k {
+		case "usage_usec":
+			usage, _ = strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		case "throttled_usec":
+			throttled, _ = strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return usage, throttled
+}
+
+// readCgroupIO sums the bytes read and written over the devices in io.stat.
+func readCgroupIO(path string) (read, write uint64) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+	for _, l := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(l)
+		for _, f := range fields[min(1, len(fields)):] {
+			k, v, _ := strings.Cut(f, "=")
+			n, _ := strconv.ParseUint(v, 10, 64)
+			switch k {
+			case "rbytes":
+				read += n
+			case "wbytes":
+				write += n
+			}
+		}
+	}
+	return read, write
+}
+
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadKernelStat(t *testing.T) {
+	stat, err := readKernelStat(filepath.Join("testdata", "proc", "stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cpu", "cpu0", "cpu1"}; !reflect.DeepEqual(stat.cpus, want) {
+		t.Errorf("cpus = %v, want %v", stat.cpus, want)
+	}
+	if want := (cpuCounters{1393280, 32966, 572056, 13343292, 6130, 0, 17875, 0}); stat.times["cpu0"] != want {
+		t.Errorf("cpu0 = %v, want %v", stat.times["cpu0"], want)
+	}
+	if stat.ctxt != 8253011465 || stat.intr != 199292264 || stat.forks != 2458714 {
+		t.Errorf("ctxt, intr, forks = %d, %d, %d", stat.ctxt, stat.intr, stat.forks)
+	}
+	if stat.procsRunning != 3 || stat.procsBlocked != 1 {
+		t.Errorf("procs running, blocked = %d, %d, want 3, 1", stat.procsRunning, stat.procsBlocked)
+	}
+
+	if _, err := readKernelStat(filepath.Join("testdata", "proc", "pressure", "cpu")); err == nil {
+		t.Error("a file without cpu lines was read without error")
+	}
+	if _, err := readKernelStat(filepath.Join("testdata", "proc", "missing")); err == nil {
+		t.Error("a missing file was read without error")
+	}
+}
+
+func TestCPUTimesBetween(t *testing.T) {
+	last := cpuCounters{100, 0, 50, 800, 50, 0, 0, 0}
+	cur := cpuCounters{300, 0, 100, 1400, 150, 0, 50, 0}
+	got, ok := cpuTimesBetween("cpu", last, cur)
+	want := CPUTimes{CPU: "cpu", User: 20, System: 5, Idle: 60, IOWait: 10, SoftIRQ: 5}
+	if !ok || got != want {
+		t.Errorf("cpuTimesBetween = %+v, %v, want %+v", got, ok, want)
+	}
+	if _, ok := cpuTimesBetween("cpu", cur, cur); ok {
+		t.Error("no time passed, but times were returned")
+	}
+}
+
+func TestReadPressureFile(t *testing.T) {
+	dir := filepath.Join("testdata", "proc", "pressure")
+	cpu := readPressureFile(filepath.Join(dir, "cpu"))
+	if want := (PressureStat{Avg10: 1.52, Avg60: 0.87, Avg300: 0.25, Total: 187263524}); cpu == nil || cpu.Some != want || cpu.Full != nil {
+		t.Errorf("cpu = %+v, want some %+v and no full", cpu, want)
+	}
+	memory := readPressureFile(filepath.Join(dir, "memory"))
+	if want := (PressureStat{Avg60: 0.05, Avg300: 0.01, Total: 2897311}); memory == nil || memory.Full == nil || *memory.Full != want {
+		t.Errorf("memory = %+v, want full %+v", memory, want)
+	}
+	if io := readPressureFile(filepath.Join(dir, "io")); io != nil {
+		t.Errorf("missing io = %+v, want nil", io)
+	}
+
+	p := readPressure(filepath.Join(dir, "cpu"), filepath.Join(dir, "memory"), filepath.Join(dir, "io"))
+	if p == nil || p.CPU == nil || p.Memory == nil || p.IO != nil {
+		t.Errorf("readPressure = %+v, want cpu and memory only", p)
+	}
+	if p := readPressure(filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")); p != nil {
+		t.Errorf("readPressure of missing files = %+v, want nil", p)
+	}
+}
+
+func TestReadCgroups(t *testing.T) {
+	samples := readCgroups(filepath.Join("testdata", "sys", "fs", "cgroup"))
+	if len(samples) != 2 {
+		t.Fatalf("got %d cgroups, want 2: %+v", len(samples), samples)
+	}
+
+	system := samples[0]
+	if system.name != "system.slice" {
+		t.Errorf("first cgroup = %q, want system.slice", system.name)
+	}
+	if want := (cgroupCounters{usage: 8371625000, throttled: 2941000, read: 3145728, write: 4194304}); system.counters != want {
+		t.Errorf("system.slice counters = %+v, want %+v", system.counters, want)
+	}
+	if system.memory != 734003200 || system.limit != 2147483648 || system.pids != 212 {
+		t.Errorf("system.slice memory, limit, pids = %d, %d, %d", system.memory, system.limit, system.pids)
+	}
+	if p := system.pressure; p == nil || p.Memory == nil || p.Memory.Some.Avg10 != 3.25 || p.CPU != nil {
+		t.Errorf("system.slice pressure = %+v, want memory only", p)
+	}
+
+	user := samples[1]
+	if user.name != "user.slice" {
+		t.Errorf("second cgroup = %q, want user.slice", user.name)
+	}
+	// memory.max is "max" without a limit, and there is no io.stat
+	if want := (cgroupCounters{usage: 125000}); user.counters != want || user.limit != 0 || user.memory != 52428800 {
+		t.Errorf("user.slice = %+v, want counters %+v and no limit", user, want)
+	}
+	if user.pressure != nil {
+		t.Errorf("user.slice pressure = %+v, want nil", user.pressure)
+	}
+
+	if samples := readCgroups(filepath.Join("testdata", "cgroup-v1")); samples != nil {
+		t.Errorf("legacy hierarchy = %+v, want nil", samples)
+	}
+}
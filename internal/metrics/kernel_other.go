@@ -0,0 +1,12 @@
+//go:build !linux
+
+package metrics
+
+import "context"
+
+type kernelState struct{}
+
+// collectKernel is a no-op outside Linux.
+func (c *Collector) collectKernel(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/user/server-moni/internal/logtail"
+)
+
+// TailLogs follows the log sources of t on the schedule of the logs
+// subsystem. The events it extracts are not part of the snapshot; the
+// agent drains them from t for every push.
+func (c *Collector) TailLogs(t *logtail.Tailer) {
+	c.logTailer = t
+}
+
+// collectLogs reads what was appended to the tailed files and reports the
+// counters of every source. Failing to save the offsets fails the run, so
+// it is logged, but the counters are still reported.
+func (c *Collector) collectLogs(ctx context.Context) error {
+	err := c.logTailer.Poll(ctx)
+	c.update(func(m *SystemMetrics) { m.Logs = c.logTailer.Stats() })
+	if err != nil {
+		return err
+	}
+	if err := c.logTailer.SaveError(); err != nil {
+		return fmt.Errorf("saving log offsets: %w", err)
+	}
+	return nil
+}
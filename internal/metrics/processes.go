@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Process sort modes
+const (
+	ProcessSortCPU    = "cpu"
+	ProcessSortMemory = "memory"
+	ProcessSortIO     = "io"
+	ProcessSortFiles  = "files"
+)
+
+const (
+	DefaultProcessLimit = 20
+	maxCmdline          = 1024 // Longer command lines are cut
+)
+
+// ProcessOptions selects the processes reported with every collection.
+type ProcessOptions struct {
+	Limit  int    // Number of processes reported, 0 for DefaultProcessLimit
+	SortBy string // One of the process sort modes, empty for cpu
+	Tree   bool   // Also report the parent/child tree of all processes
+}
+
+// Validate fills in defaults and checks the sort mode.
+func (o *ProcessOptions) Validate() error {
+	if o.Limit < 0 {
+		return errors.New("process limit must not be negative")
+	}
+	if o.Limit == 0 {
+		o.Limit = DefaultProcessLimit
+	}
+	switch o.SortBy {
+	case "":
+		o.SortBy = ProcessSortCPU
+	case ProcessSortCPU, ProcessSortMemory, ProcessSortIO, ProcessSortFiles:
+	default:
+		return errors.New("process sort must be one of cpu, memory, io, files")
+	}
+	return nil
+}
+
+// procStat is what is read for every process on every collection. The
+// rest is only read for the processes that are reported.
+type procStat struct {
+	pid, ppid int32
+	name      string
+	state     string
+	cpuTime   float64 // User and system seconds since the process started
+	rss       uint64
+	threads   int32
+	created   int64 // Milliseconds since the epoch
+}
+
+// procEntry is kept per PID between collections.
+type procEntry struct {
+	created int64 // Tells a reused PID apart
+	cpuTime float64
+	at      time.Time
+
+	readBytes, writeBytes uint64
+	ioAt                  time.Time // Zero until I/O has been read
+
+	// Attributes that do not change, read the first time the process is
+	// reported
+	user, cmdline string
+	hasStatic     bool
+}
+
+// processTracker computes per-process CPU and I/O rates from the
+// difference between collections, rather than the lifetime averages the
+// OS reports.
+type processTracker struct {
+	mu   sync.Mutex
+	opts ProcessOptions
+	last map[int32]*procEntry
+}
+
+func newProcessTracker() *processTracker {
+	opts := ProcessOptions{}
+	opts.Validate()
+	return &processTracker{opts: opts, last: make(map[int32]*procEntry)}
+}
+
+type procCandidate struct {
+	info  ProcessInfo
+	entry *procEntry
+	key   float64
+}
+
+// collect returns the top processes by the configured sort mode and, if
+// enabled, the process tree. totalMemory is used for the memory percentage.
+func (t *processTracker) collect(now time.Time, totalMemory uint64) ([]ProcessInfo, []*ProcessNode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, err := readProcStats()
+	if err != nil {
+		return nil, nil
+	}
+
+	next := make(map[int32]*procEntry, len(stats))
+	candidates := make([]procCandidate, 0, len(stats))
+	for _, st := range stats {
+		entry := t.last[st.pid]
+		var cpuPercent float64
+		if entry == nil || entry.created != st.created {
+			entry = &procEntry{created: st.created}
+		} else if elapsed := now.Sub(entry.at).Seconds(); elapsed > 0 && st.cpuTime >= entry.cpuTime {
+			cpuPercent = 100 * (st.cpuTime - entry.cpuTime) / elapsed
+		}
+		entry.cpuTime, entry.at = st.cpuTime, now
+		next[st.pid] = entry
+
+		c := procCandidate{
+			info: ProcessInfo{
+				PID:        st.pid,
+				PPID:       st.ppid,
+				Name:       st.name,
+				State:      st.state,
+				CPU:        cpuPercent,
+				RSS:        st.rss,
+				Threads:    st.threads,
+				CreateTime: st.created,
+			},
+			entry: entry,
+		}
+		if totalMemory > 0 {
+			c.info.Mem = float32(100 * float64(st.rss) / float64(totalMemory))
+		}
+		switch t.opts.SortBy {
+		case ProcessSortCPU:
+			c.key = c.info.CPU
+		case ProcessSortMemory:
+			c.key = float64(c.info.RSS)
+		case ProcessSortIO:
+			readIO(&c.info, entry, now)
+			c.key = float64(c.info.ReadRate + c.info.WriteRate)
+		case ProcessSortFiles:
+			readOpenFiles(&c.info)
+			c.key = float64(c.info.OpenFiles)
+		}
+		candidates = append(candidates, c)
+	}
+	t.last = next
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].key != candidates[j].key {
+			return candidates[i].key > candidates[j].key
+		}
+		return candidates[i].info.PID < candidates[j].info.PID
+	})
+	if len(candidates) > t.opts.Limit {
+		candidates = candidates[:t.opts.Limit]
+	}
+
+	top := make([]ProcessInfo, 0, len(candidates))
+	for _, c := range candidates {
+		e := c.entry
+		if !e.hasStatic {
+			p := &process.Process{Pid: c.info.PID}
+			e.user, _ = p.Username()
+			e.cmdline, _ = p.Cmdline()
+			if len(e.cmdline) > maxCmdline {
+				e.cmdline = e.cmdline[:maxCmdline]
+			}
+			e.hasStatic = true
+		}
+		c.info.Username, c.info.Cmdline = e.user, e.cmdline
+		if t.opts.SortBy != ProcessSortIO {
+			readIO(&c.info, e, now)
+		}
+		if t.opts.SortBy != ProcessSortFiles {
+			readOpenFiles(&c.info)
+		}
+		top = append(top, c.info)
+	}
+
+	if !t.opts.Tree {
+		return top, nil
+	}
+	return top, processTree(stats)
+}
+
+// readIO fills in the I/O rates of a process since its I/O was last read.
+// Reading the I/O of processes of other users needs privileges; they are
+// left at zero.
+func readIO(info *ProcessInfo, e *procEntry, now time.Time) {
+	io, err := (&process.Process{Pid: info.PID}).IOCounters()
+	if err != nil {
+		return
+	}
+	if !e.ioAt.IsZero() {
+		if elapsed := now.Sub(e.ioAt).Seconds(); elapsed > 0 {
+			if io.ReadBytes >= e.readBytes {
+				info.ReadRate = uint64(float64(io.ReadBytes-e.readBytes) / elapsed)
+			}
+			if io.WriteBytes >= e.writeBytes {
+				info.WriteRate = uint64(float64(io.WriteBytes-e.writeBytes) / elapsed)
+			}
+		}
+	}
+	e.readBytes, e.writeBytes, e.ioAt = io.ReadBytes, io.WriteBytes, now
+}
+
+func readOpenFiles(info *ProcessInfo) {
+	if n, err := (&process.Process{Pid: info.PID}).NumFDs(); err == nil {
+		info.OpenFiles = n
+	}
+}
+
+// processTree links every process to its parent. Processes whose parent is
+// not listed are roots; children are ordered by PID.
+func processTree(stats []procStat) []*ProcessNode {
+	nodes := make(map[int32]*ProcessNode, len(stats))
+	for _, st := range stats {
+		nodes[st.pid] = &ProcessNode{PID: st.pid, Name: st.name}
+	}
+	var roots []*ProcessNode
+	for _, st := range stats {
+		node := nodes[st.pid]
+		if parent, ok := nodes[st.ppid]; ok && st.ppid != st.pid {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	byPID := func(list []*ProcessNode) {
+		sort.Slice(list, func(i, j int) bool { return list[i].PID < list[j].PID })
+	}
+	for _, node := range nodes {
+		byPID(node.Children)
+	}
+	byPID(roots)
+	return roots
+}
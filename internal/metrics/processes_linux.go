@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+var (
+	bootTimeOnce sync.Once
+	bootTimeMS   int64
+)
+
+// readProcStats reads every process from /proc/<pid>/stat, one file per
+// process, instead of the several reads per process gopsutil makes.
+func readProcStats() ([]procStat, error) {
+	dir, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	bootTimeOnce.Do(func() { bootTimeMS = readBootTime() * 1000 })
+	pageSize := uint64(os.Getpagesize())
+
+	stats := make([]procStat, 0, len(dir))
+	for _, d := range dir {
+		pid, err := strconv.ParseInt(d.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(procRoot, d.Name(), "stat"))
+		if err != nil {
+			continue // Exited since the directory was listed
+		}
+		st, err := parseProcStat(data, pageSize)
+		if err != nil {
+			continue
+		}
+		st.pid = int32(pid)
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+// parseProcStat parses a /proc/<pid>/stat line, see proc(5). The command
+// name is in parentheses and may itself contain spaces and parentheses.
+func parseProcStat(data []byte, pageSize uint64) (procStat, error) {
+	open, end := bytes.IndexByte(data, '('), bytes.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return procStat{}, errors.New("malformed stat")
+	}
+	// Fields from the state on; field n of proc(5) is fields[n-3]
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return procStat{}, errors.New("short stat")
+	}
+	ppid, _ := strconv.ParseInt(fields[1], 10, 32)
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	threads, _ := strconv.ParseInt(fields[17], 10, 32)
+	start, _ := strconv.ParseUint(fields[19], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+	if rss < 0 {
+		rss = 0
+	}
+	return procStat{
+		ppid:    int32(ppid),
+		name:    string(data[open+1 : end]),
+		state:   processState(fields[0]),
+		cpuTime: float64(utime+stime) / cpu.ClocksPerSec,
+		rss:     uint64(rss) * pageSize,
+		threads: int32(threads),
+		created: bootTimeMS + int64(float64(start)*1000/cpu.ClocksPerSec),
+	}, nil
+}
+
+// processState names a state letter the way gopsutil does.
+func processState(letter string) string {
+	switch letter {
+	case "R":
+		return process.Running
+	case "S":
+		return process.Sleep
+	case "D":
+		return process.Blocked
+	case "I":
+		return process.Idle
+	case "T", "t":
+		return process.Stop
+	case "Z":
+		return process.Zombie
+	case "W":
+		return process.Wait
+	case "L":
+		return process.Lock
+	}
+	return process.UnknownState
+}
+
+// readBootTime returns the boot time in seconds since the epoch from
+// /proc/stat.
+func readBootTime() int64 {
+	f, err := os.Open(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			t, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return t
+		}
+	}
+	return 0
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+package metrics
+
+import (
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// readProcStats reads every process through gopsutil.
+func readProcStats() ([]procStat, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]procStat, 0, len(procs))
+	for _, p := range procs {
+		st := procStat{pid: p.Pid}
+		st.name, _ = p.Name()
+		st.ppid, _ = p.Ppid()
+		if status, err := p.Status(); err == nil && len(status) > 0 {
+			st.state = status[0]
+		}
+		if t, err := p.Times(); err == nil {
+			st.cpuTime = t.User + t.System
+		}
+		if m, err := p.MemoryInfo(); err == nil {
+			st.rss = m.RSS
+		}
+		st.threads, _ = p.NumThreads()
+		st.created, _ = p.CreateTime()
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"os"
+
+	"github.com/user/server-moni/internal/systemd"
+)
+
+// Where procfs and sysfs are read from. An agent in a container reads the
+// host's through bind mounts, e.g. /host/proc and /host/sys.
+var (
+	procRoot = "/proc"
+	sysRoot  = "/sys"
+)
+
+// SetRoots changes where procfs and sysfs are read from, for this package,
+// gopsutil (through HOST_PROC and HOST_SYS) and the systemd collector. An
+// empty value keeps the current root. Call it before starting collectors.
+func SetRoots(proc, sys string) {
+	if proc != "" {
+		procRoot = proc
+		os.Setenv("HOST_PROC", proc)
+	}
+	if sys != "" {
+		sysRoot = sys
+		os.Setenv("HOST_SYS", sys)
+		systemd.SetSysRoot(sys)
+	}
+}
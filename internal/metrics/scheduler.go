@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/user/server-moni/internal/logger"
+)
+
+// Subsystems of the collector. Each runs on its own schedule and writes its
+// part of the snapshot; synthetic checks and certificates are scheduled by
+// their own packages.
+const (
+	SubsystemHost       = "host"       // Host info
+	SubsystemCPU        = "cpu"        // Per-core usage and load averages
+	SubsystemMemory     = "memory"     // Memory and swap
+	SubsystemDisk       = "disk"       // Mounts, usage and I/O rates
+	SubsystemNetwork    = "network"    // Interface rates, errors and link state
+	SubsystemSockets    = "sockets"    // TCP states and retransmissions, listening sockets
+	SubsystemProcesses  = "processes"  // Top processes and process watches
+	SubsystemContainers = "containers" // Docker containers
+	SubsystemServices   = "services"   // systemd units, when enabled
+	SubsystemKernel     = "kernel"     // Pressure, CPU time breakdown, scheduler counters and cgroups (Linux)
+	SubsystemSensors    = "sensors"    // Hardware temperatures, fans and voltages
+	SubsystemInventory  = "inventory"  // Installed packages, pending updates and kernel (Linux)
+	SubsystemLogs       = "logs"       // Tailed log files, when enabled
+)
+
+// Schedule is how often a subsystem runs and how long one run may take. A
+// zero interval turns the subsystem off.
+type Schedule struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// DefaultSchedules returns the schedule of every subsystem.
+func DefaultSchedules() map[string]Schedule {
+	return map[string]Schedule{
+		SubsystemHost:       {Interval: time.Minute, Timeout: 10 * time.Second},
+		SubsystemCPU:        {Interval: 2 * time.Second, Timeout: 5 * time.Second},
+		SubsystemMemory:     {Interval: 2 * time.Second, Timeout: 5 * time.Second},
+		SubsystemDisk:       {Interval: 10 * time.Second, Timeout: 10 * time.Second},
+		SubsystemNetwork:    {Interval: 2 * time.Second, Timeout: 5 * time.Second},
+		SubsystemSockets:    {Interval: 10 * time.Second, Timeout: 10 * time.Second},
+		SubsystemProcesses:  {Interval: 5 * time.Second, Timeout: 10 * time.Second},
+		SubsystemContainers: {Interval: 10 * time.Second, Timeout: 20 * time.Second},
+		SubsystemServices:   {Interval: 10 * time.Second, Timeout: 5 * time.Second},
+		SubsystemKernel:     {Interval: 5 * time.Second, Timeout: 5 * time.Second},
+		SubsystemSensors:    {Interval: 30 * time.Second, Timeout: 10 * time.Second},
+		SubsystemInventory:  {Interval: time.Hour, Timeout: 5 * time.Minute},
+		SubsystemLogs:       {Interval: 5 * time.Second, Timeout: 10 * time.Second},
+	}
+}
+
+// ParseSchedules overrides the defaults with a comma separated list of
+// subsystem=interval[/timeout], e.g. "disk=30s,containers=15s/30s,processes=0".
+// Without a timeout, the default one is kept unless it is longer than the
+// interval.
+func ParseSchedules(spec string) (map[string]Schedule, error) {
+	schedules := DefaultSchedules()
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		s, known := schedules[name]
+		if !ok || !known {
+			return nil, fmt.Errorf("invalid schedule %q: want subsystem=interval[/timeout] with a subsystem of %s", item, strings.Join(subsystemNames(), ", "))
+		}
+		interval, timeout, hasTimeout := strings.Cut(value, "/")
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid interval for %s: %q", name, interval)
+		}
+		s.Interval = d
+		if hasTimeout {
+			t, err := time.ParseDuration(strings.TrimSpace(timeout))
+			if err != nil || t <= 0 {
+				return nil, fmt.Errorf("invalid timeout for %s: %q", name, timeout)
+			}
+			s.Timeout = t
+		} else if d > 0 && s.Timeout > d {
+			s.Timeout = d
+		}
+		schedules[name] = s
+	}
+	return schedules, nil
+}
+
+func subsystemNames() []string {
+	return []string{SubsystemHost, SubsystemCPU, SubsystemMemory, SubsystemDisk, SubsystemNetwork, SubsystemSockets, SubsystemProcesses, SubsystemContainers, SubsystemServices, SubsystemKernel, SubsystemSensors, SubsystemInventory, SubsystemLogs}
+}
+
+// Start runs every subsystem on its schedule until ctx is done. A run gets
+// a context with the subsystem's timeout; a subsystem that overruns only
+// delays its own next run. Configure the collector before calling Start.
+func (c *Collector) Start(ctx context.Context, schedules map[string]Schedule) {
+	runs := map[string]func(context.Context) error{
+		SubsystemHost:       c.collectHost,
+		SubsystemCPU:        c.collectCPU,
+		SubsystemMemory:     c.collectMemory,
+		SubsystemDisk:       c.collectDisks,
+		SubsystemNetwork:    c.collectNetwork,
+		SubsystemSockets:    c.collectSockets,
+		SubsystemProcesses:  c.collectProcesses,
+		SubsystemContainers: c.collectContainers,
+		SubsystemKernel:     c.collectKernel,
+		SubsystemSensors:    c.collectSensors,
+		SubsystemInventory:  c.collectInventory,
+	}
+	if c.services != nil {
+		runs[SubsystemServices] = c.collectServices
+	}
+	if c.logTailer != nil {
+		runs[SubsystemLogs] = c.collectLogs
+	}
+	for name, run := range runs {
+		s, ok := schedules[name]
+		if !ok {
+			s = DefaultSchedules()[name]
+		}
+		if s.Interval <= 0 {
+			continue
+		}
+		go runSubsystem(ctx, name, s, run)
+	}
+}
+
+func runSubsystem(ctx context.Context, name string, s Schedule, run func(context.Context) error) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	failing := false
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, s.Timeout)
+		err := run(runCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		// Log when a subsystem starts and stops failing, not on every run
+		if err != nil && !failing {
+			logger.Warn("Collector subsystem failed", "subsystem", name, "error", err)
+			failing = true
+		} else if err == nil && failing {
+			logger.Info("Collector subsystem recovered", "subsystem", name)
+			failing = false
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update applies the result of a subsystem run to the snapshot.
+func (c *Collector) update(apply func(m *SystemMetrics)) {
+	c.mu.Lock()
+	apply(&c.latest)
+	c.latest.LastUpdate = time.Now()
+	c.mu.Unlock()
+}
+
+// Snapshot returns the latest result of every subsystem. Subsystems replace
+// their slices rather than modify them, so the copy is safe to read.
+func (c *Collector) Snapshot() SystemMetrics {
+	c.mu.RLock()
+	m := c.latest
+	c.mu.RUnlock()
+	if c.certWatcher != nil {
+		m.Certificates = c.certWatcher.Latest()
+	}
+	return m
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import "sort"
+
+// Sensor kinds
+const (
+	SensorTemperature = "temperature" // Degrees Celsius
+	SensorFan         = "fan"         // RPM
+	SensorVoltage     = "voltage"     // Volts
+)
+
+// ID names a sensor for alert rules, e.g. "coretemp/Package id 0".
+func (s Sensor) ID() string {
+	return s.Chip + "/" + s.Label
+}
+
+// OverLimit reports whether the hardware flags the sensor or its value is
+// past the limit the hardware reports: at or above the critical or maximum
+// temperature or voltage, or below the minimum fan speed.
+func (s Sensor) OverLimit() bool {
+	if s.Alarm {
+		return true
+	}
+	switch s.Kind {
+	case SensorFan:
+		return s.Min > 0 && s.Value < s.Min
+	default:
+		return s.Critical > 0 && s.Value >= s.Critical ||
+			s.Max > 0 && s.Value >= s.Max ||
+			s.Kind == SensorVoltage && s.Min > 0 && s.Value < s.Min
+	}
+}
+
+func sortSensors(sensors []Sensor) {
+	sort.SliceStable(sensors, func(i, j int) bool {
+		if sensors[i].Chip != sensors[j].Chip {
+			return sensors[i].Chip < sensors[j].Chip
+		}
+		return sensors[i].Kind < sensors[j].Kind
+	})
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hwmonKinds maps the sysfs file prefixes of the hwmon ABI to sensor kinds
+// and the factor from the sysfs unit: millidegrees, RPM and millivolts.
+var hwmonKinds = []struct {
+	prefix string
+	kind   string
+	scale  float64
+}{
+	{"temp", SensorTemperature, 1000},
+	{"fan", SensorFan, 1},
+	{"in", SensorVoltage, 1000},
+}
+
+// collectSensors reads the hwmon chips and thermal zones under the sysfs
+// root, see the kernel's Documentation/hwmon/sysfs-interface.rst.
+func (c *Collector) collectSensors(ctx context.Context) error {
+	sensors := readHwmon(filepath.Join(sysRoot, "class", "hwmon"))
+	sensors = append(sensors, readThermalZones(filepath.Join(sysRoot, "class", "thermal"))...)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.update(func(m *SystemMetrics) { m.Sensors = sensors })
+	return nil
+}
+
+// readHwmon reads every chip of /sys/class/hwmon. A chip's name repeated by
+// another chip, as with two NVMe drives, gets the number of its hwmon
+// directory appended, e.g. nvme-1.
+func readHwmon(root string) []Sensor {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	names := make(map[string]int)
+	type chip struct{ dir, name string }
+	var chips []chip
+	for _, e := range entries {
+		dir := filepath.Join(root, e.Name())
+		name := readTrimmed(filepath.Join(dir, "name"))
+		if name == "" {
+			name = e.Name()
+		}
+		names[name]++
+		chips = append(chips, chip{dir, name})
+	}
+
+	var sensors []Sensor
+	for _, ch := range chips {
+		name := ch.name
+		if names[name] > 1 {
+			name += "-" + strings.TrimPrefix(filepath.Base(ch.dir), "hwmon")
+		}
+		sensors = append(sensors, readChip(ch.dir, name)...)
+	}
+	sortSensors(sensors)
+	return sensors
+}
+
+// readChip reads the <kind><n>_input files of a chip with their label,
+// limits and alarm.
+func readChip(dir, name string) []Sensor {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var sensors []Sensor
+	for _, f := range files {
+		base, ok := strings.CutSuffix(f.Name(), "_input")
+		if !ok {
+			continue
+		}
+		for _, k := range hwmonKinds {
+			index, ok := strings.CutPrefix(base, k.prefix)
+			if !ok {
+				continue
+			}
+			if _, err := strconv.Atoi(index); err != nil {
+				continue // e.g. "intrusion"
+			}
+			read := func(suffix string) float64 {
+				v, err := strconv.ParseFloat(readTrimmed(filepath.Join(dir, base+"_"+suffix)), 64)
+				if err != nil {
+					return 0
+				}
+				return v / k.scale
+			}
+			raw := readTrimmed(filepath.Join(dir, f.Name()))
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				break // Disabled or failed sensor
+			}
+			label := readTrimmed(filepath.Join(dir, base+"_label"))
+			if label == "" {
+				label = base
+			}
+			sensors = append(sensors, Sensor{
+				Chip:     name,
+				Label:    label,
+				Kind:     k.kind,
+				Value:    value / k.scale,
+				Min:      read("min"),
+				Max:      read("max"),
+				Critical: read("crit"),
+				Alarm:    readTrimmed(filepath.Join(dir, base+"_alarm")) == "1",
+			})
+			break
+		}
+	}
+	sort.SliceStable(sensors, func(i, j int) bool { return naturalLess(sensors[i].Label, sensors[j].Label) })
+	return sensors
+}
+
+// readThermalZones reads /sys/class/thermal/thermal_zone*, labelled by
+// their type, e.g. x86_pkg_temp, with the critical trip point as limit.
+func readThermalZones(root string) []Sensor {
+	zones, _ := filepath.Glob(filepath.Join(root, "thermal_zone*"))
+	var sensors []Sensor
+	for _, dir := range zones {
+		temp, err := strconv.ParseFloat(readTrimmed(filepath.Join(dir, "temp")), 64)
+		if err != nil {
+			continue
+		}
+		label := readTrimmed(filepath.Join(dir, "type"))
+		if label == "" {
+			label = filepath.Base(dir)
+		}
+		s := Sensor{Chip: "thermal", Label: label, Kind: SensorTemperature, Value: temp / 1000}
+		trips, _ := filepath.Glob(filepath.Join(dir, "trip_point_*_type"))
+		for _, t := range trips {
+			if readTrimmed(t) != "critical" {
+				continue
+			}
+			crit, err := strconv.ParseFloat(readTrimmed(strings.TrimSuffix(t, "_type")+"_temp"), 64)
+			if err == nil {
+				s.Critical = crit / 1000
+			}
+		}
+		sensors = append(sensors, s)
+	}
+	// Zones of the same type, as on machines with several packages
+	seen := make(map[string]int)
+	for i := range sensors {
+		seen[sensors[i].Label]++
+		if n := seen[sensors[i].Label]; n > 1 {
+			sensors[i].Label = fmt.Sprintf("%s %d", sensors[i].Label, n)
+		}
+	}
+	return sensors
+}
+
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// naturalLess orders labels such as temp2 before temp10.
+func naturalLess(a, b string) bool {
+	ta, na := splitNumber(a)
+	tb, nb := splitNumber(b)
+	if ta != tb || na == nb {
+		return a < b
+	}
+	return na < nb
+}
+
+func splitNumber(s string) (string, int) {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	n, _ := strconv.Atoi(s[i:])
+	return s[:i], n
+}
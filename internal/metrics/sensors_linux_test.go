@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadHwmon(t *testing.T) {
+	got := readHwmon(filepath.Join("testdata", "sys", "class", "hwmon"))
+	want := []Sensor{
+		// Labelled by the temp*_label files, temp2 before temp10; the
+		// disabled temp3 is left out
+		{Chip: "coretemp", Label: "Core 0", Kind: SensorTemperature, Value: 49, Max: 84, Critical: 100},
+		{Chip: "coretemp", Label: "Core 8", Kind: SensorTemperature, Value: 101, Max: 84, Critical: 100},
+		{Chip: "coretemp", Label: "Package id 0", Kind: SensorTemperature, Value: 52, Max: 84, Critical: 100},
+		// A chip without a name file is named after its directory
+		{Chip: "hwmon4", Label: "temp1", Kind: SensorTemperature, Value: 30},
+		// Fans before voltages; intrusion0 and pwm1 are no sensors
+		{Chip: "nct6775", Label: "CPU fan", Kind: SensorFan, Value: 1250},
+		{Chip: "nct6775", Label: "fan1", Kind: SensorFan, Value: 0, Min: 300},
+		{Chip: "nct6775", Label: "in0", Kind: SensorVoltage, Value: 1.032, Min: 0.808, Max: 1.104, Alarm: true},
+		// Two chips of the same name, without labels
+		{Chip: "nvme-1", Label: "temp1", Kind: SensorTemperature, Value: 38.85, Min: -273.15, Critical: 84.85},
+		{Chip: "nvme-2", Label: "temp1", Kind: SensorTemperature, Value: 41.85},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readHwmon =\n%+v\nwant\n%+v", got, want)
+	}
+
+	over := make(map[string]bool)
+	for _, s := range got {
+		if s.OverLimit() {
+			over[s.ID()] = true
+		}
+	}
+	if want := map[string]bool{"coretemp/Core 8": true, "nct6775/fan1": true, "nct6775/in0": true}; !reflect.DeepEqual(over, want) {
+		t.Errorf("over limit = %v, want %v", over, want)
+	}
+
+	if s := readHwmon(filepath.Join("testdata", "sys", "class", "missing")); s != nil {
+		t.Errorf("missing hwmon class = %+v, want nil", s)
+	}
+}
+
+func TestReadThermalZones(t *testing.T) {
+	got := readThermalZones(filepath.Join("testdata", "sys", "class", "thermal"))
+	want := []Sensor{
+		{Chip: "thermal", Label: "x86_pkg_temp", Kind: SensorTemperature, Value: 52, Critical: 105},
+		{Chip: "thermal", Label: "acpitz", Kind: SensorTemperature, Value: 27.8},
+		{Chip: "thermal", Label: "acpitz 2", Kind: SensorTemperature, Value: 29.8},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readThermalZones =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want bool
+	}{
+		{"temp2", "temp10", true},
+		{"temp10", "temp2", false},
+		{"Core 9", "Core 10", true},
+		{"fan1", "temp1", true},
+		{"temp1", "temp1", false},
+	} {
+		if got := naturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package metrics
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// collectSensors reports the temperatures gopsutil can read; fans and
+// voltages are only read on Linux.
+func (c *Collector) collectSensors(ctx context.Context) error {
+	temps, err := host.SensorsTemperaturesWithContext(ctx)
+	if err != nil && len(temps) == 0 {
+		return err
+	}
+	sensors := make([]Sensor, 0, len(temps))
+	for _, t := range temps {
+		sensors = append(sensors, Sensor{
+			Chip:     "host",
+			Label:    t.SensorKey,
+			Kind:     SensorTemperature,
+			Value:    t.Temperature,
+			Max:      t.High,
+			Critical: t.Critical,
+		})
+	}
+	sortSensors(sensors)
+	c.update(func(m *SystemMetrics) { m.Sensors = sensors })
+	return nil
+}
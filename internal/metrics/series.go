@@ -0,0 +1,63 @@
+package metrics
+
+import "strings"
+
+// HistoryMetrics names the series the server keeps in its metric history.
+// Percentages for cpu, memory and swap; bytes per second for the rates.
+var HistoryMetrics = []string{"cpu", "memory", "swap", "load1", "net_recv", "net_sent", "disk_read", "disk_write"}
+
+// IsHistoryMetric reports whether name is one of HistoryMetrics.
+func IsHistoryMetric(name string) bool {
+	for _, m := range HistoryMetrics {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HistoryValues extracts the HistoryMetrics from a snapshot. Metrics the
+// snapshot lacks are left out.
+func HistoryValues(m SystemMetrics) map[string]float64 {
+	values := map[string]float64{
+		"cpu":      m.CPUTotal,
+		"net_recv": float64(m.Network.TotalRecv),
+		"net_sent": float64(m.Network.TotalSent),
+	}
+	if m.Memory != nil && m.Memory.VirtualMemoryStat != nil {
+		values["memory"] = m.Memory.UsedPercent
+	}
+	if m.Swap != nil {
+		values["swap"] = m.Swap.UsedPercent
+	}
+	if m.LoadAvg != nil {
+		values["load1"] = m.LoadAvg.Load1
+	}
+	if read, write, ok := diskIO(m); ok {
+		values["disk_read"] = float64(read)
+		values["disk_write"] = float64(write)
+	}
+	return values
+}
+
+// diskIO sums the I/O of the whole devices of a snapshot. Device mapper and
+// md devices are left out, as their I/O also shows on the disks below them.
+// Snapshots of agents that don't report block devices fall back to the
+// mounts, which count a device once per mount.
+func diskIO(m SystemMetrics) (read, write uint64, ok bool) {
+	if len(m.BlockDevices) > 0 {
+		for _, d := range m.BlockDevices {
+			if strings.HasPrefix(d.Kernel, "dm-") || strings.HasPrefix(d.Kernel, "md") {
+				continue
+			}
+			read += d.ReadRate
+			write += d.WriteRate
+		}
+		return read, write, true
+	}
+	for _, d := range m.Disks {
+		read += d.ReadRate
+		write += d.WriteRate
+	}
+	return read, write, len(m.Disks) > 0
+}
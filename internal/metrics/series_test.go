@@ -0,0 +1,35 @@
+package metrics
+
+import "testing"
+
+func TestHistoryValuesDiskIO(t *testing.T) {
+	// / and /home are btrfs subvolumes on sda, each reporting the I/O of
+	// sda; /data is an LVM volume on nvme0n1
+	m := SystemMetrics{
+		Disks: []DiskInfo{
+			{Path: "/", Device: "sda", ReadRate: 400, WriteRate: 1200},
+			{Path: "/home", Device: "sda", ReadRate: 400, WriteRate: 1200},
+			{Path: "/data", Device: "vg0-data", ReadRate: 50, WriteRate: 100},
+		},
+		BlockDevices: []BlockDevice{
+			{Name: "nvme0n1", Kernel: "nvme0n1", ReadRate: 50, WriteRate: 100},
+			{Name: "sda", Kernel: "sda", ReadRate: 400, WriteRate: 1200},
+			{Name: "vg0-data", Kernel: "dm-0", ReadRate: 50, WriteRate: 100},
+		},
+	}
+	values := HistoryValues(m)
+	if values["disk_read"] != 450 || values["disk_write"] != 1300 {
+		t.Errorf("disk read, write = %v, %v, want 450, 1300", values["disk_read"], values["disk_write"])
+	}
+
+	// Agents that don't report block devices
+	m.BlockDevices = nil
+	values = HistoryValues(m)
+	if values["disk_read"] != 850 || values["disk_write"] != 2500 {
+		t.Errorf("disk read, write from mounts = %v, %v, want 850, 2500", values["disk_read"], values["disk_write"])
+	}
+
+	if _, ok := HistoryValues(SystemMetrics{})["disk_read"]; ok {
+		t.Error("a snapshot without disks has a disk_read value")
+	}
+}
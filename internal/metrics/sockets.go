@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// listenerKey identifies a listening socket across collections, whatever
+// process owns it.
+type listenerKey struct {
+	protocol string
+	address  string
+	port     uint16
+}
+
+// socketState keeps what the sockets subsystem needs between runs: the TCP
+// counters for the retransmission rate and every listener seen since the
+// agent started, to tell new ones.
+type socketState struct {
+	at          time.Time
+	outSegs     uint64
+	retransSegs uint64
+	seen        map[listenerKey]time.Time // First seen
+	owners      map[uint64]socketOwner    // By socket inode, Linux only
+	firstListed time.Time                 // Listeners seen then were already there
+}
+
+// interfaceLink is the state, e.g. up, and speed in Mbit/s of an interface.
+type interfaceLink struct {
+	state string
+	speed int
+}
+
+type socketOwner struct {
+	pid  int32
+	name string
+}
+
+// collectSockets counts TCP connections by state, computes the TCP
+// retransmission rate and lists the listening sockets. Listeners that
+// appear after the first run are marked new.
+func (c *Collector) collectSockets(ctx context.Context) error {
+	now := time.Now()
+	states, listeners, err := c.sockets.readSockets(ctx)
+	if err != nil {
+		return err
+	}
+	tcp := &TCPStats{States: states}
+	if out, retrans, err := readTCPSegments(); err == nil {
+		s := &c.sockets
+		if elapsed := now.Sub(s.at).Seconds(); !s.at.IsZero() && elapsed > 0 {
+			tcp.RetransRate = rate(s.retransSegs, retrans, elapsed)
+			if out > s.outSegs && retrans >= s.retransSegs {
+				tcp.RetransPercent = 100 * float64(retrans-s.retransSegs) / float64(out-s.outSegs)
+			}
+		}
+		s.at, s.outSegs, s.retransSegs = now, out, retrans
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s := &c.sockets
+	if s.seen == nil {
+		s.seen = make(map[listenerKey]time.Time)
+		s.firstListed = now
+	}
+	for i := range listeners {
+		l := &listeners[i]
+		key := listenerKey{l.Protocol, l.Address, l.Port}
+		first, ok := s.seen[key]
+		if !ok {
+			first = now
+			s.seen[key] = now
+		}
+		l.FirstSeen, l.New = first, first.After(s.firstListed)
+	}
+	sortListeners(listeners)
+
+	c.update(func(m *SystemMetrics) {
+		m.TCP = tcp
+		m.Listeners = listeners
+	})
+	return nil
+}
+
+func sortListeners(listeners []ListeningSocket) {
+	sort.Slice(listeners, func(i, j int) bool {
+		a, b := listeners[i], listeners[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.Address < b.Address
+	})
+}
+
+// Endpoint formats the protocol, address and port of a listener, e.g.
+// "tcp6 [::]:22".
+func (l ListeningSocket) Endpoint() string {
+	return l.Protocol + " " + net.JoinHostPort(l.Address, strconv.Itoa(int(l.Port)))
+}
+
+// String adds the owning process to the endpoint, e.g.
+// "tcp 0.0.0.0:22 (sshd, pid 612)".
+func (l ListeningSocket) String() string {
+	s := l.Endpoint()
+	if l.Process != "" {
+		s += " (" + l.Process + ", pid " + strconv.Itoa(int(l.PID)) + ")"
+	}
+	return s
+}
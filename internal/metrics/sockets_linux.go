@@ -0,0 +1,301 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TCP states by their number in /proc/net/tcp, named as gopsutil names them
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+const (
+	stateListen = "0A"
+	stateClose  = "07" // Unconnected UDP sockets
+)
+
+// procSocket is a line of /proc/net/tcp, tcp6, udp or udp6.
+type procSocket struct {
+	local, remote net.IP
+	localPort     uint16
+	state         string
+	inode         uint64
+}
+
+// netDir is the network namespace of the host: that of PID 1, which is the
+// agent's own unless it runs in a container.
+func netDir() string {
+	dir := filepath.Join(procRoot, "1", "net")
+	if _, err := os.Stat(filepath.Join(dir, "tcp")); err == nil {
+		return dir
+	}
+	return filepath.Join(procRoot, "net")
+}
+
+func (s *socketState) readSockets(ctx context.Context) (map[string]int, []ListeningSocket, error) {
+	dir := netDir()
+	ephemeralLow, ephemeralHigh := readPortRange()
+	states := make(map[string]int)
+	var listeners []ListeningSocket
+	inodes := make(map[uint64]bool)
+	found := false
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		sockets, err := readProcSockets(filepath.Join(dir, proto))
+		if err != nil {
+			continue // No IPv6
+		}
+		found = true
+		udp := strings.HasPrefix(proto, "udp")
+		for _, sock := range sockets {
+			if !udp {
+				if name, ok := tcpStates[sock.state]; ok {
+					states[name]++
+				}
+			}
+			listening := !udp && sock.state == stateListen ||
+				// Unconnected UDP sockets in the ephemeral range are
+				// mostly clients, such as resolvers, rather than services
+				udp && sock.state == stateClose && sock.remote.IsUnspecified() &&
+					(sock.localPort < ephemeralLow || sock.localPort > ephemeralHigh)
+			if !listening {
+				continue
+			}
+			listeners = append(listeners, ListeningSocket{
+				Protocol: proto,
+				Address:  sock.local.String(),
+				Port:     sock.localPort,
+				inode:    sock.inode,
+			})
+			inodes[sock.inode] = true
+		}
+	}
+	if !found {
+		return nil, nil, errors.New("no sockets in " + dir)
+	}
+
+	s.resolveOwners(ctx, inodes)
+	for i := range listeners {
+		if o, ok := s.owners[listeners[i].inode]; ok {
+			listeners[i].PID, listeners[i].Process = o.pid, o.name
+		}
+	}
+	return states, listeners, nil
+}
+
+// resolveOwners finds the processes of the socket inodes it doesn't know
+// yet by reading the file descriptors of every process, which needs root
+// for other users' processes. Listening sockets live long, so this rarely
+// runs after the first collection.
+func (s *socketState) resolveOwners(ctx context.Context, inodes map[uint64]bool) {
+	owners := make(map[uint64]socketOwner, len(inodes))
+	missing := 0
+	for inode := range inodes {
+		if o, ok := s.owners[inode]; ok {
+			owners[inode] = o
+		} else {
+			missing++
+		}
+	}
+	s.owners = owners
+	if missing == 0 {
+		return
+	}
+
+	procs, err := os.ReadDir(procRoot)
+	if err != nil {
+		return
+	}
+	for _, p := range procs {
+		pid, err := strconv.ParseInt(p.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		fdDir := filepath.Join(procRoot, p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+			if err != nil || !inodes[inode] {
+				continue
+			}
+			if _, ok := owners[inode]; ok {
+				continue // Shared with a child; keep the first, usually the parent
+			}
+			comm, _ := os.ReadFile(filepath.Join(procRoot, p.Name(), "comm"))
+			owners[inode] = socketOwner{pid: int32(pid), name: strings.TrimSpace(string(comm))}
+		}
+	}
+}
+
+func readProcSockets(path string) ([]procSocket, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseProcSockets(f)
+}
+
+// parseProcSockets parses /proc/net/tcp, tcp6, udp or udp6, see proc(5).
+func parseProcSockets(r io.Reader) ([]procSocket, error) {
+	var sockets []procSocket
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, port, err := parseSocketAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		remote, _, err := parseSocketAddr(fields[2])
+		if err != nil {
+			continue
+		}
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+		sockets = append(sockets, procSocket{local: local, remote: remote, localPort: port, state: fields[3], inode: inode})
+	}
+	return sockets, scanner.Err()
+}
+
+// parseSocketAddr parses an address such as 0100007F:1F90, where the
+// address is in host byte order by 32-bit word.
+func parseSocketAddr(s string) (net.IP, uint16, error) {
+	addr, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, errors.New("malformed address " + s)
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, err
+	}
+	b, err := hex.DecodeString(addr)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, 0, errors.New("malformed address " + s)
+	}
+	for i := 0; i < len(b); i += 4 {
+		binary.BigEndian.PutUint32(b[i:], binary.NativeEndian.Uint32(b[i:]))
+	}
+	return net.IP(b), uint16(port), nil
+}
+
+// readPortRange returns the range of local ports the kernel picks from for
+// client sockets.
+func readPortRange() (low, high uint16) {
+	low, high = 32768, 60999
+	data, err := os.ReadFile(filepath.Join(procRoot, "sys", "net", "ipv4", "ip_local_port_range"))
+	if err != nil {
+		return low, high
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return low, high
+	}
+	l, err1 := strconv.ParseUint(fields[0], 10, 16)
+	h, err2 := strconv.ParseUint(fields[1], 10, 16)
+	if err1 != nil || err2 != nil {
+		return low, high
+	}
+	return uint16(l), uint16(h)
+}
+
+// readTCPSegments returns the segments sent and retransmitted since boot
+// from /proc/net/snmp.
+func readTCPSegments() (out, retrans uint64, err error) {
+	f, err := os.Open(filepath.Join(netDir(), "snmp"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return parseSNMPTCP(f)
+}
+
+// parseSNMPTCP reads the OutSegs and RetransSegs of the pair of Tcp: lines,
+// names then values, of /proc/net/snmp.
+func parseSNMPTCP(r io.Reader) (out, retrans uint64, err error) {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(scanner.Text(), "Tcp:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if names == nil {
+			names = fields
+			continue
+		}
+		for i, name := range names {
+			if i >= len(fields) {
+				break
+			}
+			switch name {
+			case "OutSegs":
+				out, _ = strconv.ParseUint(fields[i], 10, 64)
+			case "RetransSegs":
+				retrans, _ = strconv.ParseUint(fields[i], 10, 64)
+			}
+		}
+		return out, retrans, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	return 0, 0, errors.New("no Tcp lines in snmp")
+}
+
+// interfaceLinks reads the operational state and speed of every interface
+// from sysfs.
+func interfaceLinks() map[string]interfaceLink {
+	dir := filepath.Join(sysRoot, "class", "net")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	links := make(map[string]interfaceLink, len(entries))
+	for _, e := range entries {
+		var l interfaceLink
+		if data, err := os.ReadFile(filepath.Join(dir, e.Name(), "operstate")); err == nil {
+			l.state = strings.TrimSpace(string(data))
+		}
+		// Virtual interfaces have no speed, or report -1
+		if data, err := os.ReadFile(filepath.Join(dir, e.Name(), "speed")); err == nil {
+			if speed, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && speed > 0 {
+				l.speed = speed
+			}
+		}
+		links[e.Name()] = l
+	}
+	return links
+}
@@ -0,0 +1,79 @@
+//go:build !linux
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+func (s *socketState) readSockets(ctx context.Context) (map[string]int, []ListeningSocket, error) {
+	conns, err := net.ConnectionsWithContext(ctx, "inet")
+	if err != nil {
+		return nil, nil, err
+	}
+	states := make(map[string]int)
+	var listeners []ListeningSocket
+	names := make(map[int32]string)
+	for _, c := range conns {
+		var proto string
+		switch {
+		case c.Type == 1 && c.Family == 2: // SOCK_STREAM, AF_INET
+			proto = "tcp"
+		case c.Type == 1:
+			proto = "tcp6"
+		case c.Family == 2:
+			proto = "udp"
+		default:
+			proto = "udp6"
+		}
+		tcp := c.Type == 1
+		if tcp && c.Status != "" {
+			states[c.Status]++
+		}
+		if tcp && c.Status != "LISTEN" || !tcp && c.Raddr.IP != "" {
+			continue
+		}
+		l := ListeningSocket{Protocol: proto, Address: c.Laddr.IP, Port: uint16(c.Laddr.Port), PID: c.Pid}
+		if c.Pid > 0 {
+			name, ok := names[c.Pid]
+			if !ok {
+				name, _ = (&process.Process{Pid: c.Pid}).NameWithContext(ctx)
+				names[c.Pid] = name
+			}
+			l.Process = name
+		}
+		listeners = append(listeners, l)
+	}
+	// The same socket can be listed for several processes
+	sortListeners(listeners)
+	listeners = slices.CompactFunc(listeners, func(a, b ListeningSocket) bool {
+		return a.Protocol == b.Protocol && a.Address == b.Address && a.Port == b.Port
+	})
+	return states, listeners, nil
+}
+
+// readTCPSegments is only supported on Linux.
+func readTCPSegments() (out, retrans uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+func interfaceLinks() map[string]interfaceLink {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	links := make(map[string]interfaceLink, len(ifaces))
+	for _, i := range ifaces {
+		l := interfaceLink{state: "down"}
+		if slices.Contains(i.Flags, "up") {
+			l.state = "up"
+		}
+		links[i.Name] = l
+	}
+	return links
+}
@@ -6,15 +6,17 @@ import (
 )
 
 type MetricStore struct {
-	metrics map[string]SystemMetrics
-	mutex   sync.RWMutex
+	metrics  map[string]SystemMetrics
+	received map[string]time.Time // Server time of the last update, immune to agent clock skew
+	mutex    sync.RWMutex
 }
 
 var GlobalStore *MetricStore
 
 func InitStore() {
 	GlobalStore = &MetricStore{
-		metrics: make(map[string]SystemMetrics),
+		metrics:  make(map[string]SystemMetrics),
+		received: make(map[string]time.Time),
 	}
 }
 
@@ -26,6 +28,15 @@ func (s *MetricStore) Update(serverID string, m SystemMetrics) {
 		m.LastUpdate = time.Now()
 	}
 	s.metrics[serverID] = m
+	s.received[serverID] = time.Now()
+}
+
+// LastSeen returns when metrics for the server were last received.
+func (s *MetricStore) LastSeen(serverID string) (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	t, ok := s.received[serverID]
+	return t, ok
 }
 
 func (s *MetricStore) Get(serverID string) (SystemMetrics, bool) {
@@ -0,0 +1,70 @@
+package metrics
+
+import "time"
+
+// Host status derived from how recently metrics were received
+const (
+	StatusOnline  = "online"
+	StatusStale   = "stale"
+	StatusOffline = "offline"
+	StatusUnknown = "unknown" // No metrics received since the server started
+)
+
+var (
+	StaleAfter   = 30 * time.Second
+	OfflineAfter = 5 * time.Minute
+)
+
+// Headline holds the few numbers used to compare hosts at a glance.
+type Headline struct {
+	Status        string    `json:"status"`
+	LastUpdate    time.Time `json:"last_update"`
+	CPU           float64   `json:"cpu"`
+	Load1         float64   `json:"load1"`
+	MemoryTotal   uint64    `json:"memory_total"`
+	MemoryUsed    uint64    `json:"memory_used"`
+	MemoryPercent float64   `json:"memory_percent"`
+	DiskPercent   float64   `json:"disk_percent"` // Fullest filesystem
+	DiskPath      string    `json:"disk_path"`
+}
+
+// Status classifies a host by the age of its last update.
+func Status(lastUpdate time.Time, now time.Time) string {
+	if lastUpdate.IsZero() {
+		return StatusUnknown
+	}
+	age := now.Sub(lastUpdate)
+	switch {
+	case age <= StaleAfter:
+		return StatusOnline
+	case age <= OfflineAfter:
+		return StatusStale
+	default:
+		return StatusOffline
+	}
+}
+
+// Summarize extracts the headline numbers from a full metrics snapshot.
+// lastSeen is when the server received it.
+func Summarize(m SystemMetrics, lastSeen, now time.Time) Headline {
+	h := Headline{
+		Status:     Status(lastSeen, now),
+		LastUpdate: m.LastUpdate,
+		CPU:        m.CPUTotal,
+	}
+	if m.LoadAvg != nil {
+		h.Load1 = m.LoadAvg.Load1
+	}
+	if m.Memory != nil && m.Memory.VirtualMemoryStat != nil {
+		h.MemoryTotal = m.Memory.Total
+		h.MemoryUsed = m.Memory.Used
+		h.MemoryPercent = m.Memory.UsedPercent
+	}
+	for _, d := range m.Disks {
+		if d.UsedPercent > h.DiskPercent || h.DiskPath == "" {
+			h.DiskPercent = d.UsedPercent
+			h.DiskPath = d.Path
+		}
+	}
+	return h
+}
@@ -6,6 +6,12 @@ import (
 	"github.com/shirou/gopsutil/v3/host"
 	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/user/server-moni/internal/certs"
+	"github.com/user/server-moni/internal/checks"
+	"github.com/user/server-moni/internal/inventory"
+	"github.com/user/server-moni/internal/logtail"
+	"github.com/user/server-moni/internal/procwatch"
+	"github.com/user/server-moni/internal/systemd"
 )
 
 type SystemMetrics struct {
@@ -15,27 +21,104 @@ type SystemMetrics struct {
 	Memory       *ExtendedMemoryStat    `json:"memory"`
 	Swap         *mem.SwapMemoryStat    `json:"swap"`
 	Disks        []DiskInfo             `json:"disks"`
+	BlockDevices []BlockDevice          `json:"block_devices,omitempty"` // Whole disks, device mapper and md devices
 	Network      NetworkStats           `json:"network"`
+	TCP          *TCPStats              `json:"tcp,omitempty"`
+	Listeners    []ListeningSocket      `json:"listeners,omitempty"` // Listening TCP and unconnected UDP sockets
+	Sensors      []Sensor               `json:"sensors,omitempty"`   // Temperatures, fans and voltages
 	Processes    []ProcessInfo          `json:"processes"`
+	ProcessTree  []*ProcessNode         `json:"process_tree,omitempty"` // All processes under their parents, when enabled on the agent
+	Pressure     *Pressure              `json:"pressure,omitempty"`  // Linux 4.20+
+	CPUTimes     []CPUTimes             `json:"cpu_times,omitempty"` // Linux; all cores first, then each core
+	Kernel       *KernelStats           `json:"kernel,omitempty"`    // Linux
+	Cgroups      []CgroupUsage          `json:"cgroups,omitempty"`   // Linux with cgroup v2
 	Containers   []ContainerInfo        `json:"containers"`
 	HostInfo     *host.InfoStat         `json:"host_info"`
+	Tags         map[string]string      `json:"tags"` // Reported by the agent from its config; nil leaves stored tags untouched
+	Services     []systemd.Unit         `json:"services,omitempty"` // systemd units matching the agent's filter
+	Certificates []certs.Certificate    `json:"certificates,omitempty"` // Latest scan of the watched endpoints and files
+	Inventory    *inventory.Summary     `json:"inventory,omitempty"` // Latest software inventory; the packages are uploaded apart
+	CheckResults []checks.Result        `json:"check_results,omitempty"` // Synthetic check runs since the last ingest; not kept in the live store
+	Logs         []logtail.SourceStats  `json:"logs,omitempty"` // Counters of the tailed log sources
+	LogEvents    []logtail.Event        `json:"log_events,omitempty"` // Extracted from logs since the last ingest; not kept in the live store
+	WatchedProcesses []procwatch.Stats  `json:"watched_processes,omitempty"` // One entry per process watch, even without instances
 	LastUpdate   time.Time              `json:"last_update"`
 }
 
 type ExtendedMemoryStat struct {
 	*mem.VirtualMemoryStat
-	Buffers uint64 `json:"buffers"`
-	Cached  uint64 `json:"cached"`
+	Buffers uint64   `json:"buffers"`
+	Cached  uint64   `json:"cached"`
+	VM      *VMStats `json:"vm,omitempty"` // Linux only
+}
+
+// VMStats are the paging, OOM and kernel memory figures of /proc/vmstat and
+// /proc/meminfo. Rates are over the memory interval.
+type VMStats struct {
+	MinorFaults       float64    `json:"minor_faults"`        // Per second
+	MajorFaults       float64    `json:"major_faults"`        // Per second
+	SwapIn            uint64     `json:"swap_in"`             // Bytes per second
+	SwapOut           uint64     `json:"swap_out"`            // Bytes per second
+	OOMKills          uint64     `json:"oom_kills"`           // Since boot
+	OOMKillsRecent    uint64     `json:"oom_kills_last_hour"` // Seen by the agent within the last hour
+	HugePages         *HugePages `json:"hugepages,omitempty"` // nil when none are configured
+	SlabReclaimable   uint64     `json:"slab_reclaimable"`
+	SlabUnreclaimable uint64     `json:"slab_unreclaimable"`
+	Dirty             uint64     `json:"dirty"`
+	Writeback         uint64     `json:"writeback"`
+}
+
+type HugePages struct {
+	Total    uint64 `json:"total"`
+	Free     uint64 `json:"free"`
+	Reserved uint64 `json:"reserved"`
+	Surplus  uint64 `json:"surplus"`
+	PageSize uint64 `json:"page_size"` // Bytes
+}
+
+// Sensor is a hardware temperature, fan or voltage sensor. Limits the
+// hardware doesn't report are 0.
+type Sensor struct {
+	Chip     string  `json:"chip"`  // hwmon chip name, e.g. coretemp, nvme or thermal for thermal zones
+	Label    string  `json:"label"` // e.g. "Package id 0", or the sysfs name such as temp1
+	Kind     string  `json:"kind"`  // temperature, fan or voltage
+	Value    float64 `json:"value"` // Degrees Celsius, RPM or volts
+	Min      float64 `json:"min,omitempty"`
+	Max      float64 `json:"max,omitempty"`
+	Critical float64 `json:"critical,omitempty"`
+	Alarm    bool    `json:"alarm,omitempty"` // Raised by the chip
 }
 
 type DiskInfo struct {
 	Path        string  `json:"path"`
+	Device      string  `json:"device,omitempty"` // Block device, by device mapper name where there is one
+	Fstype      string  `json:"fstype,omitempty"`
 	Total       uint64  `json:"total"`
 	Used        uint64  `json:"used"`
 	Free        uint64  `json:"free"`
 	UsedPercent float64 `json:"used_percent"`
 	ReadRate    uint64  `json:"read_rate"`  // Bytes per second
 	WriteRate   uint64  `json:"write_rate"` // Bytes per second
+
+	InodesTotal       uint64  `json:"inodes_total,omitempty"` // 0 on filesystems without a fixed inode count
+	InodesUsed        uint64  `json:"inodes_used,omitempty"`
+	InodesUsedPercent float64 `json:"inodes_used_percent,omitempty"`
+	ReadOnly          bool    `json:"read_only,omitempty"`
+	Remounted         bool    `json:"remounted_read_only,omitempty"` // Read-only now, writable when the agent saw it before
+}
+
+// BlockDevice is the I/O of a block device over the disk interval.
+type BlockDevice struct {
+	Name        string  `json:"name"`   // Device mapper name, e.g. vg0-root, or the kernel name
+	Kernel      string  `json:"kernel"` // Kernel name, e.g. dm-0, nvme0n1, md0
+	ReadIOPS    float64 `json:"read_iops"`
+	WriteIOPS   float64 `json:"write_iops"`
+	ReadRate    uint64  `json:"read_rate"`   // Bytes per second
+	WriteRate   uint64  `json:"write_rate"`  // Bytes per second
+	ReadAwait   float64 `json:"read_await"`  // Average milliseconds per read
+	WriteAwait  float64 `json:"write_await"` // Average milliseconds per write
+	Utilization float64 `json:"utilization"` // Percent of time busy
+	QueueDepth  float64 `json:"queue_depth"` // Average requests in flight
 }
 
 type NetworkStats struct {
@@ -48,14 +131,115 @@ type NetInterface struct {
 	Name      string `json:"name"`
 	RecvRate  uint64 `json:"recv_rate"`
 	SentRate  uint64 `json:"sent_rate"`
+
+	// Per second
+	RecvPackets float64 `json:"recv_packets"`
+	SentPackets float64 `json:"sent_packets"`
+	RecvErrors  float64 `json:"recv_errors"`
+	SentErrors  float64 `json:"sent_errors"`
+	RecvDrops   float64 `json:"recv_drops"`
+	SentDrops   float64 `json:"sent_drops"`
+
+	State string `json:"state,omitempty"` // Operational state, e.g. up, down or unknown
+	Speed int    `json:"speed,omitempty"` // Link speed in Mbit/s; 0 if not known, as for virtual interfaces
+}
+
+type TCPStats struct {
+	States         map[string]int `json:"states"`          // Connections by state, e.g. ESTABLISHED, TIME_WAIT
+	RetransRate    float64        `json:"retrans_rate"`    // Segments retransmitted per second (Linux)
+	RetransPercent float64        `json:"retrans_percent"` // Of the segments sent (Linux)
+}
+
+// ListeningSocket is a socket accepting connections or datagrams.
+type ListeningSocket struct {
+	Protocol  string    `json:"protocol"` // tcp, tcp6, udp or udp6
+	Address   string    `json:"address"`
+	Port      uint16    `json:"port"`
+	PID       int32     `json:"pid,omitempty"` // 0 if the owner cannot be read
+	Process   string    `json:"process,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	New       bool      `json:"new,omitempty"` // Appeared after the agent started
+
+	inode uint64
 }
 
 type ProcessInfo struct {
-	PID      int32   `json:"pid"`
-	Name     string  `json:"name"`
-	CPU      float64 `json:"cpu"`
-	Mem      float32 `json:"mem"` // Percent
-	Username string  `json:"username"`
+	PID        int32   `json:"pid"`
+	PPID       int32   `json:"ppid"`
+	Name       string  `json:"name"`
+	Cmdline    string  `json:"cmdline"`
+	State      string  `json:"state"`
+	CPU        float64 `json:"cpu"` // Percent of one core since the previous collection
+	Mem        float32 `json:"mem"` // Percent
+	RSS        uint64  `json:"rss"`
+	Threads    int32   `json:"threads"`
+	OpenFiles  int32   `json:"open_files"`
+	ReadRate   uint64  `json:"read_rate"`  // Bytes per second
+	WriteRate  uint64  `json:"write_rate"` // Bytes per second
+	Username   string  `json:"username"`
+	CreateTime int64   `json:"create_time"` // Milliseconds since the epoch
+}
+
+type ProcessNode struct {
+	PID      int32          `json:"pid"`
+	Name     string         `json:"name"`
+	Children []*ProcessNode `json:"children,omitempty"`
+}
+
+// Pressure is the pressure stall information of a resource set: the share
+// of time in which some (or all non-idle) tasks were stalled waiting for it.
+type Pressure struct {
+	CPU    *PressureLine `json:"cpu,omitempty"`
+	Memory *PressureLine `json:"memory,omitempty"`
+	IO     *PressureLine `json:"io,omitempty"`
+}
+
+type PressureLine struct {
+	Some PressureStat  `json:"some"`
+	Full *PressureStat `json:"full,omitempty"` // Not reported for CPU on older kernels
+}
+
+type PressureStat struct {
+	Avg10  float64 `json:"avg10"` // Percent over the last 10 seconds
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"` // Microseconds stalled since boot
+}
+
+// CPUTimes is the breakdown of the time of a core, in percent, over the
+// last collection interval. CPU is "cpu" for all cores together.
+type CPUTimes struct {
+	CPU     string  `json:"cpu"`
+	User    float64 `json:"user"`
+	Nice    float64 `json:"nice"`
+	System  float64 `json:"system"`
+	Idle    float64 `json:"idle"`
+	IOWait  float64 `json:"iowait"`
+	IRQ     float64 `json:"irq"`
+	SoftIRQ float64 `json:"softirq"`
+	Steal   float64 `json:"steal"`
+}
+
+type KernelStats struct {
+	ContextSwitches float64 `json:"context_switches"` // Per second
+	Interrupts      float64 `json:"interrupts"`       // Per second
+	Forks           float64 `json:"forks"`            // Processes created per second
+	ProcsRunning    uint64  `json:"procs_running"`
+	ProcsBlocked    uint64  `json:"procs_blocked"` // Waiting for I/O
+}
+
+// CgroupUsage is the resource usage of a top-level cgroup v2 group, such
+// as system.slice.
+type CgroupUsage struct {
+	Name             string    `json:"name"`
+	CPUPercent       float64   `json:"cpu_percent"`       // Of one core
+	ThrottledPercent float64   `json:"throttled_percent"` // Of the time, by the CPU limit
+	MemoryBytes      uint64    `json:"memory_bytes"`
+	MemoryLimit      uint64    `json:"memory_limit,omitempty"` // 0 without a limit
+	Pids             uint64    `json:"pids"`
+	ReadRate         uint64    `json:"read_rate"`  // Bytes per second
+	WriteRate        uint64    `json:"write_rate"` // Bytes per second
+	Pressure         *Pressure `json:"pressure,omitempty"`
 }
 
 type ContainerInfo struct {
@@ -70,21 +254,8 @@ type ContainerInfo struct {
 	MemoryLimit uint64  `json:"memory_limit"`
 }
 
-type Fail2BanStats struct {
-	TotalBans int            `json:"total_bans"`
-	BansByIP  map[string]int `json:"bans_by_ip"`
-	Jails     []string       `json:"jails"`
-}
-
 type FolderSize struct {
 	Path string `json:"path"`
 	Size uint64 `json:"size"`
 }
 
-type AuthLog struct {
-	Time    time.Time `json:"time"`
-	User    string    `json:"user"`
-	IP      string    `json:"ip"`
-	Message string    `json:"message"`
-	Success bool      `json:"success"`
-}
@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// oomWindow is how far back VMStats.OOMKillsRecent counts.
+const oomWindow = time.Hour
+
+// vmState keeps the /proc/vmstat counters the memory subsystem computes
+// rates from, and the OOM kills seen within oomWindow.
+type vmState struct {
+	at       time.Time
+	counters map[string]uint64
+	ooms     []oomEvent
+}
+
+type oomEvent struct {
+	at    time.Time
+	kills uint64
+}
+
+// readVMStats reads /proc/vmstat and /proc/meminfo under procRoot. It
+// returns nil where they don't exist, i.e. outside Linux.
+func (s *vmState) readVMStats(now time.Time) *VMStats {
+	vmstat, err := readKeyValueFile(filepath.Join(procRoot, "vmstat"), parseVMStat)
+	if err != nil {
+		return nil
+	}
+	meminfo, err := readKeyValueFile(filepath.Join(procRoot, "meminfo"), parseMeminfo)
+	if err != nil {
+		return nil
+	}
+	v := s.update(now, vmstat)
+	fillMeminfo(v, meminfo)
+	return v
+}
+
+// update turns the counters of /proc/vmstat into rates since the previous
+// call and records new OOM kills.
+func (s *vmState) update(now time.Time, counters map[string]uint64) *VMStats {
+	v := &VMStats{OOMKills: counters["oom_kill"]}
+	pageSize := float64(os.Getpagesize())
+	if elapsed := now.Sub(s.at).Seconds(); !s.at.IsZero() && elapsed > 0 {
+		last := s.counters
+		faults := rate(last["pgfault"], counters["pgfault"], elapsed)
+		v.MajorFaults = rate(last["pgmajfault"], counters["pgmajfault"], elapsed)
+		v.MinorFaults = max(faults-v.MajorFaults, 0)
+		v.SwapIn = uint64(rate(last["pswpin"], counters["pswpin"], elapsed) * pageSize)
+		v.SwapOut = uint64(rate(last["pswpout"], counters["pswpout"], elapsed) * pageSize)
+		if kills := counters["oom_kill"]; kills > last["oom_kill"] {
+			s.ooms = append(s.ooms, oomEvent{at: now, kills: kills - last["oom_kill"]})
+		}
+	}
+
+	// Drop the kills that have left the window
+	i := 0
+	for i < len(s.ooms) && now.Sub(s.ooms[i].at) > oomWindow {
+		i++
+	}
+	s.ooms = s.ooms[i:]
+	for _, e := range s.ooms {
+		v.OOMKillsRecent += e.kills
+	}
+
+	s.at, s.counters = now, counters
+	return v
+}
+
+// fillMeminfo copies the hugepage, slab and writeback figures of
+// /proc/meminfo, already in bytes.
+func fillMeminfo(v *VMStats, meminfo map[string]uint64) {
+	if total := meminfo["HugePages_Total"]; total > 0 {
+		v.HugePages = &HugePages{
+			Total:    total,
+			Free:     meminfo["HugePages_Free"],
+			Reserved: meminfo["HugePages_Rsvd"],
+			Surplus:  meminfo["HugePages_Surp"],
+			PageSize: meminfo["Hugepagesize"],
+		}
+	}
+	v.SlabReclaimable = meminfo["SReclaimable"]
+	v.SlabUnreclaimable = meminfo["SUnreclaim"]
+	v.Dirty = meminfo["Dirty"]
+	v.Writeback = meminfo["Writeback"]
+}
+
+// rate is the increase of a counter per second, or 0 if it went backwards.
+func rate(last, cur uint64, seconds float64) float64 {
+	if cur < last || seconds <= 0 {
+		return 0
+	}
+	return float64(cur-last) / seconds
+}
+
+func readKeyValueFile(path string, parse func(io.Reader) (map[string]uint64, error)) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+// parseVMStat parses the "name value" lines of /proc/vmstat.
+func parseVMStat(r io.Reader) (map[string]uint64, error) {
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values, scanner.Err()
+}
+
+// parseMeminfo parses the "Name: value [kB]" lines of /proc/meminfo. Values
+// in kB are returned in bytes; the HugePages_ counts have no unit.
+func parseMeminfo(r io.Reader) (map[string]uint64, error) {
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		values[name] = n
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseVMStat(t *testing.T) {
+	values, err := readKeyValueFile(filepath.Join("testdata", "proc", "vmstat"), parseVMStat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]uint64{"pgfault": 98213476, "pgmajfault": 30712, "pswpin": 120, "pswpout": 480, "oom_kill": 2} {
+		if values[name] != want {
+			t.Errorf("%s = %d, want %d", name, values[name], want)
+		}
+	}
+	for _, name := range []string{"bogus_line_without_value", "nr_unstable"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("the invalid line %s was parsed", name)
+		}
+	}
+}
+
+func TestParseMeminfo(t *testing.T) {
+	values, err := readKeyValueFile(filepath.Join("testdata", "proc", "meminfo"), parseMeminfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values in kB are converted to bytes, the hugepage counts have no unit
+	for name, want := range map[string]uint64{"MemTotal": 16303224 * 1024, "Dirty": 472 * 1024, "Writeback": 0, "HugePages_Total": 64, "Hugepagesize": 2 << 20} {
+		if v, ok := values[name]; !ok || v != want {
+			t.Errorf("%s = %d, want %d", name, v, want)
+		}
+	}
+	if _, ok := values["DirectMap4k"]; ok {
+		t.Error("the invalid line DirectMap4k was parsed")
+	}
+
+	var v VMStats
+	fillMeminfo(&v, values)
+	if want := (HugePages{Total: 64, Free: 48, Reserved: 4, PageSize: 2 << 20}); v.HugePages == nil || *v.HugePages != want {
+		t.Errorf("hugepages = %+v, want %+v", v.HugePages, want)
+	}
+	if v.SlabReclaimable != 512340*1024 || v.SlabUnreclaimable != 131072*1024 || v.Dirty != 472*1024 {
+		t.Errorf("slab, dirty = %d, %d, %d", v.SlabReclaimable, v.SlabUnreclaimable, v.Dirty)
+	}
+
+	v = VMStats{}
+	fillMeminfo(&v, map[string]uint64{"HugePages_Total": 0, "Hugepagesize": 2 << 20})
+	if v.HugePages != nil {
+		t.Errorf("hugepages without any configured = %+v, want nil", v.HugePages)
+	}
+}
+
+func TestVMStateUpdate(t *testing.T) {
+	first, err := readKeyValueFile(filepath.Join("testdata", "proc", "vmstat"), parseVMStat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	var s vmState
+	v := s.update(start, first)
+	if v.OOMKills != 2 || v.OOMKillsRecent != 0 || v.MajorFaults != 0 {
+		t.Errorf("first update = %+v, want the kills since boot only", v)
+	}
+
+	// Ten seconds later the OOM killer has killed three more processes
+	second := make(map[string]uint64, len(first))
+	for k, n := range first {
+		second[k] = n
+	}
+	second["pgfault"] += 1000
+	second["pgmajfault"] += 100
+	second["pswpout"] += 10
+	second["oom_kill"] += 3
+	v = s.update(start.Add(10*time.Second), second)
+	if v.OOMKills != 5 || v.OOMKillsRecent != 3 {
+		t.Errorf("oom kills, recent = %d, %d, want 5, 3", v.OOMKills, v.OOMKillsRecent)
+	}
+	if v.MajorFaults != 10 || v.MinorFaults != 90 {
+		t.Errorf("major, minor faults = %v, %v, want 10, 90", v.MajorFaults, v.MinorFaults)
+	}
+	if want := uint64(os.Getpagesize()); v.SwapOut != want || v.SwapIn != 0 {
+		t.Errorf("swap in, out = %d, %d, want 0, %d", v.SwapIn, v.SwapOut, want)
+	}
+
+	// The kills stay counted for an hour
+	v = s.update(start.Add(30*time.Minute), second)
+	if v.OOMKillsRecent != 3 {
+		t.Errorf("recent kills after 30 minutes = %d, want 3", v.OOMKillsRecent)
+	}
+	v = s.update(start.Add(time.Hour+time.Minute), second)
+	if v.OOMKillsRecent != 0 || v.OOMKills != 5 {
+		t.Errorf("oom kills, recent after an hour = %d, %d, want 5, 0", v.OOMKills, v.OOMKillsRecent)
+	}
+
+	// A counter that went backwards, as after a reboot, is no kill
+	second["oom_kill"] = 0
+	if v = s.update(start.Add(2*time.Hour), second); v.OOMKillsRecent != 0 {
+		t.Errorf("recent kills after a reset = %d, want 0", v.OOMKillsRecent)
+	}
+}
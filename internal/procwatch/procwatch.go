@@ -0,0 +1,72 @@
+// Package procwatch reports on watched processes whatever their load. The
+// top-process list of the collector drops idle processes, so a daemon that
+// matters but sleeps would otherwise vanish from the data; a watch always
+// reports, with zero instances when nothing matches.
+//
+// Watches are assigned to a system on the server and handed to its agent in
+// the ingest response, like synthetic checks.
+package procwatch
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Watch selects processes. Every criterion that is set must match.
+type Watch struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`              // Label of the watch
+	Process string `json:"process,omitempty"` // Executable name, e.g. nginx
+	Cmdline string `json:"cmdline,omitempty"` // Regular expression matched against the full command line
+	User    string `json:"user,omitempty"`    // Owner of the process
+	PIDFile string `json:"pidfile,omitempty"` // File holding the PID of the process
+}
+
+// Stats aggregates the instances of a watch.
+type Stats struct {
+	WatchID    int     `json:"watch_id"`
+	Name       string  `json:"name"`
+	Instances  int     `json:"instances"`
+	PIDs       []int32 `json:"pids,omitempty"`
+	CPUPercent float64 `json:"cpu_percent"` // Of one core, summed over instances
+	RSSBytes   uint64  `json:"rss_bytes"`
+	Threads    int32   `json:"threads"`
+	OpenFDs    int32   `json:"open_fds"`
+	ReadBytes  uint64  `json:"read_bytes"`  // Since each instance started
+	WriteBytes uint64  `json:"write_bytes"` // Since each instance started
+	ReadRate   uint64  `json:"read_rate"`   // Bytes per second
+	WriteRate  uint64  `json:"write_rate"`  // Bytes per second
+	Uptime     float64 `json:"uptime"`      // Seconds since the oldest instance started
+}
+
+// Validate checks a watch before it is stored.
+func (w *Watch) Validate() error {
+	w.Name = strings.TrimSpace(w.Name)
+	w.Process = strings.TrimSpace(w.Process)
+	w.User = strings.TrimSpace(w.User)
+	w.PIDFile = strings.TrimSpace(w.PIDFile)
+	if w.Name == "" {
+		w.Name = w.Process
+	}
+	if w.Name == "" {
+		return errors.New("name is required")
+	}
+	if w.Process == "" && w.Cmdline == "" && w.User == "" && w.PIDFile == "" {
+		return errors.New("at least one of process, cmdline, user and pidfile is required")
+	}
+	if w.Cmdline != "" {
+		if _, err := regexp.Compile(w.Cmdline); err != nil {
+			return fmt.Errorf("invalid cmdline: %v", err)
+		}
+	}
+	if w.PIDFile != "" && !strings.HasPrefix(w.PIDFile, "/") && !isWindowsPath(w.PIDFile) {
+		return errors.New("pidfile must be an absolute path")
+	}
+	return nil
+}
+
+func isWindowsPath(p string) bool {
+	return len(p) > 2 && p[1] == ':' && (p[2] == '\\' || p[2] == '/')
+}
@@ -0,0 +1,207 @@
+package procwatch
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+type compiledWatch struct {
+	Watch
+	cmdline *regexp.Regexp
+}
+
+// sample is what rates are computed from on the next collection.
+type sample struct {
+	created    int64 // Tells a reused PID apart
+	cpu        float64
+	readBytes  uint64
+	writeBytes uint64
+	at         time.Time
+}
+
+// Watcher collects the stats of a set of watches. It is safe for
+// concurrent use.
+type Watcher struct {
+	mu      sync.Mutex
+	watches []compiledWatch
+	last    map[int32]sample
+}
+
+func NewWatcher() *Watcher {
+	return &Watcher{last: make(map[int32]sample)}
+}
+
+// Update replaces the watches. Invalid ones are skipped.
+func (w *Watcher) Update(watches []Watch) {
+	compiled := make([]compiledWatch, 0, len(watches))
+	for _, watch := range watches {
+		c := compiledWatch{Watch: watch}
+		if watch.Cmdline != "" {
+			re, err := regexp.Compile(watch.Cmdline)
+			if err != nil {
+				continue
+			}
+			c.cmdline = re
+		}
+		compiled = append(compiled, c)
+	}
+	w.mu.Lock()
+	w.watches = compiled
+	w.mu.Unlock()
+}
+
+// procInfo caches what watches match on, read only when a watch needs it.
+type procInfo struct {
+	p *process.Process
+
+	name, cmdline, user          string
+	hasName, hasCmdline, hasUser bool
+}
+
+func (i *procInfo) Name() string {
+	if !i.hasName {
+		i.name, _ = i.p.Name()
+		i.hasName = true
+	}
+	return i.name
+}
+
+func (i *procInfo) Cmdline() string {
+	if !i.hasCmdline {
+		i.cmdline, _ = i.p.Cmdline()
+		i.hasCmdline = true
+	}
+	return i.cmdline
+}
+
+func (i *procInfo) User() string {
+	if !i.hasUser {
+		i.user, _ = i.p.Username()
+		i.hasUser = true
+	}
+	return i.user
+}
+
+// Collect returns one entry per watch, in the order of Update, or nil
+// without watches.
+func (w *Watcher) Collect() []Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.watches) == 0 {
+		return nil
+	}
+
+	procs, _ := process.Processes()
+	infos := make([]*procInfo, len(procs))
+	for i, p := range procs {
+		infos[i] = &procInfo{p: p}
+	}
+
+	now := time.Now()
+	next := make(map[int32]sample)
+	stats := make([]Stats, 0, len(w.watches))
+	for _, watch := range w.watches {
+		s := Stats{WatchID: watch.ID, Name: watch.Name}
+		pidFromFile := int32(-1)
+		if watch.PIDFile != "" {
+			pidFromFile = readPIDFile(watch.PIDFile)
+		}
+		var oldest int64
+		for _, info := range infos {
+			if !watch.matches(info, pidFromFile) {
+				continue
+			}
+			s.Instances++
+			s.PIDs = append(s.PIDs, info.p.Pid)
+			created := w.addProcess(&s, info.p, now, next)
+			if created > 0 && (oldest == 0 || created < oldest) {
+				oldest = created
+			}
+		}
+		if oldest > 0 {
+			s.Uptime = now.Sub(time.UnixMilli(oldest)).Seconds()
+		}
+		stats = append(stats, s)
+	}
+	w.last = next
+	return stats
+}
+
+func (watch *compiledWatch) matches(info *procInfo, pidFromFile int32) bool {
+	if watch.PIDFile != "" && info.p.Pid != pidFromFile {
+		return false
+	}
+	if watch.Process != "" && info.Name() != watch.Process {
+		return false
+	}
+	if watch.User != "" && info.User() != watch.User {
+		return false
+	}
+	if watch.cmdline != nil && !watch.cmdline.MatchString(info.Cmdline()) {
+		return false
+	}
+	return true
+}
+
+// addProcess adds one instance to s and returns its start time in
+// milliseconds since the epoch, or 0 if unknown.
+func (w *Watcher) addProcess(s *Stats, p *process.Process, now time.Time, next map[int32]sample) int64 {
+	if m, err := p.MemoryInfo(); err == nil {
+		s.RSSBytes += m.RSS
+	}
+	if n, err := p.NumThreads(); err == nil {
+		s.Threads += n
+	}
+	if n, err := p.NumFDs(); err == nil {
+		s.OpenFDs += n
+	}
+	created, _ := p.CreateTime()
+
+	cur := sample{created: created, at: now}
+	if t, err := p.Times(); err == nil {
+		cur.cpu = t.User + t.System
+	}
+	if io, err := p.IOCounters(); err == nil {
+		cur.readBytes, cur.writeBytes = io.ReadBytes, io.WriteBytes
+		s.ReadBytes += io.ReadBytes
+		s.WriteBytes += io.WriteBytes
+	}
+	if prev, ok := w.last[p.Pid]; ok && prev.created == created {
+		if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+			if cur.cpu >= prev.cpu {
+				s.CPUPercent += 100 * (cur.cpu - prev.cpu) / elapsed
+			}
+			if cur.readBytes >= prev.readBytes {
+				s.ReadRate += uint64(float64(cur.readBytes-prev.readBytes) / elapsed)
+			}
+			if cur.writeBytes >= prev.writeBytes {
+				s.WriteRate += uint64(float64(cur.writeBytes-prev.writeBytes) / elapsed)
+			}
+		}
+	}
+	next[p.Pid] = cur
+	return created
+}
+
+// readPIDFile returns the PID in a pidfile, or -1 if there is none.
+func readPIDFile(path string) int32 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return -1
+	}
+	pid, err := strconv.ParseInt(fields[0], 10, 32)
+	if err != nil {
+		return -1
+	}
+	return int32(pid)
+}
@@ -0,0 +1,64 @@
+// Package systemd reports the state of systemd units, read over D-Bus, with
+// the resource usage of their cgroups.
+package systemd
+
+import (
+	"errors"
+	"path"
+)
+
+// StateFailed is the active state of units that stopped with an error.
+const StateFailed = "failed"
+
+// DefaultInclude is used when no include patterns are configured.
+var DefaultInclude = []string{"*.service"}
+
+// ErrUnsupported is returned by Collect where there is no systemd.
+var ErrUnsupported = errors.New("systemd units are only collected on Linux")
+
+// Unit is the state of one unit.
+type Unit struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	LoadState   string  `json:"load_state"`   // loaded, not-found, masked...
+	ActiveState string  `json:"active_state"` // active, failed, activating, deactivating, inactive...
+	SubState    string  `json:"sub_state"`    // running, exited, dead, auto-restart...
+	Restarts    uint32  `json:"restarts"`     // Automatic restarts since the unit was last started by hand
+	MainPID     uint32  `json:"main_pid,omitempty"`
+	MemoryBytes uint64  `json:"memory_bytes,omitempty"` // Of the whole cgroup
+	CPUPercent  float64 `json:"cpu_percent"`            // Of one core, over the last collection interval
+}
+
+// Filter selects units by name with shell patterns such as "nginx*.service".
+type Filter struct {
+	Include []string // Defaults to DefaultInclude
+	Exclude []string
+}
+
+func (f Filter) include() []string {
+	if len(f.Include) == 0 {
+		return DefaultInclude
+	}
+	return f.Include
+}
+
+// Match reports whether a unit name is included and not excluded.
+func (f Filter) Match(name string) bool {
+	return matchAny(f.include(), name) && !matchAny(f.Exclude, name)
+}
+
+// MatchPattern reports whether name matches a shell pattern, treating a
+// malformed pattern as matching nothing.
+func MatchPattern(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchPattern(p, name) {
+			return true
+		}
+	}
+	return false
+}
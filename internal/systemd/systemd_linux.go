@@ -0,0 +1,198 @@
+package systemd
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/user/server-moni/internal/logger"
+)
+
+// cgroupRoot is where the cgroup hierarchy is mounted.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// SetSysRoot reads cgroups from the sysfs mounted at root instead of /sys.
+func SetSysRoot(root string) {
+	cgroupRoot = filepath.Join(root, "fs", "cgroup")
+}
+
+type cpuSample struct {
+	usage time.Duration
+	at    time.Time
+}
+
+// Collector reads the units matching a filter from the system manager. It
+// keeps one D-Bus connection, reopened after errors.
+type Collector struct {
+	filter Filter
+
+	mu      sync.Mutex
+	conn    *dbus.Conn
+	failing bool // Logged that the manager is unreachable
+	lastCPU map[string]cpuSample
+}
+
+func NewCollector(f Filter) *Collector {
+	return &Collector{filter: f, lastCPU: make(map[string]cpuSample)}
+}
+
+// Collect returns the matching units, sorted by name.
+func (c *Collector) Collect(ctx context.Context) ([]Unit, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	units, err := c.collect(ctx)
+	if err != nil {
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
+		}
+		if !c.failing {
+			logger.Warn("Cannot read systemd units", "error", err)
+			c.failing = true
+		}
+		return nil, err
+	}
+	if c.failing {
+		logger.Info("Reading systemd units again")
+		c.failing = false
+	}
+	return units, nil
+}
+
+func (c *Collector) collect(ctx context.Context) ([]Unit, error) {
+	if c.conn == nil {
+		conn, err := dbus.NewWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	statuses, err := c.conn.ListUnitsByPatternsContext(ctx, nil, c.filter.include())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(statuses))
+	units := make([]Unit, 0, len(statuses))
+	for _, s := range statuses {
+		if matchAny(c.filter.Exclude, s.Name) {
+			continue
+		}
+		u := Unit{
+			Name:        s.Name,
+			Description: s.Description,
+			LoadState:   s.LoadState,
+			ActiveState: s.ActiveState,
+			SubState:    s.SubState,
+		}
+		seen[s.Name] = true
+		if strings.HasSuffix(s.Name, ".service") && s.LoadState == "loaded" {
+			props, err := c.conn.GetUnitTypePropertiesContext(ctx, s.Name, "Service")
+			if err != nil {
+				// The unit may have been unloaded since it was listed
+				units = append(units, u)
+				continue
+			}
+			c.addUsage(&u, props, now)
+		}
+		units = append(units, u)
+	}
+	for name := range c.lastCPU {
+		if !seen[name] {
+			delete(c.lastCPU, name)
+		}
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Name < units[j].Name })
+	return units, nil
+}
+
+// addUsage fills in restarts, the main PID and the resources used by the
+// unit's cgroup, falling back to the accounting systemd keeps itself.
+func (c *Collector) addUsage(u *Unit, props map[string]any, now time.Time) {
+	u.Restarts, _ = props["NRestarts"].(uint32)
+	u.MainPID, _ = props["MainPID"].(uint32)
+
+	cgroup, _ := props["ControlGroup"].(string)
+	memory, memOK := cgroupMemory(cgroup)
+	if !memOK {
+		// math.MaxUint64 means memory accounting is off
+		if v, ok := props["MemoryCurrent"].(uint64); ok && v != math.MaxUint64 {
+			memory, memOK = v, true
+		}
+	}
+	if memOK {
+		u.MemoryBytes = memory
+	}
+
+	usage, cpuOK := cgroupCPU(cgroup)
+	if !cpuOK {
+		if v, ok := props["CPUUsageNSec"].(uint64); ok && v != math.MaxUint64 {
+			usage, cpuOK = time.Duration(v), true
+		}
+	}
+	if !cpuOK || u.ActiveState != "active" {
+		delete(c.lastCPU, u.Name)
+		return
+	}
+	if last, ok := c.lastCPU[u.Name]; ok && now.After(last.at) && usage >= last.usage {
+		u.CPUPercent = 100 * float64(usage-last.usage) / float64(now.Sub(last.at))
+	}
+	c.lastCPU[u.Name] = cpuSample{usage: usage, at: now}
+}
+
+// cgroupMemory reads the memory charged to a cgroup, on the unified (v2)
+// or the legacy (v1) hierarchy.
+func cgroupMemory(cgroup string) (uint64, bool) {
+	if cgroup == "" {
+		return 0, false
+	}
+	for _, file := range []string{
+		filepath.Join(cgroupRoot, cgroup, "memory.current"),
+		filepath.Join(cgroupRoot, "memory", cgroup, "memory.usage_in_bytes"),
+	} {
+		if v, err := readUint(file); err == nil {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// cgroupCPU reads the CPU time used by a cgroup.
+func cgroupCPU(cgroup string) (time.Duration, bool) {
+	if cgroup == "" {
+		return 0, false
+	}
+	if f, err := os.Open(filepath.Join(cgroupRoot, cgroup, "cpu.stat")); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if v, ok := strings.CutPrefix(scanner.Text(), "usage_usec "); ok {
+				usec, err := strconv.ParseUint(v, 10, 64)
+				return time.Duration(usec) * time.Microsecond, err == nil
+			}
+		}
+	}
+	if ns, err := readUint(filepath.Join(cgroupRoot, "cpuacct", cgroup, "cpuacct.usage")); err == nil {
+		return time.Duration(ns), true
+	}
+	return 0, false
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package systemd
+
+import "context"
+
+// Collector is a no-op outside Linux.
+type Collector struct{}
+
+func NewCollector(f Filter) *Collector {
+	return &Collector{}
+}
+
+func (c *Collector) Collect(ctx context.Context) ([]Unit, error) {
+	return nil, ErrUnsupported
+}
+
+func SetSysRoot(root string) {}
@@ -0,0 +1,176 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-/]{0,62}$`)
+
+const maxValueLength = 255
+
+// Validate checks that a tag key and value can be stored and used in
+// selector expressions.
+func Validate(key, value string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid tag key %q", key)
+	}
+	if len(value) > maxValueLength || strings.ContainsAny(value, ",=!\n") {
+		return fmt.Errorf("invalid value for tag %q", key)
+	}
+	return nil
+}
+
+// Parse reads a "key=value,key2=value2" list, as used by the agent's -tags
+// flag.
+func Parse(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("tag %q must be key=value", part)
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if err := Validate(k, v); err != nil {
+			return nil, err
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+// Format renders tags in the same form Parse accepts, sorted by key.
+func Format(t map[string]string) string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+t[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+type op int
+
+const (
+	opEquals op = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key   string
+	op    op
+	value string
+}
+
+// Selector is a parsed tag selector expression. All requirements must hold
+// for a set of tags to match.
+type Selector struct {
+	requirements []requirement
+}
+
+// ParseSelector parses a comma separated list of requirements:
+//
+//	env=prod      tag env has value prod (== is accepted too)
+//	role!=db      tag role is missing or has a value other than db
+//	team          tag team is present
+//	!legacy       tag legacy is absent
+//
+// An empty expression matches everything.
+func ParseSelector(expr string) (*Selector, error) {
+	s := &Selector{}
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var r requirement
+		switch {
+		case strings.Contains(part, "!="):
+			k, v, _ := strings.Cut(part, "!=")
+			r = requirement{key: strings.TrimSpace(k), op: opNotEquals, value: strings.TrimSpace(v)}
+		case strings.Contains(part, "=="):
+			k, v, _ := strings.Cut(part, "==")
+			r = requirement{key: strings.TrimSpace(k), op: opEquals, value: strings.TrimSpace(v)}
+		case strings.Contains(part, "="):
+			k, v, _ := strings.Cut(part, "=")
+			r = requirement{key: strings.TrimSpace(k), op: opEquals, value: strings.TrimSpace(v)}
+		case strings.HasPrefix(part, "!"):
+			r = requirement{key: strings.TrimSpace(part[1:]), op: opNotExists}
+		default:
+			r = requirement{key: part, op: opExists}
+		}
+
+		if err := Validate(r.key, r.value); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %v", part, err)
+		}
+		s.requirements = append(s.requirements, r)
+	}
+	return s, nil
+}
+
+// Empty reports whether the selector has no requirements.
+func (s *Selector) Empty() bool {
+	return s == nil || len(s.requirements) == 0
+}
+
+// Matches reports whether the tags satisfy every requirement.
+func (s *Selector) Matches(t map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for _, r := range s.requirements {
+		v, ok := t[r.key]
+		switch r.op {
+		case opEquals:
+			if !ok || v != r.value {
+				return false
+			}
+		case opNotEquals:
+			if ok && v == r.value {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *Selector) String() string {
+	if s == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(s.requirements))
+	for _, r := range s.requirements {
+		switch r.op {
+		case opEquals:
+			parts = append(parts, r.key+"="+r.value)
+		case opNotEquals:
+			parts = append(parts, r.key+"!="+r.value)
+		case opExists:
+			parts = append(parts, r.key)
+		case opNotExists:
+			parts = append(parts, "!"+r.key)
+		}
+	}
+	return strings.Join(parts, ",")
+}
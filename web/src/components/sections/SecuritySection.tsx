@@ -28,17 +28,12 @@ const SecuritySection: React.FC<SecuritySectionProps> = ({ systemId }) => {
     useEffect(() => {
         const fetchData = async () => {
             try {
-                // Fetch Fail2Ban
-                const f2bResponse = await client.get(`/systems/${systemId}/proxy`, {
-                    params: { path: '/security/fail2ban' }
+                // Bans and logins from the log events the agent ships
+                const response = await client.get(`/systems/${systemId}/security`, {
+                    params: { hours: 24 }
                 });
-                setFail2ban(f2bResponse.data);
-
-                // Fetch Auth Logs
-                const authResponse = await client.get(`/systems/${systemId}/proxy`, {
-                    params: { path: '/security/logins' }
-                });
-                setAuthLogs(authResponse.data);
+                setFail2ban(response.data.fail2ban);
+                setAuthLogs(response.data.logins);
 
             } catch (error) {
                 console.error("Failed to fetch security stats", error);